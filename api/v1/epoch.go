@@ -0,0 +1,22 @@
+package v1
+
+import "cmp"
+
+// Compare returns -1, 0 or +1 as e is older than, the same as or newer than
+// o. A nil epoch is older than any other.
+func (e *Epoch) Compare(o *Epoch) int {
+	if e == nil || o == nil {
+		return cmp.Compare(boolInt(e != nil), boolInt(o != nil))
+	}
+	if c := cmp.Compare(e.Term, o.Term); c != 0 {
+		return c
+	}
+	return cmp.Compare(e.ConfigIndex, o.ConfigIndex)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,8 +2,12 @@ package v1
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
@@ -13,14 +17,57 @@ type ErrorOffsetOutOfRange struct {
 
 func (e *ErrorOffsetOutOfRange) GRPCStatus() *status.Status {
 	st := status.New(
-		404,
+		codes.OutOfRange,
 		fmt.Sprintf("offset out of range: %d", e.Offset),
 	)
 
 	msg := fmt.Sprintf("record at offset %d is outside log range", e.Offset)
-	details := &errdetails.LocalizedMessage{
-		Locale:  "en-US",
-		Message: msg,
+	str, err := st.WithDetails(
+		&errdetails.ErrorInfo{
+			Reason: "OFFSET_OUT_OF_RANGE",
+			Domain: "prolog",
+			Metadata: map[string]string{
+				"offset": strconv.FormatUint(e.Offset, 10),
+			},
+		},
+		&errdetails.LocalizedMessage{
+			Locale:  "en-US",
+			Message: msg,
+		},
+	)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorOffsetOutOfRange) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorOffsetTruncated is returned when a record was in the log but has
+// been truncated, e.g. by retention. Unlike records past the end of the log,
+// it won't appear by waiting: readers should skip forward to Lowest, the
+// log's lowest offset now.
+type ErrorOffsetTruncated struct {
+	Offset uint64
+	Lowest uint64
+}
+
+func (e *ErrorOffsetTruncated) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.OutOfRange,
+		fmt.Sprintf("offset %d truncated, lowest offset is %d", e.Offset, e.Lowest),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "OFFSET_TRUNCATED",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"offset": strconv.FormatUint(e.Offset, 10),
+			"lowest": strconv.FormatUint(e.Lowest, 10),
+		},
 	}
 
 	str, err := st.WithDetails(details)
@@ -29,9 +76,608 @@ func (e *ErrorOffsetOutOfRange) GRPCStatus() *status.Status {
 	}
 
 	return str
+}
 
+func (e *ErrorOffsetTruncated) Error() string {
+	return e.GRPCStatus().Message()
 }
 
-func (e *ErrorOffsetOutOfRange) Error() string {
+// ErrorNotLeader is returned when a write reaches a node that isn't the Raft
+// leader. Leader holds the leader's address when it's known.
+type ErrorNotLeader struct {
+	Leader string
+}
+
+func (e *ErrorNotLeader) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Unavailable,
+		fmt.Sprintf("not the leader, current leader: %q", e.Leader),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "NOT_LEADER",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"leader": e.Leader,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorNotLeader) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorLeadershipLost is returned when the node lost leadership after it
+// proposed a write but before the write committed. The write may or may not
+// commit under the next leader, so it's reported as Aborted rather than
+// Unavailable: retrying it blindly could store the record twice.
+type ErrorLeadershipLost struct {
+	Leader string
+}
+
+func (e *ErrorLeadershipLost) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Aborted,
+		fmt.Sprintf("leadership lost before the write committed, it may have committed, current leader: %q", e.Leader),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "LEADERSHIP_LOST",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"leader":             e.Leader,
+			"may_have_committed": "true",
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorLeadershipLost) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorApplyTimeout is returned when a write wasn't committed by the cluster
+// within Timeout. The write may still be committed later.
+type ErrorApplyTimeout struct {
+	Timeout time.Duration
+}
+
+func (e *ErrorApplyTimeout) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.DeadlineExceeded,
+		fmt.Sprintf("write not committed within %s", e.Timeout),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "APPLY_TIMEOUT",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"timeout": e.Timeout.String(),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorApplyTimeout) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorApplyFailed is returned when a write was committed but the state
+// machine failed to apply it.
+type ErrorApplyFailed struct {
+	Err error
+}
+
+func (e *ErrorApplyFailed) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Internal,
+		fmt.Sprintf("failed to apply write: %v", e.Err),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "APPLY_FAILED",
+		Domain: "prolog",
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorApplyFailed) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+func (e *ErrorApplyFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrorRecordTooLarge is returned when a record is larger than the log
+// allows, even split across frames.
+type ErrorRecordTooLarge struct {
+	Size uint64
+	Max  uint64
+}
+
+func (e *ErrorRecordTooLarge) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.InvalidArgument,
+		fmt.Sprintf("record of %d bytes is larger than the max of %d", e.Size, e.Max),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "RECORD_TOO_LARGE",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"size": strconv.FormatUint(e.Size, 10),
+			"max":  strconv.FormatUint(e.Max, 10),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorRecordTooLarge) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorNotServing is returned by data-plane RPCs while a node is starting,
+// waiting for quorum or draining. State names the phase the node is in.
+type ErrorNotServing struct {
+	State string
+}
+
+func (e *ErrorNotServing) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Unavailable,
+		fmt.Sprintf("node is not serving: %s", e.State),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "NOT_SERVING",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"state": e.State,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorNotServing) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorTooManyStreams is returned when opening a stream would take a
+// client, or the node, over its limit of concurrent streams. Scope is
+// "identity" or "node", and Identity the client the limit was counted for.
+type ErrorTooManyStreams struct {
+	Scope    string
+	Identity string
+	Limit    int
+}
+
+func (e *ErrorTooManyStreams) GRPCStatus() *status.Status {
+	msg := fmt.Sprintf("node has %d streams open, its limit", e.Limit)
+	if e.Scope == "identity" {
+		msg = fmt.Sprintf("%s has %d streams open, its limit", e.Identity, e.Limit)
+	}
+	st := status.New(codes.ResourceExhausted, msg)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "TOO_MANY_STREAMS",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"scope":    e.Scope,
+			"identity": e.Identity,
+			"limit":    strconv.Itoa(e.Limit),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorTooManyStreams) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorUnknownServer is returned when asked to act on a server that isn't in
+// the cluster's configuration.
+type ErrorUnknownServer struct {
+	ID string
+}
+
+func (e *ErrorUnknownServer) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.NotFound,
+		fmt.Sprintf("no server %q in the cluster", e.ID),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "UNKNOWN_SERVER",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"id": e.ID,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorUnknownServer) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorEpochMismatch is returned when a fenced write's epoch isn't the
+// node's. If Sent is older, the client should refresh its epoch, e.g. from
+// Current, and retry; if it's newer, the node is behind the cluster and the
+// client should retry on another node.
+type ErrorEpochMismatch struct {
+	Sent    *Epoch
+	Current *Epoch
+}
+
+func (e *ErrorEpochMismatch) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf(
+			"write fenced: epoch %d.%d isn't the node's %d.%d",
+			e.Sent.GetTerm(),
+			e.Sent.GetConfigIndex(),
+			e.Current.GetTerm(),
+			e.Current.GetConfigIndex(),
+		),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "EPOCH_MISMATCH",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"sent_term":            strconv.FormatUint(e.Sent.GetTerm(), 10),
+			"sent_config_index":    strconv.FormatUint(e.Sent.GetConfigIndex(), 10),
+			"current_term":         strconv.FormatUint(e.Current.GetTerm(), 10),
+			"current_config_index": strconv.FormatUint(e.Current.GetConfigIndex(), 10),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorEpochMismatch) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorLogDiverged is returned when a consumer resuming at Offset read the
+// record before it with term Want, but the log now holds one written in
+// term Got there: the records the consumer read were replaced, e.g. after
+// a leader change, and it should re-read from before Offset.
+type ErrorLogDiverged struct {
+	Offset uint64
+	Want   uint64
+	Got    uint64
+}
+
+func (e *ErrorLogDiverged) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf(
+			"log diverged before offset %d: consumer read term %d, log has term %d",
+			e.Offset,
+			e.Want,
+			e.Got,
+		),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "LOG_DIVERGED",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"offset": strconv.FormatUint(e.Offset, 10),
+			"want":   strconv.FormatUint(e.Want, 10),
+			"got":    strconv.FormatUint(e.Got, 10),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorLogDiverged) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorWrongRole is returned when a client calls Method on a node whose
+// Role doesn't serve it to clients, e.g. a consume on an edge node, which
+// only takes produces. The client should call a node with another role.
+type ErrorWrongRole struct {
+	Role   string
+	Method string
+}
+
+func (e *ErrorWrongRole) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.PermissionDenied,
+		fmt.Sprintf("%s nodes don't serve %s to clients", e.Role, e.Method),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "WRONG_ROLE",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"role":   e.Role,
+			"method": e.Method,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorWrongRole) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorNotAuthorized is returned when the ACL doesn't grant Subject, the
+// common name of the client's certificate, or empty without one, the
+// Action Method needs.
+type ErrorNotAuthorized struct {
+	Subject string
+	Action  string
+	Method  string
+}
+
+func (e *ErrorNotAuthorized) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.PermissionDenied,
+		fmt.Sprintf("%q may not %s, which %s needs", e.Subject, e.Action, e.Method),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "NOT_AUTHORIZED",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"subject": e.Subject,
+			"action":  e.Action,
+			"method":  e.Method,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorNotAuthorized) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorSessionBehind is returned when a read carrying a session token waited
+// Timeout for the node's log to reach offset End, see Session.End, but it
+// still ends at offset Next. The read can be retried, e.g. on another
+// replica.
+type ErrorSessionBehind struct {
+	End     uint64
+	Next    uint64
+	Timeout time.Duration
+}
+
+func (e *ErrorSessionBehind) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Unavailable,
+		fmt.Sprintf(
+			"log ends at offset %d but the session has seen up to offset %d, waited %s",
+			e.Next,
+			e.End,
+			e.Timeout,
+		),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "SESSION_BEHIND",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"end":     strconv.FormatUint(e.End, 10),
+			"next":    strconv.FormatUint(e.Next, 10),
+			"timeout": e.Timeout.String(),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorSessionBehind) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorUnknownTopic is returned when a request names a topic, or a
+// partition of one, that doesn't exist.
+type ErrorUnknownTopic struct {
+	Topic     string
+	Partition uint32
+}
+
+func (e *ErrorUnknownTopic) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.NotFound,
+		fmt.Sprintf("no partition %d of topic %q", e.Partition, e.Topic),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "UNKNOWN_TOPIC",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"topic":     e.Topic,
+			"partition": strconv.FormatUint(uint64(e.Partition), 10),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorUnknownTopic) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorTopicExists is returned when creating a topic that already exists.
+type ErrorTopicExists struct {
+	Topic string
+}
+
+func (e *ErrorTopicExists) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.AlreadyExists,
+		fmt.Sprintf("topic %q already exists", e.Topic),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "TOPIC_EXISTS",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"topic": e.Topic,
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorTopicExists) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorSplitBrain is returned for produces to a node on the minority side
+// of a split brain, where more than one node claims to lead the cluster.
+// Clients should retry on another node, e.g. the majority's leader.
+type ErrorSplitBrain struct {
+	Leaders []string
+}
+
+func (e *ErrorSplitBrain) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.Unavailable,
+		fmt.Sprintf("split brain: nodes claim %d leaders", len(e.Leaders)),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "SPLIT_BRAIN",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"leaders": strings.Join(e.Leaders, ","),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorSplitBrain) Error() string {
+	return e.GRPCStatus().Message()
+}
+
+// ErrorMaintenancePaused is returned when asked to run maintenance on a
+// node while it's paused there, until Until.
+type ErrorMaintenancePaused struct {
+	Until time.Time
+}
+
+func (e *ErrorMaintenancePaused) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf("maintenance is paused until %s", e.Until.Format(time.RFC3339)),
+	)
+
+	details := &errdetails.ErrorInfo{
+		Reason: "MAINTENANCE_PAUSED",
+		Domain: "prolog",
+		Metadata: map[string]string{
+			"paused_until_unix_ms": strconv.FormatInt(e.Until.UnixMilli(), 10),
+		},
+	}
+
+	str, err := st.WithDetails(details)
+	if err != nil {
+		return st
+	}
+
+	return str
+}
+
+func (e *ErrorMaintenancePaused) Error() string {
 	return e.GRPCStatus().Message()
 }
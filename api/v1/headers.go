@@ -0,0 +1,67 @@
+package v1
+
+// Record headers the server stamps when a record is first appended, so
+// consumers and mirrors can trace where it came from and measure end-to-end
+// latency.
+const (
+	// HeaderOriginNode is the name of the node the record was produced to.
+	HeaderOriginNode = "prolog-origin-node"
+	// HeaderOriginTerm is the Raft term on the origin node at append time.
+	// It's only set by nodes that run Raft.
+	HeaderOriginTerm = "prolog-origin-term"
+	// HeaderAppendTime is when the origin node appended the record, in UTC
+	// RFC 3339 format with nanoseconds.
+	HeaderAppendTime = "prolog-append-time"
+)
+
+// HeaderReplicatedFrom is the ID of the peer a mesh replicator copied the
+// record from. Records without it originated on the node that holds them,
+// so replicators copy only those from each peer, and every record reaches
+// each node once, straight from its origin.
+const HeaderReplicatedFrom = "prolog-replicated-from"
+
+// HeaderContentType is the media type of a record's value, e.g.
+// "application/json", from before records had a ContentType. Record's
+// MediaType still reads it, so older records keep rendering.
+const HeaderContentType = "content-type"
+
+// Record headers on claim check records: records whose values were larger
+// than the server's threshold and were moved to its blob store, leaving an
+// empty value.
+const (
+	// HeaderClaimCheck is the key the value is stored under in the blob
+	// store.
+	HeaderClaimCheck = "prolog-claim-check"
+	// HeaderClaimCheckSize is the size of the value in bytes.
+	HeaderClaimCheckSize = "prolog-claim-check-size"
+)
+
+// Record headers mirrors stamp on the records they copy between clusters.
+const (
+	// HeaderOriginCluster is the ID of the cluster the record was first
+	// produced to. Mirrors don't copy records back to their origin, so
+	// bidirectional mirrors don't loop.
+	HeaderOriginCluster = "prolog-origin-cluster"
+	// HeaderMirrorCluster is the ID of the cluster the record was mirrored
+	// from, and HeaderMirrorOffset its offset there, so consumers can
+	// translate their offsets when they fail over between clusters.
+	HeaderMirrorCluster = "prolog-mirror-cluster"
+	HeaderMirrorOffset  = "prolog-mirror-offset"
+)
+
+// HeaderCloudEventsPrefix prefixes the headers that carry a CloudEvent's
+// context attributes, e.g. "ce-id", on records that hold events in binary
+// mode: the event's data is the value and its datacontenttype the record's
+// ContentType.
+const HeaderCloudEventsPrefix = "ce-"
+
+// HeaderKey is a record's key, which the Go client's KeyHashPartitioner
+// hashes so records with the same key go to the same partition of a topic,
+// and keep their order.
+const HeaderKey = "prolog-key"
+
+// HeaderDedupKey identifies what a record is a copy of, so producers that
+// retry, or produce the same event from several places, can have
+// exactly-once consumers process it once. Producers set it; records
+// without it are identified by their offset.
+const HeaderDedupKey = "prolog-dedup-key"
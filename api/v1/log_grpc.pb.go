@@ -19,11 +19,23 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Log_Produce_FullMethodName       = "/log.v1.Log/Produce"
-	Log_Consume_FullMethodName       = "/log.v1.Log/Consume"
-	Log_ConsumeStream_FullMethodName = "/log.v1.Log/ConsumeStream"
-	Log_ProduceStream_FullMethodName = "/log.v1.Log/ProduceStream"
-	Log_GetServers_FullMethodName    = "/log.v1.Log/GetServers"
+	Log_Produce_FullMethodName           = "/log.v1.Log/Produce"
+	Log_Consume_FullMethodName           = "/log.v1.Log/Consume"
+	Log_ConsumeStream_FullMethodName     = "/log.v1.Log/ConsumeStream"
+	Log_ConsumeControlled_FullMethodName = "/log.v1.Log/ConsumeControlled"
+	Log_ProduceStream_FullMethodName     = "/log.v1.Log/ProduceStream"
+	Log_GetServers_FullMethodName        = "/log.v1.Log/GetServers"
+	Log_ConsumeRange_FullMethodName      = "/log.v1.Log/ConsumeRange"
+	Log_ListRecords_FullMethodName       = "/log.v1.Log/ListRecords"
+	Log_SearchRecords_FullMethodName     = "/log.v1.Log/SearchRecords"
+	Log_CreateTopic_FullMethodName       = "/log.v1.Log/CreateTopic"
+	Log_ListTopics_FullMethodName        = "/log.v1.Log/ListTopics"
+	Log_CommitOffset_FullMethodName      = "/log.v1.Log/CommitOffset"
+	Log_FetchOffset_FullMethodName       = "/log.v1.Log/FetchOffset"
+	Log_Heartbeat_FullMethodName         = "/log.v1.Log/Heartbeat"
+	Log_LeaveGroup_FullMethodName        = "/log.v1.Log/LeaveGroup"
+	Log_AssignPartitions_FullMethodName  = "/log.v1.Log/AssignPartitions"
+	Log_WatchTopics_FullMethodName       = "/log.v1.Log/WatchTopics"
 )
 
 // LogClient is the client API for Log service.
@@ -31,10 +43,22 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LogClient interface {
 	Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*ProduceResponse, error)
-	Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error)
+	Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (*ConsumeResponse, error)
 	ConsumeStream(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error)
+	ConsumeControlled(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConsumeControl, ConsumeResponse], error)
 	ProduceStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ProduceRequest, ProduceResponse], error)
 	GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error)
+	ConsumeRange(ctx context.Context, in *ConsumeRangeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error)
+	ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error)
+	SearchRecords(ctx context.Context, in *SearchRecordsRequest, opts ...grpc.CallOption) (*SearchRecordsResponse, error)
+	CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error)
+	ListTopics(ctx context.Context, in *ListTopicsRequest, opts ...grpc.CallOption) (*ListTopicsResponse, error)
+	CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error)
+	FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	LeaveGroup(ctx context.Context, in *LeaveGroupRequest, opts ...grpc.CallOption) (*LeaveGroupResponse, error)
+	AssignPartitions(ctx context.Context, in *AssignPartitionsRequest, opts ...grpc.CallOption) (*AssignPartitionsResponse, error)
+	WatchTopics(ctx context.Context, in *WatchTopicsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TopicEvent], error)
 }
 
 type logClient struct {
@@ -55,9 +79,19 @@ func (c *logClient) Produce(ctx context.Context, in *ProduceRequest, opts ...grp
 	return out, nil
 }
 
-func (c *logClient) Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error) {
+func (c *logClient) Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (*ConsumeResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[0], Log_Consume_FullMethodName, cOpts...)
+	out := new(ConsumeResponse)
+	err := c.cc.Invoke(ctx, Log_Consume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) ConsumeStream(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[0], Log_ConsumeStream_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,26 +106,20 @@ func (c *logClient) Consume(ctx context.Context, in *ConsumeRequest, opts ...grp
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type Log_ConsumeClient = grpc.ServerStreamingClient[ConsumeResponse]
+type Log_ConsumeStreamClient = grpc.ServerStreamingClient[ConsumeResponse]
 
-func (c *logClient) ConsumeStream(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error) {
+func (c *logClient) ConsumeControlled(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConsumeControl, ConsumeResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[1], Log_ConsumeStream_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[1], Log_ConsumeControlled_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &grpc.GenericClientStream[ConsumeRequest, ConsumeResponse]{ClientStream: stream}
-	if err := x.ClientStream.SendMsg(in); err != nil {
-		return nil, err
-	}
-	if err := x.ClientStream.CloseSend(); err != nil {
-		return nil, err
-	}
+	x := &grpc.GenericClientStream[ConsumeControl, ConsumeResponse]{ClientStream: stream}
 	return x, nil
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type Log_ConsumeStreamClient = grpc.ServerStreamingClient[ConsumeResponse]
+type Log_ConsumeControlledClient = grpc.BidiStreamingClient[ConsumeControl, ConsumeResponse]
 
 func (c *logClient) ProduceStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ProduceRequest, ProduceResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
@@ -116,15 +144,155 @@ func (c *logClient) GetServers(ctx context.Context, in *GetServersRequest, opts
 	return out, nil
 }
 
+func (c *logClient) ConsumeRange(ctx context.Context, in *ConsumeRangeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsumeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[3], Log_ConsumeRange_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConsumeRangeRequest, ConsumeResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Log_ConsumeRangeClient = grpc.ServerStreamingClient[ConsumeResponse]
+
+func (c *logClient) ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecordsResponse)
+	err := c.cc.Invoke(ctx, Log_ListRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) SearchRecords(ctx context.Context, in *SearchRecordsRequest, opts ...grpc.CallOption) (*SearchRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchRecordsResponse)
+	err := c.cc.Invoke(ctx, Log_SearchRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateTopicResponse)
+	err := c.cc.Invoke(ctx, Log_CreateTopic_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) ListTopics(ctx context.Context, in *ListTopicsRequest, opts ...grpc.CallOption) (*ListTopicsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTopicsResponse)
+	err := c.cc.Invoke(ctx, Log_ListTopics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommitOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_CommitOffset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FetchOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_FetchOffset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, Log_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) LeaveGroup(ctx context.Context, in *LeaveGroupRequest, opts ...grpc.CallOption) (*LeaveGroupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LeaveGroupResponse)
+	err := c.cc.Invoke(ctx, Log_LeaveGroup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) AssignPartitions(ctx context.Context, in *AssignPartitionsRequest, opts ...grpc.CallOption) (*AssignPartitionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AssignPartitionsResponse)
+	err := c.cc.Invoke(ctx, Log_AssignPartitions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) WatchTopics(ctx context.Context, in *WatchTopicsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TopicEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[4], Log_WatchTopics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchTopicsRequest, TopicEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Log_WatchTopicsClient = grpc.ServerStreamingClient[TopicEvent]
+
 // LogServer is the server API for Log service.
 // All implementations must embed UnimplementedLogServer
 // for forward compatibility.
 type LogServer interface {
 	Produce(context.Context, *ProduceRequest) (*ProduceResponse, error)
-	Consume(*ConsumeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error
+	Consume(context.Context, *ConsumeRequest) (*ConsumeResponse, error)
 	ConsumeStream(*ConsumeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error
+	ConsumeControlled(grpc.BidiStreamingServer[ConsumeControl, ConsumeResponse]) error
 	ProduceStream(grpc.BidiStreamingServer[ProduceRequest, ProduceResponse]) error
 	GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error)
+	ConsumeRange(*ConsumeRangeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error
+	ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error)
+	SearchRecords(context.Context, *SearchRecordsRequest) (*SearchRecordsResponse, error)
+	CreateTopic(context.Context, *CreateTopicRequest) (*CreateTopicResponse, error)
+	ListTopics(context.Context, *ListTopicsRequest) (*ListTopicsResponse, error)
+	CommitOffset(context.Context, *CommitOffsetRequest) (*CommitOffsetResponse, error)
+	FetchOffset(context.Context, *FetchOffsetRequest) (*FetchOffsetResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	LeaveGroup(context.Context, *LeaveGroupRequest) (*LeaveGroupResponse, error)
+	AssignPartitions(context.Context, *AssignPartitionsRequest) (*AssignPartitionsResponse, error)
+	WatchTopics(*WatchTopicsRequest, grpc.ServerStreamingServer[TopicEvent]) error
 	mustEmbedUnimplementedLogServer()
 }
 
@@ -138,18 +306,54 @@ type UnimplementedLogServer struct{}
 func (UnimplementedLogServer) Produce(context.Context, *ProduceRequest) (*ProduceResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Produce not implemented")
 }
-func (UnimplementedLogServer) Consume(*ConsumeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error {
-	return status.Errorf(codes.Unimplemented, "method Consume not implemented")
+func (UnimplementedLogServer) Consume(context.Context, *ConsumeRequest) (*ConsumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Consume not implemented")
 }
 func (UnimplementedLogServer) ConsumeStream(*ConsumeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method ConsumeStream not implemented")
 }
+func (UnimplementedLogServer) ConsumeControlled(grpc.BidiStreamingServer[ConsumeControl, ConsumeResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ConsumeControlled not implemented")
+}
 func (UnimplementedLogServer) ProduceStream(grpc.BidiStreamingServer[ProduceRequest, ProduceResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method ProduceStream not implemented")
 }
 func (UnimplementedLogServer) GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetServers not implemented")
 }
+func (UnimplementedLogServer) ConsumeRange(*ConsumeRangeRequest, grpc.ServerStreamingServer[ConsumeResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ConsumeRange not implemented")
+}
+func (UnimplementedLogServer) ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecords not implemented")
+}
+func (UnimplementedLogServer) SearchRecords(context.Context, *SearchRecordsRequest) (*SearchRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchRecords not implemented")
+}
+func (UnimplementedLogServer) CreateTopic(context.Context, *CreateTopicRequest) (*CreateTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTopic not implemented")
+}
+func (UnimplementedLogServer) ListTopics(context.Context, *ListTopicsRequest) (*ListTopicsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTopics not implemented")
+}
+func (UnimplementedLogServer) CommitOffset(context.Context, *CommitOffsetRequest) (*CommitOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitOffset not implemented")
+}
+func (UnimplementedLogServer) FetchOffset(context.Context, *FetchOffsetRequest) (*FetchOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FetchOffset not implemented")
+}
+func (UnimplementedLogServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedLogServer) LeaveGroup(context.Context, *LeaveGroupRequest) (*LeaveGroupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LeaveGroup not implemented")
+}
+func (UnimplementedLogServer) AssignPartitions(context.Context, *AssignPartitionsRequest) (*AssignPartitionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AssignPartitions not implemented")
+}
+func (UnimplementedLogServer) WatchTopics(*WatchTopicsRequest, grpc.ServerStreamingServer[TopicEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTopics not implemented")
+}
 func (UnimplementedLogServer) mustEmbedUnimplementedLogServer() {}
 func (UnimplementedLogServer) testEmbeddedByValue()             {}
 
@@ -189,17 +393,24 @@ func _Log_Produce_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Log_Consume_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(ConsumeRequest)
-	if err := stream.RecvMsg(m); err != nil {
-		return err
+func _Log_Consume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConsumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
 	}
-	return srv.(LogServer).Consume(m, &grpc.GenericServerStream[ConsumeRequest, ConsumeResponse]{ServerStream: stream})
+	if interceptor == nil {
+		return srv.(LogServer).Consume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Consume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Consume(ctx, req.(*ConsumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type Log_ConsumeServer = grpc.ServerStreamingServer[ConsumeResponse]
-
 func _Log_ConsumeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(ConsumeRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -211,6 +422,13 @@ func _Log_ConsumeStream_Handler(srv interface{}, stream grpc.ServerStream) error
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Log_ConsumeStreamServer = grpc.ServerStreamingServer[ConsumeResponse]
 
+func _Log_ConsumeControlled_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogServer).ConsumeControlled(&grpc.GenericServerStream[ConsumeControl, ConsumeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Log_ConsumeControlledServer = grpc.BidiStreamingServer[ConsumeControl, ConsumeResponse]
+
 func _Log_ProduceStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(LogServer).ProduceStream(&grpc.GenericServerStream[ProduceRequest, ProduceResponse]{ServerStream: stream})
 }
@@ -236,39 +454,718 @@ func _Log_GetServers_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
-// Log_ServiceDesc is the grpc.ServiceDesc for Log service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var Log_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "log.v1.Log",
-	HandlerType: (*LogServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Produce",
-			Handler:    _Log_Produce_Handler,
-		},
-		{
-			MethodName: "GetServers",
-			Handler:    _Log_GetServers_Handler,
-		},
-	},
-	Streams: []grpc.StreamDesc{
-		{
-			StreamName:    "Consume",
-			Handler:       _Log_Consume_Handler,
-			ServerStreams: true,
-		},
-		{
-			StreamName:    "ConsumeStream",
-			Handler:       _Log_ConsumeStream_Handler,
-			ServerStreams: true,
-		},
-		{
-			StreamName:    "ProduceStream",
-			Handler:       _Log_ProduceStream_Handler,
-			ServerStreams: true,
-			ClientStreams: true,
+func _Log_ConsumeRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsumeRangeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServer).ConsumeRange(m, &grpc.GenericServerStream[ConsumeRangeRequest, ConsumeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Log_ConsumeRangeServer = grpc.ServerStreamingServer[ConsumeResponse]
+
+func _Log_ListRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).ListRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_ListRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).ListRecords(ctx, req.(*ListRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_SearchRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).SearchRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_SearchRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).SearchRecords(ctx, req.(*SearchRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_CreateTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).CreateTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_CreateTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).CreateTopic(ctx, req.(*CreateTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_ListTopics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTopicsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).ListTopics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_ListTopics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).ListTopics(ctx, req.(*ListTopicsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_CommitOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).CommitOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_CommitOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).CommitOffset(ctx, req.(*CommitOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_FetchOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).FetchOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_FetchOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).FetchOffset(ctx, req.(*FetchOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_LeaveGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).LeaveGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_LeaveGroup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).LeaveGroup(ctx, req.(*LeaveGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_AssignPartitions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AssignPartitionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).AssignPartitions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_AssignPartitions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).AssignPartitions(ctx, req.(*AssignPartitionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_WatchTopics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTopicsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServer).WatchTopics(m, &grpc.GenericServerStream[WatchTopicsRequest, TopicEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Log_WatchTopicsServer = grpc.ServerStreamingServer[TopicEvent]
+
+// Log_ServiceDesc is the grpc.ServiceDesc for Log service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Log_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "log.v1.Log",
+	HandlerType: (*LogServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Produce",
+			Handler:    _Log_Produce_Handler,
+		},
+		{
+			MethodName: "Consume",
+			Handler:    _Log_Consume_Handler,
+		},
+		{
+			MethodName: "GetServers",
+			Handler:    _Log_GetServers_Handler,
+		},
+		{
+			MethodName: "ListRecords",
+			Handler:    _Log_ListRecords_Handler,
+		},
+		{
+			MethodName: "SearchRecords",
+			Handler:    _Log_SearchRecords_Handler,
+		},
+		{
+			MethodName: "CreateTopic",
+			Handler:    _Log_CreateTopic_Handler,
+		},
+		{
+			MethodName: "ListTopics",
+			Handler:    _Log_ListTopics_Handler,
+		},
+		{
+			MethodName: "CommitOffset",
+			Handler:    _Log_CommitOffset_Handler,
+		},
+		{
+			MethodName: "FetchOffset",
+			Handler:    _Log_FetchOffset_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Log_Heartbeat_Handler,
+		},
+		{
+			MethodName: "LeaveGroup",
+			Handler:    _Log_LeaveGroup_Handler,
+		},
+		{
+			MethodName: "AssignPartitions",
+			Handler:    _Log_AssignPartitions_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ConsumeStream",
+			Handler:       _Log_ConsumeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ConsumeControlled",
+			Handler:       _Log_ConsumeControlled_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ProduceStream",
+			Handler:       _Log_ProduceStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ConsumeRange",
+			Handler:       _Log_ConsumeRange_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchTopics",
+			Handler:       _Log_WatchTopics_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "log.proto",
+}
+
+const (
+	Admin_ListQuarantined_FullMethodName        = "/log.v1.Admin/ListQuarantined"
+	Admin_PauseMaintenance_FullMethodName       = "/log.v1.Admin/PauseMaintenance"
+	Admin_ResumeMaintenance_FullMethodName      = "/log.v1.Admin/ResumeMaintenance"
+	Admin_DescribeMaintenance_FullMethodName    = "/log.v1.Admin/DescribeMaintenance"
+	Admin_TriggerMaintenance_FullMethodName     = "/log.v1.Admin/TriggerMaintenance"
+	Admin_PromoteStandby_FullMethodName         = "/log.v1.Admin/PromoteStandby"
+	Admin_GetSyncStatus_FullMethodName          = "/log.v1.Admin/GetSyncStatus"
+	Admin_ListQuarantinedMembers_FullMethodName = "/log.v1.Admin/ListQuarantinedMembers"
+	Admin_ReleaseMember_FullMethodName          = "/log.v1.Admin/ReleaseMember"
+	Admin_ConfigureTopic_FullMethodName         = "/log.v1.Admin/ConfigureTopic"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	ListQuarantined(ctx context.Context, in *ListQuarantinedRequest, opts ...grpc.CallOption) (*ListQuarantinedResponse, error)
+	PauseMaintenance(ctx context.Context, in *PauseMaintenanceRequest, opts ...grpc.CallOption) (*PauseMaintenanceResponse, error)
+	ResumeMaintenance(ctx context.Context, in *ResumeMaintenanceRequest, opts ...grpc.CallOption) (*ResumeMaintenanceResponse, error)
+	DescribeMaintenance(ctx context.Context, in *DescribeMaintenanceRequest, opts ...grpc.CallOption) (*DescribeMaintenanceResponse, error)
+	TriggerMaintenance(ctx context.Context, in *TriggerMaintenanceRequest, opts ...grpc.CallOption) (*TriggerMaintenanceResponse, error)
+	PromoteStandby(ctx context.Context, in *PromoteStandbyRequest, opts ...grpc.CallOption) (*PromoteStandbyResponse, error)
+	GetSyncStatus(ctx context.Context, in *GetSyncStatusRequest, opts ...grpc.CallOption) (*GetSyncStatusResponse, error)
+	ListQuarantinedMembers(ctx context.Context, in *ListQuarantinedMembersRequest, opts ...grpc.CallOption) (*ListQuarantinedMembersResponse, error)
+	ReleaseMember(ctx context.Context, in *ReleaseMemberRequest, opts ...grpc.CallOption) (*ReleaseMemberResponse, error)
+	ConfigureTopic(ctx context.Context, in *ConfigureTopicRequest, opts ...grpc.CallOption) (*ConfigureTopicResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListQuarantined(ctx context.Context, in *ListQuarantinedRequest, opts ...grpc.CallOption) (*ListQuarantinedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuarantinedResponse)
+	err := c.cc.Invoke(ctx, Admin_ListQuarantined_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PauseMaintenance(ctx context.Context, in *PauseMaintenanceRequest, opts ...grpc.CallOption) (*PauseMaintenanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PauseMaintenanceResponse)
+	err := c.cc.Invoke(ctx, Admin_PauseMaintenance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResumeMaintenance(ctx context.Context, in *ResumeMaintenanceRequest, opts ...grpc.CallOption) (*ResumeMaintenanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResumeMaintenanceResponse)
+	err := c.cc.Invoke(ctx, Admin_ResumeMaintenance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DescribeMaintenance(ctx context.Context, in *DescribeMaintenanceRequest, opts ...grpc.CallOption) (*DescribeMaintenanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DescribeMaintenanceResponse)
+	err := c.cc.Invoke(ctx, Admin_DescribeMaintenance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TriggerMaintenance(ctx context.Context, in *TriggerMaintenanceRequest, opts ...grpc.CallOption) (*TriggerMaintenanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerMaintenanceResponse)
+	err := c.cc.Invoke(ctx, Admin_TriggerMaintenance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PromoteStandby(ctx context.Context, in *PromoteStandbyRequest, opts ...grpc.CallOption) (*PromoteStandbyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PromoteStandbyResponse)
+	err := c.cc.Invoke(ctx, Admin_PromoteStandby_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetSyncStatus(ctx context.Context, in *GetSyncStatusRequest, opts ...grpc.CallOption) (*GetSyncStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSyncStatusResponse)
+	err := c.cc.Invoke(ctx, Admin_GetSyncStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListQuarantinedMembers(ctx context.Context, in *ListQuarantinedMembersRequest, opts ...grpc.CallOption) (*ListQuarantinedMembersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuarantinedMembersResponse)
+	err := c.cc.Invoke(ctx, Admin_ListQuarantinedMembers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReleaseMember(ctx context.Context, in *ReleaseMemberRequest, opts ...grpc.CallOption) (*ReleaseMemberResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReleaseMemberResponse)
+	err := c.cc.Invoke(ctx, Admin_ReleaseMember_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ConfigureTopic(ctx context.Context, in *ConfigureTopicRequest, opts ...grpc.CallOption) (*ConfigureTopicResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigureTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_ConfigureTopic_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility.
+type AdminServer interface {
+	ListQuarantined(context.Context, *ListQuarantinedRequest) (*ListQuarantinedResponse, error)
+	PauseMaintenance(context.Context, *PauseMaintenanceRequest) (*PauseMaintenanceResponse, error)
+	ResumeMaintenance(context.Context, *ResumeMaintenanceRequest) (*ResumeMaintenanceResponse, error)
+	DescribeMaintenance(context.Context, *DescribeMaintenanceRequest) (*DescribeMaintenanceResponse, error)
+	TriggerMaintenance(context.Context, *TriggerMaintenanceRequest) (*TriggerMaintenanceResponse, error)
+	PromoteStandby(context.Context, *PromoteStandbyRequest) (*PromoteStandbyResponse, error)
+	GetSyncStatus(context.Context, *GetSyncStatusRequest) (*GetSyncStatusResponse, error)
+	ListQuarantinedMembers(context.Context, *ListQuarantinedMembersRequest) (*ListQuarantinedMembersResponse, error)
+	ReleaseMember(context.Context, *ReleaseMemberRequest) (*ReleaseMemberResponse, error)
+	ConfigureTopic(context.Context, *ConfigureTopicRequest) (*ConfigureTopicResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServer struct{}
+
+func (UnimplementedAdminServer) ListQuarantined(context.Context, *ListQuarantinedRequest) (*ListQuarantinedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuarantined not implemented")
+}
+func (UnimplementedAdminServer) PauseMaintenance(context.Context, *PauseMaintenanceRequest) (*PauseMaintenanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseMaintenance not implemented")
+}
+func (UnimplementedAdminServer) ResumeMaintenance(context.Context, *ResumeMaintenanceRequest) (*ResumeMaintenanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeMaintenance not implemented")
+}
+func (UnimplementedAdminServer) DescribeMaintenance(context.Context, *DescribeMaintenanceRequest) (*DescribeMaintenanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeMaintenance not implemented")
+}
+func (UnimplementedAdminServer) TriggerMaintenance(context.Context, *TriggerMaintenanceRequest) (*TriggerMaintenanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerMaintenance not implemented")
+}
+func (UnimplementedAdminServer) PromoteStandby(context.Context, *PromoteStandbyRequest) (*PromoteStandbyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromoteStandby not implemented")
+}
+func (UnimplementedAdminServer) GetSyncStatus(context.Context, *GetSyncStatusRequest) (*GetSyncStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSyncStatus not implemented")
+}
+func (UnimplementedAdminServer) ListQuarantinedMembers(context.Context, *ListQuarantinedMembersRequest) (*ListQuarantinedMembersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuarantinedMembers not implemented")
+}
+func (UnimplementedAdminServer) ReleaseMember(context.Context, *ReleaseMemberRequest) (*ReleaseMemberResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseMember not implemented")
+}
+func (UnimplementedAdminServer) ConfigureTopic(context.Context, *ConfigureTopicRequest) (*ConfigureTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfigureTopic not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+func (UnimplementedAdminServer) testEmbeddedByValue()               {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_ListQuarantined_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuarantinedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListQuarantined(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListQuarantined_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListQuarantined(ctx, req.(*ListQuarantinedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PauseMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PauseMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_PauseMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PauseMaintenance(ctx, req.(*PauseMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ResumeMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ResumeMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ResumeMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ResumeMaintenance(ctx, req.(*ResumeMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DescribeMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DescribeMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeMaintenance(ctx, req.(*DescribeMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TriggerMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TriggerMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_TriggerMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TriggerMaintenance(ctx, req.(*TriggerMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PromoteStandby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteStandbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PromoteStandby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_PromoteStandby_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PromoteStandby(ctx, req.(*PromoteStandbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetSyncStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSyncStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSyncStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetSyncStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSyncStatus(ctx, req.(*GetSyncStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListQuarantinedMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuarantinedMembersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListQuarantinedMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListQuarantinedMembers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListQuarantinedMembers(ctx, req.(*ListQuarantinedMembersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ReleaseMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseMemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ReleaseMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ReleaseMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ReleaseMember(ctx, req.(*ReleaseMemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ConfigureTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ConfigureTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ConfigureTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ConfigureTopic(ctx, req.(*ConfigureTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "log.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListQuarantined",
+			Handler:    _Admin_ListQuarantined_Handler,
+		},
+		{
+			MethodName: "PauseMaintenance",
+			Handler:    _Admin_PauseMaintenance_Handler,
+		},
+		{
+			MethodName: "ResumeMaintenance",
+			Handler:    _Admin_ResumeMaintenance_Handler,
+		},
+		{
+			MethodName: "DescribeMaintenance",
+			Handler:    _Admin_DescribeMaintenance_Handler,
+		},
+		{
+			MethodName: "TriggerMaintenance",
+			Handler:    _Admin_TriggerMaintenance_Handler,
+		},
+		{
+			MethodName: "PromoteStandby",
+			Handler:    _Admin_PromoteStandby_Handler,
+		},
+		{
+			MethodName: "GetSyncStatus",
+			Handler:    _Admin_GetSyncStatus_Handler,
+		},
+		{
+			MethodName: "ListQuarantinedMembers",
+			Handler:    _Admin_ListQuarantinedMembers_Handler,
+		},
+		{
+			MethodName: "ReleaseMember",
+			Handler:    _Admin_ReleaseMember_Handler,
+		},
+		{
+			MethodName: "ConfigureTopic",
+			Handler:    _Admin_ConfigureTopic_Handler,
 		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "log.proto",
 }
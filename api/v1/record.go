@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// ContentTypeProtobufAny is the content type of records whose values are
+// google.protobuf.Any messages, typed payloads that carry the URL of their
+// message type. See the schema package for decoding them.
+const ContentTypeProtobufAny = "application/x-protobuf; messageType=google.protobuf.Any"
+
+// ContentTypeCloudEvents is the content type of records whose values are
+// CloudEvents in structured mode: JSON objects holding the event's context
+// attributes along with its data.
+const ContentTypeCloudEvents = "application/cloudevents+json"
+
+// ContentEncodingGzip is the content encoding of values compressed with
+// gzip, the one encoding DecodedValue undoes.
+const ContentEncodingGzip = "gzip"
+
+// MediaType returns the media type of the record's value: its ContentType,
+// or for records produced before that was a field, its content-type header.
+func (r *Record) MediaType() string {
+	if r.GetContentType() != "" {
+		return r.ContentType
+	}
+	return r.GetHeaders()[HeaderContentType]
+}
+
+// DecodedValue returns the record's value with its ContentEncoding undone,
+// ready to interpret per its MediaType. It fails on encodings it doesn't
+// know.
+func (r *Record) DecodedValue() ([]byte, error) {
+	switch r.GetContentEncoding() {
+	case "":
+		return r.GetValue(), nil
+	case ContentEncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(r.Value))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", r.ContentEncoding)
+}
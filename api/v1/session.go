@@ -0,0 +1,21 @@
+package v1
+
+// Session metadata keys, which let the client's load balancer route a
+// session's reads to replicas that aren't behind it.
+const (
+	// SessionEndMetadataKey carries the session's End on its reads.
+	SessionEndMetadataKey = "prolog-session-end"
+	// LogEndMetadataKey is the trailer a node answers reads carrying a
+	// session with, holding where its log ended.
+	LogEndMetadataKey = "prolog-log-end"
+)
+
+// End returns the offset a node's log must reach before it serves the
+// session, so the session sees its writes and never an older view of the
+// log than it has. A nil session doesn't need the log to reach any offset.
+func (s *Session) End() uint64 {
+	if s == nil {
+		return 0
+	}
+	return max(s.ProducedOffset+1, s.ReadOffset)
+}
@@ -0,0 +1,37 @@
+package v1
+
+import "fmt"
+
+// InternalTopicPrefix begins the names of the topics the cluster keeps its
+// own state in, like consumer groups' commits. Clients can't create them
+// or produce to them.
+const InternalTopicPrefix = "__"
+
+// TopicEventsTopic is the internal topic topics' changes are recorded in,
+// as TopicEvents, which WatchTopics streams.
+const TopicEventsTopic = "__topic_events"
+
+// maxTopicName bounds topic names, which name directories, well inside
+// filesystems' 255 byte limit.
+const maxTopicName = 249
+
+// CheckTopicName fails unless name can name a topic: 1 to 249 letters,
+// digits, '.', '_' and '-', not starting with '.', so it's safe as a
+// directory name.
+func CheckTopicName(name string) error {
+	if name == "" || len(name) > maxTopicName {
+		return fmt.Errorf("topic name must be 1 to %d characters, got %d", maxTopicName, len(name))
+	}
+	if name[0] == '.' {
+		return fmt.Errorf("topic name %q starts with '.'", name)
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return fmt.Errorf("topic name %q has invalid character %q", name, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package backend defines the interfaces a prolog server is built on: the
+// commit log it serves, how it lists the cluster's servers and how it
+// reacts to members joining and leaving. Implement them to reuse the
+// server as a library over your own storage or cluster.
+//
+// The package follows semantic versioning with the module: within a major
+// version its interfaces don't change. New capabilities are added as new
+// optional interfaces, like Termer and Locator, which the server checks a
+// CommitLog for and implementations opt into, rather than as methods on
+// the existing ones.
+package backend
+
+import (
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// CommitLog is the log a server serves. Offsets start at LowestOffset and
+// run without gaps to HighestOffset. Reads outside them fail with an
+// *ErrorOffsetOutOfRange, or an *ErrorOffsetTruncated for offsets the log
+// no longer holds.
+type CommitLog interface {
+	// Append appends record and returns its offset.
+	Append(*api.Record) (uint64, error)
+	// Read returns the record at an offset.
+	Read(uint64) (*api.Record, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+	// ReadRange calls fn with each record from offset from up to, but
+	// not including, to, stopping at the first error fn returns.
+	ReadRange(from, to uint64, fn func(*api.Record) error) error
+}
+
+// Truncater is implemented by commit logs whose oldest records can be
+// removed, a segment at a time.
+type Truncater interface {
+	// Truncate removes the segments holding only records up to lowest.
+	Truncate(lowest uint64) error
+}
+
+// GetServer lists the cluster's servers, for clients' load balancing.
+type GetServer interface {
+	GetServers() ([]*api.Server, error)
+}
+
+// Handler reacts to members joining and leaving the cluster, e.g. by
+// adding them to a log's replicas.
+type Handler interface {
+	Join(name, addr string) error
+	Leave(name string) error
+}
+
+// Termer is implemented by commit logs that run Raft, whose term is
+// stamped on the records they append.
+type Termer interface {
+	Term() uint64
+}
+
+// Epocher is implemented by commit logs that run Raft, whose writes can be
+// fenced by the cluster's epoch. Fenced writes fail with an
+// *ErrorEpochMismatch.
+type Epocher interface {
+	Epoch() (*api.Epoch, error)
+}
+
+// Locator is implemented by commit logs that can say where in their
+// segment files they stored a record.
+type Locator interface {
+	Locate(uint64) (*api.RecordLocation, error)
+}
+
+// ReverseReader is implemented by commit logs that can read a range newest
+// first, walking their segments backwards. The server reads other logs
+// backwards a record at a time.
+type ReverseReader interface {
+	ReadReverse(from, to uint64, fn func(*api.Record) error) error
+}
+
+// QuarantineLister lists the replicated entries a log quarantined rather
+// than applied.
+type QuarantineLister interface {
+	Quarantined() ([]*api.QuarantinedEntry, error)
+}
+
+// MaintenancePauser pauses a node's background maintenance during incident
+// response. Pauses expire on their own.
+type MaintenancePauser interface {
+	PauseMaintenance(time.Duration) (time.Time, error)
+	ResumeMaintenance() error
+}
+
+// ClusterMaintenancePauser pauses every node's background maintenance at
+// once. Pauses expire on their own.
+type ClusterMaintenancePauser interface {
+	PauseClusterMaintenance(time.Duration) (time.Time, error)
+	ResumeClusterMaintenance() error
+}
+
+// MaintenanceReporter reports a node's background maintenance's progress,
+// and runs it on demand.
+type MaintenanceReporter interface {
+	DescribeMaintenance() (*api.DescribeMaintenanceResponse, error)
+	TriggerMaintenance() (*api.TriggerMaintenanceResponse, error)
+}
+
+// StandbyManager promotes warm standbys to voters and reports how far the
+// node lags behind the cluster.
+type StandbyManager interface {
+	PromoteStandby(id string) error
+	SyncStatus() (*api.GetSyncStatusResponse, error)
+}
+
+// MemberQuarantine lists the cluster members quarantined for flapping and
+// releases them.
+type MemberQuarantine interface {
+	QuarantinedMembers() ([]*api.QuarantinedMember, error)
+	ReleaseMember(id string) error
+}
+
+// Topics is implemented by backends that serve named topics beside the
+// default CommitLog. Each topic is split into partitions, which are
+// independent CommitLogs. Requests for topics or partitions that don't
+// exist fail with an *ErrorUnknownTopic.
+type Topics interface {
+	// CreateTopic creates a topic with partitions partitions, failing with
+	// an *ErrorTopicExists if it already exists.
+	CreateTopic(name string, partitions uint32) error
+	// ListTopics lists the topics, by name.
+	ListTopics() ([]*api.Topic, error)
+	// Partition returns the log of a topic's partition.
+	Partition(topic string, partition uint32) (CommitLog, error)
+}
+
+// TopicConfigurer is implemented by Topics whose topics can override the
+// node's log settings, like segment sizes and retention, for their
+// partitions.
+type TopicConfigurer interface {
+	// CreateConfiguredTopic creates a topic with its config overrides,
+	// failing with an *ErrorTopicExists if it already exists.
+	CreateConfiguredTopic(topic *api.Topic) error
+	// ConfigureTopic replaces a topic's config overrides, failing with an
+	// *ErrorUnknownTopic if there's no such topic.
+	ConfigureTopic(name string, config *api.TopicConfig) error
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// The typed errors implementations return, which the server hands clients
+// as gRPC statuses with their codes and details.
+type (
+	// ErrorOffsetOutOfRange fails reads past either end of a CommitLog.
+	ErrorOffsetOutOfRange = api.ErrorOffsetOutOfRange
+	// ErrorOffsetTruncated fails reads of offsets a CommitLog no longer
+	// holds, e.g. because retention removed them.
+	ErrorOffsetTruncated = api.ErrorOffsetTruncated
+	// ErrorNotLeader fails writes to a node that isn't the leader.
+	ErrorNotLeader = api.ErrorNotLeader
+	// ErrorLeadershipLost fails writes whose leader stepped down before
+	// they committed; they may still commit.
+	ErrorLeadershipLost = api.ErrorLeadershipLost
+	// ErrorApplyTimeout fails writes that weren't committed in time.
+	ErrorApplyTimeout = api.ErrorApplyTimeout
+	// ErrorApplyFailed fails writes that were committed but couldn't be
+	// applied.
+	ErrorApplyFailed = api.ErrorApplyFailed
+	// ErrorRecordTooLarge fails appends of records over the log's limit.
+	ErrorRecordTooLarge = api.ErrorRecordTooLarge
+	// ErrorEpochMismatch fails writes fenced by the cluster's epoch.
+	ErrorEpochMismatch = api.ErrorEpochMismatch
+	// ErrorUnknownTopic fails requests for topics or partitions Topics
+	// doesn't have.
+	ErrorUnknownTopic = api.ErrorUnknownTopic
+	// ErrorTopicExists fails creating a topic Topics already has.
+	ErrorTopicExists = api.ErrorTopicExists
+)
@@ -0,0 +1,469 @@
+// Package client is a Go SDK for producing to and consuming from a prolog
+// cluster.
+//
+// # Topics
+//
+// A cluster serves a default log and any number of topics, each split into
+// partitions that are independent logs. A client produces to and consumes
+// from the log its Config names: the default log, or a partition of a
+// topic.
+//
+// # Ordering
+//
+// Each log's records have one total order: the order of their offsets.
+// There's no order across logs, e.g. between a topic's partitions. Records
+// produced to a log by one goroutine, waiting for each Produce to return
+// before the next, are appended in that order. Records produced
+// concurrently are appended in whatever order the leader receives them.
+// Subscribe and Tail deliver records in offset order, one at a time, so a
+// handler sees them in the order they were appended.
+//
+// A Partitioner spreads a topic's records over its partitions. The
+// KeyHashPartitioner sends records with the same key to the same
+// partition, so records are in order per key.
+package client
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+)
+
+type Config struct {
+	// DialOptions are passed to grpc.Dial, e.g. transport credentials.
+	DialOptions []grpc.DialOption
+	// Topic, if set, is the topic whose Partition the client produces to
+	// and subscribes to, rather than the cluster's default log. Records
+	// for a topic or partition that doesn't exist fail with a NotFound
+	// status and reason UNKNOWN_TOPIC.
+	Topic     string
+	Partition uint32
+	// Partitioner, if set, picks the partition of Topic each record is
+	// produced to, in place of Partition, which subscriptions still read.
+	// The client looks up how many partitions Topic has the first time it
+	// produces.
+	Partitioner Partitioner
+	// OffsetTracker stores how far each subscription has consumed so it can
+	// resume after a restart. Defaults to an in-memory tracker.
+	OffsetTracker OffsetTracker
+	// ProduceMiddleware wraps every Produce, e.g. to inject tracing, record
+	// metrics, encrypt values or validate schemas. The first middleware is
+	// the outermost.
+	ProduceMiddleware []ProduceMiddleware
+	// ResolveClaimChecks asks the server to replace claim check records,
+	// whose values it moved to its blob store, with their original values.
+	ResolveClaimChecks bool
+	// Fencing sends the newest cluster epoch the client has seen with
+	// every write, so nodes acting on different cluster metadata reject
+	// them rather than risk split-brain writes. A fenced write fails with
+	// a FailedPrecondition status, after which the client knows the
+	// newer epoch and the write can be retried.
+	Fencing bool
+	// MaxRecordBytes is the largest record the client produces or
+	// consumes, and should match the servers'. gRPC's message limits are
+	// raised to fit it, see MaxMessageBytes. Defaults to 64MiB, the
+	// servers' default.
+	MaxRecordBytes uint64
+	// HeartbeatInterval, if set, asks servers to send heartbeats on
+	// Subscribe and Tail streams idle that long, so proxies don't time
+	// them out and tails learn how far the log goes, see
+	// Iterator.HighWatermark.
+	HeartbeatInterval time.Duration
+	// Spool, if set, is where Produce queues records, returning
+	// ErrSpooled, while the cluster is unreachable. The client drains it
+	// in the background, every SpoolRetryInterval, which defaults to 1s,
+	// and queues new records behind the spooled ones so they're appended
+	// in order.
+	Spool              *Spool
+	SpoolRetryInterval time.Duration
+	// TruncationPolicy is what Subscribe and SubscribeExactlyOnce do when
+	// records a subscription hasn't consumed were truncated from the log.
+	// Defaults to TruncationFail. Either way OnTruncated, if set, is called
+	// with the subscription and the offsets it lost, from off up to, but
+	// not including, lowest, so the loss doesn't go unnoticed.
+	TruncationPolicy TruncationPolicy
+	OnTruncated      func(subscription string, off, lowest uint64)
+	// OffsetReset, if set, is what Subscribe and SubscribeExactlyOnce do
+	// when a subscription's offset is out of the log's range, in place of
+	// the TruncationPolicy. Unlike it, it also covers offsets past the end
+	// of the log, which subscriptions otherwise wait for the log to reach.
+	OffsetReset OffsetReset
+	// ReadYourWrites sends the client's session token, see Session, with
+	// its reads, so a node that hasn't yet replicated a record the client
+	// produced waits for it, up to its session timeout, rather than serving
+	// a log without it. A read that times out fails with an Unavailable
+	// status and reason SESSION_BEHIND, and can be retried on another node.
+	ReadYourWrites bool
+	// MonotonicReads likewise has nodes wait until they hold as much of
+	// the log as the client has read, so switching to a replica that's
+	// further behind never shows the client an older view of the log. The
+	// cluster's load balancer skips replicas it knows are behind the
+	// client's session.
+	MonotonicReads bool
+}
+
+// DefaultMaxRecordBytes is the largest record servers accept by default.
+const DefaultMaxRecordBytes = 64 << 20
+
+// MaxMessageBytes is the gRPC message size that fits a record of
+// maxRecordBytes, or of DefaultMaxRecordBytes if it's zero, along with its
+// headers and the request or response around it. Servers and clients both
+// size their message limits with it, so a record the log accepts is never
+// rejected by gRPC with a ResourceExhausted status instead.
+func MaxMessageBytes(maxRecordBytes uint64) int {
+	if maxRecordBytes == 0 {
+		maxRecordBytes = DefaultMaxRecordBytes
+	}
+	return int(maxRecordBytes) + 1<<20
+}
+
+// Client produces to and consumes from a cluster.
+type Client struct {
+	Config
+
+	conn    *grpc.ClientConn
+	log     api.LogClient
+	produce ProduceFunc
+
+	stopDrain context.CancelFunc
+	drained   chan struct{}
+
+	epochMu sync.Mutex
+	epoch   *api.Epoch
+	// asked is whether the client has asked the cluster for its epoch.
+	asked bool
+
+	sessionMu sync.Mutex
+	session   *api.Session
+	// produced is whether the session has produced, which a
+	// ProducedOffset of zero doesn't say.
+	produced bool
+
+	// partitions is how many partitions Topic has, once the Partitioner
+	// needed it.
+	partitionsMu sync.Mutex
+	partitions   uint32
+}
+
+// New dials target, typically a "proglog://" address resolved by the
+// cluster's resolver, or a single server's address.
+func New(target string, config Config) (*Client, error) {
+	if config.OffsetTracker == nil {
+		config.OffsetTracker = NewMemoryOffsetTracker()
+	}
+
+	// Dial options given later win, so the config's can still override
+	// the message limits.
+	opts := append([]grpc.DialOption{
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(MaxMessageBytes(config.MaxRecordBytes)),
+			grpc.MaxCallSendMsgSize(MaxMessageBytes(config.MaxRecordBytes)),
+		),
+	}, config.DialOptions...)
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Config: config,
+		conn:   conn,
+		log:    api.NewLogClient(conn),
+	}
+	c.produce = chainProduce(config.ProduceMiddleware, c.send)
+	if config.Spool != nil {
+		// Records are spooled as the middleware left them, so draining
+		// sends them as they are.
+		c.produce = chainProduce(config.ProduceMiddleware, c.sendOrSpool)
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stopDrain = cancel
+		c.drained = make(chan struct{})
+		go c.drain(ctx)
+	}
+	return c, nil
+}
+
+// Produce appends record to the log, through the produce middleware, and
+// returns its offset.
+func (c *Client) Produce(ctx context.Context, record *api.Record) (uint64, error) {
+	return c.produce(ctx, record)
+}
+
+func (c *Client) send(ctx context.Context, record *api.Record) (uint64, error) {
+	req, err := c.produceRequest(ctx, record)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.log.Produce(ctx, req)
+	if err != nil {
+		c.observeEpoch(epochFromError(err))
+		return 0, err
+	}
+	c.observeEpoch(res.Epoch)
+	c.observeProduced(res.Offset)
+	return res.Offset, nil
+}
+
+// produceRequest returns the request that produces record to the client's
+// log, or the partition of its Topic the Partitioner picks.
+func (c *Client) produceRequest(ctx context.Context, record *api.Record) (*api.ProduceRequest, error) {
+	req := &api.ProduceRequest{Record: record, Topic: c.Topic, Partition: c.Partition}
+	if c.Partitioner != nil {
+		partitions, err := c.topicPartitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if req.Partition, err = c.Partitioner.Partition(record, partitions); err != nil {
+			return nil, err
+		}
+	}
+	if c.Fencing {
+		epoch, err := c.fencingEpoch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Epoch = epoch
+	}
+	return req, nil
+}
+
+// topicPartitions returns how many partitions the client's Topic has,
+// asking the cluster the first time.
+func (c *Client) topicPartitions(ctx context.Context) (uint32, error) {
+	c.partitionsMu.Lock()
+	defer c.partitionsMu.Unlock()
+	if c.partitions > 0 {
+		return c.partitions, nil
+	}
+	topics, err := c.ListTopics(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, topic := range topics {
+		if topic.Name == c.Topic {
+			c.partitions = topic.Partitions
+			return c.partitions, nil
+		}
+	}
+	return 0, &api.ErrorUnknownTopic{Topic: c.Topic}
+}
+
+// ErrNoPartitions is returned by KeyHashPartitioner when a topic has no
+// partitions to pick from.
+var ErrNoPartitions = errors.New("client: topic has no partitions")
+
+// Partitioner picks which of a topic's partitions, numbered from 0 up to,
+// but not including, partitions, a record is produced to. It fails if it
+// can't pick one, e.g. if partitions is 0.
+type Partitioner interface {
+	Partition(record *api.Record, partitions uint32) (uint32, error)
+}
+
+var _ Partitioner = (*KeyHashPartitioner)(nil)
+
+// KeyHashPartitioner sends records with the same api.HeaderKey header to
+// the same partition, by the key's FNV-1a hash, so they're consumed in the
+// order they were produced as long as the topic's partitions don't change.
+// Records without a key are spread over the partitions in turn. The zero
+// value is ready to use.
+type KeyHashPartitioner struct {
+	next uint32
+}
+
+func (p *KeyHashPartitioner) Partition(record *api.Record, partitions uint32) (uint32, error) {
+	if partitions == 0 {
+		return 0, ErrNoPartitions
+	}
+	key, ok := record.Headers[api.HeaderKey]
+	if !ok {
+		return (atomic.AddUint32(&p.next, 1) - 1) % partitions, nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % partitions, nil
+}
+
+// Handler processes a record delivered to a subscription. Returning an error
+// stops the subscription without marking the record consumed.
+type Handler func(ctx context.Context, record *api.Record) error
+
+// Subscribe streams records to handler, starting after the last record the
+// named subscription consumed, or from the start of the log if it hasn't
+// consumed any. The offset is stored after each record is handled, so a
+// restarted subscription resumes where it left off, and if the offset it
+// would resume from is out of the log's range, does what the OffsetReset or
+// TruncationPolicy says. It blocks until ctx is done, the stream fails or
+// handler returns an error.
+func (c *Client) Subscribe(ctx context.Context, name string, handler Handler) error {
+	next, ok, err := c.OffsetTracker.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	return c.subscribe(ctx, name, next, ok, func(ctx context.Context, record *api.Record) error {
+		if err := handler(ctx, record); err != nil {
+			return err
+		}
+		return c.OffsetTracker.Store(ctx, name, record.Offset+1)
+	})
+}
+
+// stream streams records to fn from offset next or, if from isn't set,
+// from the start of the log, until ctx is done, the stream fails or fn
+// returns an error.
+func (c *Client) stream(ctx context.Context, next uint64, from bool, fn Handler) error {
+	req := &api.ConsumeRequest{Position: api.ConsumeRequest_EARLIEST}
+	if from {
+		req = &api.ConsumeRequest{Offset: next}
+	}
+	req.Topic, req.Partition = c.Topic, c.Partition
+	req.ResolveClaimChecks = c.ResolveClaimChecks
+	req.HeartbeatIntervalMs = uint64(c.HeartbeatInterval.Milliseconds())
+	req.Session = c.readSession()
+
+	// End the stream when fn does, so the server stops serving it.
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.log.ConsumeStream(withSession(streamCtx, req.Session), req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ctx.Err()
+			}
+			return err
+		}
+		if res.Record == nil {
+			// A heartbeat.
+			c.observeRead(res.HighWatermark)
+			continue
+		}
+
+		c.observeRead(res.Record.Offset + 1)
+		if err := fn(ctx, res.Record); err != nil {
+			return err
+		}
+	}
+}
+
+// ConsumeRange streams the records from offset from up to, but not
+// including, to, to handler. It returns once the range, or the log, ends.
+// It reads the default log, whatever the client's Topic.
+func (c *Client) ConsumeRange(ctx context.Context, from, to uint64, handler Handler) error {
+	stream, err := c.log.ConsumeRange(ctx, &api.ConsumeRangeRequest{
+		From:               from,
+		To:                 to,
+		ResolveClaimChecks: c.ResolveClaimChecks,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		c.observeRead(res.Record.Offset + 1)
+		if err := handler(ctx, res.Record); err != nil {
+			return err
+		}
+	}
+}
+
+// Last returns the default log's last n records, newest first, reading
+// the log backwards from its tail rather than consuming it from the start.
+// It returns fewer if the log holds fewer.
+func (c *Client) Last(ctx context.Context, n int) ([]*api.Record, error) {
+	req := &api.ListRecordsRequest{
+		Position:           api.ConsumeRequest_LATEST,
+		Reverse:            true,
+		ResolveClaimChecks: c.ResolveClaimChecks,
+	}
+	var records []*api.Record
+	for len(records) < n {
+		req.Limit = uint32(n - len(records))
+		res, err := c.log.ListRecords(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 && len(res.Records) > 0 {
+			c.observeRead(res.Records[0].Offset + 1)
+		}
+		records = append(records, res.Records...)
+		if !res.HasMore {
+			break
+		}
+		req.Position = api.ConsumeRequest_OFFSET
+		req.Start = res.NextStart
+	}
+	return records, nil
+}
+
+// CreateTopic creates a topic with partitions partitions. It fails with an
+// AlreadyExists status if the topic exists.
+func (c *Client) CreateTopic(ctx context.Context, name string, partitions uint32) error {
+	_, err := c.log.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: name, Partitions: partitions},
+	})
+	return err
+}
+
+// ListTopics lists the cluster's topics, by name.
+func (c *Client) ListTopics(ctx context.Context) ([]*api.Topic, error) {
+	res, err := c.log.ListTopics(ctx, &api.ListTopicsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return res.Topics, nil
+}
+
+// CommitOffset records next as the offset the consumer group consumes the
+// client's Topic and Partition from next, so the group's consumers resume
+// from it, whichever node they reach.
+func (c *Client) CommitOffset(ctx context.Context, group string, next uint64) error {
+	_, err := c.log.CommitOffset(ctx, &api.CommitOffsetRequest{
+		Group:     group,
+		Topic:     c.Topic,
+		Partition: c.Partition,
+		Offset:    next,
+	})
+	return err
+}
+
+// FetchOffset returns the offset the consumer group last committed for the
+// client's Topic and Partition, and false if it hasn't committed one.
+func (c *Client) FetchOffset(ctx context.Context, group string) (uint64, bool, error) {
+	res, err := c.log.FetchOffset(ctx, &api.FetchOffsetRequest{
+		Group:     group,
+		Topic:     c.Topic,
+		Partition: c.Partition,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return res.Offset, res.Committed, nil
+}
+
+func (c *Client) Close() error {
+	if c.stopDrain != nil {
+		c.stopDrain()
+		<-c.drained
+	}
+	return c.conn.Close()
+}
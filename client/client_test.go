@@ -0,0 +1,766 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/internal/log"
+	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errStop = errors.New("stop")
+
+func TestSubscribeResumes(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "client-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	offsetsPath := filepath.Join(dir, "offsets.json")
+
+	newClient := func() *client.Client {
+		tracker, err := client.NewFileOffsetTracker(offsetsPath)
+		require.NoError(t, err)
+		c, err := client.New(addr, client.Config{
+			DialOptions:   []grpc.DialOption{grpc.WithInsecure()},
+			OffsetTracker: tracker,
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	ctx := context.Background()
+	c := newClient()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+
+	// consume two records, then stop as if the process exited
+	var got []string
+	err = c.Subscribe(ctx, "test", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.NoError(t, c.Close())
+
+	// the second record's handler failed, so a new process resumes from it
+	c = newClient()
+	defer c.Close()
+	got = nil
+	err = c.Subscribe(ctx, "test", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []string{"second", "third"}, got)
+}
+
+func TestSubscribeResumesFromGroupCommits(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	newClient := func() *client.Client {
+		c, err := client.New(addr, client.Config{
+			DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		})
+		require.NoError(t, err)
+		c.OffsetTracker = client.NewGroupOffsetTracker(c)
+		return c
+	}
+
+	ctx := context.Background()
+	c := newClient()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+	var got []string
+	err := c.Subscribe(ctx, "test", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.NoError(t, c.Close())
+
+	// The offset is the group's commit, so another client resumes from it.
+	c = newClient()
+	defer c.Close()
+	next, ok, err := c.FetchOffset(ctx, "test")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), next)
+	got = nil
+	err = c.Subscribe(ctx, "test", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []string{"second", "third"}, got)
+}
+
+func TestTopic(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	newClient := func(topic string, partition uint32) *client.Client {
+		c, err := client.New(addr, client.Config{
+			DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+			Topic:       topic,
+			Partition:   partition,
+		})
+		require.NoError(t, err)
+		return c
+	}
+	ctx := context.Background()
+	c := newClient("", 0)
+	defer c.Close()
+	require.NoError(t, c.CreateTopic(ctx, "orders", 2))
+	err := c.CreateTopic(ctx, "orders", 2)
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	topics, err := c.ListTopics(ctx)
+	require.NoError(t, err)
+	require.Len(t, topics, 2)
+	require.Equal(t, "orders", topics[1].Name)
+	require.Equal(t, uint32(2), topics[1].Partitions)
+
+	orders := newClient("orders", 1)
+	defer orders.Close()
+	for _, value := range []string{"first", "second"} {
+		_, err := orders.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+	_, err = c.Produce(ctx, &api.Record{Value: []byte("default")})
+	require.NoError(t, err)
+
+	// The client subscribes to its own partition, whose offsets are its
+	// own.
+	var got []string
+	err = orders.Subscribe(ctx, "test", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []string{"first", "second"}, got)
+
+	missing := newClient("orders", 2)
+	defer missing.Close()
+	_, err = missing.Produce(ctx, &api.Record{Value: []byte("lost")})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// A partitioner picks each record's partition from its key.
+	partitioner := &client.KeyHashPartitioner{}
+	keyed, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		Topic:       "orders",
+		Partitioner: partitioner,
+	})
+	require.NoError(t, err)
+	defer keyed.Close()
+	record := &api.Record{Value: []byte("keyed"), Headers: map[string]string{api.HeaderKey: "customer-7"}}
+	off, err := keyed.Produce(ctx, record)
+	require.NoError(t, err)
+	partition, err := partitioner.Partition(record, 2)
+	require.NoError(t, err)
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := api.NewLogClient(conn).Consume(ctx, &api.ConsumeRequest{
+		Offset:    off,
+		Topic:     "orders",
+		Partition: partition,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "keyed", string(res.Record.Value))
+}
+
+func TestKeyHashPartitioner(t *testing.T) {
+	p := &client.KeyHashPartitioner{}
+	keyed := func(key string) *api.Record {
+		return &api.Record{Headers: map[string]string{api.HeaderKey: key}}
+	}
+	partition := func(record *api.Record, partitions uint32) uint32 {
+		got, err := p.Partition(record, partitions)
+		require.NoError(t, err)
+		return got
+	}
+
+	// The same key always maps to the same partition, and keys spread
+	// over the partitions.
+	seen := make(map[uint32]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("customer-%d", i)
+		want := partition(keyed(key), 8)
+		require.Less(t, want, uint32(8))
+		for j := 0; j < 10; j++ {
+			require.Equal(t, want, partition(keyed(key), 8))
+		}
+		seen[want] = true
+	}
+	require.Len(t, seen, 8)
+
+	// Records without a key take the partitions in turn.
+	for i := uint32(0); i < 6; i++ {
+		require.Equal(t, i%3, partition(&api.Record{}, 3))
+	}
+
+	// A topic without partitions has none to pick, rather than dividing by
+	// zero.
+	_, err := p.Partition(keyed("customer-7"), 0)
+	require.Equal(t, client.ErrNoPartitions, err)
+	_, err = p.Partition(&api.Record{}, 0)
+	require.Equal(t, client.ErrNoPartitions, err)
+}
+
+func TestConsumeRange(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+
+	var got []string
+	err = c.ConsumeRange(ctx, 1, 10, func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"second", "third"}, got)
+}
+
+func TestLast(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+
+	for n, want := range map[int][]string{
+		2:  {"third", "second"},
+		10: {"third", "second", "first"},
+	} {
+		records, err := c.Last(ctx, n)
+		require.NoError(t, err)
+		var got []string
+		for _, record := range records {
+			got = append(got, string(record.Value))
+		}
+		require.Equal(t, want, got)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	p, err := c.Pipeline(ctx, 4)
+	require.NoError(t, err)
+
+	var offsets []uint64
+	for i := 0; i < 20; i++ {
+		err := p.Send(ctx, &api.Record{Value: []byte{byte(i)}}, func(off uint64, err error) {
+			require.NoError(t, err)
+			offsets = append(offsets, off)
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, p.Close())
+
+	// Acknowledged in send order, with offsets in send order.
+	require.Equal(t, 20, len(offsets))
+	records, err := c.Last(ctx, 20)
+	require.NoError(t, err)
+	for i, off := range offsets {
+		require.Equal(t, uint64(i), off)
+		require.Equal(t, []byte{byte(i)}, records[19-i].Value)
+	}
+
+	err = p.Send(ctx, &api.Record{Value: []byte("late")}, nil)
+	require.Equal(t, client.ErrPipelineClosed, err)
+}
+
+func TestLargeRecords(t *testing.T) {
+	const maxRecordBytes = 8 << 20
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "client-large-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := log.Config{}
+	config.Store.MaxRecordBytes = maxRecordBytes
+	clog, err := log.NewLog(dir, config)
+	require.NoError(t, err)
+
+	srv, err := server.NewGRPCServer(nil,
+		server.WithStorage(server.Storage{CommitLog: clog}),
+		server.WithLimits(server.Limits{MaxMessageBytes: client.MaxMessageBytes(maxRecordBytes)}),
+	)
+	require.NoError(t, err)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	c, err := client.New(l.Addr().String(), client.Config{
+		DialOptions:    []grpc.DialOption{grpc.WithInsecure()},
+		MaxRecordBytes: maxRecordBytes,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	// Larger than gRPC's default 4MiB limit, in both directions.
+	ctx := context.Background()
+	value := make([]byte, maxRecordBytes-1024)
+	off, err := c.Produce(ctx, &api.Record{Value: value})
+	require.NoError(t, err)
+
+	var got []byte
+	err = c.ConsumeRange(ctx, off, off+1, func(ctx context.Context, record *api.Record) error {
+		got = record.Value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(value), len(got))
+}
+
+func TestTruncated(t *testing.T) {
+	err := status.Convert(&api.ErrorOffsetOutOfRange{Offset: 3}).Err()
+	_, ok := client.Truncated(err)
+	require.False(t, ok)
+
+	err = status.Convert(&api.ErrorOffsetTruncated{Offset: 3, Lowest: 10}).Err()
+	lowest, ok := client.Truncated(err)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), lowest)
+}
+
+func TestSubscribeTruncated(t *testing.T) {
+	dir := t.TempDir()
+	// Each record fills a segment, so truncating drops whole records.
+	config := log.Config{}
+	config.Segment.MaxStoreBytes = 8
+	clog, err := log.NewLog(dir, config)
+	require.NoError(t, err)
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{CommitLog: clog}))
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	type lost struct{ off, lowest uint64 }
+	var losses []lost
+	c, err := client.New(l.Addr().String(), client.Config{
+		DialOptions:      []grpc.DialOption{grpc.WithInsecure()},
+		TruncationPolicy: client.TruncationSkip,
+		OnTruncated: func(subscription string, off, lowest uint64) {
+			losses = append(losses, lost{off, lowest})
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, clog.Truncate(2))
+	// Both subscriptions consumed the first record before it was
+	// truncated.
+	for _, name := range []string{"a", "b"} {
+		require.NoError(t, c.OffsetTracker.Store(ctx, name, 1))
+	}
+
+	var got []uint64
+	err = c.Subscribe(ctx, "a", func(ctx context.Context, record *api.Record) error {
+		got = append(got, record.Offset)
+		if record.Offset == 4 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []uint64{3, 4}, got)
+	require.Equal(t, []lost{{1, 3}}, losses)
+
+	// Failing leaves the subscription where it was.
+	c.TruncationPolicy = client.TruncationFail
+	err = c.Subscribe(ctx, "b", func(ctx context.Context, record *api.Record) error {
+		return nil
+	})
+	lowest, ok := client.Truncated(err)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), lowest)
+}
+
+func TestSubscribeOffsetReset(t *testing.T) {
+	dir := t.TempDir()
+	// Each record fills a segment, so truncating drops whole records.
+	config := log.Config{}
+	config.Segment.MaxStoreBytes = 8
+	clog, err := log.NewLog(dir, config)
+	require.NoError(t, err)
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{CommitLog: clog}))
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	c, err := client.New(l.Addr().String(), client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		OffsetReset: client.OffsetResetError,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, clog.Truncate(2))
+	// One subscription lost records to truncation, the other is past the
+	// end of the log, e.g. one that was recreated.
+	require.NoError(t, c.OffsetTracker.Store(ctx, "truncated", 1))
+	require.NoError(t, c.OffsetTracker.Store(ctx, "ahead", 10))
+	stop := func(ctx context.Context, record *api.Record) error {
+		return errStop
+	}
+
+	err = c.Subscribe(ctx, "truncated", stop)
+	var oor *client.OffsetOutOfRangeError
+	require.True(t, errors.As(err, &oor))
+	require.Equal(t, client.OffsetOutOfRangeError{
+		Subscription: "truncated",
+		Offset:       1,
+		Lowest:       3,
+		Next:         5,
+	}, *oor)
+	err = c.Subscribe(ctx, "ahead", stop)
+	require.True(t, errors.As(err, &oor))
+	require.Equal(t, uint64(10), oor.Offset)
+
+	c.OffsetReset = client.OffsetResetEarliest
+	var got []uint64
+	err = c.Subscribe(ctx, "ahead", func(ctx context.Context, record *api.Record) error {
+		got = append(got, record.Offset)
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []uint64{3}, got)
+
+	// Resetting to the latest offset skips the records already appended.
+	c.OffsetReset = client.OffsetResetLatest
+	got = nil
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = c.Produce(ctx, &api.Record{Value: []byte("hello")})
+	}()
+	err = c.Subscribe(ctx, "truncated", func(ctx context.Context, record *api.Record) error {
+		got = append(got, record.Offset)
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []uint64{5}, got)
+}
+
+func TestSubscribeExactlyOnce(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, err := c.Produce(ctx, &api.Record{
+			Value:   []byte(key),
+			Headers: map[string]string{api.HeaderDedupKey: key},
+		})
+		require.NoError(t, err)
+	}
+
+	store := client.NewMemoryDedupStore(0)
+	var got []string
+	subscribe := func(fail string) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		return c.SubscribeExactlyOnce(ctx, "pipeline", store, func(ctx context.Context, record *api.Record, key string) error {
+			if key == fail {
+				return errStop
+			}
+			got = append(got, key)
+			if len(got) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}
+
+	// A failed record isn't committed, so it's processed again when the
+	// subscription restarts, while the retried copy of a is skipped.
+	require.Equal(t, errStop, subscribe("b"))
+	require.Equal(t, context.Canceled, subscribe(""))
+	require.Equal(t, []string{"a", "b", "c"}, got)
+}
+
+func TestSpoolDrains(t *testing.T) {
+	// Reserve an address nothing listens on yet.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	spool, err := client.NewSpool(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer spool.Close()
+	c, err := client.New(addr, client.Config{
+		DialOptions:        []grpc.DialOption{grpc.WithInsecure()},
+		Spool:              spool,
+		SpoolRetryInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	for _, v := range []string{"a", "b", "c"} {
+		_, err := c.Produce(ctx, &api.Record{Value: []byte(v)})
+		require.Equal(t, client.ErrSpooled, err)
+	}
+	require.Equal(t, 3, spool.Len())
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	_, teardown := serve(t, l)
+	defer teardown()
+
+	require.Eventually(t, func() bool {
+		return spool.Len() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	off, err := c.Produce(ctx, &api.Record{Value: []byte("d")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+
+	var got []string
+	err = c.ConsumeRange(ctx, 0, 4, func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c", "d"}, got)
+}
+
+func setupServer(t *testing.T) (addr string, teardown func()) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return serve(t, l)
+}
+
+// serve runs a server on l.
+func serve(t *testing.T, l net.Listener) (addr string, teardown func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "client-server-test")
+	require.NoError(t, err)
+
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	topics, err := log.NewTopics(dir, log.Config{})
+	require.NoError(t, err)
+
+	groups, err := server.NewConsumerGroups(topics)
+	require.NoError(t, err)
+
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{
+		CommitLog: clog,
+		Topics:    topics,
+		Groups:    groups,
+	}))
+	require.NoError(t, err)
+
+	go func() {
+		srv.Serve(l)
+	}()
+
+	return l.Addr().String(), func() {
+		srv.Stop()
+		l.Close()
+		topics.Close()
+		clog.Remove()
+	}
+}
+
+// epochLog is a commit log with a cluster epoch, like a Raft log's.
+type epochLog struct {
+	*log.Log
+	mu    sync.Mutex
+	epoch *api.Epoch
+}
+
+func (l *epochLog) Epoch() (*api.Epoch, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.epoch, nil
+}
+
+func (l *epochLog) GetServers() ([]*api.Server, error) {
+	return nil, nil
+}
+
+func TestFencing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "client-fencing-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+
+	elog := &epochLog{Log: clog, epoch: &api.Epoch{Term: 1, ConfigIndex: 1}}
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{CommitLog: elog, GetServer: elog}))
+	require.NoError(t, err)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	c, err := client.New(l.Addr().String(), client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		Fencing:     true,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	record := &api.Record{Value: []byte("hello world")}
+	_, err = c.Produce(ctx, record)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), c.Epoch().Term)
+
+	// A new leader fences the client's next write, which then knows the
+	// new epoch to retry in.
+	elog.mu.Lock()
+	elog.epoch = &api.Epoch{Term: 2, ConfigIndex: 1}
+	elog.mu.Unlock()
+	_, err = c.Produce(ctx, record)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, uint64(2), c.Epoch().Term)
+	_, err = c.Produce(ctx, record)
+	require.NoError(t, err)
+
+	// A node behind the cluster can't take the client back to its epoch.
+	elog.mu.Lock()
+	elog.epoch = &api.Epoch{Term: 1, ConfigIndex: 5}
+	elog.mu.Unlock()
+	_, err = c.Produce(ctx, record)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Equal(t, uint64(2), c.Epoch().Term)
+}
+
+func TestReadYourWrites(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	writer, err := client.New(addr, client.Config{DialOptions: opts})
+	require.NoError(t, err)
+	defer writer.Close()
+	reader, err := client.New(addr, client.Config{
+		DialOptions:    opts,
+		ReadYourWrites: true,
+		MonotonicReads: true,
+	})
+	require.NoError(t, err)
+	defer reader.Close()
+
+	ctx := context.Background()
+	require.Nil(t, writer.Session())
+	for _, value := range []string{"first", "second"} {
+		_, err := writer.Produce(ctx, &api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+	}
+	require.Equal(t, uint64(1), writer.Session().ProducedOffset)
+
+	// Joining an older session doesn't take the reader's back.
+	reader.JoinSession(writer.Session())
+	reader.JoinSession(&api.Session{ProducedOffset: 0})
+	require.Equal(t, uint64(1), reader.Session().ProducedOffset)
+
+	var got []string
+	err = reader.Subscribe(ctx, "reader", func(ctx context.Context, record *api.Record) error {
+		got = append(got, string(record.Value))
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, []string{"first", "second"}, got)
+
+	// The reader's session remembers how far it's read, so later reads
+	// don't go back.
+	require.Equal(t, uint64(2), reader.Session().ReadOffset)
+	records, err := reader.Last(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(records[0].Value))
+}
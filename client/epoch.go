@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Epoch returns the newest cluster epoch the client has seen, or nil if it
+// hasn't seen one.
+func (c *Client) Epoch() *api.Epoch {
+	c.epochMu.Lock()
+	defer c.epochMu.Unlock()
+	return c.epoch
+}
+
+// fencingEpoch returns the epoch to fence writes with, asking the cluster
+// for it before the first write. It's nil if the cluster has no epoch.
+func (c *Client) fencingEpoch(ctx context.Context) (*api.Epoch, error) {
+	c.epochMu.Lock()
+	epoch, asked := c.epoch, c.asked
+	c.epochMu.Unlock()
+	if epoch != nil || asked {
+		return epoch, nil
+	}
+
+	res, err := c.log.GetServers(ctx, &api.GetServersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	c.epochMu.Lock()
+	c.asked = true
+	c.epochMu.Unlock()
+	c.observeEpoch(res.Epoch)
+	return c.Epoch(), nil
+}
+
+// observeEpoch keeps epoch if it's newer than the one the client has. Older
+// epochs come from nodes that are behind the cluster, and are ignored so
+// they can't unfence writes to them.
+func (c *Client) observeEpoch(epoch *api.Epoch) {
+	if epoch == nil {
+		return
+	}
+	c.epochMu.Lock()
+	defer c.epochMu.Unlock()
+	if epoch.Compare(c.epoch) > 0 {
+		c.epoch = epoch
+	}
+}
+
+// epochFromError returns the node's epoch from an EPOCH_MISMATCH error, or
+// nil if err isn't one.
+func epochFromError(err error) *api.Epoch {
+	for _, detail := range status.Convert(err).Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Reason != "EPOCH_MISMATCH" || info.Domain != "prolog" {
+			continue
+		}
+		term, err := strconv.ParseUint(info.Metadata["current_term"], 10, 64)
+		if err != nil {
+			return nil
+		}
+		index, err := strconv.ParseUint(info.Metadata["current_config_index"], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &api.Epoch{Term: term, ConfigIndex: index}
+	}
+	return nil
+}
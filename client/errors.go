@@ -0,0 +1,35 @@
+package client
+
+import (
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// Truncated reports whether err says the records asked for were truncated
+// from the log, e.g. by retention, and returns the log's lowest offset,
+// where a consumer can skip forward to. Unlike records past the end of the
+// log, truncated records never arrive, so retrying doesn't help.
+func Truncated(err error) (lowest uint64, ok bool) {
+	_, lowest, ok = truncation(err)
+	return lowest, ok
+}
+
+// truncation returns the offset asked for and the log's lowest offset if
+// err is an OFFSET_TRUNCATED error.
+func truncation(err error) (off, lowest uint64, ok bool) {
+	for _, detail := range status.Convert(err).Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Reason != "OFFSET_TRUNCATED" || info.Domain != "prolog" {
+			continue
+		}
+		off, err := strconv.ParseUint(info.Metadata["offset"], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		lowest, err := strconv.ParseUint(info.Metadata["lowest"], 10, 64)
+		return off, lowest, err == nil
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// KeyedHandler processes a record delivered to an exactly-once
+// subscription. key is the record's dedup key: any side effect the
+// handler has outside the log should be idempotent by it, e.g. an upsert
+// keyed by it, since a handler that succeeded just before the process
+// crashed is called again for the same record.
+type KeyedHandler func(ctx context.Context, record *api.Record, key string) error
+
+// DedupStore stores, for each exactly-once subscription, the next offset
+// to consume and the dedup keys of the records it processed, committing
+// both together.
+type DedupStore interface {
+	// Load returns the subscription's next offset, and false if it hasn't
+	// committed one yet.
+	Load(ctx context.Context, subscription string) (next uint64, ok bool, err error)
+	// Seen reports whether the subscription committed a record with key.
+	Seen(ctx context.Context, subscription, key string) (bool, error)
+	// Commit stores that the subscription processed the record with key,
+	// and should consume from next.
+	Commit(ctx context.Context, subscription, key string, next uint64) error
+}
+
+var (
+	_ DedupStore = (*MemoryDedupStore)(nil)
+	_ DedupStore = (*FileDedupStore)(nil)
+)
+
+// DedupKey returns the record's dedup key: its HeaderDedupKey header, or
+// its offset if it has none.
+func DedupKey(record *api.Record) string {
+	if key, ok := record.Headers[api.HeaderDedupKey]; ok {
+		return key
+	}
+	return "offset:" + strconv.FormatUint(record.Offset, 10)
+}
+
+// SubscribeExactlyOnce is Subscribe for pipelines that must have each
+// record's effects once: records whose dedup key the subscription already
+// committed, e.g. copies a producer retried, are skipped, and each record
+// handled is committed to store along with its key. Together with a
+// handler that's idempotent by the key, a subscription that's restarted at
+// any point has the same effects as one that never stopped.
+func (c *Client) SubscribeExactlyOnce(ctx context.Context, name string, store DedupStore, handler KeyedHandler) error {
+	next, ok, err := store.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	return c.subscribe(ctx, name, next, ok, func(ctx context.Context, record *api.Record) error {
+		key := DedupKey(record)
+		seen, err := store.Seen(ctx, name, key)
+		if err != nil {
+			return err
+		}
+		if !seen {
+			if err := handler(ctx, record, key); err != nil {
+				return err
+			}
+		}
+		return store.Commit(ctx, name, key, record.Offset+1)
+	})
+}
+
+// defaultDedupWindow is how many keys dedup stores remember per
+// subscription unless told otherwise.
+const defaultDedupWindow = 10000
+
+// dedupState is a subscription's next offset and the keys it committed
+// most recently, oldest first.
+type dedupState struct {
+	Next uint64   `json:"next"`
+	Keys []string `json:"keys"`
+
+	seen map[string]bool
+}
+
+// dedupStates holds the state of every subscription of a dedup store.
+// Each subscription remembers the last window keys it committed, so
+// copies of a record further apart than that aren't deduplicated.
+type dedupStates struct {
+	mu     sync.Mutex
+	window int
+	states map[string]*dedupState
+}
+
+func newDedupStates(window int) dedupStates {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	return dedupStates{window: window, states: make(map[string]*dedupState)}
+}
+
+func (s *dedupStates) load(subscription string) (uint64, bool) {
+	state, ok := s.states[subscription]
+	if !ok {
+		return 0, false
+	}
+	return state.Next, true
+}
+
+func (s *dedupStates) seen(subscription, key string) bool {
+	state, ok := s.states[subscription]
+	if !ok {
+		return false
+	}
+	if state.seen == nil {
+		state.seen = make(map[string]bool, len(state.Keys))
+		for _, k := range state.Keys {
+			state.seen[k] = true
+		}
+	}
+	return state.seen[key]
+}
+
+func (s *dedupStates) commit(subscription, key string, next uint64) {
+	state, ok := s.states[subscription]
+	if !ok {
+		state = &dedupState{}
+		s.states[subscription] = state
+	}
+	if !s.seen(subscription, key) {
+		state.Keys = append(state.Keys, key)
+		state.seen[key] = true
+		if len(state.Keys) > s.window {
+			delete(state.seen, state.Keys[0])
+			state.Keys = state.Keys[1:]
+		}
+	}
+	state.Next = next
+}
+
+// MemoryDedupStore keeps dedup state in memory, so exactly-once
+// subscriptions resume across reconnects but not process restarts.
+type MemoryDedupStore struct {
+	states dedupStates
+}
+
+// NewMemoryDedupStore returns a store remembering the last window keys of
+// each subscription. Zero defaults to 10000.
+func NewMemoryDedupStore(window int) *MemoryDedupStore {
+	return &MemoryDedupStore{states: newDedupStates(window)}
+}
+
+func (s *MemoryDedupStore) Load(ctx context.Context, subscription string) (uint64, bool, error) {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	next, ok := s.states.load(subscription)
+	return next, ok, nil
+}
+
+func (s *MemoryDedupStore) Seen(ctx context.Context, subscription, key string) (bool, error) {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	return s.states.seen(subscription, key), nil
+}
+
+func (s *MemoryDedupStore) Commit(ctx context.Context, subscription, key string, next uint64) error {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	s.states.commit(subscription, key, next)
+	return nil
+}
+
+// FileDedupStore keeps dedup state in a JSON file so exactly-once
+// subscriptions resume after process restarts. Each commit rewrites the
+// file atomically, so a key and its offset are stored together or not at
+// all.
+type FileDedupStore struct {
+	path   string
+	states dedupStates
+}
+
+// NewFileDedupStore loads dedup state from path, which is created on the
+// first commit if it doesn't exist. Each subscription remembers its last
+// window keys; zero defaults to 10000.
+func NewFileDedupStore(path string, window int) (*FileDedupStore, error) {
+	s := &FileDedupStore{
+		path:   path,
+		states: newDedupStates(window),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.states.states); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileDedupStore) Load(ctx context.Context, subscription string) (uint64, bool, error) {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	next, ok := s.states.load(subscription)
+	return next, ok, nil
+}
+
+func (s *FileDedupStore) Seen(ctx context.Context, subscription, key string) (bool, error) {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	return s.states.seen(subscription, key), nil
+}
+
+func (s *FileDedupStore) Commit(ctx context.Context, subscription, key string, next uint64) error {
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	s.states.commit(subscription, key, next)
+	b, err := json.Marshal(s.states.states)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
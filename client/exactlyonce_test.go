@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupStores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.json")
+	file, err := NewFileDedupStore(path, 2)
+	require.NoError(t, err)
+
+	for name, store := range map[string]DedupStore{
+		"memory": NewMemoryDedupStore(2),
+		"file":   file,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			_, ok, err := store.Load(ctx, "sub")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			for i, key := range []string{"a", "b", "c"} {
+				require.NoError(t, store.Commit(ctx, "sub", key, uint64(i+1)))
+			}
+			next, ok, err := store.Load(ctx, "sub")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, uint64(3), next)
+
+			// Only the last two keys are remembered.
+			for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+				seen, err := store.Seen(ctx, "sub", key)
+				require.NoError(t, err)
+				require.Equal(t, want, seen, key)
+			}
+		})
+	}
+
+	// State survives reopening the file.
+	file, err = NewFileDedupStore(path, 2)
+	require.NoError(t, err)
+	seen, err := file.Seen(context.Background(), "sub", "c")
+	require.NoError(t, err)
+	require.True(t, seen)
+}
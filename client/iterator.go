@@ -0,0 +1,245 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrIteratorClosed is returned by Next once the iterator is closed.
+var ErrIteratorClosed = errors.New("client: iterator closed")
+
+// Backoff between attempts to reopen a tail's stream.
+var (
+	minTailBackoff = 100 * time.Millisecond
+	maxTailBackoff = 5 * time.Second
+)
+
+// Iterator tails the log one record at a time:
+//
+//	it := c.Tail(&api.ConsumeRequest{Position: api.ConsumeRequest_LATEST})
+//	defer it.Close()
+//	for {
+//		record, err := it.Next(ctx)
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// It reopens its stream from the record after the last one it received
+// when the stream fails with a transient error, e.g. because a node
+// restarted or leadership moved, so Next only returns errors that retrying
+// won't fix, like a LOG_DIVERGED status if the node it resumes on has
+// replaced the last record it received. An Iterator must not be used by
+// more than one goroutine.
+type Iterator struct {
+	client  *Client
+	req     *api.ConsumeRequest
+	results chan tailResult
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+	// highWatermark is written by run and read with atomic.
+	highWatermark uint64
+
+	// mu guards paused and sends on stream, the iterator's current
+	// stream.
+	mu     sync.Mutex
+	paused bool
+	stream api.Log_ConsumeControlledClient
+}
+
+type tailResult struct {
+	record *api.Record
+	err    error
+}
+
+// Tail returns an iterator over the log req names, the default log or a
+// topic's partition, starting where req says. Records are read ahead of
+// Next by at most one.
+func (c *Client) Tail(req *api.ConsumeRequest) *Iterator {
+	ctx, cancel := context.WithCancel(context.Background())
+	it := &Iterator{
+		client:  c,
+		req:     req,
+		results: make(chan tailResult),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go it.run(ctx)
+	return it
+}
+
+// Next returns the next record, waiting for one to be produced if the
+// iterator has caught up with the log. Errors other than ctx's are final:
+// every later call returns them too.
+func (it *Iterator) Next(ctx context.Context) (*api.Record, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res, ok := <-it.results:
+		if !ok {
+			it.err = ErrIteratorClosed
+			return nil, it.err
+		}
+		if res.err != nil {
+			it.err = res.err
+			return nil, it.err
+		}
+		return res.record, nil
+	}
+}
+
+// HighWatermark returns the offset the next record appended to the log
+// will get, as of the last record or heartbeat the iterator received, so
+// a consumer's lag is HighWatermark less the offset after the last record
+// Next returned. Unless Config.HeartbeatInterval is set it only advances
+// with the records the iterator receives. Unlike Next, it's safe to call
+// from any goroutine.
+func (it *Iterator) HighWatermark() uint64 {
+	return atomic.LoadUint64(&it.highWatermark)
+}
+
+// Pause asks the server to stop sending records, without closing the
+// stream or losing its position, e.g. while the consumer applies
+// backpressure; a record already read ahead can still be returned by Next.
+// Resume restarts delivery. The iterator stays paused across reconnects.
+// Unlike Next, they're safe to call from any goroutine.
+func (it *Iterator) Pause() {
+	it.control(true)
+}
+
+func (it *Iterator) Resume() {
+	it.control(false)
+}
+
+func (it *Iterator) control(pause bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.paused == pause {
+		return
+	}
+	it.paused = pause
+	if it.stream == nil {
+		return
+	}
+	action := api.ConsumeControl_RESUME
+	if pause {
+		action = api.ConsumeControl_PAUSE
+	}
+	// If the send fails, so did the stream, which reopens paused or not
+	// as the iterator is now.
+	_ = it.stream.Send(&api.ConsumeControl{Action: action})
+}
+
+// open opens a stream from req, paused if the iterator is.
+func (it *Iterator) open(ctx context.Context, req *api.ConsumeRequest) (api.Log_ConsumeControlledClient, error) {
+	stream, err := it.client.log.ConsumeControlled(withSession(ctx, req.Session))
+	if err != nil {
+		return nil, err
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	first := &api.ConsumeControl{Request: req}
+	if it.paused {
+		first.Action = api.ConsumeControl_PAUSE
+	}
+	if err := stream.Send(first); err != nil {
+		return nil, err
+	}
+	it.stream = stream
+	return stream, nil
+}
+
+// Close stops the iterator and its stream.
+func (it *Iterator) Close() error {
+	it.cancel()
+	<-it.done
+	return nil
+}
+
+func (it *Iterator) run(ctx context.Context) {
+	defer close(it.done)
+	defer close(it.results)
+
+	req := proto.Clone(it.req).(*api.ConsumeRequest)
+	backoff := minTailBackoff
+	for {
+		req.ResolveClaimChecks = it.client.ResolveClaimChecks
+		req.HeartbeatIntervalMs = uint64(it.client.HeartbeatInterval.Milliseconds())
+		req.Session = it.client.readSession()
+		stream, err := it.open(ctx, req)
+		for err == nil {
+			var res *api.ConsumeResponse
+			if res, err = stream.Recv(); err != nil {
+				break
+			}
+			if res.Record == nil {
+				atomic.StoreUint64(&it.highWatermark, res.HighWatermark)
+				it.client.observeRead(res.HighWatermark)
+				continue
+			}
+			it.client.observeRead(res.Record.Offset + 1)
+			if next := res.Record.Offset + 1; next > it.HighWatermark() {
+				atomic.StoreUint64(&it.highWatermark, next)
+			}
+			select {
+			case it.results <- tailResult{record: res.Record}:
+			case <-ctx.Done():
+				return
+			}
+			// Resume after this record from now on, however the
+			// iterator was asked to start, checking the node we resume
+			// on hasn't replaced it.
+			req = proto.Clone(it.req).(*api.ConsumeRequest)
+			req.Position = api.ConsumeRequest_OFFSET
+			req.Offset = res.Record.Offset + 1
+			req.RelativeOffset = 0
+			req.LastTerm = res.Record.Term
+			backoff = minTailBackoff
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if !retryable(err) {
+			select {
+			case it.results <- tailResult{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, maxTailBackoff)
+	}
+}
+
+// retryable reports whether reopening a stream that failed with err may
+// succeed: the server hung up, was unreachable or wasn't serving yet.
+func retryable(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/internal/log"
+	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestTailResumesAcrossRestarts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-tail-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+
+	// start serves the log in dir on addr, as a node restarting would.
+	start := func(l net.Listener) (stop func()) {
+		clog, err := log.NewLog(dir, log.Config{})
+		require.NoError(t, err)
+		srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{CommitLog: clog}))
+		require.NoError(t, err)
+		go srv.Serve(l)
+		return func() {
+			srv.Stop()
+			require.NoError(t, clog.Close())
+		}
+	}
+	stop := start(l)
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = c.Produce(ctx, &api.Record{Value: []byte("first")})
+	require.NoError(t, err)
+
+	it := c.Tail(&api.ConsumeRequest{Position: api.ConsumeRequest_EARLIEST})
+	defer it.Close()
+	record, err := it.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(record.Value))
+
+	// Next waits for new records until its context is done.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = it.Next(waitCtx)
+	waitCancel()
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// The iterator reconnects once the node is back, and carries on
+	// after the last record it returned.
+	stop()
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	stop = start(l)
+	defer stop()
+
+	// The client's connection notices the restart on its first call.
+	for i := 0; i < 50; i++ {
+		if _, err = c.Produce(ctx, &api.Record{Value: []byte("second")}); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	record, err = it.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(record.Value))
+	require.Equal(t, uint64(1), record.Offset)
+
+	require.NoError(t, it.Close())
+	_, err = it.Next(ctx)
+	require.Equal(t, client.ErrIteratorClosed, err)
+}
+
+func TestTailPause(t *testing.T) {
+	addr, teardown := setupServer(t)
+	defer teardown()
+
+	c, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = c.Produce(ctx, &api.Record{Value: []byte("first")})
+	require.NoError(t, err)
+
+	it := c.Tail(&api.ConsumeRequest{Position: api.ConsumeRequest_EARLIEST})
+	defer it.Close()
+	record, err := it.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(record.Value))
+
+	// Records produced while the tail is paused wait for it to resume.
+	it.Pause()
+	time.Sleep(50 * time.Millisecond)
+	_, err = c.Produce(ctx, &api.Record{Value: []byte("second")})
+	require.NoError(t, err)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = it.Next(waitCtx)
+	waitCancel()
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	it.Resume()
+	record, err = it.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(record.Value))
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// ProduceFunc appends a record to the log and returns its offset.
+type ProduceFunc func(ctx context.Context, record *api.Record) (uint64, error)
+
+// ProduceMiddleware wraps a ProduceFunc with a cross-cutting concern. It may
+// change the record, short-circuit by returning an error without calling
+// next, or act on the result.
+type ProduceMiddleware func(next ProduceFunc) ProduceFunc
+
+// chainProduce wraps produce in middleware so the first middleware runs
+// first.
+func chainProduce(middleware []ProduceMiddleware, produce ProduceFunc) ProduceFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		produce = middleware[i](produce)
+	}
+	return produce
+}
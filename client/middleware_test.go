@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainProduce(t *testing.T) {
+	var calls []string
+	trace := func(name string) ProduceMiddleware {
+		return func(next ProduceFunc) ProduceFunc {
+			return func(ctx context.Context, record *api.Record) (uint64, error) {
+				calls = append(calls, name)
+				record.Value = append(record.Value, name...)
+				return next(ctx, record)
+			}
+		}
+	}
+
+	var sent *api.Record
+	produce := chainProduce(
+		[]ProduceMiddleware{trace("a"), trace("b")},
+		func(ctx context.Context, record *api.Record) (uint64, error) {
+			sent = record
+			return 7, nil
+		},
+	)
+
+	off, err := produce(context.Background(), &api.Record{Value: []byte("v")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), off)
+	require.Equal(t, []string{"a", "b"}, calls)
+	require.Equal(t, "vab", string(sent.Value))
+
+	errInvalid := errors.New("invalid record")
+	validate := func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, record *api.Record) (uint64, error) {
+			return 0, errInvalid
+		}
+	}
+	sent = nil
+	produce = chainProduce(
+		[]ProduceMiddleware{validate},
+		func(ctx context.Context, record *api.Record) (uint64, error) {
+			sent = record
+			return 0, nil
+		},
+	)
+	_, err = produce(context.Background(), &api.Record{})
+	require.Equal(t, errInvalid, err)
+	require.Nil(t, sent)
+}
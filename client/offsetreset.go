@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// OffsetReset is what a subscription does when the offset it would consume
+// next is out of the range the log holds: below its lowest offset, because
+// the records were truncated, or past its end, e.g. because the log was
+// recreated under it.
+type OffsetReset string
+
+const (
+	// OffsetResetError stops the subscription with an
+	// *OffsetOutOfRangeError, leaving its offset where it was.
+	OffsetResetError OffsetReset = "error"
+	// OffsetResetEarliest resumes the subscription from the log's lowest
+	// offset.
+	OffsetResetEarliest OffsetReset = "earliest"
+	// OffsetResetLatest resumes the subscription from the end of the log,
+	// so it only consumes records appended from then on.
+	OffsetResetLatest OffsetReset = "latest"
+)
+
+// OffsetOutOfRangeError is returned by subscriptions whose offset is out
+// of the log's range under OffsetResetError.
+type OffsetOutOfRangeError struct {
+	Subscription string
+	Offset       uint64
+	// Lowest and Next are the range of offsets the log holds, from Lowest
+	// up to, but not including, Next.
+	Lowest, Next uint64
+}
+
+func (e *OffsetOutOfRangeError) Error() string {
+	return fmt.Sprintf(
+		"client: subscription %q offset %d out of range [%d, %d)",
+		e.Subscription, e.Offset, e.Lowest, e.Next,
+	)
+}
+
+// reset returns the offset the named subscription resumes from when off is
+// out of the range from lowest up to next, per the OffsetReset policy.
+func (c *Client) reset(name string, off, lowest, next uint64) (uint64, error) {
+	switch c.OffsetReset {
+	case OffsetResetEarliest:
+		return lowest, nil
+	case OffsetResetLatest:
+		return next, nil
+	}
+	return 0, &OffsetOutOfRangeError{
+		Subscription: name,
+		Offset:       off,
+		Lowest:       lowest,
+		Next:         next,
+	}
+}
+
+// logRange returns the range of offsets the log holds, from lowest up to,
+// but not including, next, asking for its newest record alone.
+func (c *Client) logRange(ctx context.Context) (lowest, next uint64, err error) {
+	res, err := c.log.ListRecords(ctx, &api.ListRecordsRequest{
+		Position: api.ConsumeRequest_LATEST,
+		Reverse:  true,
+		Limit:    1,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return res.LowestOffset, res.NextOffset, nil
+}
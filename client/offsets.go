@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OffsetTracker stores the next offset each named subscription should
+// consume from.
+type OffsetTracker interface {
+	// Load returns the subscription's next offset, and false if it hasn't
+	// stored one yet.
+	Load(ctx context.Context, subscription string) (next uint64, ok bool, err error)
+	Store(ctx context.Context, subscription string, next uint64) error
+}
+
+var (
+	_ OffsetTracker = (*MemoryOffsetTracker)(nil)
+	_ OffsetTracker = (*FileOffsetTracker)(nil)
+	_ OffsetTracker = (*GroupOffsetTracker)(nil)
+)
+
+// MemoryOffsetTracker keeps offsets in memory, so subscriptions resume
+// across reconnects but not process restarts.
+type MemoryOffsetTracker struct {
+	mu      sync.Mutex
+	offsets map[string]uint64
+}
+
+func NewMemoryOffsetTracker() *MemoryOffsetTracker {
+	return &MemoryOffsetTracker{offsets: make(map[string]uint64)}
+}
+
+func (t *MemoryOffsetTracker) Load(ctx context.Context, subscription string) (uint64, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next, ok := t.offsets[subscription]
+	return next, ok, nil
+}
+
+func (t *MemoryOffsetTracker) Store(ctx context.Context, subscription string, next uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.offsets[subscription] = next
+	return nil
+}
+
+// FileOffsetTracker keeps offsets in a JSON file so subscriptions resume
+// after process restarts. Each store rewrites the file atomically.
+type FileOffsetTracker struct {
+	mu      sync.Mutex
+	path    string
+	offsets map[string]uint64
+}
+
+// NewFileOffsetTracker loads offsets from path, which is created on the
+// first store if it doesn't exist.
+func NewFileOffsetTracker(path string) (*FileOffsetTracker, error) {
+	t := &FileOffsetTracker{
+		path:    path,
+		offsets: make(map[string]uint64),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &t.offsets); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *FileOffsetTracker) Load(ctx context.Context, subscription string) (uint64, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next, ok := t.offsets[subscription]
+	return next, ok, nil
+}
+
+func (t *FileOffsetTracker) Store(ctx context.Context, subscription string, next uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.offsets[subscription] = next
+	b, err := json.Marshal(t.offsets)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(t.path, b)
+}
+
+// GroupOffsetTracker keeps offsets on the cluster, as the commits of the
+// consumer groups named after the subscriptions, so subscriptions resume
+// after restarts on any host. Set it as a client's OffsetTracker once the
+// client is created:
+//
+//	c.OffsetTracker = client.NewGroupOffsetTracker(c)
+type GroupOffsetTracker struct {
+	client *Client
+}
+
+func NewGroupOffsetTracker(c *Client) *GroupOffsetTracker {
+	return &GroupOffsetTracker{client: c}
+}
+
+func (t *GroupOffsetTracker) Load(ctx context.Context, subscription string) (uint64, bool, error) {
+	return t.client.FetchOffset(ctx, subscription)
+}
+
+func (t *GroupOffsetTracker) Store(ctx context.Context, subscription string, next uint64) error {
+	return t.client.CommitOffset(ctx, subscription, next)
+}
+
+// writeFileAtomic writes b to a temp file and renames it over path, so a
+// crash never leaves a half written file behind.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
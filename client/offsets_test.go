@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetTrackers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offsets-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "offsets.json")
+
+	file, err := NewFileOffsetTracker(path)
+	require.NoError(t, err)
+
+	for name, tracker := range map[string]OffsetTracker{
+		"memory": NewMemoryOffsetTracker(),
+		"file":   file,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			_, ok, err := tracker.Load(ctx, "sub")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			require.NoError(t, tracker.Store(ctx, "sub", 3))
+			next, ok, err := tracker.Load(ctx, "sub")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, uint64(3), next)
+		})
+	}
+
+	// offsets survive reopening the file
+	file, err = NewFileOffsetTracker(path)
+	require.NoError(t, err)
+	next, ok, err := file.Load(context.Background(), "sub")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), next)
+}
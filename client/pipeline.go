@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// ErrPipelineClosed is returned by Send once the pipeline is closed.
+var ErrPipelineClosed = errors.New("client: pipeline closed")
+
+// DefaultMaxInFlight is how many records a pipeline sends ahead of their
+// acknowledgements unless told otherwise.
+const DefaultMaxInFlight = 64
+
+// Ack is called with the offset a pipelined record was appended at, or
+// the error that failed it.
+type Ack func(offset uint64, err error)
+
+// Pipeline produces records over one ProduceStream without waiting for
+// each to be acknowledged before sending the next, for producers whose
+// throughput would otherwise be bound by round trips. The server appends a
+// stream's records in the order they're sent and acknowledges them in that
+// order, so offsets increase in send order, and the first record that
+// fails fails every record sent after it. Unlike Produce, records don't go
+// through the produce middleware, since acknowledgements arrive after
+// Send returns.
+type Pipeline struct {
+	client *Client
+	stream api.Log_ProduceStreamClient
+	cancel context.CancelFunc
+	// window holds a token per record in flight.
+	window chan struct{}
+	// acks holds the acks of the records in flight, in send order.
+	acks chan Ack
+	done chan struct{}
+
+	// mu guards sends on stream and err, which is set once the stream
+	// ends.
+	mu  sync.Mutex
+	err error
+}
+
+// Pipeline opens a pipeline keeping up to maxInFlight records
+// unacknowledged, or DefaultMaxInFlight if it's zero.
+func (c *Client) Pipeline(ctx context.Context, maxInFlight int) (*Pipeline, error) {
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.log.ProduceStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	p := &Pipeline{
+		client: c,
+		stream: stream,
+		cancel: cancel,
+		window: make(chan struct{}, maxInFlight),
+		acks:   make(chan Ack, maxInFlight),
+		done:   make(chan struct{}),
+	}
+	go p.receive()
+	return p, nil
+}
+
+// Send sends record without waiting for it to be acknowledged, blocking
+// only while maxInFlight records are. ack, if not nil, is called once the
+// record is acknowledged or fails, from the pipeline's goroutine and in
+// send order, so it should be quick. Send only returns an error if the
+// record wasn't sent, in which case ack isn't called.
+func (p *Pipeline) Send(ctx context.Context, record *api.Record, ack Ack) error {
+	req, err := p.client.produceRequest(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case p.window <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return closedErr(p.err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		<-p.window
+		return closedErr(p.err)
+	}
+	p.acks <- ack
+	// A failed send fails the stream, which fails the record's ack with
+	// the stream's error.
+	_ = p.stream.Send(req)
+	return nil
+}
+
+// Close waits for the records in flight to be acknowledged and closes the
+// pipeline. It returns the error that failed the stream, if one did.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	_ = p.stream.CloseSend()
+	p.mu.Unlock()
+	<-p.done
+	p.cancel()
+	if p.err == io.EOF {
+		return nil
+	}
+	return p.err
+}
+
+// closedErr returns the error records sent on a stream that ended with err
+// fail with.
+func closedErr(err error) error {
+	if err == io.EOF {
+		return ErrPipelineClosed
+	}
+	return err
+}
+
+// receive matches acknowledgements to the records in flight until the
+// stream ends, then fails the records still in flight.
+func (p *Pipeline) receive() {
+	defer close(p.done)
+	for {
+		res, err := p.stream.Recv()
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		p.client.observeEpoch(res.Epoch)
+		p.client.observeProduced(res.Offset)
+		ack := <-p.acks
+		<-p.window
+		if ack != nil {
+			ack(res.Offset, nil)
+		}
+	}
+}
+
+func (p *Pipeline) fail(err error) {
+	p.client.observeEpoch(epochFromError(err))
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+
+	for {
+		select {
+		case ack := <-p.acks:
+			if ack != nil {
+				ack(0, closedErr(err))
+			}
+		default:
+			return
+		}
+	}
+}
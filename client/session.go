@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// Session returns the client's session token, recording the newest offset
+// it produced and how far it's read, or nil if it's done neither. Another
+// client can join the session, see JoinSession, to read consistently with
+// the client too.
+func (c *Client) Session() *api.Session {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.session == nil {
+		return nil
+	}
+	return &api.Session{
+		ProducedOffset: c.session.ProducedOffset,
+		ReadOffset:     c.session.ReadOffset,
+	}
+}
+
+// JoinSession merges session, another client's token, into the client's,
+// so with ReadYourWrites and MonotonicReads its reads also see that
+// client's writes and nothing older than it's read.
+func (c *Client) JoinSession(session *api.Session) {
+	if session == nil {
+		return
+	}
+	c.observeProduced(session.ProducedOffset)
+	c.observeRead(session.ReadOffset)
+}
+
+// observeProduced records that the client's session wrote offset off.
+func (c *Client) observeProduced(off uint64) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.session == nil {
+		c.session = &api.Session{}
+	}
+	c.produced = true
+	c.session.ProducedOffset = max(c.session.ProducedOffset, off)
+}
+
+// observeRead records that the client's session has seen the log up to,
+// but not including, offset end.
+func (c *Client) observeRead(end uint64) {
+	if end == 0 {
+		return
+	}
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.session == nil {
+		c.session = &api.Session{}
+	}
+	c.session.ReadOffset = max(c.session.ReadOffset, end)
+}
+
+// readSession returns the session token to send with reads, holding what
+// ReadYourWrites and MonotonicReads ask nodes to wait for, or nil if
+// they're not set or there's nothing to wait for yet.
+func (c *Client) readSession() *api.Session {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.session == nil {
+		return nil
+	}
+	session := &api.Session{}
+	var wait bool
+	if c.ReadYourWrites && c.produced {
+		session.ProducedOffset = c.session.ProducedOffset
+		wait = true
+	}
+	if c.MonotonicReads && c.session.ReadOffset > 0 {
+		session.ReadOffset = c.session.ReadOffset
+		wait = true
+	}
+	if !wait {
+		return nil
+	}
+	return session
+}
+
+// withSession returns an outgoing context telling the load balancer how far
+// a read's node must have got to serve session, so it can skip replicas
+// known to be behind.
+func withSession(ctx context.Context, session *api.Session) context.Context {
+	if session == nil {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, api.SessionEndMetadataKey, strconv.FormatUint(session.End(), 10))
+}
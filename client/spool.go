@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrSpooled is returned by Produce when the cluster was unreachable and
+// the record was spooled to disk instead. It's appended, with no offset
+// reported, once the cluster is back.
+var ErrSpooled = errors.New("cluster unavailable, record spooled")
+
+// ErrSpoolFull is returned by Produce when the cluster was unreachable and
+// the spool had no room for the record.
+var ErrSpoolFull = errors.New("spool full")
+
+var enc = binary.BigEndian
+
+// lenWidth is the width of the length prefixing each spooled record.
+const lenWidth = 8
+
+// Spool is a queue of records on disk, which a client produces to while
+// the cluster is unreachable and drains in order once it's back, for
+// producers with unreliable connectivity, like edge and IoT devices.
+//
+// Records are delivered at least once: a produce that failed as the
+// cluster became unreachable may have been appended anyway. A spool is
+// used by one client at a time.
+type Spool struct {
+	mu       sync.Mutex
+	file     *os.File
+	headPath string
+	maxBytes int64
+	// size is the size of the queue file, head the position of its first
+	// record not yet delivered, and pending how many records follow it.
+	size    int64
+	head    int64
+	pending int
+
+	// OnDropped, if set, is called with the spooled records that draining
+	// them fails with anything but the cluster being unavailable, e.g.
+	// because they're too large. They're dropped rather than block the
+	// records behind them.
+	OnDropped func(record *api.Record, err error)
+}
+
+// NewSpool opens the spool in dir, creating it if it doesn't exist, with
+// the records a previous process left in it still queued. maxBytes bounds
+// the queue file; zero is unbounded.
+func NewSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(
+		filepath.Join(dir, "spool"),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s := &Spool{
+		file:     file,
+		headPath: filepath.Join(dir, "head"),
+		maxBytes: maxBytes,
+		size:     fi.Size(),
+	}
+	b, err := os.ReadFile(s.headPath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		file.Close()
+		return nil, err
+	case len(b) == lenWidth:
+		s.head = int64(enc.Uint64(b))
+	}
+	// Count the records left, dropping any the previous process was
+	// writing when it stopped.
+	for pos := s.head; pos < s.size; s.pending++ {
+		n, err := s.length(pos)
+		if err != nil || pos+lenWidth+n > s.size {
+			if err := file.Truncate(pos); err != nil {
+				file.Close()
+				return nil, err
+			}
+			s.size = pos
+			break
+		}
+		pos += lenWidth + n
+	}
+	return s, nil
+}
+
+// Len returns how many records are spooled.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+func (s *Spool) length(pos int64) (int64, error) {
+	b := make([]byte, lenWidth)
+	if _, err := s.file.ReadAt(b, pos); err != nil {
+		return 0, err
+	}
+	return int64(enc.Uint64(b)), nil
+}
+
+// push queues record, syncing it to disk before returning.
+func (s *Spool) push(record *api.Record) error {
+	b, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := int64(lenWidth + len(b))
+	if s.maxBytes > 0 && s.size+n > s.maxBytes {
+		return ErrSpoolFull
+	}
+	buf := make([]byte, n)
+	enc.PutUint64(buf, uint64(len(b)))
+	copy(buf[lenWidth:], b)
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.size += n
+	s.pending++
+	return nil
+}
+
+// peek returns the first spooled record, or io.EOF if there are none.
+func (s *Spool) peek() (*api.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == 0 {
+		return nil, io.EOF
+	}
+	n, err := s.length(s.head)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := s.file.ReadAt(b, s.head+lenWidth); err != nil {
+		return nil, err
+	}
+	record := &api.Record{}
+	if err := proto.Unmarshal(b, record); err != nil {
+		return nil, fmt.Errorf("spooled record at %d: %w", s.head, err)
+	}
+	return record, nil
+}
+
+// pop removes the first spooled record, emptying the queue file once
+// they've all been delivered.
+func (s *Spool) pop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == 0 {
+		return nil
+	}
+	n, err := s.length(s.head)
+	if err != nil {
+		return err
+	}
+	head := s.head + lenWidth + n
+	if s.pending == 1 {
+		if err := s.file.Truncate(0); err != nil {
+			return err
+		}
+		s.size = 0
+		head = 0
+	}
+	b := make([]byte, lenWidth)
+	enc.PutUint64(b, uint64(head))
+	if err := os.WriteFile(s.headPath, b, 0644); err != nil {
+		return err
+	}
+	s.head = head
+	s.pending--
+	return nil
+}
+
+// Close closes the spool's file. The client using it must be closed
+// first.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// unavailable reports whether err means the cluster couldn't be reached,
+// so the record should be spooled and retried.
+func unavailable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// sendOrSpool sends record, spooling it if the cluster is unavailable or
+// records spooled before it are still waiting, so they're appended in the
+// order they were produced.
+func (c *Client) sendOrSpool(ctx context.Context, record *api.Record) (uint64, error) {
+	if c.Spool.Len() == 0 {
+		off, err := c.send(ctx, record)
+		if !unavailable(err) {
+			return off, err
+		}
+	}
+	if err := c.Spool.push(record); err != nil {
+		return 0, err
+	}
+	return 0, ErrSpooled
+}
+
+// drain sends the spooled records, in order, whenever the cluster is
+// available, until ctx is done.
+func (c *Client) drain(ctx context.Context) {
+	defer close(c.drained)
+	interval := c.SpoolRetryInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for {
+		for {
+			record, err := c.Spool.peek()
+			if err != nil {
+				break
+			}
+			_, err = c.send(ctx, record)
+			if ctx.Err() != nil || unavailable(err) {
+				break
+			}
+			if err != nil && c.Spool.OnDropped != nil {
+				c.Spool.OnDropped(record, err)
+			}
+			if err := c.Spool.pop(); err != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, 0)
+	require.NoError(t, err)
+	for _, v := range []string{"a", "b", "c"} {
+		require.NoError(t, s.push(&api.Record{Value: []byte(v)}))
+	}
+	record, err := s.peek()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(record.Value))
+	require.NoError(t, s.pop())
+	require.NoError(t, s.Close())
+
+	// Reopening keeps the records not yet delivered, dropping a record
+	// that was half written.
+	f, err := os.OpenFile(filepath.Join(dir, "spool"), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 9, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = NewSpool(dir, 0)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, 2, s.Len())
+	for _, v := range []string{"b", "c"} {
+		record, err := s.peek()
+		require.NoError(t, err)
+		require.Equal(t, v, string(record.Value))
+		require.NoError(t, s.pop())
+	}
+	_, err = s.peek()
+	require.Equal(t, io.EOF, err)
+
+	fi, err := os.Stat(filepath.Join(dir, "spool"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), fi.Size())
+}
+
+func TestSpoolFull(t *testing.T) {
+	s, err := NewSpool(t.TempDir(), 16)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.push(&api.Record{Value: []byte("a")}))
+	require.Equal(t, ErrSpoolFull, s.push(&api.Record{Value: []byte("b")}))
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// TruncationPolicy is what a subscription does when records it hasn't
+// consumed were truncated from the log, e.g. by retention, so it can
+// never consume them.
+type TruncationPolicy string
+
+const (
+	// TruncationFail stops the subscription with the server's
+	// OFFSET_TRUNCATED error, which Truncated recognizes, leaving its
+	// offset where it was for an operator to decide what to do.
+	TruncationFail TruncationPolicy = "fail"
+	// TruncationSkip resumes the subscription from the log's lowest
+	// offset, skipping the lost records. The new offset is committed with
+	// the next record the subscription handles.
+	TruncationSkip TruncationPolicy = "skip-to-earliest"
+)
+
+// subscribe streams records to fn from offset next, or from the start of
+// the log if from isn't set, on behalf of the named subscription. When the
+// records it would consume next were truncated, it reports the loss to
+// OnTruncated and then resets its offset per the OffsetReset policy, if
+// set, or fails or skips past them per the TruncationPolicy.
+func (c *Client) subscribe(ctx context.Context, name string, next uint64, from bool, fn Handler) error {
+	if from && c.OffsetReset != "" {
+		// A stream from past the end of the log would wait for it to get
+		// there, silently.
+		lowest, end, err := c.logRange(ctx)
+		if err != nil {
+			return err
+		}
+		if next > end {
+			if next, err = c.reset(name, next, lowest, end); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		err := c.stream(ctx, next, from, func(ctx context.Context, record *api.Record) error {
+			if err := fn(ctx, record); err != nil {
+				return err
+			}
+			next, from = record.Offset+1, true
+			return nil
+		})
+		off, lowest, ok := truncation(err)
+		if !ok {
+			return err
+		}
+		if c.OnTruncated != nil {
+			c.OnTruncated(name, off, lowest)
+		}
+		switch {
+		case c.OffsetReset != "":
+			_, end, rerr := c.logRange(ctx)
+			if rerr != nil {
+				return rerr
+			}
+			if next, err = c.reset(name, off, lowest, end); err != nil {
+				return err
+			}
+		case c.TruncationPolicy == TruncationSkip:
+			next = lowest
+		default:
+			return err
+		}
+		from = true
+	}
+}
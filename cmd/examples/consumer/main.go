@@ -0,0 +1,60 @@
+// Command consumer is an example tailing consumer. It prints every record
+// from the start of the log, or from its end with --latest, as it's
+// produced, along with how far behind the log it is.
+//
+//	go run ./cmd/examples/consumer --addr localhost:8400
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8400", "RPC address of a server")
+	latest := flag.Bool("latest", false, "only print records produced from now on")
+	flag.Parse()
+
+	c, err := client.New(*addr, client.Config{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+		HeartbeatInterval: time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	req := &api.ConsumeRequest{Position: api.ConsumeRequest_EARLIEST}
+	if *latest {
+		req.Position = api.ConsumeRequest_LATEST
+	}
+	it := c.Tail(req)
+	defer it.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for {
+		record, err := it.Next(ctx)
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		lag := it.HighWatermark() - (record.Offset + 1)
+		fmt.Printf("%d\t(lag %d)\t%s\n", record.Offset, lag, record.Value)
+	}
+}
@@ -0,0 +1,147 @@
+// Command dashboard is an example web dashboard. It serves a page showing
+// the cluster's servers, how far the log goes and the records produced
+// since it started, refreshed every few seconds.
+//
+//	go run ./cmd/examples/dashboard --addr localhost:8400 --http :8080
+package main
+
+import (
+	"context"
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// recent is how many records the dashboard shows.
+const recent = 20
+
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="3">
+<title>prolog</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>prolog at {{.Addr}}</h1>
+{{if .Err}}<p>Error: {{.Err}}</p>{{end}}
+<h2>Servers</h2>
+<table>
+<tr><th>ID</th><th>RPC address</th><th>Leader</th></tr>
+{{range .Servers}}<tr><td>{{.Id}}</td><td>{{.RpcAddr}}</td><td>{{if .IsLeader}}yes{{end}}</td></tr>
+{{end}}</table>
+<h2>Log</h2>
+<p>Next offset: {{.HighWatermark}}</p>
+<table>
+<tr><th>Offset</th><th>Origin</th><th>Value</th></tr>
+{{range .Records}}<tr><td>{{.Offset}}</td><td>{{index .Headers "prolog-origin-node"}}</td><td>{{printf "%s" .Value}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type dashboard struct {
+	addr string
+	log  api.LogClient
+	it   *client.Iterator
+
+	mu      sync.Mutex
+	records []*api.Record
+	err     error
+}
+
+// tail keeps the records produced since the dashboard started, newest
+// first.
+func (d *dashboard) tail(ctx context.Context) {
+	for {
+		record, err := d.it.Next(ctx)
+		d.mu.Lock()
+		if err != nil {
+			d.err = err
+			d.mu.Unlock()
+			return
+		}
+		d.records = append([]*api.Record{record}, d.records...)
+		if len(d.records) > recent {
+			d.records = d.records[:recent]
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Addr          string
+		Servers       []*api.Server
+		HighWatermark uint64
+		Records       []*api.Record
+		Err           error
+	}{
+		Addr:          d.addr,
+		HighWatermark: d.it.HighWatermark(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	res, err := d.log.GetServers(ctx, &api.GetServersRequest{})
+	if err != nil {
+		data.Err = err
+	} else {
+		data.Servers = res.Servers
+	}
+
+	d.mu.Lock()
+	data.Records = d.records
+	if d.err != nil {
+		data.Err = d.err
+	}
+	d.mu.Unlock()
+
+	if err := page.Execute(w, data); err != nil {
+		log.Print(err)
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8400", "RPC address of a server")
+	httpAddr := flag.String("http", ":8080", "address to serve the dashboard on")
+	flag.Parse()
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	c, err := client.New(*addr, client.Config{
+		DialOptions:       opts,
+		HeartbeatInterval: time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+	conn, err := grpc.Dial(*addr, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	d := &dashboard{
+		addr: *addr,
+		log:  api.NewLogClient(conn),
+		it:   c.Tail(&api.ConsumeRequest{Position: api.ConsumeRequest_LATEST}),
+	}
+	defer d.it.Close()
+	go d.tail(context.Background())
+
+	log.Printf("serving the dashboard on %s", *httpAddr)
+	log.Fatal(http.ListenAndServe(*httpAddr, d))
+}
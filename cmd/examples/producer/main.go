@@ -0,0 +1,66 @@
+// Command producer is an example producer. It produces each line of stdin
+// as a record or, with -n, n generated records, and prints their offsets.
+//
+//	go run ./cmd/examples/producer --addr localhost:8400 -n 10
+//	tail -F app.log | go run ./cmd/examples/producer --addr localhost:8400
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8400", "RPC address of a server")
+	n := flag.Int("n", 0, "produce n generated records instead of stdin's lines")
+	flag.Parse()
+
+	c, err := client.New(*addr, client.Config{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	produce := func(value string) {
+		off, err := c.Produce(ctx, &api.Record{
+			Value:       []byte(value),
+			ContentType: "text/plain",
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d\t%s\n", off, value)
+	}
+
+	if *n > 0 {
+		for i := 0; i < *n && ctx.Err() == nil; i++ {
+			produce(fmt.Sprintf("record %d at %s", i, time.Now().Format(time.RFC3339Nano)))
+		}
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() && ctx.Err() == nil {
+		produce(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
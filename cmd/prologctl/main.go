@@ -0,0 +1,247 @@
+// Command prologctl is an operator CLI for prolog clusters.
+//
+//	prologctl export --addr localhost:8400 --from 0 --to 1000 --out records.jsonl
+//	prologctl grep --addr localhost:8400 --regex 'user [0-9]+' --header-match shard=1
+//	prologctl soak --addr localhost:8400 --duration 8h --kill-cmd 'docker restart prolog-1' --kill-every 10m
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/export"
+	"github.com/Tarunshrma/prolog/schema"
+	"github.com/Tarunshrma/prolog/soak"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "grep":
+		err = runGrep(os.Args[2:])
+	case "soak":
+		err = runSoak(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "prologctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: prologctl export|grep|soak [flags]")
+	os.Exit(2)
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8400", "RPC address of a server")
+	from := fs.Uint64("from", 0, "first offset to export")
+	to := fs.Uint64("to", 0, "offset to stop before")
+	format := fs.String("format", string(export.FormatJSONL), "file format: jsonl")
+	out := fs.String("out", "", "file to write, defaults to stdout")
+	schemas := fs.String("descriptor-sets", "", "comma separated protobuf file descriptor sets to decode typed values with")
+	_ = fs.Parse(args)
+
+	registry, err := loadRegistry(*schemas)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ew, err := export.NewWriter(w, export.Format(*format))
+	if err != nil {
+		return err
+	}
+	if jw, ok := ew.(*export.JSONLWriter); ok {
+		jw.Registry = registry
+	}
+
+	c, err := client.New(*addr, client.Config{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return export.Range(context.Background(), c, *from, *to, ew)
+}
+
+func runGrep(args []string) error {
+	fs := flag.NewFlagSet("grep", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8400", "RPC address of a server")
+	from := fs.Uint64("from", 0, "first offset to search")
+	to := fs.Uint64("to", 0, "offset to stop before, 0 for the end of the log")
+	since := fs.Duration("since", 0, "only search records appended in this long before now, 0 for all")
+	contains := fs.String("contains", "", "match values containing this")
+	regex := fs.String("regex", "", "match values matching this RE2 regular expression")
+	header := fs.String("header-match", "", "match records whose header has a value containing this, as name=value")
+	invert := fs.Bool("v", false, "match the records --contains and --regex don't")
+	schemas := fs.String("descriptor-sets", "", "comma separated protobuf file descriptor sets to decode typed values with")
+	_ = fs.Parse(args)
+
+	registry, err := loadRegistry(*schemas)
+	if err != nil {
+		return err
+	}
+
+	req := &api.SearchRecordsRequest{From: *from, To: *to}
+	if *since > 0 {
+		req.SinceUnixMs = time.Now().Add(-*since).UnixMilli()
+	}
+	if *contains != "" || *regex != "" {
+		req.Matchers = append(req.Matchers, &api.Matcher{
+			Contains: *contains,
+			Regex:    *regex,
+			Negate:   *invert,
+		})
+	}
+	if *header != "" {
+		name, value, ok := strings.Cut(*header, "=")
+		if !ok {
+			return fmt.Errorf("--header-match must be name=value, got %q", *header)
+		}
+		req.Matchers = append(req.Matchers, &api.Matcher{Header: name, Contains: value})
+	}
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log := api.NewLogClient(conn)
+
+	// Each search scans a bounded part of the window, so keep searching
+	// from where the last one stopped until the window's scanned.
+	w := export.NewJSONLWriter(os.Stdout)
+	w.Registry = registry
+	ctx := context.Background()
+	for {
+		res, err := log.SearchRecords(ctx, req)
+		if err != nil {
+			return err
+		}
+		for _, record := range res.Records {
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		if !res.HasMore {
+			return w.Close()
+		}
+		req.From = res.NextOffset
+	}
+}
+
+// loadRegistry returns a registry of the types linked into prologctl and
+// those in the comma separated file descriptor sets at paths.
+func loadRegistry(paths string) (*schema.Registry, error) {
+	registry := schema.NewRegistry()
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if err := registry.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func runSoak(args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8400", "RPC address of a server, or a proglog:// address of the cluster")
+	duration := fs.Duration("duration", time.Hour, "how long to produce for")
+	producers := fs.Int("producers", 4, "concurrent producers")
+	interval := fs.Duration("interval", 0, "pause between each producer's records")
+	recordBytes := fs.Int("record-bytes", 128, "size of each record's value")
+	verifyEvery := fs.Duration("verify-every", 10*time.Second, "how often to read back acknowledged records")
+	killCmd := fs.String("kill-cmd", "", "shell command that kills or restarts a node, run every --kill-every")
+	killEvery := fs.Duration("kill-every", 5*time.Minute, "how often to run --kill-cmd")
+	settle := fs.Duration("settle", time.Minute, "how long to wait for the cluster to serve every acknowledged record at the end")
+	_ = fs.Parse(args)
+
+	c, err := client.New(*addr, client.Config{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	config := soak.Config{
+		Duration:        *duration,
+		Producers:       *producers,
+		ProduceInterval: *interval,
+		RecordBytes:     *recordBytes,
+		VerifyInterval:  *verifyEvery,
+		SettleTimeout:   *settle,
+		Progress: func(r soak.Report) {
+			fmt.Fprintf(os.Stderr, "produced %d (%d errors), verified %d, %d violations\n",
+				r.Produced, r.ProduceErrors, r.Verified, len(r.Violations))
+		},
+	}
+	if *killCmd != "" {
+		config.DisruptInterval = *killEvery
+		config.Disrupt = func(ctx context.Context) error {
+			cmd := exec.CommandContext(ctx, "sh", "-c", *killCmd)
+			cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+			return cmd.Run()
+		}
+	}
+
+	// Interrupting stops producing early but still checks what was
+	// acknowledged.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := soak.Run(ctx, c, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("produced:       %d\n", report.Produced)
+	fmt.Printf("produce errors: %d\n", report.ProduceErrors)
+	fmt.Printf("verified:       %d\n", report.Verified)
+	fmt.Printf("consume errors: %d\n", report.ConsumeErrors)
+	fmt.Printf("disruptions:    %d (%d failed)\n", report.Disruptions, report.DisruptErrors)
+	for _, v := range report.Violations {
+		fmt.Println(v)
+	}
+	if n := len(report.Violations); n > 0 {
+		return fmt.Errorf("%d invariant violations", n)
+	}
+	return nil
+}
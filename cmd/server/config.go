@@ -0,0 +1,497 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/internal/budget"
+	tlsconfig "github.com/Tarunshrma/prolog/internal/config"
+	"github.com/Tarunshrma/prolog/internal/connect"
+	"github.com/Tarunshrma/prolog/internal/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Every flag can also be set with an environment variable, so the agent can
+// be configured entirely from env under docker-compose or Kubernetes. Flags
+// win over env vars.
+type config struct {
+	agent        bool
+	dev          bool
+	dataDir      string
+	bindAddr     string
+	rpcPort      int
+	nodeName     string
+	joinAddrs    string
+	discoveryDNS string
+	noReflection bool
+	replication  string
+	bootstrap    bool
+	otlp         bool
+	forwardAddr  string
+	statsdAddr   string
+	otlpMetrics  string
+	claimCheck   string
+	claimMin     int
+	segments     bool
+	segmentRate  int
+	standby      bool
+	flapFailures int
+	flapWindow   time.Duration
+	flapCooldown time.Duration
+	poisonSkip   bool
+	maxRecord    int
+	maxStreams   int
+	maxPerClient int
+	limits       string
+	workers      int
+	workerQueue  int
+	raftLogDir   string
+	orphans      string
+	checksums    bool
+	scrubEvery   time.Duration
+	scrubRate    int
+	retainAge    time.Duration
+	retainBytes  int
+	splitCheck   time.Duration
+	tlsCert      string
+	tlsKey       string
+	tlsCA        string
+	tlsAuth      string
+	aclFile      string
+	role         string
+	labels       string
+	clusterID    string
+	mirrorAddr   string
+	mirrorID     string
+	mirrorPolicy string
+	mirrorKey    string
+	truncPolicy  string
+	sinkTopic    string
+	sinkPart     int
+	stdoutSink   bool
+	webhookSink  string
+	s3Bucket     string
+	s3Endpoint   string
+	s3Region     string
+	s3Prefix     string
+	sourceTopic  string
+	sourcePart   int
+	filePaths    string
+	fileStart    bool
+	syslogUDP    string
+	syslogTCP    string
+	journald     bool
+	webUIAddr    string
+	schemas      string
+	cloudEvents  string
+	sessionWait  time.Duration
+}
+
+func parseFlags() config {
+	var c config
+	flag.BoolVar(&c.agent, "agent", envBool("PROLOG_AGENT", false),
+		"run a clustered agent [PROLOG_AGENT]")
+	flag.BoolVar(&c.dev, "dev", envBool("PROLOG_DEV", false),
+		"run a single-node agent for local development [PROLOG_DEV]")
+	flag.StringVar(&c.dataDir, "data-dir", envString("PROLOG_DATA_DIR", ""),
+		"directory to store log data in, dev mode defaults to a temp dir [PROLOG_DATA_DIR]")
+	flag.StringVar(&c.bindAddr, "bind-addr", envString("PROLOG_BIND_ADDR", defaultBindAddr()),
+		"address to bind serf on, its host is also advertised for RPC [PROLOG_BIND_ADDR]")
+	flag.IntVar(&c.rpcPort, "rpc-port", envInt("PROLOG_RPC_PORT", 8400),
+		"port for RPC clients, 0 picks a free port [PROLOG_RPC_PORT]")
+	flag.StringVar(&c.nodeName, "node-name", envString("PROLOG_NODE_NAME", defaultNodeName()),
+		"unique server ID, defaults to the hostname [PROLOG_NODE_NAME]")
+	flag.StringVar(&c.joinAddrs, "start-join-addrs", envString("PROLOG_START_JOIN_ADDRS", ""),
+		"comma separated serf addresses to join [PROLOG_START_JOIN_ADDRS]")
+	flag.StringVar(&c.discoveryDNS, "discovery-dns", envString("PROLOG_DISCOVERY_DNS", ""),
+		"DNS name, e.g. a headless service, resolving to peers to join [PROLOG_DISCOVERY_DNS]")
+	flag.BoolVar(&c.noReflection, "disable-reflection", envBool("PROLOG_DISABLE_REFLECTION", false),
+		"don't serve gRPC reflection [PROLOG_DISABLE_REFLECTION]")
+	flag.StringVar(&c.replication, "replication", envString("PROLOG_REPLICATION", ""),
+		"raft, gossip-replicator or none, defaults to none in dev mode and gossip-replicator otherwise [PROLOG_REPLICATION]")
+	flag.BoolVar(&c.bootstrap, "bootstrap", envBool("PROLOG_BOOTSTRAP", false),
+		"bootstrap a new raft cluster with this node as its first voter [PROLOG_BOOTSTRAP]")
+	flag.BoolVar(&c.otlp, "otlp", envBool("PROLOG_OTLP", false),
+		"accept OpenTelemetry OTLP/gRPC log exports on the RPC port [PROLOG_OTLP]")
+	flag.StringVar(&c.cloudEvents, "cloudevents", envString("PROLOG_CLOUDEVENTS", ""),
+		"binary or structured, to only take records that are CloudEvents and store them in that mode [PROLOG_CLOUDEVENTS]")
+	flag.DurationVar(&c.sessionWait, "session-timeout", envDuration("PROLOG_SESSION_TIMEOUT", 0),
+		"how long reads with a session token wait for this node to catch up with the session, defaults to 5s [PROLOG_SESSION_TIMEOUT]")
+	flag.StringVar(&c.forwardAddr, "fluent-forward-addr", envString("PROLOG_FLUENT_FORWARD_ADDR", ""),
+		"address to accept Fluentd and Fluent Bit's Forward protocol on, e.g. :24224 [PROLOG_FLUENT_FORWARD_ADDR]")
+	flag.StringVar(&c.statsdAddr, "metrics-statsd-addr", envString("PROLOG_METRICS_STATSD_ADDR", ""),
+		"statsd server to push metrics to over UDP [PROLOG_METRICS_STATSD_ADDR]")
+	flag.StringVar(&c.otlpMetrics, "metrics-otlp-addr", envString("PROLOG_METRICS_OTLP_ADDR", ""),
+		"OpenTelemetry collector to push metrics to over OTLP/gRPC [PROLOG_METRICS_OTLP_ADDR]")
+	flag.StringVar(&c.claimCheck, "claim-check-store", envString("PROLOG_CLAIM_CHECK_STORE", ""),
+		"file:// or http(s):// URL of a blob store to move large values to [PROLOG_CLAIM_CHECK_STORE]")
+	flag.IntVar(&c.claimMin, "claim-check-threshold", envInt("PROLOG_CLAIM_CHECK_THRESHOLD", 1<<20),
+		"size in bytes above which values are moved to the claim check store [PROLOG_CLAIM_CHECK_THRESHOLD]")
+	flag.BoolVar(&c.segments, "segment-transfer", envBool("PROLOG_SEGMENT_TRANSFER", false),
+		"have raft followers far behind fetch sealed segment files instead of replaying records [PROLOG_SEGMENT_TRANSFER]")
+	flag.IntVar(&c.segmentRate, "segment-transfer-rate", envInt("PROLOG_SEGMENT_TRANSFER_RATE", 0),
+		"bytes per second to serve segment transfers at, 0 doesn't throttle [PROLOG_SEGMENT_TRANSFER_RATE]")
+	flag.BoolVar(&c.standby, "standby", envBool("PROLOG_STANDBY", false),
+		"join a raft cluster as a warm standby that syncs the log outside the quorum [PROLOG_STANDBY]")
+	flag.IntVar(&c.flapFailures, "quarantine-failures", envInt("PROLOG_QUARANTINE_FAILURES", 0),
+		"with raft, quarantine members failing this often within the quarantine window, 0 doesn't quarantine [PROLOG_QUARANTINE_FAILURES]")
+	flag.DurationVar(&c.flapWindow, "quarantine-window", envDuration("PROLOG_QUARANTINE_WINDOW", 0),
+		"window member failures are counted in, defaults to 5m [PROLOG_QUARANTINE_WINDOW]")
+	flag.DurationVar(&c.flapCooldown, "quarantine-cooldown", envDuration("PROLOG_QUARANTINE_COOLDOWN", 0),
+		"how long members stay quarantined unless released, defaults to 10m [PROLOG_QUARANTINE_COOLDOWN]")
+	flag.BoolVar(&c.poisonSkip, "quarantine-entries", envBool("PROLOG_QUARANTINE_ENTRIES", false),
+		"with raft, record and skip replicated entries that fail to apply instead of failing replay [PROLOG_QUARANTINE_ENTRIES]")
+	flag.StringVar(&c.raftLogDir, "raft-log-dir", envString("PROLOG_RAFT_LOG_DIR", ""),
+		"directory to store the raft log in, e.g. on a faster disk, defaults to under the data dir [PROLOG_RAFT_LOG_DIR]")
+	flag.StringVar(&c.orphans, "orphan-policy", envString("PROLOG_ORPHAN_POLICY", ""),
+		"quarantine or remove files in the data dir no segment accounts for, defaults to quarantine [PROLOG_ORPHAN_POLICY]")
+	flag.BoolVar(&c.checksums, "record-checksums", envBool("PROLOG_RECORD_CHECKSUMS", false),
+		"store a checksum with each record, which reads and the scrubber verify [PROLOG_RECORD_CHECKSUMS]")
+	flag.DurationVar(&c.scrubEvery, "scrub-interval", envDuration("PROLOG_SCRUB_INTERVAL", 0),
+		"how often to reread sealed segments for disk corruption, 0 doesn't [PROLOG_SCRUB_INTERVAL]")
+	flag.IntVar(&c.scrubRate, "scrub-rate", envInt("PROLOG_SCRUB_RATE", 0),
+		"bytes per second to scrub at, 0 doesn't throttle [PROLOG_SCRUB_RATE]")
+	flag.DurationVar(&c.retainAge, "retention-max-age", envDuration("PROLOG_RETENTION_MAX_AGE", 0),
+		"remove segments whose records are older than this, 0 keeps them [PROLOG_RETENTION_MAX_AGE]")
+	flag.IntVar(&c.retainBytes, "retention-max-bytes", envInt("PROLOG_RETENTION_MAX_BYTES", 0),
+		"remove the oldest segments while the log is larger than this, 0 doesn't bound it [PROLOG_RETENTION_MAX_BYTES]")
+	flag.DurationVar(&c.splitCheck, "split-brain-check-interval", envDuration("PROLOG_SPLIT_BRAIN_CHECK_INTERVAL", 0),
+		"with raft, how often to check members agree on the leader, defaults to 10s, negative doesn't check [PROLOG_SPLIT_BRAIN_CHECK_INTERVAL]")
+	flag.StringVar(&c.tlsCert, "tls-cert-file", envString("PROLOG_TLS_CERT_FILE", ""),
+		"PEM certificate to serve gRPC over TLS with and present to peers, plaintext without one [PROLOG_TLS_CERT_FILE]")
+	flag.StringVar(&c.tlsKey, "tls-key-file", envString("PROLOG_TLS_KEY_FILE", ""),
+		"PEM key of the TLS certificate [PROLOG_TLS_KEY_FILE]")
+	flag.StringVar(&c.tlsCA, "tls-ca-file", envString("PROLOG_TLS_CA_FILE", ""),
+		"PEM CA bundle to verify clients' and peers' certificates against [PROLOG_TLS_CA_FILE]")
+	flag.StringVar(&c.tlsAuth, "tls-client-auth", envString("PROLOG_TLS_CLIENT_AUTH", ""),
+		"none, request or require, defaults to require with a CA and none without [PROLOG_TLS_CLIENT_AUTH]")
+	flag.StringVar(&c.aclFile, "acl-file", envString("PROLOG_ACL_FILE", ""),
+		"policy file of subject,action lines granting clients, by certificate common name, produce or consume [PROLOG_ACL_FILE]")
+	flag.IntVar(&c.maxRecord, "max-record-bytes", envInt("PROLOG_MAX_RECORD_BYTES", 0),
+		"largest record to accept, gRPC message limits grow to fit it, defaults to 64MiB [PROLOG_MAX_RECORD_BYTES]")
+	flag.IntVar(&c.maxStreams, "max-streams", envInt("PROLOG_MAX_STREAMS", 0),
+		"most consume and produce streams to serve at once, 0 is unlimited [PROLOG_MAX_STREAMS]")
+	flag.IntVar(&c.maxPerClient, "max-streams-per-client", envInt("PROLOG_MAX_STREAMS_PER_CLIENT", 0),
+		"most consume and produce streams one client may open at once, 0 is unlimited [PROLOG_MAX_STREAMS_PER_CLIENT]")
+	flag.IntVar(&c.workers, "workers", envInt("PROLOG_WORKERS", 0),
+		"most produce and consume requests to work on at once, 0 is unbounded [PROLOG_WORKERS]")
+	flag.IntVar(&c.workerQueue, "worker-queue", envInt("PROLOG_WORKER_QUEUE", 0),
+		"most requests to queue for a worker before refusing them, 0 is unbounded [PROLOG_WORKER_QUEUE]")
+	flag.StringVar(&c.limits, "resource-limits", envString("PROLOG_RESOURCE_LIMITS", ""),
+		"comma separated soft limits, e.g. consume_streams=1000,replication_goroutines=64 [PROLOG_RESOURCE_LIMITS]")
+	flag.StringVar(&c.role, "role", envString("PROLOG_ROLE", ""),
+		"storage, ingest or edge, defaults to serving everything [PROLOG_ROLE]")
+	flag.StringVar(&c.labels, "labels", envString("PROLOG_LABELS", ""),
+		"comma separated labels to advertise to the cluster, e.g. zone=a,rack=3 [PROLOG_LABELS]")
+	flag.StringVar(&c.clusterID, "cluster-id", envString("PROLOG_CLUSTER_ID", ""),
+		"ID of this cluster, stamped on the records mirrored from it [PROLOG_CLUSTER_ID]")
+	flag.StringVar(&c.mirrorAddr, "mirror-addr", envString("PROLOG_MIRROR_ADDR", ""),
+		"RPC address of another cluster to mirror the log to [PROLOG_MIRROR_ADDR]")
+	flag.StringVar(&c.mirrorID, "mirror-cluster-id", envString("PROLOG_MIRROR_CLUSTER_ID", ""),
+		"ID of the cluster mirrored to, whose records aren't mirrored back to it [PROLOG_MIRROR_CLUSTER_ID]")
+	flag.StringVar(&c.mirrorPolicy, "mirror-conflict-policy", envString("PROLOG_MIRROR_CONFLICT_POLICY", string(connect.SourceWins)),
+		"source-wins or timestamp-wins, for records both clusters wrote the same key of [PROLOG_MIRROR_CONFLICT_POLICY]")
+	flag.StringVar(&c.mirrorKey, "mirror-key-header", envString("PROLOG_MIRROR_KEY_HEADER", ""),
+		"header holding the key timestamp-wins compares records' writes of [PROLOG_MIRROR_KEY_HEADER]")
+	flag.StringVar(&c.truncPolicy, "connector-truncation-policy", envString("PROLOG_CONNECTOR_TRUNCATION_POLICY", string(client.TruncationFail)),
+		"fail or skip-to-earliest, for connectors whose undelivered records were truncated [PROLOG_CONNECTOR_TRUNCATION_POLICY]")
+	flag.StringVar(&c.sinkTopic, "sink-topic", envString("PROLOG_SINK_TOPIC", ""),
+		"topic the stdout, webhook and S3 sinks copy a partition of, the default log if empty [PROLOG_SINK_TOPIC]")
+	flag.IntVar(&c.sinkPart, "sink-partition", envInt("PROLOG_SINK_PARTITION", 0),
+		"partition of the sink topic the sinks copy [PROLOG_SINK_PARTITION]")
+	flag.BoolVar(&c.stdoutSink, "stdout-sink", envBool("PROLOG_STDOUT_SINK", false),
+		"print the log's records to stdout as JSON lines [PROLOG_STDOUT_SINK]")
+	flag.StringVar(&c.webhookSink, "webhook-sink-url", envString("PROLOG_WEBHOOK_SINK_URL", ""),
+		"URL to POST each of the log's records to as JSON [PROLOG_WEBHOOK_SINK_URL]")
+	flag.StringVar(&c.s3Bucket, "s3-sink-bucket", envString("PROLOG_S3_SINK_BUCKET", ""),
+		"S3 bucket to upload each of the log's records to, with credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY [PROLOG_S3_SINK_BUCKET]")
+	flag.StringVar(&c.s3Endpoint, "s3-sink-endpoint", envString("PROLOG_S3_SINK_ENDPOINT", ""),
+		"URL of the S3 compatible store, defaults to AWS's in the region [PROLOG_S3_SINK_ENDPOINT]")
+	flag.StringVar(&c.s3Region, "s3-sink-region", envString("PROLOG_S3_SINK_REGION", envString("AWS_REGION", "us-east-1")),
+		"region of the S3 bucket, defaults to AWS_REGION or us-east-1 [PROLOG_S3_SINK_REGION]")
+	flag.StringVar(&c.s3Prefix, "s3-sink-prefix", envString("PROLOG_S3_SINK_PREFIX", ""),
+		"prefix of the keys of the objects uploaded to the S3 bucket [PROLOG_S3_SINK_PREFIX]")
+	flag.StringVar(&c.sourceTopic, "source-topic", envString("PROLOG_SOURCE_TOPIC", ""),
+		"topic the file, syslog and journald sources produce to a partition of, the default log if empty [PROLOG_SOURCE_TOPIC]")
+	flag.IntVar(&c.sourcePart, "source-partition", envInt("PROLOG_SOURCE_PARTITION", 0),
+		"partition of the source topic the sources produce to [PROLOG_SOURCE_PARTITION]")
+	flag.StringVar(&c.filePaths, "file-source-paths", envString("PROLOG_FILE_SOURCE_PATHS", ""),
+		"comma separated files to tail, following rotation, producing each line [PROLOG_FILE_SOURCE_PATHS]")
+	flag.BoolVar(&c.fileStart, "file-source-from-start", envBool("PROLOG_FILE_SOURCE_FROM_START", false),
+		"tail files from their start rather than their end [PROLOG_FILE_SOURCE_FROM_START]")
+	flag.StringVar(&c.syslogUDP, "syslog-source-udp-addr", envString("PROLOG_SYSLOG_SOURCE_UDP_ADDR", ""),
+		"address to receive syslog messages on over UDP, e.g. :514 [PROLOG_SYSLOG_SOURCE_UDP_ADDR]")
+	flag.StringVar(&c.syslogTCP, "syslog-source-tcp-addr", envString("PROLOG_SYSLOG_SOURCE_TCP_ADDR", ""),
+		"address to receive syslog messages on over TCP, one per line [PROLOG_SYSLOG_SOURCE_TCP_ADDR]")
+	flag.BoolVar(&c.journald, "journald-source", envBool("PROLOG_JOURNALD_SOURCE", false),
+		"follow the systemd journal through journalctl, producing each entry as JSON [PROLOG_JOURNALD_SOURCE]")
+	flag.StringVar(&c.webUIAddr, "web-ui-addr", envString("PROLOG_WEB_UI_ADDR", ""),
+		"address to serve the web admin UI on, e.g. :8080; it has no authentication [PROLOG_WEB_UI_ADDR]")
+	flag.StringVar(&c.schemas, "schema-descriptor-sets", envString("PROLOG_SCHEMA_DESCRIPTOR_SETS", ""),
+		"comma separated protobuf file descriptor sets the web UI decodes typed record values with [PROLOG_SCHEMA_DESCRIPTOR_SETS]")
+	flag.Parse()
+	return c
+}
+
+// quarantine returns the member quarantine the flags describe.
+func (c config) quarantine() discovery.QuarantineConfig {
+	return discovery.QuarantineConfig{
+		Failures: c.flapFailures,
+		Window:   c.flapWindow,
+		Cooldown: c.flapCooldown,
+	}
+}
+
+// tls returns the TLS config the flags describe.
+func (c config) tls() tlsconfig.TLSConfig {
+	return tlsconfig.TLSConfig{
+		CertFile:   c.tlsCert,
+		KeyFile:    c.tlsKey,
+		CAFile:     c.tlsCA,
+		ClientAuth: tlsconfig.ClientAuth(c.tlsAuth),
+	}
+}
+
+func (c config) startJoinAddrs() []string {
+	var addrs []string
+	for _, addr := range strings.Split(c.joinAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// resourceLimits parses the resource limits flag.
+func (c config) resourceLimits() (map[budget.Resource]int64, error) {
+	limits := make(map[budget.Resource]int64)
+	for _, limit := range strings.Split(c.limits, ",") {
+		if limit = strings.TrimSpace(limit); limit == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(limit, "=")
+		if !ok {
+			return nil, fmt.Errorf("resource limit %q isn't name=value", limit)
+		}
+		r := budget.Resource(name)
+		if !slices.Contains(budget.Resources, r) {
+			return nil, fmt.Errorf("unknown resource %q", name)
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("resource limit %q: %w", limit, err)
+		}
+		limits[r] = n
+	}
+	return limits, nil
+}
+
+// mirror returns the connector mirroring the log to another cluster, if
+// one is configured.
+func (c config) mirror() (*connect.Mirror, error) {
+	if c.mirrorAddr == "" {
+		return nil, nil
+	}
+	if c.clusterID == "" || c.mirrorID == "" {
+		return nil, fmt.Errorf("mirroring needs both clusters' IDs")
+	}
+	policy := connect.ConflictPolicy(c.mirrorPolicy)
+	if policy != connect.SourceWins && policy != connect.TimestampWins {
+		return nil, fmt.Errorf("unknown mirror conflict policy %q", c.mirrorPolicy)
+	}
+	target, err := client.New(c.mirrorAddr, client.Config{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+		MaxRecordBytes: uint64(c.maxRecord),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &connect.Mirror{
+		Cluster:   c.clusterID,
+		Target:    c.mirrorID,
+		Client:    target,
+		Policy:    policy,
+		KeyHeader: c.mirrorKey,
+	}, nil
+}
+
+// sinks returns the stdout, webhook and S3 sink connectors the flags
+// configure, reading the sink topic's partition.
+func (c config) sinks() ([]connect.Connector, error) {
+	var sinks []connect.Connector
+	if c.stdoutSink {
+		sinks = append(sinks, connect.Connector{
+			Name: "stdout",
+			Sink: connect.NewWriterSink(os.Stdout),
+		})
+	}
+	if c.webhookSink != "" {
+		sinks = append(sinks, connect.Connector{
+			Name: "webhook",
+			Sink: &connect.WebhookSink{URL: c.webhookSink},
+		})
+	}
+	if c.s3Bucket != "" {
+		id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("the S3 sink needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		endpoint := c.s3Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", c.s3Region)
+		}
+		sinks = append(sinks, connect.Connector{
+			Name: "s3-" + c.s3Bucket,
+			Sink: &connect.S3Sink{
+				Endpoint:        endpoint,
+				Region:          c.s3Region,
+				Bucket:          c.s3Bucket,
+				Prefix:          c.s3Prefix,
+				AccessKeyID:     id,
+				SecretAccessKey: secret,
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			},
+		})
+	}
+	for i := range sinks {
+		sinks[i].Topic, sinks[i].Partition = c.sinkTopic, uint32(c.sinkPart)
+	}
+	return sinks, nil
+}
+
+// sources returns the file, syslog and journald source connectors the flags
+// configure, producing to the source topic's partition.
+func (c config) sources() []connect.Connector {
+	var sources []connect.Connector
+	for _, path := range strings.Split(c.filePaths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			sources = append(sources, connect.Connector{
+				Name:   "file-" + path,
+				Source: &connect.FileSource{Path: path, FromStart: c.fileStart},
+			})
+		}
+	}
+	if c.syslogUDP != "" {
+		sources = append(sources, connect.Connector{
+			Name:   "syslog-udp",
+			Source: &connect.SyslogSource{Network: "udp", Addr: c.syslogUDP},
+		})
+	}
+	if c.syslogTCP != "" {
+		sources = append(sources, connect.Connector{
+			Name:   "syslog-tcp",
+			Source: &connect.SyslogSource{Network: "tcp", Addr: c.syslogTCP},
+		})
+	}
+	if c.journald {
+		sources = append(sources, connect.Connector{
+			Name:   "journald",
+			Source: &connect.JournaldSource{},
+		})
+	}
+	for i := range sources {
+		sources[i].Topic, sources[i].Partition = c.sourceTopic, uint32(c.sourcePart)
+	}
+	return sources
+}
+
+// truncationPolicy parses the connector truncation policy flag.
+func (c config) truncationPolicy() (client.TruncationPolicy, error) {
+	policy := client.TruncationPolicy(c.truncPolicy)
+	if policy != client.TruncationFail && policy != client.TruncationSkip {
+		return "", fmt.Errorf("unknown connector truncation policy %q", c.truncPolicy)
+	}
+	return policy, nil
+}
+
+// nodeLabels parses the labels flag.
+func (c config) nodeLabels() (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range strings.Split(c.labels, ",") {
+		if label = strings.TrimSpace(label); label == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q isn't key=value", label)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// schemaDescriptorSets parses the schema descriptor sets flag.
+func (c config) schemaDescriptorSets() []string {
+	var paths []string
+	for _, path := range strings.Split(c.schemas, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func envBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// defaultNodeName names the node after its hostname, which is unique per
+// container and stable per Kubernetes StatefulSet pod.
+func defaultNodeName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "prolog"
+	}
+	return hostname
+}
+
+// defaultBindAddr binds to the address the hostname resolves to, which
+// peers can reach in a container network, falling back to loopback.
+func defaultBindAddr() string {
+	host := "127.0.0.1"
+	if hostname, err := os.Hostname(); err == nil {
+		if ips, err := net.LookupIP(hostname); err == nil {
+			for _, ip := range ips {
+				if ip.To4() != nil && !ip.IsLoopback() {
+					host = ip.String()
+					break
+				}
+			}
+		}
+	}
+	return net.JoinHostPort(host, "8401")
+}
@@ -1,13 +1,142 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Tarunshrma/prolog/internal/agent"
+	"github.com/Tarunshrma/prolog/internal/connect"
 	"github.com/Tarunshrma/prolog/internal/server"
 )
 
 func main() {
-	// This is the main entry point for the application
-	// It should start the HTTP server and listen for requests
+	c := parseFlags()
+
+	if !c.agent && !c.dev {
+		// This is the main entry point for the application
+		// It should start the HTTP server and listen for requests
+
+		srv := server.NewHttpServer(":8080")
+		srv.ListenAndServe()
+		return
+	}
+
+	if c.dev && c.dataDir == "" {
+		dir, err := ioutil.TempDir("", "prolog-dev")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		c.dataDir = dir
+	}
+
+	var connectors []connect.Connector
+	if c.forwardAddr != "" {
+		connectors = append(connectors, connect.Connector{
+			Name:   "fluent-forward",
+			Source: &connect.ForwardSource{Addr: c.forwardAddr},
+		})
+	}
+	mirror, err := c.mirror()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if mirror != nil {
+		connectors = append(connectors, connect.Connector{
+			Name: "mirror-" + mirror.Target,
+			Sink: mirror,
+		})
+	}
+
+	sinks, err := c.sinks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	connectors = append(connectors, sinks...)
+	connectors = append(connectors, c.sources()...)
+
+	limits, err := c.resourceLimits()
+	if err != nil {
+		log.Fatal(err)
+	}
+	labels, err := c.nodeLabels()
+	if err != nil {
+		log.Fatal(err)
+	}
+	truncation, err := c.truncationPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a, err := agent.New(agent.Config{
+		DataDir:                   c.dataDir,
+		BindAddr:                  c.bindAddr,
+		RPCPort:                   c.rpcPort,
+		NodeName:                  c.nodeName,
+		StartJoinAddrs:            c.startJoinAddrs(),
+		DiscoveryDNS:              c.discoveryDNS,
+		Dev:                       c.dev,
+		DisableReflection:         c.noReflection,
+		Replication:               agent.Replication(c.replication),
+		Bootstrap:                 c.bootstrap,
+		OTLP:                      c.otlp,
+		Connectors:                connectors,
+		ConnectorTruncationPolicy: truncation,
+		MetricsStatsdAddr:         c.statsdAddr,
+		MetricsOTLPAddr:           c.otlpMetrics,
+		ClaimCheckStore:           c.claimCheck,
+		ClaimCheckThreshold:       c.claimMin,
+		SegmentTransfer:           c.segments,
+		SegmentTransferRate:       int64(c.segmentRate),
+		Standby:                   c.standby,
+		MemberQuarantine:          c.quarantine(),
+		QuarantineEntries:         c.poisonSkip,
+		RaftLogDir:                c.raftLogDir,
+		OrphanPolicy:              c.orphans,
+		RecordChecksums:           c.checksums,
+		ScrubInterval:             c.scrubEvery,
+		ScrubRate:                 int64(c.scrubRate),
+		RetentionMaxAge:           c.retainAge,
+		RetentionMaxBytes:         uint64(c.retainBytes),
+		SplitBrainCheckInterval:   c.splitCheck,
+		TLS:                       c.tls(),
+		ACLFile:                   c.aclFile,
+		MaxRecordBytes:            uint64(c.maxRecord),
+		MaxStreams:                c.maxStreams,
+		MaxStreamsPerClient:       c.maxPerClient,
+		ResourceLimits:            limits,
+		Workers:                   c.workers,
+		WorkerQueue:               c.workerQueue,
+		Role:                      server.Role(c.role),
+		CloudEvents:               server.CloudEventsMode(c.cloudEvents),
+		SessionTimeout:            c.sessionWait,
+		Labels:                    labels,
+		WebUIAddr:                 c.webUIAddr,
+		SchemaDescriptorSets:      c.schemaDescriptorSets(),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rpcAddr, err := a.Config.RPCAddr()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.dev {
+		fmt.Printf("prolog dev agent ready at %s (data in %s)\n", rpcAddr, c.dataDir)
+	} else {
+		fmt.Printf("prolog agent %s serving at %s\n", c.nodeName, rpcAddr)
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	<-sigc
 
-	srv := server.NewHttpServer(":8080")
-	srv.ListenAndServe()
+	if err := a.Shutdown(); err != nil {
+		log.Fatal(err)
+	}
 }
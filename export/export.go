@@ -0,0 +1,124 @@
+// Package export writes ranges of the log to files that warehouses and
+// batch jobs can ingest without running a consumer.
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/schema"
+)
+
+// Format is a file format records can be exported to.
+type Format string
+
+const (
+	// FormatJSONL writes one JSON object per record and line.
+	FormatJSONL Format = "jsonl"
+)
+
+// Writer writes exported records to a file.
+type Writer interface {
+	Write(*api.Record) error
+	// Close flushes buffered records. It doesn't close the underlying
+	// io.Writer.
+	Close() error
+}
+
+// NewWriter returns a Writer that writes records to w in format.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatJSONL:
+		return NewJSONLWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// Range exports the records from offset from up to, but not including, to
+// through w.
+func Range(ctx context.Context, c *client.Client, from, to uint64, w Writer) error {
+	err := c.ConsumeRange(ctx, from, to, func(ctx context.Context, record *api.Record) error {
+		return w.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// JSONLWriter writes each record as a JSON object on its own line:
+//
+//	{"offset":0,"term":1,"content_type":"application/json","value":{"id":1}}
+//
+// Values are written decoded from their content encoding. Those whose media
+// type is application/json are written as JSON; other values are written as
+// base64 strings, along with their content encoding if it couldn't be
+// decoded, except for protobuf Any values whose types the Registry knows,
+// which are written as JSON with their type URLs under "@type".
+type JSONLWriter struct {
+	// Registry, if set, resolves the types of protobuf Any values.
+	Registry *schema.Registry
+
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	buf := bufio.NewWriter(w)
+	return &JSONLWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+type jsonlRecord struct {
+	Offset          uint64            `json:"offset"`
+	Term            uint64            `json:"term,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Value           json.RawMessage   `json:"value"`
+}
+
+func (w *JSONLWriter) Write(record *api.Record) error {
+	var encoding string
+	raw, err := record.DecodedValue()
+	if err != nil {
+		raw, encoding = record.Value, record.ContentEncoding
+	}
+	value := json.RawMessage(raw)
+	if b, ok := w.typed(record); ok {
+		value = b
+	} else if encoding != "" || record.MediaType() != "application/json" || !json.Valid(raw) {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		value = b
+	}
+
+	return w.enc.Encode(jsonlRecord{
+		Offset:          record.Offset,
+		Term:            record.Term,
+		Headers:         record.Headers,
+		ContentType:     record.ContentType,
+		ContentEncoding: encoding,
+		Value:           value,
+	})
+}
+
+// typed renders record's value as JSON if it's a protobuf Any of a type the
+// Registry knows.
+func (w *JSONLWriter) typed(record *api.Record) (json.RawMessage, bool) {
+	if w.Registry == nil || record.MediaType() != api.ContentTypeProtobufAny {
+		return nil, false
+	}
+	b, err := w.Registry.JSON(record)
+	return b, err == nil
+}
+
+func (w *JSONLWriter) Close() error {
+	return w.buf.Flush()
+}
@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/schema"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatJSONL)
+	require.NoError(t, err)
+
+	records := []*api.Record{
+		{
+			Offset:  0,
+			Term:    1,
+			Headers: map[string]string{api.HeaderContentType: "application/json"},
+			Value:   []byte(`{"id":1}`),
+		},
+		{Offset: 1, Value: []byte("hello")},
+		{
+			Offset:          2,
+			ContentType:     "application/json",
+			ContentEncoding: api.ContentEncodingGzip,
+			Value:           gzipped(t, `{"id":2}`),
+		},
+		{Offset: 3, ContentEncoding: "br", Value: []byte("hello")},
+	}
+	for _, record := range records {
+		require.NoError(t, w.Write(record))
+	}
+	require.NoError(t, w.Close())
+
+	require.Equal(t, `{"offset":0,"term":1,"headers":{"content-type":"application/json"},"value":{"id":1}}
+{"offset":1,"value":"aGVsbG8="}
+{"offset":2,"content_type":"application/json","value":{"id":2}}
+{"offset":3,"content_encoding":"br","value":"aGVsbG8="}
+`, buf.String())
+
+	// Typed values whose types the registry knows are written as JSON.
+	buf.Reset()
+	jw := NewJSONLWriter(&buf)
+	record, err := schema.NewRecord(wrapperspb.String("hello"))
+	require.NoError(t, err)
+	require.NoError(t, jw.Write(record))
+	jw.Registry = schema.NewRegistry()
+	require.NoError(t, jw.Write(record))
+	require.NoError(t, jw.Close())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.NotContains(t, lines[0], "@type")
+	require.Contains(t, lines[1], `"value":{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hello"}`)
+
+	_, err = NewWriter(&buf, "parquet")
+	require.Error(t, err)
+}
+
+func gzipped(t *testing.T, value string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(value))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
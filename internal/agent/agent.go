@@ -1,25 +1,68 @@
 package agent
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/internal/blob"
+	"github.com/Tarunshrma/prolog/internal/budget"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/Tarunshrma/prolog/internal/config"
+	"github.com/Tarunshrma/prolog/internal/connect"
 	"github.com/Tarunshrma/prolog/internal/discovery"
 	"github.com/Tarunshrma/prolog/internal/log"
+	"github.com/Tarunshrma/prolog/internal/metrics"
 	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/Tarunshrma/prolog/internal/webui"
+	"github.com/Tarunshrma/prolog/schema"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 type Agent struct {
 	Config
 
+	replication Replication
+	// id is the node's ID, persisted in DataDir, which Raft and serf
+	// members know it by.
+	id         string
+	mux        *mux
 	log        *log.Log
+	raft       *log.DistributedLog
+	topics     *log.Topics
+	forwarder  *forwarder
+	lifecycle  *server.Lifecycle
+	startup    *startup
 	server     *grpc.Server
 	membeship  *discovery.Membership
 	replicator *log.Replicator
+	connectors *connect.Runtime
+	webUI      *http.Server
+	metrics    *metrics.Registry
+	budget     *budget.Budget
+	pushers    []metrics.Pusher
+	stopPush   context.CancelFunc
+	// splitBrain fences produces while the node is on the minority side of
+	// a split brain, and splitBrained is whether one was last detected.
+	splitBrain   *server.SplitBrainGuard
+	splitBrained atomic.Bool
+	// serverTLS and peerTLS, if Config.TLS has a certificate, are what the
+	// agent serves gRPC with and dials its peers with.
+	serverTLS *tls.Config
+	peerTLS   *tls.Config
 
 	shutdown     bool
 	shutdowns    chan struct{}
@@ -32,6 +75,148 @@ type Config struct {
 	RPCPort        int
 	NodeName       string
 	StartJoinAddrs []string
+	// Dev runs a single node without membership or replication, serving
+	// the local log directly. It's meant for local development and
+	// examples, not production.
+	Dev bool
+	// DiscoveryDNS, if set, is resolved at startup, e.g. to a Kubernetes
+	// headless service, and every peer it resolves to is joined on the
+	// serf port in addition to StartJoinAddrs.
+	DiscoveryDNS string
+	// DisableReflection turns off the gRPC reflection service.
+	DisableReflection bool
+	// Replication picks how records are replicated between nodes. It
+	// defaults to ReplicationNone in dev mode and ReplicationGossip
+	// otherwise.
+	Replication Replication
+	// Bootstrap, with Raft replication, bootstraps a new cluster with this
+	// node as its only voter. Only the first node of a cluster sets it.
+	Bootstrap bool
+	// Connectors are hosted by the agent. Sinks copy the log out from the
+	// last record they delivered, which they commit as consumer groups;
+	// sources produce what they read into it.
+	Connectors []connect.Connector
+	// ConnectorTruncationPolicy is what sinks do when records they haven't
+	// delivered were truncated from the log. Defaults to failing, which
+	// retries until an operator intervenes; losses are logged either way.
+	ConnectorTruncationPolicy client.TruncationPolicy
+	// OTLP accepts OpenTelemetry log exports over OTLP/gRPC on the RPC port.
+	OTLP bool
+	// CloudEvents, if set, has the server only take records that are
+	// CloudEvents and store them in its mode, see server.CloudEventsMode.
+	CloudEvents server.CloudEventsMode
+	// SessionTimeout is how long reads with a session token wait for the
+	// node to catch up with the session, see server.Config.SessionTimeout.
+	SessionTimeout time.Duration
+	// MetricsStatsdAddr and MetricsOTLPAddr, if set, are a statsd server and
+	// an OTLP/gRPC collector the agent pushes its metrics to, for
+	// environments where nothing can scrape it.
+	MetricsStatsdAddr string
+	MetricsOTLPAddr   string
+	// MetricsPushInterval is how often metrics are pushed. Defaults to 10s.
+	MetricsPushInterval time.Duration
+	// MaxRecordBytes bounds the records the agent accepts and stores.
+	// Defaults to the log's 64MiB.
+	MaxRecordBytes uint64
+	// MaxStreamsPerClient and MaxStreams cap the ConsumeStream and
+	// ProduceStream calls one client, and the whole agent, may have open
+	// at once. Zero is unlimited.
+	MaxStreamsPerClient int
+	MaxStreams          int
+	// Workers, if set, bounds how many produce and consume requests,
+	// including each record of a stream, the agent works on at once.
+	// WorkerQueue bounds how many more may wait for a worker; beyond it
+	// requests fail with a ResourceExhausted status. Zero is unbounded.
+	Workers     int
+	WorkerQueue int
+	// ResourceLimits are soft limits on the resources the agent's
+	// subsystems use, reported as budget_* metrics. Over a limit, new
+	// ConsumeStreams and peers to replicate are refused; memory is only
+	// reported. Resources without a limit are unlimited.
+	ResourceLimits map[budget.Resource]int64
+	// ClaimCheckStore, if set, is the URL of a blob store, see blob.Open,
+	// that values larger than ClaimCheckThreshold bytes are moved to, with
+	// the log keeping a claim check pointing at them. Every node must use
+	// the same store. ClaimCheckThreshold defaults to 1MiB.
+	ClaimCheckStore     string
+	ClaimCheckThreshold int
+	// SegmentTransfer, with Raft replication, has followers that fall far
+	// behind fetch sealed segment files from a replica instead of
+	// replaying every record. Every node must enable it before any node
+	// takes a snapshot with it. SegmentTransferRate throttles the segments
+	// this node serves, in bytes per second; zero doesn't throttle.
+	SegmentTransfer     bool
+	SegmentTransferRate int64
+	// Standby, with Raft replication, joins the cluster as a warm standby:
+	// the log is replicated to it, but it isn't part of the quorum until
+	// it's promoted through the Admin service's PromoteStandby.
+	Standby bool
+	// MemberQuarantine, with Raft replication, quarantines members that
+	// fail too often too quickly: the leader rejoins them as nonvoters
+	// until the cooldown passes or the Admin service's ReleaseMember
+	// releases them, so a flapping node doesn't churn elections.
+	MemberQuarantine discovery.QuarantineConfig
+	// QuarantineEntries, with Raft replication, has the log record and
+	// skip replicated entries that fail to apply instead of failing the
+	// apply, so one poison entry can't wedge replay. The Admin service's
+	// ListQuarantined lists them. See log.Config.
+	QuarantineEntries bool
+	// RaftLogDir, with Raft replication, stores the Raft log apart from
+	// the records, e.g. on a faster disk. See log.Config.
+	RaftLogDir string
+	// RecordChecksums stores a checksum with each record, which reads and
+	// the scrubber verify. ScrubInterval, if set, has the log rescrub its
+	// sealed segments that often, reading them at ScrubRate bytes per
+	// second, or unthrottled if it's zero, to find latent disk corruption.
+	// See log.Config.
+	RecordChecksums bool
+	ScrubInterval   time.Duration
+	ScrubRate       int64
+	// OrphanPolicy is what the log does with orphaned files it finds in
+	// the data dir when it opens, "quarantine" or "remove". See
+	// log.Config.
+	OrphanPolicy string
+	// RetentionMaxAge and RetentionMaxBytes, if set, have the log remove
+	// its oldest segments once their records are that old, or while it's
+	// that large. See log.Config.
+	RetentionMaxAge   time.Duration
+	RetentionMaxBytes uint64
+	// TLS, if it has a certificate, serves gRPC over TLS, verifying
+	// clients' certificates against its CA as its ClientAuth says, and
+	// dials peers presenting the same certificate. Its Server field is
+	// ignored.
+	TLS config.TLSConfig
+	// ACLFile, if set, is a policy file granting clients, by their
+	// certificates' common names, produce and consume. See server.LoadACL.
+	// Peers may call every RPC.
+	ACLFile string
+	// SplitBrainCheckInterval, with Raft replication, is how often the
+	// agent asks the cluster's members which node leads it. If they name
+	// more than one, it raises the split_brain metric and, on the minority
+	// side, refuses produces until they agree again. Defaults to 10s;
+	// negative disables the check.
+	SplitBrainCheckInterval time.Duration
+	// WebUIAddr, if set, is the address the agent serves its web admin UI
+	// on, see the webui package. It has no authentication, so it should
+	// only be reachable by operators.
+	WebUIAddr string
+	// SchemaDescriptorSets are protobuf file descriptor sets the web UI
+	// decodes typed record values with, see the schema package.
+	SchemaDescriptorSets []string
+	// Role decides what the node does for clients: storage nodes serve
+	// only their peers, ingest nodes only take produces, and edge nodes
+	// hold no log and forward what's produced to them to nodes that do.
+	// It's advertised to the cluster in the node's membership tags.
+	// Defaults to server.RoleAll, which serves everything.
+	Role server.Role
+	// Labels are advertised to the cluster in the node's membership tags,
+	// under discovery.TagLabelPrefix, e.g. to tell operators which zone or
+	// rack it runs in.
+	Labels map[string]string
+	// Clock times the log's and server's timeouts and how long the agent
+	// waits for RPCs to finish when it shuts down, so tests can advance it
+	// instead of sleeping. Defaults to the system clock.
+	Clock clock.Clock
 }
 
 func (c Config) RPCAddr() (string, error) {
@@ -43,16 +228,43 @@ func (c Config) RPCAddr() (string, error) {
 }
 
 func New(config Config) (*Agent, error) {
+	replication, err := config.replication()
+	if err != nil {
+		return nil, err
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
 	a := &Agent{
-		Config:    config,
-		shutdowns: make(chan struct{}),
+		Config:      config,
+		replication: replication,
+		lifecycle:   &server.Lifecycle{},
+		metrics:     metrics.NewRegistry(),
+		budget:      budget.New(config.ResourceLimits),
+		shutdowns:   make(chan struct{}),
 	}
+	a.budget.Register(a.metrics)
+	a.startup = newStartup(a.lifecycle)
 
 	setup := []func() error{
 		a.setupLogger,
+		a.setupNodeID,
+		a.setupTLS,
+		a.setupMux,
 		a.setupLog,
 		a.setupServer,
-		a.setupMembership,
+	}
+	if a.replication != ReplicationNone {
+		setup = append(setup, a.setupMembership)
+	}
+	if len(a.Config.Connectors) > 0 {
+		setup = append(setup, a.setupConnectors)
+	}
+	if a.Config.MetricsStatsdAddr != "" || a.Config.MetricsOTLPAddr != "" {
+		setup = append(setup, a.setupMetrics)
+	}
+	if a.Config.WebUIAddr != "" {
+		setup = append(setup, a.setupWebUI)
 	}
 
 	for _, fn := range setup {
@@ -61,6 +273,17 @@ func New(config Config) (*Agent, error) {
 		}
 	}
 
+	if a.replication == ReplicationRaft && a.raft != nil {
+		go a.waitForLeader()
+		if a.Config.SplitBrainCheckInterval >= 0 {
+			go a.watchSplitBrain()
+		}
+		return a, nil
+	}
+	// The log is local to each node, or held by other nodes for edge nodes,
+	// so there's no quorum to wait for once membership is set up.
+	a.lifecycle.Set(server.StateServing)
+	a.startup.reached("serving", "")
 	return a, nil
 }
 
@@ -74,38 +297,254 @@ func (a *Agent) setupLogger() error {
 	return nil
 }
 
-func (a *Agent) setupLog() error {
+// setupNodeID loads the node's ID, generating it on the node's first start.
+func (a *Agent) setupNodeID() error {
 	var err error
-	a.log, err = log.NewLog(a.Config.DataDir, log.Config{})
+	a.id, err = log.NodeID(a.Config.DataDir)
 	return err
 }
 
-func (a *Agent) setupServer() error {
-	serverConfig := &server.Config{
-		CommitLog: a.log,
-		GetServer: a.log,
+// NodeID returns the node's ID, which stays with its data directory
+// whatever its NodeName.
+func (a *Agent) NodeID() string {
+	return a.id
+}
+
+func (a *Agent) setupMux() error {
+	rpcAddr, err := a.RPCAddr()
+	if err != nil {
+		return err
 	}
 
-	//var opts []grpc.ServerOption
+	ln, err := net.Listen("tcp", rpcAddr)
+	if err != nil {
+		return err
+	}
+	// Record the port we got when asked for any free one.
+	a.Config.RPCPort = ln.Addr().(*net.TCPAddr).Port
+	a.mux = newMux(ln)
+	return nil
+}
 
+func (a *Agent) setupLog() error {
+	if a.Config.Role == server.RoleEdge {
+		a.forwarder = newForwarder(
+			a.peerCredentials(),
+			grpc.WithDefaultCallOptions(
+				grpc.MaxCallRecvMsgSize(client.MaxMessageBytes(a.Config.MaxRecordBytes)),
+				grpc.MaxCallSendMsgSize(client.MaxMessageBytes(a.Config.MaxRecordBytes)),
+			),
+		)
+		a.startup.reached("forwarder started", phaseJoiningCluster)
+		return nil
+	}
+	// Raft replicates topics along with the default log. Otherwise their
+	// partitions are stored on the node that serves them.
+	if a.replication == ReplicationRaft {
+		return a.setupRaft()
+	}
 	var err error
-	a.server, err = server.NewGRPCServer(serverConfig)
+	a.topics, err = log.NewTopics(a.Config.DataDir, a.logConfig())
 	if err != nil {
 		return err
 	}
+	a.log, err = log.NewLog(a.Config.DataDir, a.logConfig())
+	if err != nil {
+		return err
+	}
+	next := phaseJoiningCluster
+	if a.replication == ReplicationNone {
+		next = ""
+	}
+	a.startup.reached("log opened", next)
+	return nil
+}
 
-	rpcAddr, err := a.RPCAddr()
+func (a *Agent) logConfig() log.Config {
+	config := log.Config{Clock: a.Config.Clock, Budget: a.budget, Metrics: a.metrics}
+	config.Store.MaxRecordBytes = a.Config.MaxRecordBytes
+	config.Orphans = log.OrphanPolicy(a.Config.OrphanPolicy)
+	config.Store.Checksums = a.Config.RecordChecksums
+	config.Scrub.Interval = a.Config.ScrubInterval
+	config.Scrub.BytesPerSecond = a.Config.ScrubRate
+	config.Retention.MaxAge = a.Config.RetentionMaxAge
+	config.Retention.MaxBytes = a.Config.RetentionMaxBytes
+	return config
+}
+
+func (a *Agent) setupRaft() error {
+	config := a.logConfig()
+	config.Raft.StreamLayer = log.NewStreamLayer(a.mux.raft, a.serverTLS, a.peerTLS)
+	config.Raft.LocalID = raft.ServerID(a.id)
+	config.Raft.Bootstrap = a.Config.Bootstrap
+	config.SegmentTransfer.Enabled = a.Config.SegmentTransfer
+	config.SegmentTransfer.BytesPerSecond = a.Config.SegmentTransferRate
+	config.Raft.LogDir = a.Config.RaftLogDir
+	config.Raft.Quarantine = a.Config.QuarantineEntries
+
+	var err error
+	a.raft, err = log.NewDistributedLog(a.Config.DataDir, config)
 	if err != nil {
 		return err
 	}
+	a.startup.reached("raft started", phaseJoiningCluster)
+	// Serve segments even when not fetching them, so peers that do can
+	// fetch from this node. Serve returns once the mux closes.
+	go func() { _ = a.raft.ServeSegments(a.mux.segments) }()
+	if a.Config.Bootstrap {
+		a.lifecycle.SetPhase(phaseElectingLeader)
+		return a.raft.WaitForLeader(3 * time.Second)
+	}
+	return nil
+}
 
-	ln, err := net.Listen("tcp", rpcAddr)
+// setupGroups opens the consumer groups, whose commits are kept in an
+// internal topic among topics.
+func (a *Agent) setupGroups(topics backend.Topics) (*server.ConsumerGroups, error) {
+	return server.NewConsumerGroups(topics)
+}
+
+// waitForLeader starts serving once the Raft cluster has a leader to take
+// writes.
+func (a *Agent) waitForLeader() {
+	for {
+		select {
+		case <-a.shutdowns:
+			return
+		default:
+		}
+		if err := a.raft.WaitForLeader(time.Second); err == nil {
+			var leader string
+			if servers, err := a.raft.GetServers(); err == nil {
+				leader = leaderOf(servers)
+			}
+			a.startup.reached("leader elected", "", zap.String("leader", leader))
+			a.shutdownLock.Lock()
+			if !a.shutdown {
+				a.lifecycle.Set(server.StateServing)
+				a.startup.reached("serving", "")
+			}
+			a.shutdownLock.Unlock()
+			return
+		}
+	}
+}
+
+func (a *Agent) setupServer() error {
+	serverConfig := &server.Config{
+		Storage:   server.Storage{CommitLog: a.log, GetServer: devServers{agent: a}},
+		Telemetry: server.Telemetry{Metrics: a.metrics},
+		Limits: server.Limits{
+			Budget:          a.budget,
+			MaxMessageBytes: client.MaxMessageBytes(a.Config.MaxRecordBytes),
+		},
+		Lifecycle:         a.lifecycle,
+		DisableReflection: a.Config.DisableReflection,
+		NodeName:          a.Config.NodeName,
+		OTLP:              a.Config.OTLP,
+		CloudEvents:       a.Config.CloudEvents,
+		SessionTimeout:    a.Config.SessionTimeout,
+		Clock:             a.Config.Clock,
+	}
+	serverConfig.TLS = a.serverTLS
+	if a.Config.Workers > 0 {
+		serverConfig.Scheduler = server.NewScheduler(server.SchedulerConfig{
+			Workers:  a.Config.Workers,
+			MaxQueue: a.Config.WorkerQueue,
+			Metrics:  a.metrics,
+		})
+	}
+	if a.Config.MaxStreamsPerClient > 0 || a.Config.MaxStreams > 0 {
+		serverConfig.StreamLimiter = server.NewStreamLimiter(server.StreamLimiterConfig{
+			PerIdentity: a.Config.MaxStreamsPerClient,
+			PerNode:     a.Config.MaxStreams,
+		})
+	}
+	if a.Config.ClaimCheckStore != "" {
+		store, err := blob.Open(a.Config.ClaimCheckStore)
+		if err != nil {
+			return err
+		}
+		threshold := a.Config.ClaimCheckThreshold
+		if threshold == 0 {
+			threshold = 1 << 20
+		}
+		serverConfig.ClaimCheck = &server.ClaimCheck{Store: store, Threshold: threshold}
+	}
+	switch {
+	case a.raft != nil:
+		serverConfig.Topics = a.raft
+	case a.topics != nil:
+		serverConfig.Topics = a.topics
+	}
+	if serverConfig.Topics != nil {
+		groups, err := a.setupGroups(serverConfig.Topics)
+		if err != nil {
+			return err
+		}
+		serverConfig.Groups = groups
+	}
+	if a.Config.ACLFile != "" {
+		acl, err := server.LoadACL(a.Config.ACLFile)
+		if err != nil {
+			return err
+		}
+		acl.IsPeer = a.isPeer
+		serverConfig.ACL = acl
+	}
+	if a.Config.Role != server.RoleAll {
+		serverConfig.Authorizer = &server.Authorizer{
+			Role:   a.Config.Role,
+			IsPeer: a.isPeer,
+		}
+	}
+	switch {
+	case a.forwarder != nil:
+		serverConfig.CommitLog = a.forwarder
+		serverConfig.GetServer = devServers{agent: a}
+	case a.replication == ReplicationRaft:
+		serverConfig.CommitLog = a.raft
+		serverConfig.GetServer = a.raft
+		serverConfig.Maintenance = a.raft
+		serverConfig.Standby = a.raft
+		serverConfig.Quarantine = a.raft
+		serverConfig.Members = quarantinedMembers{agent: a}
+		a.splitBrain = &server.SplitBrainGuard{}
+		serverConfig.SplitBrain = a.splitBrain
+		a.metrics.Gauge("split_brain", func() float64 {
+			if a.splitBrained.Load() {
+				return 1
+			}
+			return 0
+		})
+	case a.replication == ReplicationNone:
+		serverConfig.GetServer = devServers{agent: a}
+	}
+
+	a.metrics.Gauge("highest_offset", func() float64 {
+		off, _ := serverConfig.CommitLog.HighestOffset()
+		return float64(off)
+	})
+	if a.raft != nil {
+		a.metrics.Gauge("sync_lag_entries", func() float64 {
+			status, err := a.raft.SyncStatus()
+			if err != nil {
+				return 0
+			}
+			return float64(status.LagEntries)
+		})
+	}
+
+	//var opts []grpc.ServerOption
+
+	var err error
+	a.server, err = server.NewGRPCServer(serverConfig)
 	if err != nil {
 		return err
 	}
 
 	go func() {
-		if err := a.server.Serve(ln); err != nil {
+		if err := a.server.Serve(a.mux.grpc); err != nil {
 			_ = a.Shutdown()
 		}
 	}()
@@ -119,30 +558,217 @@ func (a *Agent) setupMembership() error {
 		return err
 	}
 
-	var opts []grpc.DialOption
-	conn, err := grpc.Dial(rpcAddr, opts...)
+	// Raft replicates to the members serf finds by adding them as voters,
+	// while the gossip replicator copies their records.
+	var handler backend.Handler = a.raft
+	if a.forwarder != nil {
+		handler = a.forwarder
+	} else if a.replication == ReplicationGossip {
+		opts := []grpc.DialOption{
+			a.peerCredentials(),
+			grpc.WithDefaultCallOptions(
+				grpc.MaxCallRecvMsgSize(client.MaxMessageBytes(a.Config.MaxRecordBytes)),
+				grpc.MaxCallSendMsgSize(client.MaxMessageBytes(a.Config.MaxRecordBytes)),
+			),
+		}
+		conn, err := grpc.Dial(rpcAddr, opts...)
+		if err != nil {
+			return err
+		}
+
+		client := api.NewLogClient(conn)
+		a.replicator = &log.Replicator{
+			DialOptions: opts,
+			LocalServer: client,
+			NodeName:    a.Config.NodeName,
+			Budget:      a.budget,
+		}
+		handler = a.replicator
+	}
+
+	startJoinAddrs := a.Config.StartJoinAddrs
+	if a.Config.DiscoveryDNS != "" {
+		_, port, err := net.SplitHostPort(a.Config.BindAddr)
+		if err != nil {
+			return err
+		}
+		serfPort, err := strconv.Atoi(port)
+		if err != nil {
+			return err
+		}
+		seeds, err := discovery.LookupSeeds(a.Config.DiscoveryDNS, serfPort)
+		if err != nil {
+			return err
+		}
+		startJoinAddrs = append(startJoinAddrs, seeds...)
+	}
+
+	tags := map[string]string{
+		"rpc_addr":           rpcAddr,
+		discovery.TagNodeID:  a.id,
+		discovery.TagStandby: strconv.FormatBool(a.Config.Standby),
+		discovery.TagRole:    string(a.Config.Role),
+	}
+	for k, v := range a.Config.Labels {
+		tags[discovery.TagLabelPrefix+k] = v
+	}
+	// Edge nodes hold no log, so they're neither replicated to nor
+	// forwarded to.
+	var roles []string
+	for _, r := range server.Roles {
+		if r.HoldsLog() {
+			roles = append(roles, string(r))
+		}
+	}
+
+	var quarantine discovery.QuarantineConfig
+	if a.replication == ReplicationRaft {
+		quarantine = a.Config.MemberQuarantine
+	}
+
+	a.lifecycle.Set(server.StateWaitingForQuorum)
+	a.membeship, err = discovery.New(handler, discovery.Config{
+		NodeName:       a.Config.NodeName,
+		BindAddr:       a.Config.BindAddr,
+		Tags:           tags,
+		StartJoinAddrs: startJoinAddrs,
+		Roles:          roles,
+		Quarantine:     quarantine,
+	})
 	if err != nil {
 		return err
 	}
 
-	client := api.NewLogClient(conn)
-	a.replicator = &log.Replicator{
-		DialOptions: opts,
-		LocalServer: client,
+	peers := 0
+	for _, m := range a.membeship.Members() {
+		if m.Status == serf.StatusAlive && m.Name != a.Config.NodeName {
+			peers++
+		}
 	}
+	next := ""
+	if a.replication == ReplicationRaft {
+		next = phaseElectingLeader
+	}
+	a.startup.reached("joined cluster", next, zap.Int("peers", peers))
+	return nil
+}
 
-	a.membeship, err = discovery.New(a.replicator, discovery.Config{
-		NodeName: a.Config.NodeName,
-		BindAddr: a.Config.BindAddr,
-		Tags: map[string]string{
-			"rpc_addr": rpcAddr,
-		},
-		StartJoinAddrs: a.Config.StartJoinAddrs,
-	})
+func (a *Agent) setupConnectors() error {
+	rpcAddr, err := a.Config.RPCAddr()
+	if err != nil {
+		return err
+	}
 
+	a.connectors, err = connect.Start(rpcAddr, client.Config{
+		DialOptions:      []grpc.DialOption{a.peerCredentials()},
+		MaxRecordBytes:   a.Config.MaxRecordBytes,
+		TruncationPolicy: a.Config.ConnectorTruncationPolicy,
+		OnTruncated: func(connector string, off, lowest uint64) {
+			zap.L().Warn(
+				"connector lost records truncated from the log",
+				zap.String("connector", connector),
+				zap.Uint64("from", off),
+				zap.Uint64("to", lowest),
+			)
+		},
+	}, a.Config.Connectors)
 	return err
 }
 
+func (a *Agent) setupWebUI() error {
+	config := webui.Config{
+		NodeName:  a.Config.NodeName,
+		Log:       a.log,
+		Members:   a.members,
+		Consumers: a.consumers,
+		Registry:  schema.NewRegistry(),
+	}
+	for _, path := range a.Config.SchemaDescriptorSets {
+		if err := config.Registry.Load(path); err != nil {
+			return err
+		}
+	}
+	switch {
+	case a.forwarder != nil:
+		config.Log = a.forwarder
+	case a.raft != nil:
+		config.Log = a.raft
+		config.Servers = a.raft
+	case a.replication == ReplicationNone:
+		config.Servers = devServers{agent: a}
+	}
+
+	ln, err := net.Listen("tcp", a.Config.WebUIAddr)
+	if err != nil {
+		return err
+	}
+	a.webUI = &http.Server{Handler: webui.New(config)}
+	go func() { _ = a.webUI.Serve(ln) }()
+	return nil
+}
+
+// members lists the cluster's members for the web UI.
+func (a *Agent) members() []webui.Member {
+	if a.membeship == nil {
+		return nil
+	}
+	var members []webui.Member
+	for _, m := range a.membeship.Members() {
+		members = append(members, webui.Member{
+			Name:   m.Name,
+			Addr:   net.JoinHostPort(m.Addr.String(), strconv.Itoa(int(m.Port))),
+			Status: m.Status.String(),
+			Tags:   m.Tags,
+		})
+	}
+	return members
+}
+
+// consumers returns the next offset of each sink connector, the consumers
+// the agent knows of, for the web UI.
+func (a *Agent) consumers(ctx context.Context) (map[string]uint64, error) {
+	if a.connectors == nil {
+		return make(map[string]uint64), nil
+	}
+	return a.connectors.Offsets(ctx)
+}
+
+func (a *Agent) setupMetrics() error {
+	if a.Config.MetricsStatsdAddr != "" {
+		p, err := metrics.NewStatsdPusher(a.Config.MetricsStatsdAddr, "prolog.")
+		if err != nil {
+			return err
+		}
+		a.pushers = append(a.pushers, p)
+	}
+	if a.Config.MetricsOTLPAddr != "" {
+		p, err := metrics.NewOTLPPusher(
+			a.Config.MetricsOTLPAddr,
+			a.Config.NodeName,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		if err != nil {
+			return err
+		}
+		a.pushers = append(a.pushers, p)
+	}
+
+	interval := a.Config.MetricsPushInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopPush = cancel
+	for _, p := range a.pushers {
+		go metrics.Push(ctx, a.metrics, p, interval)
+	}
+	return nil
+}
+
+// Shutdown stops the agent in dependency order: first whatever writes to
+// the log, then the RPCs reading it, and only then Raft and the log itself,
+// so nothing is still using the log when it's closed. Every step runs even
+// if an earlier one fails, and the first failure is returned.
 func (a *Agent) Shutdown() error {
 	a.shutdownLock.Lock()
 	defer a.shutdownLock.Unlock()
@@ -154,21 +780,130 @@ func (a *Agent) Shutdown() error {
 	a.shutdown = true
 	close(a.shutdowns)
 
-	shutdown := []func() error{
-		a.membeship.Leave,
-		a.replicator.Close,
+	var shutdown []func() error
+	if a.webUI != nil {
+		shutdown = append(shutdown, a.webUI.Close)
+	}
+	if a.stopPush != nil {
+		a.stopPush()
+	}
+	for _, p := range a.pushers {
+		shutdown = append(shutdown, p.Close)
+	}
+	if a.connectors != nil {
+		shutdown = append(shutdown, a.connectors.Close)
+	}
+	if a.membeship != nil {
+		shutdown = append(shutdown, a.membeship.Leave)
+	}
+	// The replicator produces through the local server, so it's closed,
+	// flushing the records it has in flight, before the server drains.
+	if a.replicator != nil {
+		shutdown = append(shutdown, a.replicator.Close)
+	}
+	shutdown = append(shutdown,
 		func() error {
-			a.server.GracefulStop()
+			// Draining ends consume streams, which would otherwise keep
+			// GracefulStop waiting until their clients hang up.
+			a.lifecycle.Set(server.StateDraining)
+			a.stopServer()
 			return nil
 		},
-		a.log.Close,
+	)
+	switch {
+	case a.forwarder != nil:
+		shutdown = append(shutdown, a.forwarder.Close)
+	case a.raft != nil:
+		shutdown = append(shutdown, a.raft.Close)
+	default:
+		shutdown = append(shutdown, a.log.Close)
+	}
+	if a.topics != nil {
+		shutdown = append(shutdown, a.topics.Close)
 	}
+	shutdown = append(shutdown, a.mux.Close)
 
+	var first error
 	for _, fn := range shutdown {
-		if err := fn(); err != nil {
-			return err
+		if err := fn(); err != nil && first == nil {
+			first = err
 		}
 	}
 
-	return nil
+	return first
+}
+
+// stopTimeout bounds how long the server waits for in-flight RPCs to finish
+// before cancelling them.
+const stopTimeout = 5 * time.Second
+
+func (a *Agent) stopServer() {
+	stopped := make(chan struct{})
+	go func() {
+		a.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-a.Config.Clock.After(stopTimeout):
+		a.server.Stop()
+		<-stopped
+	}
+}
+
+// isPeer reports whether identity, as the server names its clients, is
+// one of the cluster's live members, by name or by address.
+func (a *Agent) isPeer(identity string) bool {
+	if a.membeship == nil {
+		return false
+	}
+	for _, m := range a.membeship.Members() {
+		if m.Status != serf.StatusAlive {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(m.Tags["rpc_addr"])
+		if identity == m.Name || identity == host || identity == m.Addr.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// devServers reports an agent as the sole server and leader of its
+// cluster: a standalone agent, or an edge node, which clients should
+// produce to rather than the nodes it forwards to.
+type devServers struct {
+	agent *Agent
+}
+
+func (d devServers) GetServers() ([]*api.Server, error) {
+	rpcAddr, err := d.agent.Config.RPCAddr()
+	if err != nil {
+		return nil, err
+	}
+	return []*api.Server{{
+		Id:       d.agent.id,
+		RpcAddr:  rpcAddr,
+		IsLeader: true,
+	}}, nil
+}
+
+// quarantinedMembers serves the members the agent's membership quarantined,
+// which it sets up after the server.
+type quarantinedMembers struct {
+	agent *Agent
+}
+
+func (q quarantinedMembers) QuarantinedMembers() ([]*api.QuarantinedMember, error) {
+	if q.agent.membeship == nil {
+		return nil, nil
+	}
+	return q.agent.membeship.QuarantinedMembers()
+}
+
+func (q quarantinedMembers) ReleaseMember(id string) error {
+	if q.agent.membeship == nil {
+		return nil
+	}
+	return q.agent.membeship.ReleaseMember(id)
 }
@@ -10,9 +10,12 @@ import (
 
 	api "github.com/Tarunshrma/prolog/api/v1"
 	"github.com/Tarunshrma/prolog/internal/agent"
-	"github.com/test-go/testify/require"
+	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/stretchr/testify/require"
 	"github.com/travisjeffery/go-dynaport"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestAgent(t *testing.T) {
@@ -78,6 +81,436 @@ func TestAgent(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "hello", string(consumeResp.Record.Value))
 
+	// Each node replicates every other, so a record produced anywhere
+	// reaches each node exactly once, rather than again through every
+	// node that has a copy.
+	for i := 1; i < len(agents); i++ {
+		_, err := client(t, agents[i]).Produce(context.Background(), &api.ProduceRequest{
+			Record: &api.Record{Value: []byte(fmt.Sprintf("from %d", i))},
+		})
+		require.NoError(t, err)
+	}
+	want := []string{"hello", "from 1", "from 2"}
+	for _, a := range agents {
+		c := client(t, a)
+		require.Eventually(t, func() bool {
+			return len(values(t, c)) == len(want)
+		}, 3*time.Second, 50*time.Millisecond)
+	}
+	time.Sleep(time.Second)
+	for _, a := range agents {
+		require.ElementsMatch(t, want, values(t, client(t, a)))
+	}
+}
+
+// values returns the values of the records in a node's log, in order.
+func values(t *testing.T, c api.LogClient) []string {
+	t.Helper()
+	var values []string
+	for off := uint64(0); ; off++ {
+		res, err := c.Consume(context.Background(), &api.ConsumeRequest{Offset: off})
+		if status.Code(err) == codes.OutOfRange {
+			return values
+		}
+		require.NoError(t, err)
+		values = append(values, string(res.Record.Value))
+	}
+}
+
+func TestAgentDev(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "agent-dev-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	a, err := agent.New(agent.Config{
+		NodeName: "dev",
+		BindAddr: "127.0.0.1:0",
+		RPCPort:  0,
+		DataDir:  dataDir,
+		Dev:      true,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, a.Shutdown())
+	}()
+	require.NotEqual(t, 0, a.Config.RPCPort)
+
+	c := client(t, a)
+	ctx := context.Background()
+	produceResp, err := c.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello")},
+	})
+	require.NoError(t, err)
+
+	consumeResp, err := c.Consume(ctx, &api.ConsumeRequest{
+		Offset: produceResp.Offset,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(consumeResp.Record.Value))
+
+	servers, err := c.GetServers(ctx, &api.GetServersRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(servers.Servers))
+	require.True(t, servers.Servers[0].IsLeader)
+}
+
+func TestAgentRaft(t *testing.T) {
+	var agents []*agent.Agent
+	for i := 0; i < 2; i++ {
+		ports := dynaport.Get(2)
+		dataDir, err := ioutil.TempDir("", "agent-raft-test")
+		require.NoError(t, err)
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = append(startJoinAddrs, agents[0].Config.BindAddr)
+		}
+
+		a, err := agent.New(agent.Config{
+			NodeName:       fmt.Sprintf("%d", i),
+			StartJoinAddrs: startJoinAddrs,
+			BindAddr:       fmt.Sprintf("127.0.0.1:%d", ports[0]),
+			RPCPort:        ports[1],
+			DataDir:        dataDir,
+			Replication:    agent.ReplicationRaft,
+			Bootstrap:      i == 0,
+			// Poison entries are skipped and listed rather than wedging
+			// replay.
+			QuarantineEntries: true,
+		})
+		require.NoError(t, err)
+		agents = append(agents, a)
+	}
+	defer func() {
+		for i := len(agents) - 1; i >= 0; i-- {
+			require.NoError(t, agents[i].Shutdown())
+			require.NoError(t, os.RemoveAll(agents[i].Config.DataDir))
+		}
+	}()
+
+	// Nodes only serve once they've found the leader.
+	ctx := context.Background()
+	var produceResp *api.ProduceResponse
+	var err error
+	for i := 0; i < 50; i++ {
+		produceResp, err = client(t, agents[0]).Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello")},
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+
+	// The follower gets the record through Raft rather than the replicator.
+	var consumeResp *api.ConsumeResponse
+	for i := 0; i < 50; i++ {
+		consumeResp, err = client(t, agents[1]).Consume(ctx, &api.ConsumeRequest{
+			Offset: produceResp.Offset,
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(consumeResp.Record.Value))
+
+	// Topics are replicated too, so the follower serves them.
+	_, err = client(t, agents[0]).CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 2},
+	})
+	require.NoError(t, err)
+	produceResp, err = client(t, agents[0]).Produce(ctx, &api.ProduceRequest{
+		Record:    &api.Record{Value: []byte("order")},
+		Topic:     "orders",
+		Partition: 1,
+	})
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		consumeResp, err = client(t, agents[1]).Consume(ctx, &api.ConsumeRequest{
+			Offset:    produceResp.Offset,
+			Topic:     "orders",
+			Partition: 1,
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	require.Equal(t, "order", string(consumeResp.Record.Value))
+
+	// So are consumer groups' commits, so the next leader has them.
+	_, err = client(t, agents[0]).CommitOffset(ctx, &api.CommitOffsetRequest{
+		Group:  "billing",
+		Offset: 42,
+	})
+	require.NoError(t, err)
+	var fetchResp *api.FetchOffsetResponse
+	for i := 0; i < 50; i++ {
+		fetchResp, err = client(t, agents[1]).FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing"})
+		if err == nil && fetchResp.Committed {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	require.True(t, fetchResp.Committed)
+	require.Equal(t, uint64(42), fetchResp.Offset)
+
+	quarantined, err := adminClient(t, agents[1]).ListQuarantined(ctx, &api.ListQuarantinedRequest{})
+	require.NoError(t, err)
+	require.Empty(t, quarantined.Entries)
+}
+
+func TestAgentStandby(t *testing.T) {
+	var agents []*agent.Agent
+	for i := 0; i < 2; i++ {
+		ports := dynaport.Get(2)
+		dataDir, err := ioutil.TempDir("", "agent-standby-test")
+		require.NoError(t, err)
+		defer os.RemoveAll(dataDir)
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = append(startJoinAddrs, agents[0].Config.BindAddr)
+		}
+
+		a, err := agent.New(agent.Config{
+			NodeName:       fmt.Sprintf("%d", i),
+			StartJoinAddrs: startJoinAddrs,
+			BindAddr:       fmt.Sprintf("127.0.0.1:%d", ports[0]),
+			RPCPort:        ports[1],
+			DataDir:        dataDir,
+			Replication:    agent.ReplicationRaft,
+			Bootstrap:      i == 0,
+			Standby:        i == 1,
+		})
+		require.NoError(t, err)
+		defer a.Shutdown()
+		agents = append(agents, a)
+	}
+
+	ctx := context.Background()
+	var produceResp *api.ProduceResponse
+	var err error
+	for i := 0; i < 50; i++ {
+		produceResp, err = client(t, agents[0]).Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello")},
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+
+	// The standby syncs the log without being a voter.
+	require.Eventually(t, func() bool {
+		res, err := client(t, agents[1]).Consume(ctx, &api.ConsumeRequest{
+			Offset: produceResp.Offset,
+		})
+		return err == nil && string(res.Record.Value) == "hello"
+	}, 5*time.Second, 100*time.Millisecond)
+	standby := func() bool {
+		servers, err := client(t, agents[0]).GetServers(ctx, &api.GetServersRequest{})
+		require.NoError(t, err)
+		for _, srv := range servers.Servers {
+			if srv.Id == agents[1].NodeID() {
+				return srv.IsStandby
+			}
+		}
+		return false
+	}
+	require.True(t, standby())
+
+	sync, err := adminClient(t, agents[1]).GetSyncStatus(ctx, &api.GetSyncStatusRequest{})
+	require.NoError(t, err)
+	require.True(t, sync.Standby)
+	require.True(t, sync.AppliedIndex > 0)
+	require.True(t, sync.LastContactUnixMs > 0)
+
+	// Promotion has to go through the leader.
+	_, err = adminClient(t, agents[1]).PromoteStandby(ctx, &api.PromoteStandbyRequest{Id: agents[1].NodeID()})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = adminClient(t, agents[0]).PromoteStandby(ctx, &api.PromoteStandbyRequest{Id: "2"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = adminClient(t, agents[0]).PromoteStandby(ctx, &api.PromoteStandbyRequest{Id: agents[1].NodeID()})
+	require.NoError(t, err)
+	require.False(t, standby())
+}
+
+func TestAgentShutdownWithStreams(t *testing.T) {
+	var agents []*agent.Agent
+	for i := 0; i < 2; i++ {
+		ports := dynaport.Get(2)
+		dataDir, err := ioutil.TempDir("", "agent-shutdown-test")
+		require.NoError(t, err)
+		defer os.RemoveAll(dataDir)
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = append(startJoinAddrs, agents[0].Config.BindAddr)
+		}
+
+		a, err := agent.New(agent.Config{
+			NodeName:       fmt.Sprintf("%d", i),
+			StartJoinAddrs: startJoinAddrs,
+			BindAddr:       fmt.Sprintf("127.0.0.1:%d", ports[0]),
+			RPCPort:        ports[1],
+			DataDir:        dataDir,
+			Replication:    agent.ReplicationRaft,
+			Bootstrap:      i == 0,
+		})
+		require.NoError(t, err)
+		agents = append(agents, a)
+	}
+
+	ctx := context.Background()
+	var err error
+	for i := 0; i < 50; i++ {
+		_, err = client(t, agents[0]).Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello")},
+		})
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err)
+
+	// Leave a consume stream open on each node, waiting for records past
+	// the end of the log.
+	var streams []api.Log_ConsumeStreamClient
+	for _, a := range agents {
+		var stream api.Log_ConsumeStreamClient
+		require.Eventually(t, func() bool {
+			stream, err = client(t, a).ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+			if err != nil {
+				return false
+			}
+			_, err = stream.Recv()
+			return err == nil
+		}, 5*time.Second, 100*time.Millisecond)
+		streams = append(streams, stream)
+	}
+
+	// Shutting down ends the streams rather than waiting on them, and
+	// closes the log after Raft without errors.
+	for i := len(agents) - 1; i >= 0; i-- {
+		start := time.Now()
+		require.NoError(t, agents[i].Shutdown())
+		require.True(t, time.Since(start) < 5*time.Second)
+		_, err := streams[i].Recv()
+		require.Error(t, err)
+	}
+}
+
+func TestAgentEdge(t *testing.T) {
+	var agents []*agent.Agent
+	for i, role := range []server.Role{server.RoleStorage, server.RoleEdge} {
+		ports := dynaport.Get(2)
+		dataDir, err := ioutil.TempDir("", "agent-edge-test")
+		require.NoError(t, err)
+
+		var startJoinAddrs []string
+		if i != 0 {
+			startJoinAddrs = append(startJoinAddrs, agents[0].Config.BindAddr)
+		}
+		a, err := agent.New(agent.Config{
+			NodeName:       string(role),
+			StartJoinAddrs: startJoinAddrs,
+			BindAddr:       fmt.Sprintf("%s:%d", "127.0.0.1", ports[0]),
+			RPCPort:        ports[1],
+			DataDir:        dataDir,
+			Role:           role,
+			Labels:         map[string]string{"zone": "a"},
+		})
+		require.NoError(t, err)
+		agents = append(agents, a)
+	}
+	defer func() {
+		for _, a := range agents {
+			require.NoError(t, a.Shutdown())
+			require.NoError(t, os.RemoveAll(a.Config.DataDir))
+		}
+	}()
+
+	// The edge node forwards produces to the storage node once it has
+	// joined.
+	ctx := context.Background()
+	edge := client(t, agents[1])
+	var offset uint64
+	require.Eventually(t, func() bool {
+		res, err := edge.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello")},
+		})
+		if err != nil {
+			return false
+		}
+		offset = res.Offset
+		return true
+	}, 5*time.Second, 100*time.Millisecond)
+
+	consumeResp, err := client(t, agents[0]).Consume(ctx, &api.ConsumeRequest{Offset: offset})
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(consumeResp.Record.Value))
+	require.Equal(t, "edge", consumeResp.Record.Headers[api.HeaderOriginNode])
+
+	// The edge node holds no log to consume from.
+	_, err = edge.Consume(ctx, &api.ConsumeRequest{Offset: offset})
+	require.Error(t, err)
+}
+
+func TestAgentReplicationConfig(t *testing.T) {
+	for scenario, config := range map[string]agent.Config{
+		"unknown replication": {Replication: "paxos"},
+		"dev with raft":       {Dev: true, Replication: agent.ReplicationRaft},
+		"dev with gossip":     {Dev: true, Replication: agent.ReplicationGossip},
+		"none joining a cluster": {
+			Replication:    agent.ReplicationNone,
+			StartJoinAddrs: []string{"127.0.0.1:8401"},
+		},
+		"bootstrap without raft": {
+			Replication: agent.ReplicationGossip,
+			Bootstrap:   true,
+		},
+		"standby without raft": {
+			Replication: agent.ReplicationGossip,
+			Standby:     true,
+		},
+		"standby bootstrapping": {
+			Replication: agent.ReplicationRaft,
+			Bootstrap:   true,
+			Standby:     true,
+		},
+		"unknown role": {Role: "archive"},
+		"edge without replication": {
+			Replication: agent.ReplicationNone,
+			Role:        server.RoleEdge,
+		},
+		"edge bootstrapping": {
+			Replication: agent.ReplicationRaft,
+			Role:        server.RoleEdge,
+			Bootstrap:   true,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			_, err := agent.New(config)
+			require.Error(t, err)
+		})
+	}
+}
+
+func adminClient(t *testing.T, a *agent.Agent) api.AdminClient {
+	rpcAddr, err := a.Config.RPCAddr()
+	require.NoError(t, err)
+
+	conn, err := grpc.Dial(rpcAddr, grpc.WithInsecure())
+	require.NoError(t, err)
+	return api.NewAdminClient(conn)
 }
 
 func client(t *testing.T, a *agent.Agent) api.LogClient {
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNoLog is returned by an edge node's commit log for reads, since it
+// holds no records.
+var errNoLog = errors.New("edge nodes hold no log")
+
+// forwarder is an edge node's commit log. It holds no records, and
+// forwards the records produced to it to the nodes that do, which
+// membership tells it about as they join and leave.
+type forwarder struct {
+	dialOptions []grpc.DialOption
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	names []string
+	next  int
+}
+
+func newForwarder(opts ...grpc.DialOption) *forwarder {
+	return &forwarder{
+		dialOptions: opts,
+		conns:       make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (f *forwarder) Join(name, addr string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.conns[name]; ok {
+		return nil
+	}
+	conn, err := grpc.Dial(addr, f.dialOptions...)
+	if err != nil {
+		return err
+	}
+	f.conns[name] = conn
+	f.names = append(f.names, name)
+	return nil
+}
+
+func (f *forwarder) Leave(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conn, ok := f.conns[name]
+	if !ok {
+		return nil
+	}
+	delete(f.conns, name)
+	for i, n := range f.names {
+		if n == name {
+			f.names = append(f.names[:i], f.names[i+1:]...)
+			break
+		}
+	}
+	return conn.Close()
+}
+
+// clients returns a client for each node the forwarder knows of, starting
+// from the one after the node the last call started from, so produces are
+// spread between them.
+func (f *forwarder) clients() []api.LogClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clients := make([]api.LogClient, 0, len(f.names))
+	for i := range f.names {
+		name := f.names[(f.next+i)%len(f.names)]
+		clients = append(clients, api.NewLogClient(f.conns[name]))
+	}
+	f.next++
+	return clients
+}
+
+// Append produces record to a node holding the log, trying the next one
+// while they're unavailable, e.g. because they aren't the Raft leader.
+func (f *forwarder) Append(record *api.Record) (uint64, error) {
+	err := error(status.Error(codes.Unavailable, "no nodes holding the log to forward to"))
+	for _, c := range f.clients() {
+		var res *api.ProduceResponse
+		res, err = c.Produce(context.Background(), &api.ProduceRequest{Record: record})
+		if err == nil {
+			return res.Offset, nil
+		}
+		if status.Code(err) != codes.Unavailable {
+			return 0, err
+		}
+	}
+	return 0, err
+}
+
+func (f *forwarder) Read(uint64) (*api.Record, error) {
+	return nil, errNoLog
+}
+
+func (f *forwarder) LowestOffset() (uint64, error) {
+	return 0, errNoLog
+}
+
+func (f *forwarder) HighestOffset() (uint64, error) {
+	return 0, errNoLog
+}
+
+func (f *forwarder) ReadRange(from, to uint64, fn func(*api.Record) error) error {
+	return errNoLog
+}
+
+func (f *forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var first error
+	for name, conn := range f.conns {
+		if err := conn.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(f.conns, name)
+	}
+	f.names = nil
+	return first
+}
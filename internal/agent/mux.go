@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/log"
+)
+
+// mux shares the RPC port between Raft, segment transfers and gRPC. Raft's
+// stream layer starts each connection with log.RaftRPC, segment fetches
+// with log.SegmentRPC and record repairs with log.RangeRPC, none of which
+// can start an HTTP/2 connection, so the first byte tells them apart.
+type mux struct {
+	ln       net.Listener
+	raft     *muxListener
+	segments *muxListener
+	grpc     *muxListener
+}
+
+func newMux(ln net.Listener) *mux {
+	m := &mux{
+		ln:       ln,
+		raft:     newMuxListener(ln.Addr()),
+		segments: newMuxListener(ln.Addr()),
+		grpc:     newMuxListener(ln.Addr()),
+	}
+	go m.serve()
+	return m
+}
+
+func (m *mux) serve() {
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			m.raft.Close()
+			m.segments.Close()
+			m.grpc.Close()
+			return
+		}
+		go m.route(conn)
+	}
+}
+
+func (m *mux) route(conn net.Conn) {
+	b := make([]byte, 1)
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		conn.Close()
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	l := m.grpc
+	switch b[0] {
+	case log.RaftRPC:
+		l = m.raft
+	case log.SegmentRPC, log.RangeRPC:
+		l = m.segments
+	}
+	l.deliver(&prefixConn{Conn: conn, prefix: b})
+}
+
+func (m *mux) Close() error {
+	return m.ln.Close()
+}
+
+// muxListener is the net.Listener one protocol accepts its connections on.
+type muxListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *muxListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *muxListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
+
+// prefixConn replays the bytes the mux read to route the connection.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(p, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Tarunshrma/prolog/internal/server"
+)
+
+// Replication is how an agent replicates records between nodes. An agent
+// runs exactly one strategy, since running Raft alongside the gossip
+// replicator would write every record twice.
+type Replication string
+
+const (
+	// ReplicationRaft replicates records through Raft, so every node holds
+	// the same log and writes go through the leader.
+	ReplicationRaft Replication = "raft"
+	// ReplicationGossip has every node copy the records of the peers serf
+	// discovers into its own log.
+	ReplicationGossip Replication = "gossip-replicator"
+	// ReplicationNone runs a standalone node that doesn't join a cluster.
+	ReplicationNone Replication = "none"
+)
+
+// replication returns the configured strategy, defaulting to none in dev
+// mode and the gossip replicator otherwise, and rejects combinations that
+// don't make sense for it.
+func (c Config) replication() (Replication, error) {
+	r := c.Replication
+	if r == "" {
+		r = ReplicationGossip
+		if c.Dev {
+			r = ReplicationNone
+		}
+	}
+
+	switch r {
+	case ReplicationRaft, ReplicationGossip, ReplicationNone:
+	default:
+		return "", fmt.Errorf("unknown replication %q", r)
+	}
+	if c.Dev && r != ReplicationNone {
+		return "", fmt.Errorf("dev mode runs a single node and can't use %s replication", r)
+	}
+	if r == ReplicationNone && (len(c.StartJoinAddrs) > 0 || c.DiscoveryDNS != "") {
+		return "", fmt.Errorf("a node without replication can't join a cluster")
+	}
+	if c.Bootstrap && r != ReplicationRaft {
+		return "", fmt.Errorf("only raft replication can bootstrap a cluster, not %s", r)
+	}
+	if c.Standby && r != ReplicationRaft {
+		return "", fmt.Errorf("only raft replication has standbys, not %s", r)
+	}
+	if !slices.Contains(server.Roles, c.Role) {
+		return "", fmt.Errorf("unknown role %q", c.Role)
+	}
+	if !slices.Contains(server.CloudEventsModes, c.CloudEvents) {
+		return "", fmt.Errorf("unknown CloudEvents mode %q", c.CloudEvents)
+	}
+	if c.Role == server.RoleEdge && r == ReplicationNone {
+		return "", fmt.Errorf("an edge node forwards to a cluster, so needs replication")
+	}
+	if c.Role == server.RoleEdge && (c.Bootstrap || c.Standby) {
+		return "", fmt.Errorf("an edge node holds no log, so can't bootstrap or be a standby")
+	}
+	if c.Standby && c.Bootstrap {
+		return "", fmt.Errorf("a standby can't bootstrap a cluster, since it isn't a voter")
+	}
+	return r, nil
+}
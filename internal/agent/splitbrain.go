@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/discovery"
+	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/hashicorp/serf/serf"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// defaultSplitBrainCheckInterval is how often Raft agents check for a split
+// brain unless configured otherwise.
+const defaultSplitBrainCheckInterval = 10 * time.Second
+
+// watchSplitBrain checks for a split brain every SplitBrainCheckInterval
+// until the agent shuts down.
+func (a *Agent) watchSplitBrain() {
+	interval := a.Config.SplitBrainCheckInterval
+	if interval == 0 {
+		interval = defaultSplitBrainCheckInterval
+	}
+	for {
+		select {
+		case <-a.shutdowns:
+			return
+		case <-time.After(interval):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		a.checkSplitBrain(a.leaderViews(ctx))
+		cancel()
+	}
+}
+
+// checkSplitBrain raises the alarm if the members name more than one
+// leader, fencing produces if this node is on the minority side, and
+// clears it once they agree again.
+func (a *Agent) checkSplitBrain(views map[string]string) {
+	leaders, minority := splitBrain(views, a.id)
+	logger := zap.L().Named("agent")
+	if leaders == nil {
+		if a.splitBrained.Swap(false) {
+			logger.Info("split brain resolved")
+		}
+		a.splitBrain.Clear()
+		return
+	}
+
+	if !a.splitBrained.Swap(true) {
+		a.metrics.Counter("split_brain_detected").Inc()
+		logger.Error(
+			"split brain detected",
+			zap.Strings("leaders", leaders),
+			zap.Bool("minority", minority),
+		)
+	}
+	if minority {
+		a.splitBrain.Fence(leaders)
+	} else {
+		a.splitBrain.Clear()
+	}
+}
+
+// leaderViews asks this node and every live member holding the log which
+// node leads the cluster, returning their answers by node ID. Members that
+// don't answer, or know of no leader, are left out.
+func (a *Agent) leaderViews(ctx context.Context) map[string]string {
+	views := make(map[string]string)
+	if servers, err := a.raft.GetServers(); err == nil {
+		if leader := leaderOf(servers); leader != "" {
+			views[a.id] = leader
+		}
+	}
+	for _, m := range a.membeship.Members() {
+		id := m.Tags[discovery.TagNodeID]
+		if m.Status != serf.StatusAlive || id == "" || id == a.id ||
+			!server.Role(m.Tags[discovery.TagRole]).HoldsLog() {
+			continue
+		}
+		conn, err := grpc.DialContext(ctx, m.Tags["rpc_addr"], a.peerCredentials())
+		if err != nil {
+			continue
+		}
+		res, err := api.NewLogClient(conn).GetServers(ctx, &api.GetServersRequest{})
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		if leader := leaderOf(res.Servers); leader != "" {
+			views[id] = leader
+		}
+	}
+	return views
+}
+
+// leaderOf returns the ID of the leader among servers, or "" if there's
+// none.
+func leaderOf(servers []*api.Server) string {
+	for _, srv := range servers {
+		if srv.IsLeader {
+			return srv.Id
+		}
+	}
+	return ""
+}
+
+// splitBrain returns the leaders views, each node's leader by node ID,
+// name if they name more than one, and whether self is on the minority
+// side: its leader is named by no more nodes than another is.
+func splitBrain(views map[string]string, self string) (leaders []string, minority bool) {
+	followers := make(map[string]int)
+	for _, leader := range views {
+		followers[leader]++
+	}
+	if len(followers) < 2 {
+		return nil, false
+	}
+	mine := views[self]
+	for leader, n := range followers {
+		leaders = append(leaders, leader)
+		if leader != mine && n >= followers[mine] {
+			minority = true
+		}
+	}
+	sort.Strings(leaders)
+	return leaders, minority
+}
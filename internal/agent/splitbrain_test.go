@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBrain(t *testing.T) {
+	for scenario, test := range map[string]struct {
+		views    map[string]string
+		leaders  []string
+		minority bool
+	}{
+		"members agree": {
+			views: map[string]string{"a": "a", "b": "a", "c": "a"},
+		},
+		"majority side": {
+			views:   map[string]string{"a": "a", "b": "a", "c": "c"},
+			leaders: []string{"a", "c"},
+		},
+		"majority side following another leader": {
+			views:   map[string]string{"a": "c", "b": "a", "c": "c", "d": "c", "e": "a"},
+			leaders: []string{"a", "c"},
+		},
+		"minority side": {
+			views:    map[string]string{"a": "a", "b": "c", "c": "c", "d": "c"},
+			leaders:  []string{"a", "c"},
+			minority: true,
+		},
+		"tie": {
+			views:    map[string]string{"a": "a", "b": "b"},
+			leaders:  []string{"a", "b"},
+			minority: true,
+		},
+		"self without a leader": {
+			views:    map[string]string{"b": "b", "c": "c", "d": "c"},
+			leaders:  []string{"b", "c"},
+			minority: true,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			leaders, minority := splitBrain(test.views, "a")
+			require.Equal(t, test.leaders, leaders)
+			require.Equal(t, test.minority, minority)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/server"
+	"go.uber.org/zap"
+)
+
+// Startup phases, which the lifecycle reports until the agent serves.
+const (
+	phaseOpeningLog     = "opening-log"
+	phaseJoiningCluster = "joining-cluster"
+	phaseElectingLeader = "electing-leader"
+)
+
+// startup logs the milestones of the agent's startup as it reaches them,
+// with how long the step took and how long the agent has been starting,
+// and records the phase it moves on to in the lifecycle, so slow startups
+// can be told apart from stuck ones.
+type startup struct {
+	mu        sync.Mutex
+	lifecycle *server.Lifecycle
+	started   time.Time
+	last      time.Time
+}
+
+func newStartup(lifecycle *server.Lifecycle) *startup {
+	now := time.Now()
+	lifecycle.SetPhase(phaseOpeningLog)
+	return &startup{lifecycle: lifecycle, started: now, last: now}
+}
+
+// reached logs that the agent reached milestone, e.g. "log opened", and
+// moves on to phase, or to serving if phase is empty.
+func (s *startup) reached(milestone, phase string, fields ...zap.Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	fields = append(fields,
+		zap.Duration("took", now.Sub(s.last)),
+		zap.Duration("elapsed", now.Sub(s.started)),
+	)
+	s.last = now
+	zap.L().Named("agent").Info(milestone, fields...)
+	if phase != "" {
+		s.lifecycle.SetPhase(phase)
+	}
+}
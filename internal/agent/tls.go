@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"github.com/Tarunshrma/prolog/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// setupTLS builds the TLS configs the agent serves gRPC with and dials its
+// peers, and itself, with, if Config.TLS has a certificate.
+func (a *Agent) setupTLS() error {
+	if a.Config.TLS.CertFile == "" {
+		return nil
+	}
+	serverTLS := a.Config.TLS
+	serverTLS.Server = true
+	var err error
+	if a.serverTLS, err = config.SetupTLSConfig(serverTLS); err != nil {
+		return err
+	}
+	// Peers present the node's certificate, so servers requiring client
+	// certificates let them in.
+	peerTLS := a.Config.TLS
+	peerTLS.Server = false
+	a.peerTLS, err = config.SetupTLSConfig(peerTLS)
+	return err
+}
+
+// peerCredentials returns the transport credentials the agent dials its
+// peers and itself with: TLS if it serves TLS, otherwise none.
+func (a *Agent) peerCredentials() grpc.DialOption {
+	if a.peerTLS == nil {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(a.peerTLS.Clone()))
+}
@@ -0,0 +1,140 @@
+// Package blob stores record values too large to keep in the log, so the
+// log can keep a claim check pointing at them instead.
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by key. Keys are safe to use as file names and URL path
+// segments.
+type Store interface {
+	Put(ctx context.Context, key string, value []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Open returns the store at rawurl: file:///path for a directory, e.g. a
+// mounted bucket, or an http:// or https:// base URL of an object store
+// that takes PUTs and GETs of objects under it.
+func Open(rawurl string) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return &FileStore{Dir: u.Path}, nil
+	case "http", "https":
+		return &HTTPStore{BaseURL: rawurl}, nil
+	}
+	return nil, fmt.Errorf("unsupported blob store %q", rawurl)
+}
+
+var (
+	_ Store = (*FileStore)(nil)
+	_ Store = (*HTTPStore)(nil)
+)
+
+// FileStore keeps each blob in a file named by its key in Dir.
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, value []byte) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	// Write to a temp file and rename it into place so readers never see a
+	// partial blob.
+	f, err := os.CreateTemp(s.Dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.Dir, key))
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(s.Dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// HTTPStore keeps each blob as an object at BaseURL/key, PUT to store it
+// and GET to read it back.
+type HTTPStore struct {
+	BaseURL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (s *HTTPStore) Put(ctx context.Context, key string, value []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url(key), bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("blob store returned %s storing %s", resp.Status, key)
+	}
+	return nil
+}
+
+func (s *HTTPStore) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("blob store returned %s reading %s", resp.Status, key)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *HTTPStore) url(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
+
+func (s *HTTPStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
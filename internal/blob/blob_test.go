@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blob-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			objects[key] = b
+		case http.MethodGet:
+			b, ok := objects[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(b)
+		}
+	}))
+	defer srv.Close()
+
+	for scenario, rawurl := range map[string]string{
+		"file": "file://" + dir + "/blobs",
+		"http": srv.URL + "/bucket/",
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			store, err := Open(rawurl)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			require.NoError(t, store.Put(ctx, "abc", []byte("hello world")))
+			got, err := store.Get(ctx, "abc")
+			require.NoError(t, err)
+			require.Equal(t, []byte("hello world"), got)
+
+			_, err = store.Get(ctx, "missing")
+			require.Equal(t, ErrNotFound, err)
+		})
+	}
+
+	_, err = Open("s3://bucket")
+	require.Error(t, err)
+}
@@ -0,0 +1,120 @@
+// Package budget accounts for the goroutines and memory a node's
+// subsystems use, reports them as metrics and enforces soft limits on
+// them: work over a limit is refused when it starts, rather than work
+// already running being stopped.
+package budget
+
+import (
+	"sync"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+)
+
+// Resource is something a node has a limited amount of.
+type Resource string
+
+const (
+	// ConsumeStreams counts the ConsumeStream calls being served.
+	ConsumeStreams Resource = "consume_streams"
+	// ReplicationGoroutines counts the goroutines replicating peers'
+	// records.
+	ReplicationGoroutines Resource = "replication_goroutines"
+	// BufferBytes counts the memory of the log's store write buffers.
+	BufferBytes Resource = "buffer_bytes"
+	// MmapBytes counts the bytes of index files mapped into memory.
+	MmapBytes Resource = "mmap_bytes"
+)
+
+// Resources lists every resource a Budget accounts for.
+var Resources = []Resource{ConsumeStreams, ReplicationGoroutines, BufferBytes, MmapBytes}
+
+// Budget tracks how much of each resource is in use. A nil *Budget
+// accounts for nothing and refuses nothing, so subsystems can take one
+// optionally. It's safe for concurrent use.
+type Budget struct {
+	mu     sync.Mutex
+	limits map[Resource]int64
+	used   map[Resource]int64
+}
+
+// New returns a budget with the given soft limits. Resources without a
+// positive limit are accounted for but unlimited.
+func New(limits map[Resource]int64) *Budget {
+	b := &Budget{
+		limits: make(map[Resource]int64),
+		used:   make(map[Resource]int64),
+	}
+	for r, limit := range limits {
+		if limit > 0 {
+			b.limits[r] = limit
+		}
+	}
+	return b
+}
+
+// TryAcquire takes n of r, unless that would take r over its limit, and
+// reports whether it did. Taken resources must be released.
+func (b *Budget) TryAcquire(r Resource, n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limit, ok := b.limits[r]; ok && b.used[r]+n > limit {
+		return false
+	}
+	b.used[r] += n
+	return true
+}
+
+// Acquire takes n of r whatever its limit, for resources already in use
+// that can't be refused, like memory mapped to open an index.
+func (b *Budget) Acquire(r Resource, n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used[r] += n
+}
+
+// Release gives back n of r.
+func (b *Budget) Release(r Resource, n int64) {
+	b.Acquire(r, -n)
+}
+
+// Used returns how much of r is in use.
+func (b *Budget) Used(r Resource) int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used[r]
+}
+
+// Limit returns r's limit, or zero if it's unlimited.
+func (b *Budget) Limit(r Resource) int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limits[r]
+}
+
+// Register reports every resource's use, and the limits that are set, as
+// gauges named budget_<resource> and budget_<resource>_limit.
+func (b *Budget) Register(m *metrics.Registry) {
+	for _, r := range Resources {
+		r := r
+		m.Gauge("budget_"+string(r), func() float64 {
+			return float64(b.Used(r))
+		})
+		if b.Limit(r) > 0 {
+			m.Gauge("budget_"+string(r)+"_limit", func() float64 {
+				return float64(b.Limit(r))
+			})
+		}
+	}
+}
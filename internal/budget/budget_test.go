@@ -0,0 +1,41 @@
+package budget
+
+import (
+	"testing"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	b := New(map[Resource]int64{ConsumeStreams: 2})
+
+	require.True(t, b.TryAcquire(ConsumeStreams, 1))
+	require.True(t, b.TryAcquire(ConsumeStreams, 1))
+	require.False(t, b.TryAcquire(ConsumeStreams, 1))
+	b.Release(ConsumeStreams, 1)
+	require.True(t, b.TryAcquire(ConsumeStreams, 1))
+
+	// Memory already in use is accounted for over the limit.
+	require.True(t, b.TryAcquire(MmapBytes, 1<<30))
+	b.Acquire(MmapBytes, 1<<30)
+	require.Equal(t, int64(2<<30), b.Used(MmapBytes))
+
+	r := metrics.NewRegistry()
+	b.Register(r)
+	require.Equal(t, []metrics.Sample{
+		{Name: "budget_buffer_bytes", Kind: metrics.KindGauge, Value: 0},
+		{Name: "budget_consume_streams", Kind: metrics.KindGauge, Value: 2},
+		{Name: "budget_consume_streams_limit", Kind: metrics.KindGauge, Value: 2},
+		{Name: "budget_mmap_bytes", Kind: metrics.KindGauge, Value: 2 << 30},
+		{Name: "budget_replication_goroutines", Kind: metrics.KindGauge, Value: 0},
+	}, r.Snapshot())
+}
+
+func TestNilBudget(t *testing.T) {
+	var b *Budget
+	require.True(t, b.TryAcquire(ConsumeStreams, 1))
+	b.Acquire(MmapBytes, 1)
+	b.Release(MmapBytes, 1)
+	require.Zero(t, b.Used(ConsumeStreams))
+}
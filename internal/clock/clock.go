@@ -0,0 +1,202 @@
+// Package clock abstracts telling time and waiting, so code with timeouts,
+// pauses and pacing can be tested by advancing a fake clock instead of
+// sleeping.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells time and schedules timers.
+type Clock interface {
+	Now() time.Time
+	// After waits for d to pass and then sends the time on the channel.
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc waits for d to pass and then calls f.
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer. C is nil for timers made by AfterFunc.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+func (realClock) NewTimer(d time.Duration) Timer   { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// Fake is a clock that only moves when it's advanced. Timers due as it's
+// advanced fire in order, and AfterFunc funcs are called before Advance
+// returns, so tests can check their effects right after.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ Clock = (*Fake)(nil)
+
+// NewFake returns a fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.schedule(&fakeTimer{clock: f, f: fn}, d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.schedule(&fakeTimer{clock: f, c: make(chan time.Time, 1)}, d)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.schedule(&fakeTimer{clock: f, c: make(chan time.Time, 1), period: d}, d)}
+}
+
+// Advance moves the clock forward by d, firing the timers that come due on
+// the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	for len(f.timers) > 0 && !f.timers[0].when.After(end) {
+		t := f.timers[0]
+		f.now = t.when
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+			f.sort()
+		} else {
+			f.timers = f.timers[1:]
+		}
+		now := f.now
+		f.mu.Unlock()
+		t.fire(now)
+		f.mu.Lock()
+	}
+	f.now = end
+	f.mu.Unlock()
+}
+
+// Timers returns how many timers and tickers are waiting to fire, so tests
+// can wait for the code under test to start waiting before advancing.
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.when = f.now.Add(d)
+	// Timers already due send right away, like the time package's. Funcs
+	// wait for the next Advance rather than run on the caller's goroutine,
+	// which may hold locks they take.
+	if d <= 0 && t.period == 0 && t.f == nil {
+		t.fire(t.when)
+		return t
+	}
+	f.timers = append(f.timers, t)
+	f.sort()
+	return t
+}
+
+func (f *Fake) sort() {
+	sort.SliceStable(f.timers, func(i, j int) bool {
+		return f.timers[i].when.Before(f.timers[j].when)
+	})
+}
+
+// remove unschedules t and reports whether it was scheduled.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, other := range f.timers {
+		if other == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+	f      func()
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+		return
+	}
+	// Like the time package, drop ticks the receiver isn't keeping up with.
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	t.clock.schedule(t, d)
+	return active
+}
+
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,87 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, c *Fake){
+		"timers fire once due":       testFakeTimer,
+		"funcs run in order":         testFakeAfterFunc,
+		"stopped timers don't fire":  testFakeStop,
+		"tickers fire every period":  testFakeTicker,
+		"due timers send right away": testFakeDue,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t, NewFake(time.Unix(0, 0)))
+		})
+	}
+}
+
+func testFakeTimer(t *testing.T, c *Fake) {
+	ch := c.After(time.Second)
+	require.Equal(t, 1, c.Timers())
+
+	c.Advance(999 * time.Millisecond)
+	require.Empty(t, ch)
+
+	c.Advance(time.Millisecond)
+	require.Equal(t, time.Unix(1, 0), <-ch)
+	require.Equal(t, 0, c.Timers())
+}
+
+func testFakeAfterFunc(t *testing.T, c *Fake) {
+	var fired []time.Time
+	for _, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		c.AfterFunc(d, func() { fired = append(fired, c.Now()) })
+	}
+
+	c.Advance(time.Minute)
+	require.Equal(t, []time.Time{time.Unix(1, 0), time.Unix(2, 0), time.Unix(3, 0)}, fired)
+	require.Equal(t, time.Unix(60, 0), c.Now())
+}
+
+func testFakeStop(t *testing.T, c *Fake) {
+	timer := c.NewTimer(time.Second)
+	require.True(t, timer.Stop())
+	require.False(t, timer.Stop())
+	c.Advance(time.Second)
+	require.Empty(t, timer.C())
+
+	require.False(t, timer.Reset(time.Second))
+	require.True(t, timer.Reset(2*time.Second))
+	c.Advance(time.Second)
+	require.Empty(t, timer.C())
+	c.Advance(time.Second)
+	require.Len(t, timer.C(), 1)
+}
+
+func testFakeTicker(t *testing.T, c *Fake) {
+	ticker := c.NewTicker(time.Second)
+	c.Advance(time.Second)
+	require.Equal(t, time.Unix(1, 0), <-ticker.C())
+
+	// Ticks the receiver misses are dropped.
+	c.Advance(3 * time.Second)
+	require.Equal(t, time.Unix(2, 0), <-ticker.C())
+	require.Empty(t, ticker.C())
+
+	ticker.Stop()
+	c.Advance(time.Second)
+	require.Empty(t, ticker.C())
+}
+
+func testFakeDue(t *testing.T, c *Fake) {
+	require.Equal(t, time.Unix(0, 0), <-c.After(0))
+
+	// Funcs wait for the clock to move, since their caller may hold locks
+	// they take.
+	ran := false
+	c.AfterFunc(0, func() { ran = true })
+	require.False(t, ran)
+	c.Advance(0)
+	require.True(t, ran)
+}
@@ -0,0 +1,100 @@
+// Package config loads the certificates nodes and clients secure their
+// connections with.
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ClientAuth is how a server authenticates its clients.
+type ClientAuth string
+
+const (
+	// ClientAuthNone doesn't ask clients for certificates.
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthRequest verifies the certificates clients send against
+	// the CA, but serves clients that send none.
+	ClientAuthRequest ClientAuth = "request"
+	// ClientAuthRequire only serves clients with a certificate the CA
+	// signed: mutual TLS.
+	ClientAuthRequire ClientAuth = "require"
+)
+
+// TLSConfig is the certificates one side of a connection uses.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM certificate and key the side
+	// presents. Servers need them; clients only to authenticate to servers
+	// that ask.
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM CA bundle the side verifies the other's
+	// certificate against. Without it clients use the system roots and
+	// servers can't verify clients.
+	CAFile string
+	// ServerAddress is the name clients verify the server's certificate
+	// against. Defaults to the host dialed.
+	ServerAddress string
+	// Server builds a server's config rather than a client's.
+	Server bool
+	// ClientAuth is how a server authenticates its clients. Defaults to
+	// ClientAuthRequire if CAFile is set, else ClientAuthNone.
+	ClientAuth ClientAuth
+}
+
+// SetupTLSConfig builds the tls.Config cfg describes.
+func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if cfg.Server {
+		return nil, fmt.Errorf("a TLS server needs a certificate and key")
+	}
+
+	var pool *x509.CertPool
+	if cfg.CAFile != "" {
+		b, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("failed to parse a certificate from %s", cfg.CAFile)
+		}
+	}
+
+	if !cfg.Server {
+		tlsConfig.RootCAs = pool
+		tlsConfig.ServerName = cfg.ServerAddress
+		return tlsConfig, nil
+	}
+
+	auth := cfg.ClientAuth
+	if auth == "" {
+		auth = ClientAuthNone
+		if pool != nil {
+			auth = ClientAuthRequire
+		}
+	}
+	switch auth {
+	case ClientAuthNone:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", auth)
+	}
+	if auth != ClientAuthNone && pool == nil {
+		return nil, fmt.Errorf("verifying clients in %q mode needs a CA", auth)
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
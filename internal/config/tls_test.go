@@ -0,0 +1,138 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	_, err := SetupTLSConfig(TLSConfig{Server: true})
+	require.Error(t, err)
+	_, err = SetupTLSConfig(TLSConfig{
+		CertFile:   file("server.pem"),
+		KeyFile:    file("server-key.pem"),
+		Server:     true,
+		ClientAuth: ClientAuthRequire,
+	})
+	require.Error(t, err)
+
+	server, err := SetupTLSConfig(TLSConfig{
+		CertFile: file("server.pem"),
+		KeyFile:  file("server-key.pem"),
+		CAFile:   file("ca.pem"),
+		Server:   true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, server.ClientAuth)
+
+	// With a CA, servers require clients to have a certificate it signed.
+	client, err := SetupTLSConfig(TLSConfig{
+		CertFile:      file("client.pem"),
+		KeyFile:       file("client-key.pem"),
+		CAFile:        file("ca.pem"),
+		ServerAddress: "127.0.0.1",
+	})
+	require.NoError(t, err)
+	require.NoError(t, handshake(server, client))
+
+	anonymous, err := SetupTLSConfig(TLSConfig{CAFile: file("ca.pem"), ServerAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	require.Error(t, handshake(server, anonymous))
+
+	server, err = SetupTLSConfig(TLSConfig{
+		CertFile:   file("server.pem"),
+		KeyFile:    file("server-key.pem"),
+		CAFile:     file("ca.pem"),
+		Server:     true,
+		ClientAuth: ClientAuthRequest,
+	})
+	require.NoError(t, err)
+	require.NoError(t, handshake(server, anonymous))
+}
+
+// handshake runs a TLS handshake between server and client configs,
+// returning the server's error, or the client's if the server's succeeded.
+func handshake(server, client *tls.Config) error {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		// TLS 1.3 clients finish their handshake before the server
+		// verifies them, so read for the server's verdict.
+		_, err = conn.Read(make([]byte, 1))
+		errs <- err
+	}()
+	conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, cerr := conn.Write([]byte{0})
+	if err := <-errs; err != nil {
+		return err
+	}
+	return cerr
+}
+
+// writeCert writes a certificate for 127.0.0.1, and its key, to
+// <name>.pem and <name>-key.pem in dir, signed by parent, or self-signed as
+// a CA if parent is nil.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+"-key.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
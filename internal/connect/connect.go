@@ -0,0 +1,150 @@
+// Package connect runs connectors that move records between the log and
+// external systems. Sink connectors consume the log as a consumer group,
+// committing each record they deliver, so they resume from the last one
+// on whichever node serves them. Source connectors produce what they
+// read, e.g. lines tailed from a file, to the log.
+package connect
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"go.uber.org/zap"
+)
+
+// Sink writes records to an external system. Write is called with records in
+// offset order; a record is only marked delivered once Write returns nil.
+type Sink interface {
+	Write(ctx context.Context, record *api.Record) error
+	Close() error
+}
+
+// Source reads records from an external system and passes each to emit,
+// which produces it to the log, until ctx is done or reading fails.
+type Source interface {
+	Run(ctx context.Context, emit func(context.Context, *api.Record) error) error
+}
+
+// Connector names a sink or a source; set exactly one. A sink connector's
+// name is also the consumer group it consumes the log as, so it must be
+// unique and stable across restarts.
+type Connector struct {
+	Name   string
+	Sink   Sink
+	Source Source
+	// Topic and Partition are the log the connector reads or writes: a
+	// partition of Topic, or the default log if Topic is empty.
+	Topic     string
+	Partition uint32
+}
+
+// retryInterval is how long a connector waits to resubscribe after its
+// subscription or sink fails.
+const retryInterval = time.Second
+
+// Runtime runs connectors until it's closed, resubscribing any that fail.
+type Runtime struct {
+	logger *zap.Logger
+
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	clients []*client.Client
+	sinks   []Sink
+	// groups are the clients of the sinks, by name.
+	groups map[string]*client.Client
+}
+
+// Start runs connectors against the cluster at target, each through its
+// own client, configured by config with the connector's Topic and
+// Partition. Sinks' offsets are their consumer groups' commits, whatever
+// config's OffsetTracker.
+func Start(target string, config client.Config, connectors []Connector) (*Runtime, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runtime{
+		logger: zap.L().Named("connect"),
+		cancel: cancel,
+		groups: make(map[string]*client.Client),
+	}
+	for _, conn := range connectors {
+		config := config
+		config.Topic, config.Partition = conn.Topic, conn.Partition
+		c, err := client.New(target, config)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		c.OffsetTracker = client.NewGroupOffsetTracker(c)
+		r.clients = append(r.clients, c)
+		if conn.Sink != nil {
+			r.sinks = append(r.sinks, conn.Sink)
+			r.groups[conn.Name] = c
+		}
+		r.wg.Add(1)
+		go r.run(ctx, c, conn)
+	}
+	return r, nil
+}
+
+// Offsets returns the offset each sink consumes from next, by name.
+func (r *Runtime) Offsets(ctx context.Context) (map[string]uint64, error) {
+	nexts := make(map[string]uint64)
+	for name, c := range r.groups {
+		next, _, err := c.OffsetTracker.Load(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		nexts[name] = next
+	}
+	return nexts, nil
+}
+
+func (r *Runtime) run(ctx context.Context, c *client.Client, conn Connector) {
+	defer r.wg.Done()
+	for {
+		var err error
+		if conn.Source != nil {
+			err = conn.Source.Run(ctx, func(ctx context.Context, record *api.Record) error {
+				_, err := c.Produce(ctx, record)
+				return err
+			})
+		} else {
+			err = c.Subscribe(ctx, conn.Name, func(ctx context.Context, record *api.Record) error {
+				return conn.Sink.Write(ctx, record)
+			})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Error(
+			"connector failed",
+			zap.String("connector", conn.Name),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Close stops the connectors and closes their sinks and clients.
+func (r *Runtime) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	var err error
+	for _, sink := range r.sinks {
+		if cerr := sink.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for _, c := range r.clients {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/Tarunshrma/prolog/internal/connect"
+	"github.com/Tarunshrma/prolog/internal/log"
+	"github.com/Tarunshrma/prolog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestWebhookConnector(t *testing.T) {
+	var mu sync.Mutex
+	var got []uint64
+	fail := true
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Fail the first delivery to check it's retried.
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var record struct {
+			Offset uint64 `json:"offset"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+		got = append(got, record.Offset)
+	}))
+	defer hook.Close()
+
+	addr, c := setupServer(t)
+	ctx := context.Background()
+	require.NoError(t, c.CreateTopic(ctx, "orders", 2))
+	orders, err := client.New(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		Topic:       "orders",
+		Partition:   1,
+	})
+	require.NoError(t, err)
+	defer orders.Close()
+	for i := 0; i < 3; i++ {
+		_, err := orders.Produce(ctx, &api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+
+	r, err := connect.Start(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	}, []connect.Connector{{
+		Name:      "webhook",
+		Sink:      &connect.WebhookSink{URL: hook.URL},
+		Topic:     "orders",
+		Partition: 1,
+	}})
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []uint64{0, 1, 2}, got)
+	mu.Unlock()
+
+	// The sink's offset is its consumer group's commit.
+	require.Eventually(t, func() bool {
+		next, ok, err := orders.FetchOffset(ctx, "webhook")
+		return err == nil && ok && next == 3
+	}, 5*time.Second, 50*time.Millisecond)
+	offsets, err := r.Offsets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{"webhook": 3}, offsets)
+}
+
+func TestSourceConnector(t *testing.T) {
+	addr, c := setupServer(t)
+	ctx := context.Background()
+	require.NoError(t, c.CreateTopic(ctx, "logs", 2))
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("started\n"), 0644))
+	r, err := connect.Start(addr, client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	}, []connect.Connector{{
+		Name:      "file",
+		Source:    &connect.FileSource{Path: path, FromStart: true, Poll: 10 * time.Millisecond},
+		Topic:     "logs",
+		Partition: 1,
+	}})
+	require.NoError(t, err)
+	defer r.Close()
+
+	// The source produces to its topic's partition, not the default log.
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	logs := api.NewLogClient(conn)
+	require.Eventually(t, func() bool {
+		res, err := logs.Consume(ctx, &api.ConsumeRequest{Topic: "logs", Partition: 1})
+		return err == nil && string(res.Record.Value) == "started"
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = logs.Consume(ctx, &api.ConsumeRequest{})
+	require.Error(t, err)
+}
+
+// setupClient returns a client of a new server.
+func setupClient(t *testing.T) *client.Client {
+	t.Helper()
+	_, c := setupServer(t)
+	return c
+}
+
+// setupServer starts a server with topics and consumer groups, returning
+// its address and a client of it.
+func setupServer(t *testing.T) (string, *client.Client) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "connect-test")
+	require.NoError(t, err)
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	topics, err := log.NewTopics(dir, log.Config{})
+	require.NoError(t, err)
+	groups, err := server.NewConsumerGroups(topics)
+	require.NoError(t, err)
+
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{
+		CommitLog: clog,
+		Topics:    topics,
+		Groups:    groups,
+	}))
+	require.NoError(t, err)
+	go srv.Serve(l)
+
+	c, err := client.New(l.Addr().String(), client.Config{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		c.Close()
+		srv.Stop()
+		topics.Close()
+		clog.Remove()
+	})
+	return l.Addr().String(), c
+}
@@ -0,0 +1,298 @@
+package connect
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// Headers records received over the Forward protocol carry.
+const (
+	// HeaderFluentTag is the tag Fluentd or Fluent Bit routed the event by.
+	HeaderFluentTag = "fluent-tag"
+	// HeaderFluentTime is the event's time in RFC 3339 format.
+	HeaderFluentTime = "fluent-time"
+)
+
+var _ Source = (*ForwardSource)(nil)
+
+// ForwardSource listens on Addr for Fluentd and Fluent Bit's Forward
+// protocol, so their forward outputs can ship logs to the cluster. Each event
+// is produced as a JSON record tagged with its tag and time. It accepts the
+// Message, Forward, PackedForward and gzip CompressedPackedForward modes,
+// and acknowledges chunks once their events are produced, but not the
+// shared key handshake, so it should only listen where it's trusted.
+type ForwardSource struct {
+	Addr string
+}
+
+func (s *ForwardSource) Run(ctx context.Context, emit func(context.Context, *api.Record) error) error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	// A connection that fails to produce closes the listener and reports
+	// why here.
+	errc := make(chan error, 1)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case err := <-errc:
+				return err
+			default:
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := s.serve(ctx, conn, emit)
+			if _, ok := err.(forwardEmitError); ok {
+				select {
+				case errc <- err:
+				default:
+				}
+				ln.Close()
+			}
+		}()
+	}
+}
+
+// forwardEmitError wraps errors producing events, as opposed to errors
+// reading a connection, which only drop that connection.
+type forwardEmitError struct {
+	error
+}
+
+// serve handles the messages sent on conn until it's closed.
+func (s *ForwardSource) serve(ctx context.Context, conn net.Conn, emit func(context.Context, *api.Record) error) error {
+	d := msgpack.NewDecoder(bufio.NewReader(conn))
+	e := msgpack.NewEncoder(conn)
+	for {
+		tag, entries, options, err := decodeForward(d)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			record, err := forwardRecord(tag, entry)
+			if err != nil {
+				return err
+			}
+			if err := emit(ctx, record); err != nil {
+				return forwardEmitError{err}
+			}
+		}
+		if chunk, ok := options["chunk"].(string); ok {
+			if err := e.Encode(map[string]string{"ack": chunk}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// forwardEntry is an event: its time and its record.
+type forwardEntry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// decodeForward decodes a message in any of the Forward protocol's modes:
+//
+//	Message:       [tag, time, record, options?]
+//	Forward:       [tag, [[time, record], ...], options?]
+//	PackedForward: [tag, bin of concatenated [time, record], options?]
+func decodeForward(d *msgpack.Decoder) (tag string, entries []forwardEntry, options map[string]interface{}, err error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if n < 2 {
+		return "", nil, nil, fmt.Errorf("forward: message has %d elements", n)
+	}
+	if tag, err = d.DecodeString(); err != nil {
+		return "", nil, nil, err
+	}
+
+	c, err := d.PeekCode()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var packed []byte
+	used := 2
+	switch {
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		m, err := d.DecodeArrayLen()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		for i := 0; i < m; i++ {
+			entry, err := decodeForwardEntry(d)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			entries = append(entries, entry)
+		}
+	case msgpcode.IsString(c) || msgpcode.IsBin(c):
+		if packed, err = d.DecodeBytes(); err != nil {
+			return "", nil, nil, err
+		}
+	default:
+		if n < 3 {
+			return "", nil, nil, fmt.Errorf("forward: message has %d elements", n)
+		}
+		t, err := decodeForwardTime(d)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		record, err := d.DecodeMap()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		entries = append(entries, forwardEntry{time: t, record: record})
+		used = 3
+	}
+
+	if n > used {
+		if options, err = d.DecodeMap(); err != nil {
+			return "", nil, nil, err
+		}
+		for i := used + 1; i < n; i++ {
+			if err := d.Skip(); err != nil {
+				return "", nil, nil, err
+			}
+		}
+	}
+
+	if packed != nil {
+		var r io.Reader = bytes.NewReader(packed)
+		if options["compressed"] == "gzip" {
+			if r, err = gzip.NewReader(r); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		pd := msgpack.NewDecoder(r)
+		for {
+			entry, err := decodeForwardEntry(pd)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", nil, nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return tag, entries, options, nil
+}
+
+func decodeForwardEntry(d *msgpack.Decoder) (forwardEntry, error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return forwardEntry{}, err
+	}
+	if n != 2 {
+		return forwardEntry{}, fmt.Errorf("forward: entry has %d elements", n)
+	}
+	t, err := decodeForwardTime(d)
+	if err != nil {
+		return forwardEntry{}, err
+	}
+	record, err := d.DecodeMap()
+	if err != nil {
+		return forwardEntry{}, err
+	}
+	return forwardEntry{time: t, record: record}, nil
+}
+
+// decodeForwardTime decodes an event's time, either seconds since the epoch
+// or an EventTime: ext type 0 holding big-endian seconds and nanoseconds.
+func decodeForwardTime(d *msgpack.Decoder) (time.Time, error) {
+	c, err := d.PeekCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !msgpcode.IsExt(c) && !msgpcode.IsFixedExt(c) {
+		sec, err := d.DecodeInt64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	}
+
+	id, n, err := d.DecodeExtHeader()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if id != 0 || n != 8 {
+		return time.Time{}, fmt.Errorf("forward: unknown time ext type %d of %d bytes", id, n)
+	}
+	var b [8]byte
+	if err := d.ReadFull(b[:]); err != nil {
+		return time.Time{}, err
+	}
+	sec := binary.BigEndian.Uint32(b[:4])
+	nsec := binary.BigEndian.Uint32(b[4:])
+	return time.Unix(int64(sec), int64(nsec)), nil
+}
+
+func forwardRecord(tag string, entry forwardEntry) (*api.Record, error) {
+	value, err := json.Marshal(jsonValue(entry.record))
+	if err != nil {
+		return nil, err
+	}
+	return &api.Record{
+		Value:       value,
+		ContentType: "application/json",
+		Headers: map[string]string{
+			HeaderFluentTag:  tag,
+			HeaderFluentTime: entry.time.UTC().Format(time.RFC3339Nano),
+		},
+	}, nil
+}
+
+// jsonValue converts what msgpack decodes into values encoding/json
+// marshals as a logging agent meant them: binary strings as strings, and
+// maps with any keys as objects.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = jsonValue(v[k])
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(jsonValue(k))] = jsonValue(e)
+		}
+		return m
+	}
+	return v
+}
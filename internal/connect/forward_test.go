@@ -0,0 +1,78 @@
+package connect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// eventTime encodes t as a Forward protocol EventTime.
+func eventTime(t time.Time) msgpack.RawMessage {
+	b := []byte{0xd7, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:6], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[6:], uint32(t.Nanosecond()))
+	return b
+}
+
+func TestForwardSource(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", dynaport.Get(1)[0])
+	at := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	var packed bytes.Buffer
+	zw := gzip.NewWriter(&packed)
+	pe := msgpack.NewEncoder(zw)
+	for _, msg := range []string{"packed 1", "packed 2"} {
+		require.NoError(t, pe.Encode([]interface{}{eventTime(at), map[string]string{"log": msg}}))
+	}
+	require.NoError(t, zw.Close())
+
+	source := &ForwardSource{Addr: addr}
+	records := collect(t, source, 4, func() {
+		var conn net.Conn
+		require.Eventually(t, func() bool {
+			var err error
+			conn, err = net.Dial("tcp", addr)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		defer conn.Close()
+		e := msgpack.NewEncoder(conn)
+
+		// Message mode with a time in seconds.
+		require.NoError(t, e.Encode([]interface{}{
+			"app.access", at.Unix(), map[string]interface{}{"log": "message", "status": 200},
+		}))
+		// Forward mode, asking for an ack.
+		require.NoError(t, e.Encode([]interface{}{
+			"app.access",
+			[]interface{}{[]interface{}{eventTime(at), map[string]string{"log": "forward"}}},
+			map[string]string{"chunk": "c1"},
+		}))
+		var ack map[string]string
+		require.NoError(t, msgpack.NewDecoder(conn).Decode(&ack))
+		require.Equal(t, "c1", ack["ack"])
+		// CompressedPackedForward mode.
+		require.NoError(t, e.Encode([]interface{}{
+			"app.error", packed.Bytes(), map[string]string{"compressed": "gzip"},
+		}))
+	})
+
+	require.Equal(t, []string{
+		`{"log":"message","status":200}`,
+		`{"log":"forward"}`,
+		`{"log":"packed 1"}`,
+		`{"log":"packed 2"}`,
+	}, values(records))
+	require.Equal(t, "app.access", records[0].Headers[HeaderFluentTag])
+	require.Equal(t, "2024-05-01T12:00:00Z", records[0].Headers[HeaderFluentTime])
+	require.Equal(t, "2024-05-01T12:00:00.0000005Z", records[1].Headers[HeaderFluentTime])
+	require.Equal(t, "app.error", records[3].Headers[HeaderFluentTag])
+	require.Equal(t, "application/json", records[3].ContentType)
+}
@@ -0,0 +1,168 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ Sink = (*Mirror)(nil)
+
+// ConflictPolicy decides, for bidirectional mirrors, whether a record is
+// mirrored when the target cluster has written the same key too.
+type ConflictPolicy string
+
+const (
+	// SourceWins mirrors every record, so the target ends up with both
+	// clusters' writes in the order they were mirrored.
+	SourceWins ConflictPolicy = "source-wins"
+	// TimestampWins drops records appended before the latest write of
+	// their key the mirror has seen from the target cluster, so the last
+	// writer by append time wins.
+	TimestampWins ConflictPolicy = "timestamp-wins"
+)
+
+// maxCheckpoints bounds the offset translations a Mirror remembers.
+const maxCheckpoints = 4096
+
+// Mirror is a sink that copies the log to another cluster, for
+// active-active setups where each cluster mirrors to the other.
+//
+// Mirrored records are stamped with the cluster they were first produced
+// to, Cluster unless a mirror already stamped another, and the cluster and
+// offset they were mirrored from. Records whose origin is Target came from
+// it through another mirror and aren't copied back.
+type Mirror struct {
+	// Cluster is the ID of the cluster the mirror reads from, and Target
+	// of the one it writes to through Client.
+	Cluster string
+	Target  string
+	Client  *client.Client
+	// Policy defaults to SourceWins.
+	Policy ConflictPolicy
+	// KeyHeader names the header holding the key records write, which
+	// TimestampWins compares writes of. Records without it never conflict.
+	KeyHeader string
+
+	mu sync.Mutex
+	// targetWrites is when the target cluster last wrote each key, as far
+	// as the mirror has seen from the records mirrored back from it.
+	targetWrites map[string]time.Time
+	// checkpoints translates offsets, in increasing order of both. forgot
+	// is whether older ones were dropped.
+	checkpoints []checkpoint
+	forgot      bool
+}
+
+// checkpoint is a record's offset in the source cluster and in the target.
+type checkpoint struct {
+	source, target uint64
+}
+
+func (m *Mirror) Write(ctx context.Context, record *api.Record) error {
+	key, keyed := record.Headers[m.KeyHeader]
+	keyed = keyed && m.KeyHeader != ""
+	if origin, ok := record.Headers[api.HeaderOriginCluster]; ok && origin == m.Target {
+		if keyed {
+			m.sawTargetWrite(key, appendTime(record))
+		}
+		return nil
+	}
+	if keyed && m.Policy == TimestampWins && m.conflicts(key, appendTime(record)) {
+		zap.L().Named("mirror").Debug(
+			"dropping record overwritten in the target cluster",
+			zap.String("target", m.Target),
+			zap.Uint64("offset", record.Offset),
+			zap.String("key", key),
+		)
+		return nil
+	}
+
+	// Cloning, rather than copying fields, keeps the ones added later, like
+	// the content type and encoding; only the position is the target's.
+	mirrored := proto.Clone(record).(*api.Record)
+	mirrored.Offset = 0
+	mirrored.Term = 0
+	if mirrored.Headers == nil {
+		mirrored.Headers = make(map[string]string, 3)
+	}
+	if _, ok := mirrored.Headers[api.HeaderOriginCluster]; !ok {
+		mirrored.Headers[api.HeaderOriginCluster] = m.Cluster
+	}
+	mirrored.Headers[api.HeaderMirrorCluster] = m.Cluster
+	mirrored.Headers[api.HeaderMirrorOffset] = strconv.FormatUint(record.Offset, 10)
+
+	off, err := m.Client.Produce(ctx, mirrored)
+	if err != nil {
+		return fmt.Errorf("mirror to %s: %w", m.Target, err)
+	}
+	m.checkpoint(record.Offset, off)
+	return nil
+}
+
+func (m *Mirror) sawTargetWrite(key string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.targetWrites == nil {
+		m.targetWrites = make(map[string]time.Time)
+	}
+	if t.After(m.targetWrites[key]) {
+		m.targetWrites[key] = t
+	}
+}
+
+// conflicts reports whether the target cluster wrote key after t.
+func (m *Mirror) conflicts(key string, t time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.targetWrites[key].After(t)
+}
+
+func (m *Mirror) checkpoint(source, target uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints = append(m.checkpoints, checkpoint{source: source, target: target})
+	if len(m.checkpoints) > maxCheckpoints {
+		m.checkpoints = m.checkpoints[len(m.checkpoints)-maxCheckpoints:]
+		m.forgot = true
+	}
+}
+
+// Translate returns the offset in the target cluster a consumer that would
+// have read offset next from the source should resume from: that of the
+// first record mirrored from at or after next. It reports false if the
+// mirror hasn't mirrored such a record, or no longer remembers it; the
+// HeaderMirrorOffset headers in the target's log translate any offset.
+func (m *Mirror) Translate(next uint64) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.Search(len(m.checkpoints), func(i int) bool {
+		return m.checkpoints[i].source >= next
+	})
+	if i == len(m.checkpoints) || (i == 0 && m.forgot && next < m.checkpoints[0].source) {
+		return 0, false
+	}
+	return m.checkpoints[i].target, true
+}
+
+func (m *Mirror) Close() error {
+	return m.Client.Close()
+}
+
+// appendTime returns when the record was appended to its origin cluster,
+// or the zero time if it wasn't stamped.
+func appendTime(record *api.Record) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, record.Headers[api.HeaderAppendTime])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,69 @@
+package connect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/connect"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	target := setupClient(t)
+	m := &connect.Mirror{
+		Cluster:   "a",
+		Target:    "b",
+		Client:    target,
+		Policy:    connect.TimestampWins,
+		KeyHeader: "key",
+	}
+
+	at := func(sec int) string {
+		return time.Unix(int64(sec), 0).UTC().Format(time.RFC3339Nano)
+	}
+	ctx := context.Background()
+	for _, record := range []*api.Record{
+		{Offset: 0, Headers: map[string]string{"key": "x", api.HeaderAppendTime: at(2)}},
+		// Mirrored from b, so not mirrored back, but b wrote x at 3.
+		{Offset: 1, Headers: map[string]string{
+			"key":                   "x",
+			api.HeaderAppendTime:    at(3),
+			api.HeaderOriginCluster: "b",
+		}},
+		// Overwritten by b's later write.
+		{Offset: 2, Headers: map[string]string{"key": "x", api.HeaderAppendTime: at(1)}},
+		{
+			Offset:          3,
+			Headers:         map[string]string{"key": "y", api.HeaderAppendTime: at(1)},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+		},
+	} {
+		require.NoError(t, m.Write(ctx, record))
+	}
+
+	var got []*api.Record
+	err := target.ConsumeRange(ctx, 0, 2, func(ctx context.Context, record *api.Record) error {
+		got = append(got, record)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+	for i, source := range []string{"0", "3"} {
+		require.Equal(t, "a", got[i].Headers[api.HeaderOriginCluster])
+		require.Equal(t, "a", got[i].Headers[api.HeaderMirrorCluster])
+		require.Equal(t, source, got[i].Headers[api.HeaderMirrorOffset])
+	}
+	require.Equal(t, "application/json", got[1].ContentType)
+	require.Equal(t, "gzip", got[1].ContentEncoding)
+
+	for next, want := range map[uint64]uint64{0: 0, 1: 1, 3: 1} {
+		off, ok := m.Translate(next)
+		require.True(t, ok)
+		require.Equal(t, want, off)
+	}
+	_, ok := m.Translate(4)
+	require.False(t, ok)
+}
@@ -0,0 +1,180 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/export"
+)
+
+var _ Sink = (*S3Sink)(nil)
+
+// S3Sink uploads each record to an S3 bucket, or a store with S3's API like
+// MinIO, as an object holding the record in the export package's JSONL
+// format. Objects are keyed by Prefix and the record's offset, zero padded
+// so keys sort in offset order, e.g. orders/0/00000000000000000042.json, so
+// an upload retried after a failure replaces the same object rather than
+// adding another. Connectors sinking different logs to one bucket need
+// different prefixes.
+//
+// Requests are signed with AWS Signature Version 4 and address the bucket
+// by path, which every S3 compatible store supports.
+type S3Sink struct {
+	// Endpoint is the store's URL, e.g. https://s3.us-east-1.amazonaws.com.
+	Endpoint string
+	Region   string
+	Bucket   string
+	Prefix   string
+	// AccessKeyID and SecretAccessKey sign the requests, along with
+	// SessionToken if the credentials are temporary.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Key returns the key of the object record is uploaded to.
+func (s *S3Sink) Key(record *api.Record) string {
+	return fmt.Sprintf("%s%020d.json", s.Prefix, record.Offset)
+}
+
+func (s *S3Sink) Write(ctx context.Context, record *api.Record) error {
+	var body bytes.Buffer
+	w := export.NewJSONLWriter(&body)
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return err
+	}
+	endpoint.Path = "/" + s.Bucket + "/" + s.Key(record)
+	endpoint.RawPath = "/" + uriEncode(s.Bucket) + "/" + uriEncode(s.Key(record))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signV4(req, body.Bytes(), s.AccessKeyID, s.SecretAccessKey, s.Region, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("s3 put %s responded %s: %s", s.Key(record), res.Status, msg)
+	}
+	return nil
+}
+
+func (s *S3Sink) Close() error {
+	return nil
+}
+
+// signV4 signs req, whose body is body and which has no query string, for
+// S3 in region as of t, with AWS Signature Version 4, signing all of req's
+// headers along with its host.
+func signV4(req *http.Request, body []byte, accessKeyID, secretAccessKey, region string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		// The sink's requests have no query string.
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// uriEncode percent encodes every byte of s but the unreserved characters,
+// and /, which separates the parts of S3 keys.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,88 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/export"
+)
+
+var (
+	_ Sink = (*WriterSink)(nil)
+	_ Sink = (*WebhookSink)(nil)
+)
+
+// WriterSink writes records to w as JSON lines, e.g. to stdout.
+type WriterSink struct {
+	mu sync.Mutex
+	w  *export.JSONLWriter
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: export.NewJSONLWriter(w)}
+}
+
+func (s *WriterSink) Write(ctx context.Context, record *api.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	// Flush each record so it's delivered before its offset is stored.
+	return s.w.Close()
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// WebhookSink POSTs each record to URL as a JSON object in the export
+// package's JSONL format. Any response other than 2xx fails the write, so
+// the record is retried.
+type WebhookSink struct {
+	URL string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (s *WebhookSink) Write(ctx context.Context, record *api.Record) error {
+	var body bytes.Buffer
+	w := export.NewJSONLWriter(&body)
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s responded %s", s.URL, res.Status)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,258 @@
+package connect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// HeaderSource names where a source connector read a record from, e.g. a
+// file path or a syslog client's address.
+const HeaderSource = "prolog-source"
+
+var (
+	_ Source = (*FileSource)(nil)
+	_ Source = (*SyslogSource)(nil)
+	_ Source = (*JournaldSource)(nil)
+)
+
+// FileSource tails a file like tail -F, producing each line as a record. It
+// follows the path across rotation, reopening it when it's replaced or
+// truncated. It doesn't remember its position, so it starts from the end of
+// the file, or from the start with FromStart, each time it runs.
+type FileSource struct {
+	Path      string
+	FromStart bool
+	// Poll is how often to check for new lines. Defaults to 250ms.
+	Poll time.Duration
+}
+
+func (s *FileSource) Run(ctx context.Context, emit func(context.Context, *api.Record) error) error {
+	poll := s.Poll
+	if poll == 0 {
+		poll = 250 * time.Millisecond
+	}
+
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	if !s.FromStart {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	r := bufio.NewReader(f)
+
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			record := lineRecord(partial[:len(partial)-1], s.Path)
+			partial = nil
+			if err := emit(ctx, record); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+
+		rotated, err := s.rotated(f)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			// Finish reading the old file before switching to the new one.
+			if rest, _ := io.ReadAll(r); len(rest) > 0 || len(partial) > 0 {
+				partial = append(partial, rest...)
+				if err := emit(ctx, lineRecord(partial, s.Path)); err != nil {
+					return err
+				}
+				partial = nil
+			}
+			f.Close()
+			if f, err = os.Open(s.Path); err != nil {
+				return err
+			}
+			r.Reset(f)
+		}
+	}
+}
+
+// rotated reports whether the file at the path isn't f anymore, or has been
+// truncated below what's been read of it.
+func (s *FileSource) rotated(f *os.File) (bool, error) {
+	fi, err := os.Stat(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotation renamed the file and its replacement isn't there yet.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cur, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(fi, cur) {
+		return true, nil
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() < pos, nil
+}
+
+// SyslogSource receives syslog messages on Addr over "udp", one message per
+// datagram, or "tcp", one message per line, and produces each as a record.
+// Messages are stored as received, without parsing their priority or
+// timestamp.
+type SyslogSource struct {
+	Network string
+	Addr    string
+}
+
+func (s *SyslogSource) Run(ctx context.Context, emit func(context.Context, *api.Record) error) error {
+	if s.Network == "udp" {
+		return s.runUDP(ctx, emit)
+	}
+
+	ln, err := net.Listen(s.Network, s.Addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	// A connection that fails to produce closes the listener and reports
+	// why here.
+	errc := make(chan error, 1)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case err := <-errc:
+				return err
+			default:
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			source := conn.RemoteAddr().String()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				if err := emit(ctx, lineRecord(scanner.Bytes(), source)); err != nil {
+					select {
+					case errc <- err:
+					default:
+					}
+					ln.Close()
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *SyslogSource) runUDP(ctx context.Context, emit func(context.Context, *api.Record) error) error {
+	conn, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	// Syslog over UDP limits messages to a datagram.
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := emit(ctx, lineRecord(buf[:n], addr.String())); err != nil {
+			return err
+		}
+	}
+}
+
+// JournaldSource follows the systemd journal through journalctl, producing
+// each entry as a JSON record. It starts with new entries each time it runs.
+type JournaldSource struct {
+	// Command runs journalctl. Defaults to following the whole journal:
+	// journalctl --follow --lines=0 --output=json.
+	Command []string
+}
+
+func (s *JournaldSource) Run(ctx context.Context, emit func(context.Context, *api.Record) error) error {
+	command := s.Command
+	if len(command) == 0 {
+		command = []string{"journalctl", "--follow", "--lines=0", "--output=json"}
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(out)
+	// Journal entries can carry large fields, e.g. core dump metadata.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record := lineRecord(scanner.Bytes(), "journald")
+		record.ContentType = "application/json"
+		if err := emit(ctx, record); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+// lineRecord copies line, which callers reuse, into a record from source.
+func lineRecord(line []byte, source string) *api.Record {
+	return &api.Record{
+		Value:   append([]byte(nil), line...),
+		Headers: map[string]string{HeaderSource: source},
+	}
+}
@@ -0,0 +1,125 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
+)
+
+// collect runs source until it has emitted n records.
+func collect(t *testing.T, source Source, n int, act func()) []*api.Record {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var records []*api.Record
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Run(ctx, func(ctx context.Context, record *api.Record) error {
+			mu.Lock()
+			defer mu.Unlock()
+			records = append(records, record)
+			return nil
+		})
+	}()
+
+	act()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(records) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+	return records
+}
+
+func values(records []*api.Record) []string {
+	var vals []string
+	for _, record := range records {
+		vals = append(vals, string(record.Value))
+	}
+	return vals
+}
+
+func TestFileSourceFollowsRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-source-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("old\n"), 0644))
+
+	appendLine := func(line string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(line)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	source := &FileSource{Path: path, Poll: 10 * time.Millisecond}
+	records := collect(t, source, 3, func() {
+		time.Sleep(50 * time.Millisecond)
+		appendLine("first\n")
+		appendLine("second")
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendLine("third\n")
+	})
+
+	// Lines written before the source started are skipped, and the
+	// unterminated line is flushed when the file rotates.
+	require.Equal(t, []string{"first", "second", "third"}, values(records))
+	require.Equal(t, path, records[0].Headers[HeaderSource])
+}
+
+func TestSyslogSource(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			addr := fmt.Sprintf("127.0.0.1:%d", dynaport.Get(1)[0])
+			source := &SyslogSource{Network: network, Addr: addr}
+			records := collect(t, source, 2, func() {
+				// UDP can't tell whether the source is listening yet.
+				time.Sleep(50 * time.Millisecond)
+				var conn net.Conn
+				require.Eventually(t, func() bool {
+					var err error
+					conn, err = net.Dial(network, addr)
+					return err == nil
+				}, time.Second, 10*time.Millisecond)
+				defer conn.Close()
+				for _, msg := range []string{"<34>1 first", "<34>1 second"} {
+					if network == "tcp" {
+						msg += "\n"
+					}
+					_, err := conn.Write([]byte(msg))
+					require.NoError(t, err)
+				}
+			})
+			require.Equal(t, []string{"<34>1 first", "<34>1 second"}, values(records))
+		})
+	}
+}
+
+func TestJournaldSource(t *testing.T) {
+	source := &JournaldSource{
+		Command: []string{"echo", `{"MESSAGE":"hello"}`},
+	}
+	records := collect(t, source, 1, func() {})
+	require.Equal(t, `{"MESSAGE":"hello"}`, string(records[0].Value))
+	require.Equal(t, "application/json", records[0].ContentType)
+}
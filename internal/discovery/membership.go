@@ -2,7 +2,10 @@ package discovery
 
 import (
 	"net"
+	"slices"
+	"time"
 
+	"github.com/Tarunshrma/prolog/backend"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 	"go.uber.org/zap"
@@ -10,18 +13,23 @@ import (
 
 type Membership struct {
 	Config
-	handler Handler
+	handler backend.Handler
 	serf    *serf.Serf
 	events  chan serf.Event
 	logger  *zap.Logger
+	flaps   flaps
 }
 
-func New(handler Handler, config Config) (*Membership, error) {
+func New(handler backend.Handler, config Config) (*Membership, error) {
 	m := &Membership{
 		Config:  config,
 		handler: handler,
 		events:  make(chan serf.Event),
 		logger:  zap.L().Named("membership"),
+		flaps: flaps{
+			failures: make(map[string][]time.Time),
+			members:  make(map[string]*quarantinedMember),
+		},
 	}
 
 	if err := m.setupSerf(); err != nil {
@@ -36,6 +44,13 @@ type Config struct {
 	BindAddr       string
 	Tags           map[string]string
 	StartJoinAddrs []string
+	// Roles, if set, limits the members passed to the handler to those
+	// advertising one of these roles under TagRole. Members without the
+	// tag have the empty role.
+	Roles []string
+	// Quarantine, if its Failures is set, keeps flapping members from
+	// rejoining as voters.
+	Quarantine QuarantineConfig
 }
 
 func (m *Membership) setupSerf() error {
@@ -73,9 +88,36 @@ func (m *Membership) setupSerf() error {
 	return nil
 }
 
-type Handler interface {
-	Join(name, addr string) error
-	Leave(name string) error
+// TagRole is the role a member advertises, e.g. "edge" for a member that
+// holds no log.
+const TagRole = "role"
+
+// TagLabelPrefix prefixes the tags a member advertises its operator-set
+// labels under, e.g. "label:zone" for the zone label.
+const TagLabelPrefix = "label:"
+
+// TagStandby marks a member as a warm standby when set to "true".
+const TagStandby = "standby"
+
+// TagNodeID is the ID a member advertises, which the handler knows it by
+// rather than by its name, since names may repeat across restarts of
+// containers sharing a hostname. Members without the tag are known by
+// their name.
+const TagNodeID = "node_id"
+
+// memberID returns the ID the handler knows member by.
+func memberID(member serf.Member) string {
+	if id := member.Tags[TagNodeID]; id != "" {
+		return id
+	}
+	return member.Name
+}
+
+// StandbyHandler is implemented by handlers that add warm standbys
+// differently from other members. Members tagged with TagStandby are joined
+// through JoinStandby if the handler implements it.
+type StandbyHandler interface {
+	JoinStandby(name, addr string) error
 }
 
 func (m *Membership) eventHandler() {
@@ -83,16 +125,19 @@ func (m *Membership) eventHandler() {
 		switch e.EventType() {
 		case serf.EventMemberJoin:
 			for _, member := range e.(serf.MemberEvent).Members { // e.(serf.MemberEvent) ??
-				if m.isLocal(member) {
+				if m.isLocal(member) || !m.handles(member) {
 					continue
 				}
 				m.handleJoin(member)
 			}
 		case serf.EventMemberLeave, serf.EventMemberFailed:
 			for _, member := range e.(serf.MemberEvent).Members {
-				if m.isLocal(member) {
+				if m.isLocal(member) || !m.handles(member) {
 					continue
 				}
+				if e.EventType() == serf.EventMemberFailed {
+					m.fail(member)
+				}
 				m.handleLeave(member)
 			}
 		}
@@ -101,14 +146,33 @@ func (m *Membership) eventHandler() {
 
 func (m *Membership) handleJoin(member serf.Member) {
 	m.logger.Info("Node joined", zap.String("name", member.Name), zap.String("addr", member.Addr.String()))
-	if err := m.handler.Join(member.Name, member.Tags["rpc_addrs"]); err != nil {
+	if err := m.join(member); err != nil {
 		m.logError(err, "Failed to handle join", member)
 	}
 }
 
+// join passes member to the handler, through JoinStandby if it's a
+// standby or quarantined. Quarantined members aren't joined at all if the
+// handler has no standbys.
+func (m *Membership) join(member serf.Member) error {
+	id, addr := memberID(member), member.Tags["rpc_addr"]
+	h, standbys := m.handler.(StandbyHandler)
+	if m.quarantined(id) {
+		if !standbys {
+			m.logger.Info("Quarantined node not joined", zap.String("name", member.Name), zap.String("id", id))
+			return nil
+		}
+		return h.JoinStandby(id, addr)
+	}
+	if standbys && member.Tags[TagStandby] == "true" {
+		return h.JoinStandby(id, addr)
+	}
+	return m.handler.Join(id, addr)
+}
+
 func (m *Membership) handleLeave(member serf.Member) {
 	m.logger.Info("Node left", zap.String("name", member.Name), zap.String("addr", member.Addr.String()))
-	if err := m.handler.Leave(member.Name); err != nil {
+	if err := m.handler.Leave(memberID(member)); err != nil {
 		m.logError(err, "Failed to handle leave", member)
 	}
 }
@@ -117,6 +181,15 @@ func (m *Membership) isLocal(member serf.Member) bool {
 	return member.Name == m.serf.LocalMember().Name
 }
 
+// handles reports whether member has one of the roles the handler is
+// passed.
+func (m *Membership) handles(member serf.Member) bool {
+	if len(m.Roles) == 0 {
+		return true
+	}
+	return slices.Contains(m.Roles, member.Tags[TagRole])
+}
+
 func (m *Membership) Members() []serf.Member {
 	return m.serf.Members()
 }
@@ -133,5 +206,6 @@ func (m *Membership) logError(err error, msg string, member serf.Member) {
 	log(msg,
 		zap.Error(err),
 		zap.String("name", member.Name),
+		zap.String("id", memberID(member)),
 		zap.String("rpc_addr", member.Tags["rpc_addr"]))
 }
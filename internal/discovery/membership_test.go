@@ -8,6 +8,7 @@ import (
 	. "github.com/Tarunshrma/prolog/internal/discovery"
 	"github.com/hashicorp/serf/serf"
 	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
 )
 
 func TestMembership(t *testing.T) {
@@ -30,7 +31,8 @@ func TestMembership(t *testing.T) {
 			serf.StatusLeft == m[0].Members()[2].Status
 	}, 3*time.Second, 250*time.Millisecond)
 
-	require.Equal(t, fmt.Sprintf("%d", 2), <-handler.leaves)
+	// The handler knows members by the ID they advertise.
+	require.Equal(t, "node-2", <-handler.leaves)
 
 }
 
@@ -40,7 +42,10 @@ func setupMember(t *testing.T, members []*Membership) (
 	id := len(members)
 	ports := dynaport.Get(1)
 	addr := fmt.Sprintf("%s:%d", "127.0.0.1", ports[0])
-	tags := map[string]string{"rpc_addr": addr}
+	tags := map[string]string{
+		"rpc_addr": addr,
+		TagNodeID:  fmt.Sprintf("node-%d", id),
+	}
 
 	c := Config{
 		NodeName: fmt.Sprintf("%d", id),
@@ -0,0 +1,175 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"go.uber.org/zap"
+)
+
+// defaultQuarantineWindow and defaultQuarantineCooldown are the window
+// failures are counted in and how long a flapping member stays quarantined,
+// unless configured otherwise.
+const (
+	defaultQuarantineWindow   = 5 * time.Minute
+	defaultQuarantineCooldown = 10 * time.Minute
+)
+
+// QuarantineConfig quarantines flapping members: those that fail Failures
+// times within Window. While quarantined, a member that rejoins is joined
+// through the handler's JoinStandby, or not at all if the handler has no
+// standbys, so it can't vote and churn elections each time it drops out.
+// It's joined as usual once Cooldown passes or an operator releases it.
+type QuarantineConfig struct {
+	// Failures is how many failures within Window quarantine a member.
+	// Zero disables quarantine. Window defaults to 5m.
+	Failures int
+	Window   time.Duration
+	// Cooldown is how long a quarantine lasts unless the member is
+	// released sooner. Defaults to 10m.
+	Cooldown time.Duration
+}
+
+// flaps tracks members' recent failures and the members they got
+// quarantined.
+type flaps struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	members  map[string]*quarantinedMember
+}
+
+type quarantinedMember struct {
+	name     string
+	failures int
+	until    time.Time
+	timer    *time.Timer
+}
+
+// fail records that member failed, quarantining it if it failed too often
+// within the window.
+func (m *Membership) fail(member serf.Member) {
+	if m.Quarantine.Failures <= 0 {
+		return
+	}
+	window := m.Quarantine.Window
+	if window == 0 {
+		window = defaultQuarantineWindow
+	}
+	id := memberID(member)
+	now := time.Now()
+
+	m.flaps.mu.Lock()
+	defer m.flaps.mu.Unlock()
+	var recent []time.Time
+	for _, t := range m.flaps.failures[id] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	m.flaps.failures[id] = recent
+	if len(recent) < m.Quarantine.Failures {
+		return
+	}
+
+	cooldown := m.Quarantine.Cooldown
+	if cooldown == 0 {
+		cooldown = defaultQuarantineCooldown
+	}
+	if q, ok := m.flaps.members[id]; ok {
+		q.timer.Stop()
+	}
+	q := &quarantinedMember{
+		name:     member.Name,
+		failures: len(recent),
+		until:    now.Add(cooldown),
+	}
+	q.timer = time.AfterFunc(cooldown, func() {
+		err := m.release(id, q)
+		log := m.logger.Error
+		if err == raft.ErrNotLeader {
+			log = m.logger.Debug
+		}
+		if err != nil {
+			log("Failed to rejoin node released from quarantine", zap.Error(err), zap.String("id", id))
+		}
+	})
+	m.flaps.members[id] = q
+	m.logger.Warn(
+		"Node quarantined for flapping",
+		zap.String("name", member.Name),
+		zap.String("id", id),
+		zap.Int("failures", len(recent)),
+		zap.Duration("cooldown", cooldown),
+	)
+}
+
+// quarantined reports whether the member with id is quarantined.
+func (m *Membership) quarantined(id string) bool {
+	m.flaps.mu.Lock()
+	defer m.flaps.mu.Unlock()
+	_, ok := m.flaps.members[id]
+	return ok
+}
+
+// QuarantinedMembers lists the quarantined members, by ID.
+func (m *Membership) QuarantinedMembers() ([]*api.QuarantinedMember, error) {
+	m.flaps.mu.Lock()
+	defer m.flaps.mu.Unlock()
+
+	members := make([]*api.QuarantinedMember, 0, len(m.flaps.members))
+	for id, q := range m.flaps.members {
+		members = append(members, &api.QuarantinedMember{
+			Id:          id,
+			Name:        q.name,
+			Failures:    uint32(q.failures),
+			UntilUnixMs: q.until.UnixMilli(),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+	return members, nil
+}
+
+// ReleaseMember ends the quarantine of the member with id, forgetting its
+// failures, and joins it as usual if it's alive. Releasing a member that
+// isn't quarantined is a no-op.
+func (m *Membership) ReleaseMember(id string) error {
+	return m.release(id, nil)
+}
+
+// release ends the quarantine of the member with id, if it's quarantined
+// by expired, which is set when its cooldown passed, or by anything if
+// expired is nil.
+func (m *Membership) release(id string, expired *quarantinedMember) error {
+	m.flaps.mu.Lock()
+	q, ok := m.flaps.members[id]
+	ok = ok && (expired == nil || q == expired)
+	if ok {
+		q.timer.Stop()
+		delete(m.flaps.members, id)
+		delete(m.flaps.failures, id)
+	}
+	m.flaps.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	m.logger.Info(
+		"Node released from quarantine",
+		zap.String("name", q.name),
+		zap.String("id", id),
+		zap.Bool("expired", expired != nil),
+	)
+	for _, member := range m.serf.Members() {
+		if member.Status != serf.StatusAlive || memberID(member) != id ||
+			m.isLocal(member) || !m.handles(member) {
+			continue
+		}
+		return m.join(member)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type standbyHandler struct {
+	joins    []string
+	standbys []string
+}
+
+func (h *standbyHandler) Join(id, addr string) error {
+	h.joins = append(h.joins, id)
+	return nil
+}
+
+func (h *standbyHandler) JoinStandby(id, addr string) error {
+	h.standbys = append(h.standbys, id)
+	return nil
+}
+
+func (h *standbyHandler) Leave(id string) error {
+	return nil
+}
+
+func TestQuarantine(t *testing.T) {
+	h := &standbyHandler{}
+	m := &Membership{
+		Config: Config{
+			Quarantine: QuarantineConfig{
+				Failures: 2,
+				Window:   time.Minute,
+				Cooldown: time.Hour,
+			},
+		},
+		handler: h,
+		logger:  zap.NewNop(),
+		flaps: flaps{
+			failures: make(map[string][]time.Time),
+			members:  make(map[string]*quarantinedMember),
+		},
+	}
+	flapper := serf.Member{Name: "flapper", Tags: map[string]string{TagNodeID: "node-1"}}
+
+	m.fail(flapper)
+	require.False(t, m.quarantined("node-1"))
+	require.NoError(t, m.join(flapper))
+	require.Equal(t, []string{"node-1"}, h.joins)
+
+	// A second failure within the window quarantines it, so it rejoins as
+	// a standby.
+	m.fail(flapper)
+	require.True(t, m.quarantined("node-1"))
+	require.NoError(t, m.join(flapper))
+	require.Equal(t, []string{"node-1"}, h.joins)
+	require.Equal(t, []string{"node-1"}, h.standbys)
+
+	members, err := m.QuarantinedMembers()
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	require.Equal(t, "node-1", members[0].Id)
+	require.Equal(t, "flapper", members[0].Name)
+	require.Equal(t, uint32(2), members[0].Failures)
+	require.Greater(t, members[0].UntilUnixMs, time.Now().UnixMilli())
+
+	// Releasing a member that isn't quarantined is a no-op.
+	require.NoError(t, m.ReleaseMember("node-2"))
+	require.True(t, m.quarantined("node-1"))
+}
@@ -0,0 +1,36 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+)
+
+// LookupSeeds resolves name, typically a Kubernetes headless service, to the
+// serf addresses of its peers on port. Addresses belonging to this host are
+// left out, so the first node to start finds no seeds and starts alone.
+func LookupSeeds(name string, port int) ([]string, error) {
+	ips, err := net.LookupIP(name)
+	if err != nil {
+		return nil, err
+	}
+
+	local := map[string]bool{}
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range ifaceAddrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			local[ipnet.IP.String()] = true
+		}
+	}
+
+	var seeds []string
+	for _, ip := range ips {
+		if local[ip.String()] {
+			continue
+		}
+		seeds = append(seeds, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	}
+	return seeds, nil
+}
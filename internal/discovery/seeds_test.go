@@ -0,0 +1,19 @@
+package discovery_test
+
+import (
+	"testing"
+
+	. "github.com/Tarunshrma/prolog/internal/discovery"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupSeeds(t *testing.T) {
+	// localhost only resolves to this host, so there are no peers to seed.
+	seeds, err := LookupSeeds("localhost", 8401)
+	require.NoError(t, err)
+	require.Empty(t, seeds)
+
+	seeds, err = LookupSeeds("192.0.2.10", 8401)
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.10:8401"}, seeds)
+}
@@ -0,0 +1,133 @@
+package loadbalance
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HealthPolicy decides when the picker ejects a follower from the read
+// rotation, so one failing or slow node doesn't degrade every read, and
+// when it probes the follower to bring it back.
+type HealthPolicy struct {
+	// MaxFailureRate ejects followers whose reads fail at this rate or
+	// more, averaged over their recent reads. Only failures that say
+	// something about the node count: Unavailable, DeadlineExceeded,
+	// ResourceExhausted and Internal statuses. Zero disables it.
+	MaxFailureRate float64
+	// MaxLatency ejects followers whose Consume calls take this long or
+	// more, averaged over their recent calls. Zero disables it.
+	MaxLatency time.Duration
+	// An ejected follower gets one probe read after EjectBackoff, which
+	// doubles up to MaxEjectBackoff each time its probe fails too. A probe
+	// that succeeds returns it to the rotation.
+	EjectBackoff    time.Duration
+	MaxEjectBackoff time.Duration
+}
+
+// DefaultHealthPolicy ejects followers once about half their recent reads
+// fail, probing them after 1s and backing off up to 30s.
+var DefaultHealthPolicy = HealthPolicy{
+	MaxFailureRate:  0.5,
+	EjectBackoff:    time.Second,
+	MaxEjectBackoff: 30 * time.Second,
+}
+
+// healthWeight is the weight a follower's averages give its latest read.
+const healthWeight = 0.2
+
+// health scores a follower by its recent reads.
+type health struct {
+	mu sync.Mutex
+	// failureRate and latency, in nanoseconds, are exponentially weighted
+	// averages of the follower's reads.
+	failureRate float64
+	latency     float64
+	// ejections counts the follower's consecutive ejections, and is zero
+	// while it's in the rotation. An ejected follower is due a probe at
+	// probeAt, and probing is whether one is in flight.
+	ejections int
+	probeAt   time.Time
+	probing   bool
+	// end is where the follower last said its log ends, at endAt.
+	end   uint64
+	endAt time.Time
+}
+
+// admit reports whether a read can go to the follower now, and whether
+// the read probes an ejected follower.
+func (h *health) admit(now time.Time) (ok, probe bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ejections == 0 {
+		return true, false
+	}
+	if h.probing || now.Before(h.probeAt) {
+		return false, false
+	}
+	h.probing = true
+	return true, true
+}
+
+// observe scores a read the follower served, ejecting it or returning it
+// to the rotation per policy. timed is whether latency is the read's
+// latency rather than a stream's lifetime.
+func (h *health) observe(policy *HealthPolicy, now time.Time, probe bool, err error, latency time.Duration, timed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	failed := failure(err)
+	slow := timed && policy.MaxLatency > 0 && latency >= policy.MaxLatency
+
+	if probe {
+		h.probing = false
+		if failed || slow {
+			h.eject(policy, now)
+			return
+		}
+		h.ejections = 0
+		h.failureRate, h.latency = 0, 0
+		return
+	}
+	if h.ejections > 0 {
+		// A read picked before the follower was ejected.
+		return
+	}
+
+	var f float64
+	if failed {
+		f = 1
+	}
+	h.failureRate += healthWeight * (f - h.failureRate)
+	if timed {
+		h.latency += healthWeight * (float64(latency) - h.latency)
+	}
+	if (policy.MaxFailureRate > 0 && h.failureRate >= policy.MaxFailureRate) ||
+		(policy.MaxLatency > 0 && h.latency >= float64(policy.MaxLatency)) {
+		h.eject(policy, now)
+	}
+}
+
+func (h *health) eject(policy *HealthPolicy, now time.Time) {
+	backoff := policy.EjectBackoff
+	for i := 0; i < h.ejections && backoff < policy.MaxEjectBackoff; i++ {
+		backoff *= 2
+	}
+	h.ejections++
+	h.probeAt = now.Add(min(backoff, policy.MaxEjectBackoff))
+}
+
+// failure reports whether a read failed because of the node serving it,
+// rather than, say, reading past the end of the log. A node behind a
+// session is only lagging, which the picker routes around.
+func failure(err error) bool {
+	if sessionBehind(err) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
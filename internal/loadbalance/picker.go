@@ -5,6 +5,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/Tarunshrma/prolog/internal/clock"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 )
@@ -14,43 +15,82 @@ import (
 // compile-time assertion ensuring that the *Picker type implements the base.PickerBuilder interface.
 var _ base.PickerBuilder = (*Picker)(nil)
 
+// Picker sends writes to the leader and spreads reads over the followers,
+// ejecting followers whose reads fail or slow down from the rotation until
+// a probe read says they've recovered. Reads carrying a client session skip
+// followers known to be behind the session, see api.Session, so switching
+// replicas doesn't make the session wait or serve it an older view. Reads go
+// to the leader when no follower is in the rotation.
+//
+// Picker builds the pickers for one client conn; the balancer registered
+// for the proglog scheme makes a Picker for each.
 type Picker struct {
-	mu        sync.RWMutex
-	leader    balancer.SubConn
-	followers []balancer.SubConn
-	current   uint64
+	// Health decides when followers are ejected. Nil uses
+	// DefaultHealthPolicy.
+	Health *HealthPolicy
+	// Clock defaults to the system clock.
+	Clock clock.Clock
+
+	mu sync.Mutex
+	// health scores each follower as of the last build. Scores carry over
+	// between builds, so other nodes coming and going doesn't reset them.
+	health map[balancer.SubConn]*health
 }
 
 func (p *Picker) Build(buildInfo base.PickerBuildInfo) balancer.Picker {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	var followers []balancer.SubConn
+	picked := &picker{
+		health: make(map[balancer.SubConn]*health),
+		policy: p.Health,
+		clock:  p.Clock,
+	}
+	if picked.policy == nil {
+		picked.policy = &DefaultHealthPolicy
+	}
+	if picked.clock == nil {
+		picked.clock = clock.Real
+	}
 
 	for sc, scinfo := range buildInfo.ReadySCs {
 		if scinfo.Address.Attributes.Value("is_leader") == true {
-			p.leader = sc
+			picked.leader = sc
 			continue
 		}
 
-		followers = append(followers, sc)
+		picked.followers = append(picked.followers, sc)
+		if h, ok := p.health[sc]; ok {
+			picked.health[sc] = h
+		} else {
+			picked.health[sc] = &health{}
+		}
 	}
 
-	p.followers = followers
-	return p
+	p.health = picked.health
+	return picked
 }
 
-var _ balancer.Picker = (*Picker)(nil)
+var _ balancer.Picker = (*picker)(nil)
 
-func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	p.mu.Lock()
-	defer p.mu.RUnlock()
+// picker picks from the subconns ready as of a build.
+type picker struct {
+	leader    balancer.SubConn
+	followers []balancer.SubConn
+	current   uint64
+	health    map[balancer.SubConn]*health
+	policy    *HealthPolicy
+	clock     clock.Clock
+}
 
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	var result balancer.PickResult
-	if strings.Contains(info.FullMethodName, "Produce") || len(p.followers) == 0 {
-		result.SubConn = p.leader
-	} else if strings.Contains(info.FullMethodName, "Consume") {
-		result.SubConn = p.nextFollower()
+	result.SubConn = p.leader
+	if strings.Contains(info.FullMethodName, "Consume") {
+		if sc, h, probe := p.nextFollower(sessionEnd(info.Ctx)); sc != nil {
+			result.SubConn = sc
+			result.Done = p.observe(h, probe, info.FullMethodName)
+		}
 	}
 
 	if result.SubConn == nil {
@@ -61,15 +101,52 @@ func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 
 }
 
-func (p *Picker) nextFollower() balancer.SubConn {
+// nextFollower returns the next follower in the rotation that isn't known
+// to end before offset end, or an ejected one due a probe, or nil if
+// there's neither.
+func (p *picker) nextFollower(end uint64) (balancer.SubConn, *health, bool) {
+	n := uint64(len(p.followers))
+	if n == 0 {
+		return nil, nil, false
+	}
+	now := p.clock.Now()
 	cur := atomic.AddUint64(&p.current, uint64(1))
-	len := uint64(len(p.followers))
-	idx := int(cur % len)
-	return p.followers[idx]
+	for i := uint64(0); i < n; i++ {
+		sc := p.followers[(cur+i)%n]
+		h := p.health[sc]
+		if h.behind(now, end) {
+			continue
+		}
+		if ok, probe := h.admit(now); ok {
+			return sc, h, probe
+		}
+	}
+	return nil, nil, false
+}
+
+// observe returns the callback that scores a read once it's done. Only
+// unary Consume calls are timed; streams last as long as their consumers
+// want.
+func (p *picker) observe(h *health, probe bool, method string) func(balancer.DoneInfo) {
+	start := p.clock.Now()
+	timed := strings.HasSuffix(method, "/Consume")
+	return func(info balancer.DoneInfo) {
+		now := p.clock.Now()
+		h.observe(p.policy, now, probe, info.Err, now.Sub(start), timed)
+		h.observeEnd(now, info.Trailer)
+	}
+}
+
+// builder builds the proglog balancer for a client conn, with a Picker of
+// its own so follower health isn't shared between client conns.
+type builder struct{}
+
+func (builder) Name() string { return Name }
+
+func (builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	return base.NewBalancerBuilder(Name, &Picker{}, base.Config{}).Build(cc, opts)
 }
 
 func init() {
-	balancer.Register(
-		base.NewBalancerBuilder(Name, &Picker{}, base.Config{}),
-	)
+	balancer.Register(builder{})
 }
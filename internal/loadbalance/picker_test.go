@@ -1,18 +1,26 @@
 package loadbalance_test
 
 import (
+	"context"
+	"strconv"
 	"testing"
+	"time"
 
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/clock"
 	"github.com/Tarunshrma/prolog/internal/loadbalance"
-	"github.com/test-go/testify/require"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/attributes"
 	balancer "google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
 )
 
 func TestPickerNoSubConnAvaiable(t *testing.T) {
-	picker := &loadbalance.Picker{}
+	picker := (&loadbalance.Picker{}).Build(base.PickerBuildInfo{})
 	for _, method := range []string{
 		"/log.vX.Log/Produce",
 		"/log.vX.Log/Consume",
@@ -27,7 +35,7 @@ func TestPickerNoSubConnAvaiable(t *testing.T) {
 }
 
 func TestPickerProducesToLeader(t *testing.T) {
-	picker, subConns := setupTest()
+	picker, subConns := setupTest(&loadbalance.Picker{})
 	info := balancer.PickInfo{
 		FullMethodName: "/log.vX.Log/Produce",
 	}
@@ -40,7 +48,7 @@ func TestPickerProducesToLeader(t *testing.T) {
 }
 
 func TestPickerConsumesFromFollowers(t *testing.T) {
-	picker, subConns := setupTest()
+	picker, subConns := setupTest(&loadbalance.Picker{})
 	info := balancer.PickInfo{
 		FullMethodName: "/log.vX.Log/Consume",
 	}
@@ -52,26 +60,166 @@ func TestPickerConsumesFromFollowers(t *testing.T) {
 	}
 }
 
-func setupTest() (*loadbalance.Picker, []*SubConn) {
-	var subConns []*SubConn
-	buildInfo := base.PickerBuildInfo{
-		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo),
+func TestPickerEjectsUnhealthyFollowers(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	picker, subConns := setupTest(&loadbalance.Picker{Clock: clk})
+	info := balancer.PickInfo{
+		FullMethodName: "/log.vX.Log/Consume",
+	}
+	pick := func() balancer.PickResult {
+		t.Helper()
+		result, err := picker.Pick(info)
+		require.NoError(t, err)
+		return result
+	}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	leader, bad, good := subConns[0], subConns[1], subConns[2]
+
+	// Reads fail on one follower until it's ejected.
+	for i := 0; i < 10; i++ {
+		result := pick()
+		var err error
+		if result.SubConn == bad {
+			err = unavailable
+		}
+		result.Done(balancer.DoneInfo{Err: err})
+	}
+	for i := 0; i < 5; i++ {
+		require.Equal(t, good, pick().SubConn)
+	}
+
+	// After the backoff, one read probes it, and its success returns the
+	// follower to the rotation.
+	clk.Advance(loadbalance.DefaultHealthPolicy.EjectBackoff)
+	var probe balancer.PickResult
+	for i := 0; i < 2 && probe.SubConn != bad; i++ {
+		probe = pick()
+	}
+	require.Equal(t, bad, probe.SubConn)
+	require.Equal(t, good, pick().SubConn)
+	require.Equal(t, good, pick().SubConn)
+	probe.Done(balancer.DoneInfo{})
+	picked := map[balancer.SubConn]bool{}
+	for i := 0; i < 2; i++ {
+		picked[pick().SubConn] = true
+	}
+	require.True(t, picked[bad] && picked[good])
+
+	// With every follower ejected, reads go to the leader.
+	for i := 0; i < 10; i++ {
+		result := pick()
+		if result.Done != nil {
+			result.Done(balancer.DoneInfo{Err: unavailable})
+		}
+	}
+	require.Equal(t, leader, pick().SubConn)
+}
+
+func TestPickerHealthIsPerBuilder(t *testing.T) {
+	builder := &loadbalance.Picker{}
+	picker, subConns := setupTest(builder)
+	info := balancer.PickInfo{FullMethodName: "/log.vX.Log/Consume"}
+	bad, good := subConns[1], subConns[2]
+	for i := 0; i < 10; i++ {
+		result, err := picker.Pick(info)
+		require.NoError(t, err)
+		if result.SubConn == bad {
+			result.Done(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "unavailable")})
+		}
+	}
+
+	// Rebuilding keeps the follower ejected, but another client conn's
+	// builder still reads from it.
+	for _, tc := range []struct {
+		builder *loadbalance.Picker
+		ejected bool
+	}{
+		{builder, true},
+		{&loadbalance.Picker{}, false},
+	} {
+		picker := tc.builder.Build(buildInfo(subConns))
+		picked := map[balancer.SubConn]bool{}
+		for i := 0; i < 4; i++ {
+			result, err := picker.Pick(info)
+			require.NoError(t, err)
+			picked[result.SubConn] = true
+		}
+		require.True(t, picked[good])
+		require.Equal(t, !tc.ejected, picked[bad])
+	}
+}
+
+func TestPickerRoutesSessionsAroundLaggingFollowers(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	picker, subConns := setupTest(&loadbalance.Picker{Clock: clk})
+	pick := func(end uint64) balancer.PickResult {
+		t.Helper()
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			api.SessionEndMetadataKey, strconv.FormatUint(end, 10))
+		result, err := picker.Pick(balancer.PickInfo{FullMethodName: "/log.vX.Log/ConsumeStream", Ctx: ctx})
+		require.NoError(t, err)
+		return result
+	}
+	leader, lagging, current := subConns[0], subConns[1], subConns[2]
+
+	// Followers say where their logs end as they serve sessions.
+	for _, sc := range []*SubConn{lagging, current} {
+		var result balancer.PickResult
+		for result.SubConn != sc {
+			result = pick(1)
+		}
+		end := map[*SubConn]string{lagging: "5", current: "10"}[sc]
+		result.Done(balancer.DoneInfo{Trailer: metadata.Pairs(api.LogEndMetadataKey, end)})
+	}
+
+	// A session that's seen further than a follower holds skips it, and
+	// goes to the leader if every follower is behind.
+	for i := 0; i < 4; i++ {
+		require.Equal(t, current, pick(8).SubConn)
+		require.Equal(t, leader, pick(11).SubConn)
+	}
+	picked := map[balancer.SubConn]bool{}
+	for i := 0; i < 2; i++ {
+		picked[pick(5).SubConn] = true
 	}
+	require.True(t, picked[lagging] && picked[current])
 
+	// Followers catch up, so their reports go stale.
+	clk.Advance(time.Second)
+	picked = map[balancer.SubConn]bool{}
+	for i := 0; i < 2; i++ {
+		picked[pick(11).SubConn] = true
+	}
+	require.True(t, picked[lagging] && picked[current])
+}
+
+func setupTest(builder *loadbalance.Picker) (balancer.Picker, []*SubConn) {
+	var subConns []*SubConn
 	for i := 0; i < 3; i++ {
-		sc := &SubConn{}
+		subConns = append(subConns, &SubConn{})
+	}
+	return builder.Build(buildInfo(subConns)), subConns
+}
+
+// buildInfo lists subConns as ready, the 0th as the leader.
+func buildInfo(subConns []*SubConn) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo),
+	}
+	for i, sc := range subConns {
 		addr := resolver.Address{
 			Attributes: attributes.New("is_leader", i == 0),
 		}
-
-		//0th subconn is leader
 		sc.UpdateAddresses([]resolver.Address{addr})
-		buildInfo.ReadySCs[sc] = base.SubConnInfo{Address: addr}
-		subConns = append(subConns, sc)
+		info.ReadySCs[sc] = base.SubConnInfo{Address: addr}
 	}
-	picker := &loadbalance.Picker{}
-	picker.Build(buildInfo)
-	return picker, subConns
+	return info
+}
+
+// SubConn is a balancer.SubConn that remembers its addresses.
+type SubConn struct {
+	balancer.SubConn
+	addrs []resolver.Address
 }
 
 func (s *SubConn) UpdateAddresses(addrs []resolver.Address) {
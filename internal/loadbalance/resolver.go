@@ -1,16 +1,35 @@
 package loadbalance
 
 import (
+	"context"
 	"sync"
-)
 
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
 
-type Resolver interface {
-	mu   sync.Mutex
-	clientConn resolver.ClientConn
+// Resolver discovers the cluster's servers and hands clients a service
+// config that load balances with our picker and retries calls that fail
+// because a node is unavailable or no longer the leader.
+//
+// The resolver registered for the proglog scheme uses DefaultRetryPolicy. To
+// customise the policies, pass your own resolver with grpc.WithResolvers.
+type Resolver struct {
+	// RetryPolicy applies to every Log RPC. Nil uses DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+	// HedgingPolicy, if set, hedges read-only RPCs instead of retrying them.
+	HedgingPolicy *HedgingPolicy
+
+	mu           sync.Mutex
+	clientConn   resolver.ClientConn
 	resolverConn *grpc.ClientConn
 	serverConfig *serviceconfig.ParseResult
-	logger *zap.Logger
+	logger       *zap.Logger
 }
 
 var _ resolver.Resolver = (*Resolver)(nil)
@@ -18,7 +37,7 @@ var _ resolver.Resolver = (*Resolver)(nil)
 func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
+
 	client := api.NewLogClient(r.resolverConn)
 	ctx := context.Background()
 	res, err := client.GetServers(ctx, &api.GetServersRequest{})
@@ -29,7 +48,7 @@ func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
 
 	var addrs []resolver.Address
 	for _, server := range res.Servers {
-		addrs = append(addrs, resolver.Address{Addr: server.RpcAddr, Attributes: attribute.New("is_leader", server.IsLeader,),})
+		addrs = append(addrs, resolver.Address{Addr: server.RpcAddr, Attributes: attributes.New("is_leader", server.IsLeader)})
 	}
 
 	r.clientConn.UpdateState(resolver.State{Addresses: addrs, ServiceConfig: r.serverConfig})
@@ -47,21 +66,29 @@ func (r *Resolver) Build(
 	target resolver.Target,
 	cc resolver.ClientConn,
 	opts resolver.BuildOptions,
-)(resolver.Resolver, error) {
+) (resolver.Resolver, error) {
 	r.logger = zap.L().Named("resolver")
 	r.clientConn = cc
 
+	// Ask for the servers the way the client conn reaches them, over TLS
+	// if it uses TLS.
 	var dialOpts []grpc.DialOption
-	if(opts.DialCreds != nil) {
+	if opts.DialCreds != nil {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.DialCreds))
 	} else {
-		dialOpts = append(dialOpts, grpc.WithInsecure())
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if opts.Dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(opts.Dialer))
 	}
 
-	r.serverConfig = r.clientConn.ParseServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, Name))
+	sc, err := serviceConfig(r.RetryPolicy, r.HedgingPolicy)
+	if err != nil {
+		return nil, err
+	}
+	r.serverConfig = r.clientConn.ParseServiceConfig(sc)
 
-	var err error
-	r.resolverConn, err = grpc.Dial(target.Endpoint, dialOpts...)
+	r.resolverConn, err = grpc.Dial(target.Endpoint(), dialOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +102,6 @@ func (r *Resolver) Scheme() string {
 	return Name
 }
 
-func init(){
+func init() {
 	resolver.Register(&Resolver{})
 }
-
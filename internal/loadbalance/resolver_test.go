@@ -2,24 +2,25 @@ package loadbalance_test
 
 import (
 	"net"
+	"net/url"
 	"testing"
 
 	api "github.com/Tarunshrma/prolog/api/v1"
 	loadbalance "github.com/Tarunshrma/prolog/internal/loadbalance"
 	"github.com/Tarunshrma/prolog/internal/server"
-	"github.com/test-go/testify/require"
-	"google.golang.org/grpc"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/attributes"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
 )
 
 func TestResolver(t *testing.T) {
-	l, err := net.Listen("tcp", "127.0.0.1")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
 
-	srv, err := server.NewGRPCServer(&server.Config{
+	srv, err := server.NewGRPCServer(nil, server.WithStorage(server.Storage{
 		GetServer: &getServer{},
-	}, grpc.WithInsecure())
+	}))
 
 	require.NoError(t, err)
 	go srv.Serve(l)
@@ -28,9 +29,7 @@ func TestResolver(t *testing.T) {
 	r := &loadbalance.Resolver{}
 
 	_, err = r.Build(
-		resolver.Target{
-			Endpoint: l.Addr().String(),
-		},
+		resolver.Target{URL: url.URL{Path: l.Addr().String()}},
 		conn,
 		resolver.BuildOptions{},
 	)
@@ -56,7 +55,7 @@ func TestResolver(t *testing.T) {
 type getServer struct{}
 
 func (g *getServer) GetServers() ([]*api.Server, error) {
-	return []*server.Server{
+	return []*api.Server{
 		{
 			Id:       "leader",
 			RpcAddr:  "localhost:9001",
@@ -75,8 +74,9 @@ type clientConn struct {
 	state resolver.State
 }
 
-func (c *clientConn) UpdateState(state resolver.State) {
+func (c *clientConn) UpdateState(state resolver.State) error {
 	c.state = state
+	return nil
 }
 
 func (c *clientConn) ReportError(err error) {}
@@ -85,6 +85,6 @@ func (c *clientConn) NewAddress(addrs []resolver.Address) {}
 
 func (c *clientConn) NewServiceConfig(serviceConfig string) {}
 
-func (c *clientConn) ParseServiceConfig(config string) *serviceConfig.ParseResult {
+func (c *clientConn) ParseServiceConfig(config string) *serviceconfig.ParseResult {
 	return nil
 }
@@ -0,0 +1,120 @@
+package loadbalance
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// RetryPolicy configures how a client transparently retries failed calls.
+// See https://github.com/grpc/proposal/blob/master/A6-client-retries.md.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// RetryableStatusCodes are the status codes worth retrying. Servers
+	// report a write sent to a follower as Unavailable with a NOT_LEADER
+	// error detail, so retrying Unavailable covers leader changes.
+	RetryableStatusCodes []codes.Code
+}
+
+// DefaultRetryPolicy retries calls rejected because a node is unavailable or
+// isn't the leader, backing off from 100ms up to 2s over 5 attempts.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          5,
+	InitialBackoff:       100 * time.Millisecond,
+	MaxBackoff:           2 * time.Second,
+	BackoffMultiplier:    2,
+	RetryableStatusCodes: []codes.Code{codes.Unavailable},
+}
+
+// HedgingPolicy configures sending several copies of a read-only call and
+// keeping the first response. It's only applied to Consume and GetServers,
+// since hedging a Produce would append duplicate records. grpc-go doesn't
+// implement hedging yet, so Go clients ignore this policy and fall back to
+// sending a single call.
+type HedgingPolicy struct {
+	MaxAttempts         int
+	HedgingDelay        time.Duration
+	NonFatalStatusCodes []codes.Code
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+type methodConfig struct {
+	Name          []methodName   `json:"name"`
+	RetryPolicy   *retryPolicy   `json:"retryPolicy,omitempty"`
+	HedgingPolicy *hedgingPolicy `json:"hedgingPolicy,omitempty"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int          `json:"maxAttempts"`
+	InitialBackoff       string       `json:"initialBackoff"`
+	MaxBackoff           string       `json:"maxBackoff"`
+	BackoffMultiplier    float64      `json:"backoffMultiplier"`
+	RetryableStatusCodes []codes.Code `json:"retryableStatusCodes"`
+}
+
+type hedgingPolicy struct {
+	MaxAttempts         int          `json:"maxAttempts"`
+	HedgingDelay        string       `json:"hedgingDelay"`
+	NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes,omitempty"`
+}
+
+const logService = "log.v1.Log"
+
+// serviceConfig renders the JSON service config the resolver hands to
+// clients: our load balancer plus the retry and hedging policies.
+func serviceConfig(retry *RetryPolicy, hedging *HedgingPolicy) (string, error) {
+	if retry == nil {
+		retry = &DefaultRetryPolicy
+	}
+
+	var methods []methodConfig
+	if hedging != nil {
+		methods = append(methods, methodConfig{
+			Name: []methodName{
+				{Service: logService, Method: "Consume"},
+				{Service: logService, Method: "GetServers"},
+			},
+			HedgingPolicy: &hedgingPolicy{
+				MaxAttempts:         hedging.MaxAttempts,
+				HedgingDelay:        duration(hedging.HedgingDelay),
+				NonFatalStatusCodes: hedging.NonFatalStatusCodes,
+			},
+		})
+	}
+	methods = append(methods, methodConfig{
+		Name: []methodName{{Service: logService}},
+		RetryPolicy: &retryPolicy{
+			MaxAttempts:          retry.MaxAttempts,
+			InitialBackoff:       duration(retry.InitialBackoff),
+			MaxBackoff:           duration(retry.MaxBackoff),
+			BackoffMultiplier:    retry.BackoffMultiplier,
+			RetryableStatusCodes: retry.RetryableStatusCodes,
+		},
+	})
+
+	b, err := json.Marshal(struct {
+		LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+		MethodConfig        []methodConfig        `json:"methodConfig"`
+	}{
+		LoadBalancingConfig: []map[string]struct{}{{Name: {}}},
+		MethodConfig:        methods,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// duration formats d the way the service config's JSON expects, e.g. "0.1s".
+func duration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
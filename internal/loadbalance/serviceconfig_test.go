@@ -0,0 +1,60 @@
+package loadbalance
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestServiceConfig(t *testing.T) {
+	for scenario, tc := range map[string]struct {
+		retry   *RetryPolicy
+		hedging *HedgingPolicy
+		methods int
+	}{
+		"default retry policy": {methods: 1},
+		"custom retry policy": {
+			retry: &RetryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       10 * time.Microsecond,
+				MaxBackoff:           time.Second,
+				BackoffMultiplier:    1.5,
+				RetryableStatusCodes: []codes.Code{codes.Unavailable, codes.Aborted},
+			},
+			methods: 1,
+		},
+		"hedged reads": {
+			hedging: &HedgingPolicy{
+				MaxAttempts:  2,
+				HedgingDelay: 50 * time.Millisecond,
+			},
+			methods: 2,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			sc, err := serviceConfig(tc.retry, tc.hedging)
+			require.NoError(t, err)
+
+			var got struct {
+				MethodConfig []methodConfig `json:"methodConfig"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(sc), &got))
+			require.Equal(t, tc.methods, len(got.MethodConfig))
+
+			// gRPC validates the default service config when creating a
+			// client, so this fails if it can't understand ours.
+			cc, err := grpc.NewClient(
+				"passthrough:///localhost:0",
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultServiceConfig(sc),
+			)
+			require.NoError(t, err)
+			require.NoError(t, cc.Close())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package loadbalance
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// endTTL is how long the picker trusts where a follower said its log ends.
+// Followers keep replicating, so once a report is older than this, reads
+// go to the follower again, which waits to catch up if it must and reports
+// afresh.
+const endTTL = time.Second
+
+// sessionEnd returns the offset the session reading with ctx needs a
+// node's log to reach, or zero if the read doesn't carry a session.
+func sessionEnd(ctx context.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return 0
+	}
+	vals := md.Get(api.SessionEndMetadataKey)
+	if len(vals) == 0 {
+		return 0
+	}
+	end, _ := strconv.ParseUint(vals[0], 10, 64)
+	return end
+}
+
+// behind reports whether the follower recently said its log ends before
+// offset end.
+func (h *health) behind(now time.Time, end uint64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.end < end && now.Sub(h.endAt) < endTTL
+}
+
+// observeEnd keeps where the follower said its log ends, in the trailer of
+// a read carrying a session.
+func (h *health) observeEnd(now time.Time, trailer metadata.MD) {
+	vals := trailer.Get(api.LogEndMetadataKey)
+	if len(vals) == 0 {
+		return
+	}
+	end, err := strconv.ParseUint(vals[0], 10, 64)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.end, h.endAt = end, now
+}
+
+// sessionBehind reports whether err is a SESSION_BEHIND error.
+func sessionBehind(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == "SESSION_BEHIND" && info.Domain == "prolog" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ErrOffsetGap is returned when the log finds its offsets aren't strictly
+// consecutive: a segment doesn't start where the one before it ends, or an
+// index entry isn't for the offset after the entry before it. The log
+// refuses to open, or to append, rather than serve a log with holes.
+var ErrOffsetGap = errors.New("offset gap")
+
+// checkOffsets checks, when the log opens, that its segments follow on from
+// each other without gaps and that each one's index is consecutive.
+func (l *Log) checkOffsets() error {
+	for i, s := range l.segments {
+		if i > 0 {
+			if prev := l.segments[i-1]; s.baseOffset != prev.nextOffset {
+				return l.anomaly(fmt.Errorf(
+					"%w: segment %d ends before offset %d but segment %d starts at %d",
+					ErrOffsetGap,
+					prev.baseOffset,
+					prev.nextOffset,
+					s.baseOffset,
+					s.baseOffset,
+				))
+			}
+		}
+		if err := s.checkIndex(); err != nil {
+			return l.anomaly(err)
+		}
+	}
+	return nil
+}
+
+// checkAppend checks, before each append, that the active segment follows
+// on from the one before it and that its index has an entry for every
+// offset it has assigned, so the offset it assigns next follows on from the
+// log's highest. l.mu must be held.
+func (l *Log) checkAppend() error {
+	s := l.activeSegment
+	if n := len(l.segments); n > 1 {
+		if prev := l.segments[n-2]; s.baseOffset != prev.nextOffset {
+			return l.anomaly(fmt.Errorf(
+				"%w: active segment %d doesn't follow segment %d, which ends before offset %d",
+				ErrOffsetGap,
+				s.baseOffset,
+				prev.baseOffset,
+				prev.nextOffset,
+			))
+		}
+	}
+	if entries := s.index.entries(); s.baseOffset+entries != s.nextOffset {
+		return l.anomaly(fmt.Errorf(
+			"%w: segment %d's index has %d entries but its next offset is %d",
+			ErrOffsetGap,
+			s.baseOffset,
+			entries,
+			s.nextOffset,
+		))
+	}
+	return nil
+}
+
+// checkIndex checks that the n'th entry of the segment's index is for the
+// n'th offset from its base.
+func (s *segment) checkIndex() error {
+	s.index.mu.RLock()
+	defer s.index.mu.RUnlock()
+	for n := uint64(0); n < s.index.entries(); n++ {
+		if off, _ := s.index.entry(n); uint64(off) != n {
+			return fmt.Errorf(
+				"%w: entry %d of segment %d's index is for offset %d, want %d",
+				ErrOffsetGap,
+				n,
+				s.baseOffset,
+				s.baseOffset+uint64(off),
+				s.baseOffset+n,
+			)
+		}
+	}
+	return nil
+}
+
+// anomaly counts and logs err, an offset anomaly, and returns it.
+func (l *Log) anomaly(err error) error {
+	if l.Config.Metrics != nil {
+		l.Config.Metrics.Counter("log_offset_anomalies").Inc()
+	}
+	zap.L().Named("log").Error("offset anomaly", zap.String("dir", l.Dir), zap.Error(err))
+	return err
+}
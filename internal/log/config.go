@@ -1,17 +1,249 @@
 package log
 
-import "github.com/hashicorp/raft"
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/budget"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/hashicorp/raft"
+)
 
 type Config struct {
+	// Clock times the log's own timeouts and pauses, so tests can advance
+	// it instead of sleeping. Raft keeps its own time. Defaults to the
+	// system clock.
+	Clock clock.Clock
+	// Budget, if set, accounts for the memory the log's store buffers and
+	// mapped indexes use.
+	Budget *budget.Budget
+	// Metrics, if set, is where the log counts the offset anomalies, gaps
+	// in its offsets, it detects, the orphaned files it cleans up, the
+	// corrupt records it scrubs and the segments retention removes.
+	Metrics *metrics.Registry
+	// Orphans is what the log does, when it opens, with orphaned files:
+	// files in its directory no segment accounts for, like half-removed
+	// segments, and staging directories interrupted installs left beside
+	// it. Defaults to OrphansQuarantine.
+	Orphans OrphanPolicy
+
 	Raft struct {
 		raft.Config
-		StreamLayer *raft.StreamLayer
+		StreamLayer *StreamLayer
 		Bootstrap   bool
+		// ApplyTimeout bounds how long a write waits to be committed.
+		// Defaults to 10s.
+		ApplyTimeout time.Duration
+		// Quarantine records and skips replicated entries that fail to
+		// apply instead of crash-looping on them during replay.
+		Quarantine bool
+		// Witness makes this node a voter that stores no record data, so
+		// two-datacenter deployments can place a cheap tie-breaker in a
+		// third location. A witness hands off leadership when elected,
+		// rejects writes and has no records to read. Its snapshots are
+		// empty, so it never sends them: while it leads, followers it
+		// can't catch up from its log wait for a data node to lead.
+		Witness bool
+		// LogCacheEntries is how many recent Raft log entries are kept in
+		// memory, so Raft's reads of them, e.g. to replicate them, skip
+		// the index and store. Defaults to 512; negative disables the
+		// cache.
+		LogCacheEntries int
+		// LogDir, if set, is where the Raft log is stored rather than
+		// under the data directory, e.g. on a small, fast disk apart from
+		// the records, since Raft syncs its log on every write and
+		// compacts it after each snapshot.
+		LogDir string
+		// LogMaxStoreBytes, if set, sizes the segments of the Raft log instead of Segment.MaxStoreBytes, so the Raft log can
+		// be compacted in smaller steps than the records are retained in.
+		LogMaxStoreBytes uint64
 	}
 
 	Segment struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
 		InitialOffset uint64
+		// IndexMmap is how much of MaxIndexBytes an index maps up front.
+		// Defaults to IndexMmapPreallocate.
+		IndexMmap IndexMmapPolicy
+	}
+
+	Store struct {
+		// WriteBufferBytes sizes the buffer appends go through before
+		// they're written to the store file. Records larger than it are
+		// written straight through. Defaults to 64KiB.
+		WriteBufferBytes int
+		// ReadBufferBytes sizes the buffer range reads stream records
+		// from the store file through. Defaults to 64KiB.
+		ReadBufferBytes int
+		// MaxFrameBytes is the largest chunk of a record written as one
+		// frame. Larger records are split into continuation frames and
+		// reassembled on read. Defaults to 1MiB.
+		MaxFrameBytes uint64
+		// MaxRecordBytes bounds a record's size once its frames are
+		// reassembled. Larger records are rejected on append. Defaults to
+		// 64MiB.
+		MaxRecordBytes uint64
+		// Checksums stores a CRC-32C with each record appended, which
+		// reads and the scrubber verify, so latent disk corruption is
+		// caught rather than served. Records appended without them, e.g.
+		// before they were enabled, aren't verified.
+		Checksums bool
+	}
+
+	Scrub struct {
+		// Interval is how long the scrubber waits between passes over the
+		// log's sealed segments, rereading them to find latent disk
+		// corruption. Zero disables it.
+		Interval time.Duration
+		// BytesPerSecond throttles the scrubber's reads, so it doesn't
+		// compete with serving the log. Zero doesn't throttle.
+		BytesPerSecond int64
+		// Repair, if set, is called with each corrupt range the scrubber
+		// finds. A DistributedLog defaults it to repairing the range from
+		// a replica.
+		Repair func(c *Corruption) error
+	}
+
+	Retention struct {
+		// MaxAge removes sealed segments whose newest record was appended
+		// longer ago than it. Zero keeps records however old they are.
+		MaxAge time.Duration
+		// MaxBytes removes the oldest sealed segments while the log's
+		// store files hold more than it. The active segment is never
+		// removed, so the log can hold up to a segment more. Zero doesn't
+		// bound the log's size.
+		MaxBytes uint64
+		// Interval is how often the janitor checks the log against
+		// MaxAge and MaxBytes. Defaults to 1m if either is set.
+		Interval time.Duration
+		// OnDelete, if set, is called with each deletion retention makes,
+		// after the segments are removed, so the log's owner, like a
+		// DistributedLog, can coordinate with it.
+		OnDelete func(d *Deletion)
+	}
+
+	SegmentTransfer struct {
+		// Enabled makes Raft snapshots list the log's sealed segments
+		// instead of carrying their records, so a follower far behind
+		// fetches the segment files it's missing from the snapshot's node,
+		// or any other replica, rather than replaying every record. Nodes
+		// that don't enable it can't restore such snapshots.
+		Enabled bool
+		// BytesPerSecond throttles each transfer this node serves. Zero
+		// doesn't throttle.
+		BytesPerSecond int64
+		// Dial connects to peers to fetch segments. Defaults to TCP.
+		Dial SegmentDialer
+	}
+}
+
+// OrphanPolicy is what the log does with orphaned files.
+type OrphanPolicy string
+
+const (
+	// OrphansQuarantine moves orphaned files into the log directory's
+	// orphaned directory for an operator to inspect.
+	OrphansQuarantine OrphanPolicy = "quarantine"
+	// OrphansRemove deletes orphaned files.
+	OrphansRemove OrphanPolicy = "remove"
+)
+
+// IndexMmapPolicy decides how an index file is sized and memory-mapped.
+type IndexMmapPolicy int
+
+const (
+	// IndexMmapPreallocate sizes index files to MaxIndexBytes and maps all
+	// of it when the segment is created.
+	IndexMmapPreallocate IndexMmapPolicy = iota
+	// IndexMmapGrow starts with a small mapping and doubles it, up to
+	// MaxIndexBytes, as the index fills. It suits large MaxIndexBytes with
+	// segments that often roll over on MaxStoreBytes first.
+	IndexMmapGrow
+)
+
+const (
+	defaultBufferBytes = 64 * 1024
+	minBufferBytes     = 512
+	maxBufferBytes     = 64 * 1024 * 1024
+
+	defaultMaxFrameBytes  = 1024 * 1024
+	defaultMaxRecordBytes = 64 * 1024 * 1024
+
+	defaultRetentionInterval = time.Minute
+	// maxFrameBytes keeps the continuation and checksum bits out of frame
+	// lengths.
+	maxFrameBytes = 1<<62 - 1
+)
+
+// setDefaults fills in unset tuning knobs and checks they're in bounds.
+func (c *Config) setDefaults() error {
+	if c.Clock == nil {
+		c.Clock = clock.Real
+	}
+	if c.Segment.MaxStoreBytes == 0 {
+		c.Segment.MaxStoreBytes = 1024
+	}
+	if c.Segment.MaxIndexBytes == 0 {
+		c.Segment.MaxIndexBytes = 1024
+	}
+	if c.Store.WriteBufferBytes == 0 {
+		c.Store.WriteBufferBytes = defaultBufferBytes
+	}
+	if c.Store.ReadBufferBytes == 0 {
+		c.Store.ReadBufferBytes = defaultBufferBytes
+	}
+	if c.Store.MaxFrameBytes == 0 {
+		c.Store.MaxFrameBytes = defaultMaxFrameBytes
+	}
+	if c.Store.MaxRecordBytes == 0 {
+		c.Store.MaxRecordBytes = defaultMaxRecordBytes
+	}
+	if c.Retention.Interval == 0 && (c.Retention.MaxAge > 0 || c.Retention.MaxBytes > 0) {
+		c.Retention.Interval = defaultRetentionInterval
+	}
+
+	if c.Segment.MaxIndexBytes < entWidth {
+		return fmt.Errorf(
+			"max index bytes %d can't hold an entry of %d bytes",
+			c.Segment.MaxIndexBytes,
+			entWidth,
+		)
+	}
+	switch c.Orphans {
+	case "":
+		c.Orphans = OrphansQuarantine
+	case OrphansQuarantine, OrphansRemove:
+	default:
+		return fmt.Errorf("unknown orphan policy %q", c.Orphans)
+	}
+	switch c.Segment.IndexMmap {
+	case IndexMmapPreallocate, IndexMmapGrow:
+	default:
+		return fmt.Errorf("unknown index mmap policy %d", c.Segment.IndexMmap)
+	}
+	for name, n := range map[string]int{
+		"write": c.Store.WriteBufferBytes,
+		"read":  c.Store.ReadBufferBytes,
+	} {
+		if n < minBufferBytes || n > maxBufferBytes {
+			return fmt.Errorf(
+				"store %s buffer of %d bytes is outside [%d, %d]",
+				name,
+				n,
+				minBufferBytes,
+				maxBufferBytes,
+			)
+		}
+	}
+	if c.Store.MaxFrameBytes < minBufferBytes || c.Store.MaxFrameBytes > maxFrameBytes {
+		return fmt.Errorf(
+			"max frame of %d bytes is outside [%d, %d]",
+			c.Store.MaxFrameBytes,
+			minBufferBytes,
+			uint64(maxFrameBytes),
+		)
 	}
+	return nil
 }
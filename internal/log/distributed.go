@@ -1,28 +1,66 @@
 package log
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	api "github.com/Tarunshrma/prolog/log/api/v1"
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"github.com/Tarunshrma/prolog/internal/clock"
 	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 )
 
 type DistributedLog struct {
 	config Config
 	log    *Log
+	// topics are replicated like log: see topics.go.
+	topics *Topics
+	fsm    *fsm
 	raft   *raft.Raft
+	// raftLog is where Raft stores its log, closed once Raft shuts down.
+	raftLog raftLogStore
+
+	shutdown chan struct{}
+
+	// pauseMu guards pausing maintenance; see maintenance.go.
+	pauseMu     sync.Mutex
+	pauseTimer  clock.Timer
+	pausedUntil time.Time
+	unpaused    raft.ReloadableConfig
 }
 
+var (
+	_ backend.CommitLog                = (*DistributedLog)(nil)
+	_ backend.Handler                  = (*DistributedLog)(nil)
+	_ backend.QuarantineLister         = (*DistributedLog)(nil)
+	_ backend.MaintenancePauser        = (*DistributedLog)(nil)
+	_ backend.ClusterMaintenancePauser = (*DistributedLog)(nil)
+	_ backend.MaintenanceReporter      = (*DistributedLog)(nil)
+	_ backend.StandbyManager           = (*DistributedLog)(nil)
+	_ backend.Topics                   = (*DistributedLog)(nil)
+)
+
 func NewDistributedLog(dataDir string, config Config) (*DistributedLog, error) {
+	if err := config.setDefaults(); err != nil {
+		return nil, err
+	}
 	l := &DistributedLog{
-		config: config,
+		config:   config,
+		shutdown: make(chan struct{}),
 	}
 
 	if err := l.setupLog(dataDir); err != nil {
@@ -42,28 +80,40 @@ func (l *DistributedLog) setupLog(dataDir string) error {
 		return err
 	}
 
+	// Corruption the scrubber finds is repaired from replicas unless the
+	// caller repairs it some other way.
+	config := l.config
+	if config.Scrub.Repair == nil {
+		config.Scrub.Repair = l.Repair
+	}
 	var err error
-	l.log, err = NewLog(logDir, l.config)
+	l.log, err = NewLog(logDir, config)
+	if err != nil {
+		return err
+	}
+	l.topics, err = NewTopics(dataDir, l.config)
 	return err
 }
 
 func (l *DistributedLog) setupRaft(dataDir string) error {
-	fsm := &fsm{log: l.log}
-
-	logDir := filepath.Join(dataDir, "raft", "log")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return err
+	l.fsm = &fsm{
+		log:        l.log,
+		topics:     l.topics,
+		quarantine: l.config.Raft.Quarantine,
+		witness:    l.config.Raft.Witness,
+		logger:     zap.L().Named("fsm"),
+		localAddr:  l.config.Raft.StreamLayer.Addr().String(),
+		pause:      l.pauseUntil,
 	}
 
-	logConfig := l.config
-	logConfig.Segment.InitialOffset = 1
-	logStore, err := newLogStore(logDir, logConfig)
+	logStore, err := l.setupRaftLog(dataDir)
 	if err != nil {
 		return err
 	}
+	l.raftLog = logStore
 
 	//Key-value store where where raft store its metadata like current term, voted for etc.
-	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "raft", "stable"))
+	stableStore, err := newStableStore(filepath.Join(dataDir, "raft", "stable"))
 	if err != nil {
 		return err
 	}
@@ -71,12 +121,18 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 	retain := 1
 
 	//Snapshot store where raft store snapshots
-	snapshotStore, err := raft.NewFileSnapshotStore(
+	var snapshotStore raft.SnapshotStore
+	snapshotStore, err = raft.NewFileSnapshotStore(
 		filepath.Join(dataDir, "raft"),
 		retain, os.Stderr)
 	if err != nil {
 		return err
 	}
+	var witnessStore *witnessSnapshotStore
+	if l.config.Raft.Witness {
+		witnessStore = &witnessSnapshotStore{SnapshotStore: snapshotStore}
+		snapshotStore = witnessStore
+	}
 
 	maxPool := 5
 	timeout := 10 * time.Second
@@ -100,11 +156,27 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 	if l.config.Raft.CommitTimeout != 0 {
 		config.CommitTimeout = l.config.Raft.CommitTimeout
 	}
+	if l.config.Raft.SnapshotInterval != 0 {
+		config.SnapshotInterval = l.config.Raft.SnapshotInterval
+	}
+	if l.config.Raft.Witness {
+		// Witnesses keep no records, so snapshot often to keep as little of
+		// the raft log around as possible.
+		config.SnapshotThreshold = witnessTrailingLogs
+		config.TrailingLogs = witnessTrailingLogs
+	}
 
-	l.raft, err := raft.NewRaft(config, fsm, logStore, stableStore, snapshotStore, transport)
+	// The FSM may apply a maintenance pause, which reloads Raft's config,
+	// before NewRaft returns.
+	l.pauseMu.Lock()
+	l.raft, err = raft.NewRaft(config, l.fsm, logStore, stableStore, snapshotStore, transport)
+	l.pauseMu.Unlock()
 	if err != nil {
 		return err
 	}
+	if witnessStore != nil {
+		witnessStore.raft.Store(l.raft)
+	}
 	hasState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
 	if err != nil {
 		return err
@@ -121,19 +193,27 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 		err = l.raft.BootstrapCluster(config).Error()
 	}
 
+	if l.config.Raft.Witness {
+		go l.handOffLeadership()
+	}
+
 	return err
 }
 
-func (l *DistributedLog) Append(record *Record) (uint64, error) {
+func (l *DistributedLog) Append(record *api.Record) (uint64, error) {
+	if l.config.Raft.Witness {
+		return 0, &api.ErrorNotLeader{}
+	}
+
 	res, err := l.apply(
 		AppendRequestType,
 		&api.ProduceRequest{Record: record},
 	)
 
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
-	return res.(*AppendResponse).Offset, nil
+	return res.(*api.ProduceResponse).Offset, nil
 }
 
 func (l *DistributedLog) apply(reqType RequestType, req proto.Message) (interface{}, error) {
@@ -151,20 +231,205 @@ func (l *DistributedLog) apply(reqType RequestType, req proto.Message) (interfac
 	if err != nil {
 		return nil, err
 	}
-	timeout := 10 * time.Second
+	timeout := l.config.Raft.ApplyTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
 	f := l.raft.Apply(buf.Bytes(), timeout)
-	if f.Error() != nil {
-		return nil, f.Error()
+
+	// Raft only applies the timeout to enqueuing the entry, so bound the
+	// wait for it to commit as well.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- f.Error()
+	}()
+	select {
+	case err = <-errc:
+	case <-l.config.Clock.After(timeout):
+		return nil, &api.ErrorApplyTimeout{Timeout: timeout}
+	}
+	if err != nil {
+		return nil, applyError(err, l.raft.Leader(), timeout)
 	}
 	res := f.Response()
-	if err, ok := res.(error); ok {
-		return nil, err
+	switch err := res.(type) {
+	case *api.ErrorEpochMismatch, *api.ErrorTopicExists, *api.ErrorUnknownTopic:
+		return nil, err.(error)
+	case error:
+		return nil, &api.ErrorApplyFailed{Err: err}
 	}
 	return res, nil
 }
 
-func (l *DistributedLog) Read(offset uint64) (*Record, error) {
-	return l.log.Read(offset)
+const witnessTrailingLogs = 64
+
+// handOffLeadership transfers leadership to another voter whenever this
+// witness wins an election, since it has no records to serve.
+func (l *DistributedLog) handOffLeadership() {
+	// Polls Raft, which keeps its own time, so it doesn't use the clock.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.shutdown:
+			return
+		case <-ticker.C:
+			if l.raft.State() != raft.Leader {
+				continue
+			}
+			// Fails while there's no other voter to take over; try again on
+			// the next tick.
+			_ = l.raft.LeadershipTransfer().Error()
+		}
+	}
+}
+
+// witnessSnapshotStore is a witness's snapshot store. The witness's own
+// snapshots hold none of the records, so installing one on a follower
+// would skip it past records it never gets. While the witness leads, until
+// it hands off leadership, the store lists no snapshots, so Raft can't
+// send one: a follower too far behind to catch up from the witness's
+// trailing logs waits for a data node to lead instead.
+type witnessSnapshotStore struct {
+	raft.SnapshotStore
+	// raft is the witness's Raft, once it's created.
+	raft atomic.Pointer[raft.Raft]
+}
+
+func (s *witnessSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	if r := s.raft.Load(); r != nil && r.State() == raft.Leader {
+		return nil, nil
+	}
+	return s.SnapshotStore.List()
+}
+
+// Term returns the node's current Raft term.
+func (l *DistributedLog) Term() uint64 {
+	return l.raft.CurrentTerm()
+}
+
+// Epoch returns the cluster's current epoch: the Raft term and the index of
+// the latest configuration, which increase as leaders are elected and
+// servers are added or removed.
+func (l *DistributedLog) Epoch() (*api.Epoch, error) {
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return nil, err
+	}
+	return &api.Epoch{
+		Term:        l.raft.CurrentTerm(),
+		ConfigIndex: configFuture.Index(),
+	}, nil
+}
+
+// Read reads the record at offset, repairing it from a replica if this
+// node's copy is corrupt.
+func (l *DistributedLog) Read(offset uint64) (*api.Record, error) {
+	record, err := l.log.Read(offset)
+	if l.repaired(offset, err) {
+		return l.log.Read(offset)
+	}
+	return record, err
+}
+
+// Locate returns where this node stored the record at offset.
+func (l *DistributedLog) Locate(offset uint64) (*api.RecordLocation, error) {
+	return l.log.Locate(offset)
+}
+
+// ReadRange reads a range of records like Log.ReadRange, repairing the
+// first corrupt record it reaches, if any, from a replica and carrying on.
+func (l *DistributedLog) ReadRange(from, to uint64, fn func(*api.Record) error) error {
+	next := from
+	err := l.log.ReadRange(from, to, func(record *api.Record) error {
+		next = record.Offset + 1
+		return fn(record)
+	})
+	if l.repaired(next, err) {
+		return l.log.ReadRange(next, to, fn)
+	}
+	return err
+}
+
+func (l *DistributedLog) ReadReverse(from, to uint64, fn func(*api.Record) error) error {
+	return l.log.ReadReverse(from, to, fn)
+}
+
+func (l *DistributedLog) LowestOffset() (uint64, error) {
+	return l.log.LowestOffset()
+}
+
+func (l *DistributedLog) HighestOffset() (uint64, error) {
+	return l.log.HighestOffset()
+}
+
+// ServeSegments serves this node's sealed segments to followers catching up
+// on connections accepted from ln, until ln closes.
+func (l *DistributedLog) ServeSegments(ln net.Listener) error {
+	srv := &SegmentServer{
+		Log:            l.log,
+		BytesPerSecond: l.config.SegmentTransfer.BytesPerSecond,
+	}
+	return srv.Serve(ln)
+}
+
+// Repair repairs c, corruption in this node's copy of the log, with copies
+// of the records fetched from the leader or, failing that, another replica.
+func (l *DistributedLog) Repair(c *Corruption) error {
+	if l.raft == nil {
+		return errors.New("raft isn't running yet")
+	}
+	future := l.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	local := raft.ServerAddress(l.config.Raft.StreamLayer.Addr().String())
+	leader := l.raft.Leader()
+	var peers []string
+	if leader != "" && leader != local {
+		peers = append(peers, string(leader))
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.Address != local && srv.Address != leader {
+			peers = append(peers, string(srv.Address))
+		}
+	}
+
+	fetch := func(from, to uint64) ([]*api.Record, error) {
+		err := errors.New("no replica to repair from")
+		for _, addr := range peers {
+			var records []*api.Record
+			records, err = fetchRange(context.Background(), l.config.SegmentTransfer.Dial, addr, from, to)
+			if err == nil {
+				return records, nil
+			}
+			zap.L().Named("log").Warn("failed to fetch records to repair",
+				zap.String("address", addr),
+				zap.Error(err))
+		}
+		return nil, err
+	}
+	return l.log.Repair(c, fetch)
+}
+
+// repaired reports whether err, from reading the record at offset, was
+// corruption that's since been repaired.
+func (l *DistributedLog) repaired(offset uint64, err error) bool {
+	if !errors.Is(err, ErrRecordChecksum) {
+		return false
+	}
+	loc, lerr := l.log.Locate(offset)
+	if lerr != nil {
+		return false
+	}
+	c := &Corruption{Base: loc.SegmentBaseOffset, From: offset, To: offset + 1, Err: err}
+	l.log.corrupt(c)
+	if err := l.Repair(c); err != nil {
+		zap.L().Named("log").Error("repair failed", zap.String("dir", l.log.Dir), zap.Error(err))
+		return false
+	}
+	return true
 }
 
 func (l *DistributedLog) GetServers() ([]*api.Server, error) {
@@ -176,15 +441,22 @@ func (l *DistributedLog) GetServers() ([]*api.Server, error) {
 	var servers []*api.Server
 	for _, srv := range future.Configuration().Servers {
 		servers = append(servers, &api.Server{
-			Id:       string(srv.ID),
-			RpcAddr:  string(srv.Address),
-			IsLeader: l.raft.Leader() == srv.Address,
+			Id:        string(srv.ID),
+			RpcAddr:   string(srv.Address),
+			IsLeader:  l.raft.Leader() == srv.Address,
+			IsStandby: srv.Suffrage == raft.Nonvoter,
 		})
 	}
 
 	return servers, nil
 }
 
+// Quarantined returns the replicated entries the FSM failed to apply and
+// skipped because quarantine is enabled.
+func (l *DistributedLog) Quarantined() ([]*api.QuarantinedEntry, error) {
+	return l.fsm.Quarantined(), nil
+}
+
 func (l *DistributedLog) Join(id, addr string) error {
 	configFuture := l.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
@@ -196,9 +468,13 @@ func (l *DistributedLog) Join(id, addr string) error {
 
 	for _, srv := range configFuture.Configuration().Servers {
 		if srv.ID == serverID || srv.Address == serverAddr {
-			// Already joined
+			// Already joined. A nonvoter, like a member quarantined for
+			// flapping and since released, is made a voter.
 			if srv.ID == serverID && srv.Address == serverAddr {
-				return nil
+				if srv.Suffrage == raft.Voter {
+					return nil
+				}
+				break
 			}
 			removeFuture := l.raft.RemoveServer(srv.ID, 0, 0)
 			if err := removeFuture.Error(); err != nil {
@@ -214,12 +490,92 @@ func (l *DistributedLog) Join(id, addr string) error {
 	return nil
 }
 
+// JoinStandby adds the server as a warm standby: a nonvoter that Raft
+// replicates the log to but that isn't part of the quorum, so it doesn't
+// slow down or block commits. A server that's already in the cluster keeps
+// its suffrage, so a promoted standby isn't demoted when it rejoins.
+func (l *DistributedLog) JoinStandby(id, addr string) error {
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+
+	serverID := raft.ServerID(id)
+	serverAddr := raft.ServerAddress(addr)
+
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == serverID || srv.Address == serverAddr {
+			if srv.ID == serverID && srv.Address == serverAddr {
+				return nil
+			}
+			removeFuture := l.raft.RemoveServer(srv.ID, 0, 0)
+			if err := removeFuture.Error(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return l.raft.AddNonvoter(serverID, serverAddr, 0, 0).Error()
+}
+
+// PromoteStandby makes the warm standby id a voter. It's a no-op if id is
+// already a voter, and must be called on the leader.
+func (l *DistributedLog) PromoteStandby(id string) error {
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID != raft.ServerID(id) {
+			continue
+		}
+		if srv.Suffrage == raft.Voter {
+			return nil
+		}
+		err := l.raft.AddVoter(srv.ID, srv.Address, 0, 0).Error()
+		if err != nil {
+			return applyError(err, l.raft.Leader(), 0)
+		}
+		return nil
+	}
+	return &api.ErrorUnknownServer{ID: id}
+}
+
+// SyncStatus reports how far this node lags behind the cluster's commits
+// and when it last heard from the leader.
+func (l *DistributedLog) SyncStatus() (*api.GetSyncStatusResponse, error) {
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return nil, err
+	}
+
+	res := &api.GetSyncStatusResponse{AppliedIndex: l.raft.AppliedIndex()}
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == l.config.Raft.LocalID {
+			res.Standby = srv.Suffrage == raft.Nonvoter
+		}
+	}
+	// Raft only exposes the commit index through its stats.
+	res.CommitIndex, _ = strconv.ParseUint(l.raft.Stats()["commit_index"], 10, 64)
+	if res.CommitIndex > res.AppliedIndex {
+		res.LagEntries = res.CommitIndex - res.AppliedIndex
+	}
+	if l.raft.State() != raft.Leader {
+		if contact := l.raft.LastContact(); !contact.IsZero() {
+			res.LastContactUnixMs = contact.UnixMilli()
+		}
+	}
+	return res, nil
+}
+
 func (l *DistributedLog) Leave(id string) error {
 	removeFuture := l.raft.RemoveServer(raft.ServerID(id), 0, 0)
 	return removeFuture.Error()
 }
 
 func (l *DistributedLog) WaitForLeader(timeout time.Duration) error {
+	// Elections run on Raft's time rather than the log's clock.
 	timeoutCh := time.After(timeout)
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
@@ -236,45 +592,175 @@ func (l *DistributedLog) WaitForLeader(timeout time.Duration) error {
 	}
 }
 
-func (l *DistributedLog) Close() string {
+func (l *DistributedLog) Close() error {
+	close(l.shutdown)
 	f := l.raft.Shutdown()
 	if err := f.Error(); err != nil {
 		return err
 	}
+	if err := l.raftLog.Close(); err != nil {
+		return err
+	}
+	if err := l.topics.Close(); err != nil {
+		return err
+	}
 	return l.log.Close()
 }
 
-var _ raft.FSM = (*fsm)(nil)
+var _ raft.ConfigurationStore = (*fsm)(nil)
 
 type fsm struct {
 	log *Log
+	// topics are the replicated topics, or nil if the FSM serves none.
+	topics *Topics
+
+	// quarantine makes the FSM record and skip entries that fail to apply,
+	// rather than panicking and wedging replay on every restart.
+	quarantine bool
+	// witness makes the FSM drop records instead of storing them.
+	witness bool
+	logger  *zap.Logger
+	// pause applies the cluster's maintenance pauses to the node; see
+	// DistributedLog.PauseClusterMaintenance.
+	pause func(until time.Time) error
+
+	mu          sync.Mutex
+	quarantined []*api.QuarantinedEntry
+
+	// localAddr is this node's Raft address, and servers the addresses of
+	// the voters in the last configuration applied, which snapshots list
+	// as sources of their sealed segments. Raft only calls the FSM from
+	// one goroutine, so servers needs no lock.
+	localAddr string
+	servers   []string
 }
 
 type RequestType uint8
 
 const (
-	AppendRequestType RequestType = 0
+	AppendRequestType      RequestType = 0
+	CreateTopicRequestType RequestType = 1
+	// ConfigureTopicRequestType replaces a topic's config overrides.
+	ConfigureTopicRequestType RequestType = 2
+	// PauseMaintenanceRequestType pauses or resumes every node's
+	// maintenance.
+	PauseMaintenanceRequestType RequestType = 3
+	// TruncatePartitionRequestType removes a topic partition's oldest
+	// segments.
+	TruncatePartitionRequestType RequestType = 4
 )
 
-func (l *fsm) Apply(record *raft.Log) interface{} {
+var ErrMalformedEntry = errors.New("malformed raft log entry")
+
+func (l *fsm) Apply(record *raft.Log) (res interface{}) {
+	if l.quarantine {
+		defer func() {
+			if r := recover(); r != nil {
+				res = fmt.Errorf("panic applying entry: %v", r)
+			}
+			// Fenced writes, and writes to topics that don't exist or
+			// creating ones that do, are rejected the same way on every
+			// replica, so they aren't poison.
+			switch res.(type) {
+			case *api.ErrorEpochMismatch, *api.ErrorTopicExists, *api.ErrorUnknownTopic:
+				return
+			}
+			if err, ok := res.(error); ok {
+				l.quarantineEntry(record, err)
+			}
+		}()
+	}
+
 	buf := record.Data
+	if len(buf) == 0 {
+		return ErrMalformedEntry
+	}
+
 	reqType := RequestType(buf[0])
 	switch reqType {
 	case AppendRequestType:
-		return l.applyAppend(buf[1:])
+		return l.applyAppend(buf[1:], record.Term)
+	case CreateTopicRequestType:
+		return l.applyCreateTopic(buf[1:])
+	case ConfigureTopicRequestType:
+		return l.applyConfigureTopic(buf[1:])
+	case PauseMaintenanceRequestType:
+		return l.applyPauseMaintenance(buf[1:])
+	case TruncatePartitionRequestType:
+		return l.applyTruncatePartition(buf[1:])
 	}
-	return nil
+	return fmt.Errorf("%w: unknown request type %d", ErrMalformedEntry, reqType)
+}
+
+func (l *fsm) quarantineEntry(record *raft.Log, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Replay after a restart applies the same entries again, so only record
+	// each index once.
+	for _, e := range l.quarantined {
+		if e.Index == record.Index {
+			return
+		}
+	}
+
+	l.logger.Error("quarantined raft log entry",
+		zap.Uint64("index", record.Index),
+		zap.Uint64("term", record.Term),
+		zap.Error(err))
+
+	l.quarantined = append(l.quarantined, &api.QuarantinedEntry{
+		Index: record.Index,
+		Term:  record.Term,
+		Error: err.Error(),
+	})
+}
+
+func (l *fsm) Quarantined() []*api.QuarantinedEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]*api.QuarantinedEntry, len(l.quarantined))
+	copy(entries, l.quarantined)
+	return entries
 }
 
-func (l *fsm) applyAppend(b []byte) interface{} {
+// applyAppend appends the record of a produce request committed in term, to
+// the default log or the request's topic partition. A record with a term
+// was fenced by the server to that term, and is rejected if it was
+// committed in another, i.e. after leadership changed.
+func (l *fsm) applyAppend(b []byte, term uint64) interface{} {
 	var req api.ProduceRequest
 	err := proto.Unmarshal(b, &req)
 
 	if err != nil {
 		return err
 	}
+	if req.Record == nil {
+		return fmt.Errorf("%w: produce request without a record", ErrMalformedEntry)
+	}
+	if req.Record.Term != 0 && req.Record.Term != term {
+		return &api.ErrorEpochMismatch{
+			Sent:    &api.Epoch{Term: req.Record.Term},
+			Current: &api.Epoch{Term: term},
+		}
+	}
+	req.Record.Term = term
+
+	if l.witness {
+		return &api.ProduceResponse{}
+	}
 
-	offset, err := l.log.Append(req.Record)
+	clog := l.log
+	if req.Topic != "" {
+		if l.topics == nil {
+			return &api.ErrorUnknownTopic{Topic: req.Topic, Partition: req.Partition}
+		}
+		if clog, err = l.topics.partition(req.Topic, req.Partition); err != nil {
+			return err
+		}
+	}
+	offset, err := clog.Append(req.Record)
 	if err != nil {
 		return err
 	}
@@ -282,18 +768,69 @@ func (l *fsm) applyAppend(b []byte) interface{} {
 	return &api.ProduceResponse{Offset: offset}
 }
 
+// StoreConfiguration records the voters' addresses as Raft applies a change
+// to them.
+func (l *fsm) StoreConfiguration(index uint64, config raft.Configuration) {
+	l.servers = l.servers[:0]
+	for _, srv := range config.Servers {
+		if srv.Suffrage == raft.Voter {
+			l.servers = append(l.servers, string(srv.Address))
+		}
+	}
+}
+
 func (l *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	r := l.log.Reader()
-	return &snapshot{reader: r}, nil
+	// Raft doesn't apply entries while it takes a snapshot, so the
+	// readers pin the logs as of the last entry applied. Persisting them
+	// runs alongside later applies.
+	var topics *topicsSnapshot
+	if l.topics != nil && !l.witness {
+		topics = l.topics.snapshot()
+	}
+	if !l.log.Config.SegmentTransfer.Enabled || l.witness {
+		r := l.log.Reader()
+		return &snapshot{topics: topics, reader: r, records: r}, nil
+	}
+
+	// List the sealed segments, which don't change, and carry only the
+	// active segment's records.
+	sealed, next, active := l.log.sealedRanges()
+	m := &segmentManifest{
+		sources:  []string{l.localAddr},
+		segments: sealed,
+		next:     next,
+	}
+	for _, addr := range l.servers {
+		if addr != l.localAddr {
+			m.sources = append(m.sources, addr)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		active.Close()
+		topics.Close()
+		return nil, err
+	}
+	return &snapshot{topics: topics, reader: io.MultiReader(&buf, active), records: active}, nil
 }
 
 var _ raft.FSMSnapshot = (*snapshot)(nil)
 
 type snapshot struct {
+	// topics reads the topics' records, which precede the default log's,
+	// or is nil if the snapshot has none.
+	topics *topicsSnapshot
 	reader io.Reader
+	// records reads the snapshot's records, pinning the segments they're
+	// in until the snapshot is released.
+	records *Reader
 }
 
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.topics.write(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
 	if _, err := io.Copy(sink, s.reader); err != nil {
 		sink.Cancel()
 		return err
@@ -302,14 +839,30 @@ func (s *snapshot) Persist(sink raft.SnapshotSink) error {
 	return sink.Close()
 }
 
-func (s *snapshot) Release() {}
+func (s *snapshot) Release() {
+	s.topics.Close()
+	s.records.Close()
+}
 
-func (f *fsm) Restore(r io.ReadCloser) error {
-	b := make([]byte, lenWidth)
-	var buf bytes.Buffer
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	r := bufio.NewReader(rc)
+	topics := f.topics
+	if f.witness {
+		topics = nil
+	}
+	if err := restoreTopics(r, topics, f.log.Config.Store.MaxRecordBytes); err != nil {
+		return err
+	}
+	m, err := readManifest(r)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return f.restoreSegments(m, r)
+	}
 
 	for i := 0; ; i++ {
-		_, err := io.ReadFull(r, b)
+		p, err := readRecord(r, f.log.Config.Store.MaxRecordBytes)
 		if err == io.EOF {
 			break
 		}
@@ -317,13 +870,8 @@ func (f *fsm) Restore(r io.ReadCloser) error {
 			return err
 		}
 
-		size := int64(enc.Uint64(b))
-		if _, err = io.CopyN(&buf, r, size); err != nil {
-			return err
-		}
-
 		record := &api.Record{}
-		if err = proto.Unmarshal(buf.Bytes(), record); err != nil {
+		if err = proto.Unmarshal(p, record); err != nil {
 			return err
 		}
 
@@ -337,17 +885,95 @@ func (f *fsm) Restore(r io.ReadCloser) error {
 		if _, err = f.log.Append(record); err != nil {
 			return err
 		}
-
-		buf.Reset()
 	}
 
 	return nil
 }
 
-var _ raft.LogStore = (*logStore)(nil)
+// restoreSegments restores a snapshot that lists sealed segments, fetching
+// those the log doesn't already have from the replicas the manifest lists,
+// and then appends the records that follow the manifest.
+func (f *fsm) restoreSegments(m *segmentManifest, r io.Reader) error {
+	f.servers = m.sources
+	if f.witness {
+		return nil
+	}
+
+	fetch := func(dir string, missing []segmentRange) error {
+		err := errors.New("no replica to fetch segments from")
+		for _, addr := range m.sources {
+			if addr == f.localAddr {
+				continue
+			}
+			var n int
+			n, err = fetchSegments(context.Background(), f.log.Config.SegmentTransfer.Dial, addr, dir, missing)
+			if err == nil {
+				return nil
+			}
+			f.logger.Warn("failed to fetch segments",
+				zap.String("address", addr),
+				zap.Error(err))
+			missing = missing[n:]
+		}
+		return err
+	}
+	if err := f.log.install(m.segments, m.next, fetch); err != nil {
+		return err
+	}
+
+	for {
+		p, err := readRecord(r, f.log.Config.Store.MaxRecordBytes)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record := &api.Record{}
+		if err = proto.Unmarshal(p, record); err != nil {
+			return err
+		}
+		if _, err = f.log.Append(record); err != nil {
+			return err
+		}
+	}
+}
+
+// raftLogStore is a Raft log backend.
+type raftLogStore interface {
+	raft.LogStore
+	Close() error
+}
+
+// setupRaftLog opens the Raft log, in Raft.LogDir or, by default, under
+// dataDir.
+func (l *DistributedLog) setupRaftLog(dataDir string) (raftLogStore, error) {
+	dir := l.config.Raft.LogDir
+	if dir == "" {
+		dir = filepath.Join(dataDir, "raft", "log")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	logConfig := l.config
+	logConfig.Segment.InitialOffset = 1
+	// Raft compacts its own log after snapshots; retention is for the
+	// records.
+	logConfig.Retention.MaxAge, logConfig.Retention.MaxBytes = 0, 0
+	logConfig.Retention.OnDelete = nil
+	if l.config.Raft.LogMaxStoreBytes != 0 {
+		logConfig.Segment.MaxStoreBytes = l.config.Raft.LogMaxStoreBytes
+	}
+	return newLogStore(dir, logConfig)
+}
+
+var _ raftLogStore = (*logStore)(nil)
 
 type logStore struct {
 	*Log
+	// cache holds recent entries, or is nil if caching is disabled.
+	cache *logCache
 }
 
 func newLogStore(dir string, config Config) (*logStore, error) {
@@ -355,11 +981,19 @@ func newLogStore(dir string, config Config) (*logStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &logStore{Log: l}, nil
+	s := &logStore{Log: l}
+	entries := config.Raft.LogCacheEntries
+	if entries == 0 {
+		entries = defaultLogCacheEntries
+	}
+	if entries > 0 {
+		s.cache = newLogCache(entries, config.Metrics)
+	}
+	return s, nil
 }
 
 func (s *logStore) FirstIndex() (uint64, error) {
-	return s.FirstOffset()
+	return s.LowestOffset()
 }
 
 func (s *logStore) LastIndex() (uint64, error) {
@@ -368,14 +1002,24 @@ func (s *logStore) LastIndex() (uint64, error) {
 }
 
 func (s *logStore) GetLog(index uint64, out *raft.Log) error {
+	if s.cache != nil && s.cache.get(index, out) {
+		return nil
+	}
 	in, err := s.Read(index)
-	if err != nil {
+	switch err.(type) {
+	case nil:
+	case *api.ErrorOffsetOutOfRange, *api.ErrorOffsetTruncated:
+		// Raft falls back to sending a snapshot only for this error, e.g.
+		// to a follower behind the entries compacted away.
+		return raft.ErrLogNotFound
+	default:
 		return err
 	}
 
 	out.Data = in.Value
 	out.Index = in.Offset
 	out.Term = in.Term
+	out.Type = raft.LogType(in.Type)
 	return nil
 }
 
@@ -383,38 +1027,77 @@ func (s *logStore) StoreLog(log *raft.Log) error {
 	return s.StoreLogs([]*raft.Log{log})
 }
 
+// StoreLogs appends logs as one batch, synced to disk once.
 func (s *logStore) StoreLogs(logs []*raft.Log) error {
-	for _, l := range logs {
-		if _, err := s.Append(&Record{
+	records := make([]*api.Record, len(logs))
+	for i, l := range logs {
+		records[i] = &api.Record{
 			Term:  l.Term,
 			Value: l.Data,
 			Type:  uint32(l.Type),
-		}); err != nil {
-			return err
+		}
+	}
+	if _, err := s.AppendBatch(records); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		for _, l := range logs {
+			s.cache.add(l)
 		}
 	}
 	return nil
 }
 
+// DeleteRange deletes the entries from min to max inclusive. Raft deletes
+// from the head of the log, compacting it after a snapshot, or from its
+// tail, dropping entries that conflict with a new leader's.
 func (s *logStore) DeleteRange(min, max uint64) error {
-	return s.Truncate(min)
-}
-
-type StreamLayer interface {
-	net.Listener
-
-	// Dial is used to establish a connection to a remote address
-	Dial(address ServerAddress, timeout time.Duration) (net.Conn, error)
+	if s.cache != nil {
+		s.cache.remove(min, max)
+	}
+	lowest, err := s.LowestOffset()
+	if err != nil {
+		return err
+	}
+	highest, err := s.HighestOffset()
+	if err != nil {
+		return err
+	}
+	switch {
+	case min <= lowest && max >= highest:
+		// Entries resume after the deleted ones, e.g. after the snapshot
+		// the log was compacted to.
+		return s.Clear(max + 1)
+	case max >= highest:
+		return s.TruncateTail(min)
+	case min <= lowest:
+		// Truncate keeps the segment holding max, so Raft may find
+		// entries up to it until the log grows past the segment.
+		return s.Truncate(max)
+	}
+	return fmt.Errorf("can't delete entries %d to %d from the middle of the log", min, max)
 }
 
 var _ raft.StreamLayer = (*StreamLayer)(nil)
 
+// StreamLayer carries Raft's RPCs over connections to ln, optionally
+// secured with mutual TLS.
 type StreamLayer struct {
-	ln net.Listener
+	ln              net.Listener
+	serverTLSConfig *tls.Config
+	peerTLSConfig   *tls.Config
 }
 
-func NewStreamLayer(ln net.Listener) StreamLayer {
-	return &StreamLayer{ln: ln}
+// NewStreamLayer returns a stream layer accepting Raft's connections on ln.
+// With serverTLSConfig, accepted connections are served over TLS, and with
+// peerTLSConfig, the connections it dials are; either nil leaves that side
+// plaintext.
+func NewStreamLayer(ln net.Listener, serverTLSConfig, peerTLSConfig *tls.Config) *StreamLayer {
+	return &StreamLayer{
+		ln:              ln,
+		serverTLSConfig: serverTLSConfig,
+		peerTLSConfig:   peerTLSConfig,
+	}
 }
 
 const RaftRPC = 1
@@ -426,11 +1109,24 @@ func (s *StreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (n
 		return nil, err
 	}
 
+	// The RPC type byte is sent in the clear, so the listener can route
+	// the connection before the handshake.
 	_, err = conn.Write([]byte{byte(RaftRPC)})
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
+	if s.peerTLSConfig != nil {
+		config := s.peerTLSConfig
+		if config.ServerName == "" {
+			// Verify the peer's certificate names the host dialed, as
+			// gRPC does.
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(string(address))
+		}
+		conn = tls.Client(conn, config)
+	}
 	return conn, nil
 }
 
@@ -450,6 +1146,9 @@ func (s *StreamLayer) Accept() (net.Conn, error) {
 		return nil, fmt.Errorf("expected Raft RPC but got %v", b)
 	}
 
+	if s.serverTLSConfig != nil {
+		conn = tls.Server(conn, s.serverTLSConfig)
+	}
 	return conn, nil
 }
 
@@ -9,11 +9,13 @@ import (
 	"testing"
 	"time"
 
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
 	"github.com/Tarunshrma/prolog/internal/log"
-	api "github.com/Tarunshrma/prolog/log/api/v1"
 	"github.com/hashicorp/raft"
-	"github.com/test-go/testify/require"
+	"github.com/stretchr/testify/require"
 	"github.com/travisjeffery/go-dynaport"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestMultipleNodes(t *testing.T) {
@@ -35,11 +37,11 @@ func TestMultipleNodes(t *testing.T) {
 		require.NoError(t, err)
 
 		config := log.Config{}
-		config.Raft.StreamLayer = log.NewStreamLayer(ln)
+		config.Raft.StreamLayer = log.NewStreamLayer(ln, nil, nil)
 		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
 		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
 		config.Raft.ElectionTimeout = 50 * time.Millisecond
-		config.Raft.LeaderLeaseTimeout = 100 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
 		config.Raft.CommitTimeout = 5 * time.Millisecond
 
 		if i == 0 {
@@ -48,6 +50,7 @@ func TestMultipleNodes(t *testing.T) {
 
 		l, err := log.NewDistributedLog(dataDir, config)
 		require.NoError(t, err)
+		defer l.Close()
 		if i != 0 {
 			err = logs[0].Join(fmt.Sprintf("%d", i), ln.Addr().String())
 			require.NoError(t, err)
@@ -56,34 +59,120 @@ func TestMultipleNodes(t *testing.T) {
 			require.NoError(t, err)
 		}
 		logs = append(logs, l)
+	}
 
-		records := []*api.Record{
-			{Value: []byte("first")},
-			{Value: []byte("second")},
-		}
+	records := []*api.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+	}
 
-		for _, record := range records {
-			off, err := logs[0].Append(record)
-			require.NoError(t, err)
+	for _, record := range records {
+		off, err := logs[0].Append(record)
+		require.NoError(t, err)
 
-			require.Eventually(t, func() bool {
-				for j := 0; j < nodeCount; j++ {
-					got, err := logs[j].Read(off)
-					if err != nil {
-						return false
-					}
-
-					record.Offset = off
-					if !reflect.DeepEqual(got.value, record.Value) {
-						return false
-					}
+		require.Eventually(t, func() bool {
+			for j := 0; j < nodeCount; j++ {
+				got, err := logs[j].Read(off)
+				if err != nil {
+					return false
 				}
-				return true
-			}, 500*time.Millisecond, 50*time.Millisecond)
+
+				record.Offset = off
+				if !reflect.DeepEqual(got.Value, record.Value) {
+					return false
+				}
+			}
+			return true
+		}, 500*time.Millisecond, 50*time.Millisecond)
+	}
+
+	// Topics and their records are replicated like the default log's, so
+	// any node can serve them.
+	require.NoError(t, logs[0].CreateTopic("orders", 2))
+	partition, err := logs[0].Partition("orders", 1)
+	require.NoError(t, err)
+	orderOff, err := partition.Append(&api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		for j := 0; j < nodeCount; j++ {
+			partition, err := logs[j].Partition("orders", 1)
+			if err != nil {
+				return false
+			}
+			got, err := partition.Read(orderOff)
+			if err != nil || string(got.Value) != "order" {
+				return false
+			}
 		}
+		return true
+	}, 500*time.Millisecond, 50*time.Millisecond)
+	err = logs[1].CreateTopic("orders", 1)
+	require.IsType(t, &api.ErrorNotLeader{}, err)
+
+	// So are topics' config overrides.
+	config := &api.TopicConfig{RetentionMaxBytes: 1 << 20}
+	require.NoError(t, logs[0].ConfigureTopic("orders", config))
+	require.Eventually(t, func() bool {
+		for j := 0; j < nodeCount; j++ {
+			topics, err := logs[j].ListTopics()
+			if err != nil || len(topics) != 2 || !proto.Equal(config, topics[1].Config) {
+				return false
+			}
+		}
+		return true
+	}, 500*time.Millisecond, 50*time.Millisecond)
+
+	// And so are truncations of topics' partitions.
+	require.NoError(t, logs[0].CreateConfiguredTopic(&api.Topic{
+		Name:       "truncated",
+		Partitions: 1,
+		Config:     &api.TopicConfig{SegmentMaxStoreBytes: 64},
+	}))
+	partition, err = logs[0].Partition("truncated", 0)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = partition.Append(&api.Record{Value: []byte("truncated")})
+		require.NoError(t, err)
 	}
+	require.NoError(t, partition.(backend.Truncater).Truncate(5))
+	require.Eventually(t, func() bool {
+		for j := 0; j < nodeCount; j++ {
+			partition, err := logs[j].Partition("truncated", 0)
+			if err != nil {
+				return false
+			}
+			lowest, err := partition.LowestOffset()
+			if err != nil || lowest == 0 || lowest > 6 {
+				return false
+			}
+		}
+		return true
+	}, 500*time.Millisecond, 50*time.Millisecond)
 
-	err := logs[0].Leave("1")
+	// Maintenance can be paused on every node at once, through the leader.
+	until, err := logs[0].PauseClusterMaintenance(time.Hour)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		for j := 0; j < nodeCount; j++ {
+			if !logs[j].MaintenancePausedUntil().Equal(until) {
+				return false
+			}
+		}
+		return true
+	}, 500*time.Millisecond, 50*time.Millisecond)
+	_, err = logs[1].PauseClusterMaintenance(time.Hour)
+	require.IsType(t, &api.ErrorNotLeader{}, err)
+	require.NoError(t, logs[0].ResumeClusterMaintenance())
+	require.Eventually(t, func() bool {
+		for j := 0; j < nodeCount; j++ {
+			if !logs[j].MaintenancePausedUntil().IsZero() {
+				return false
+			}
+		}
+		return true
+	}, 500*time.Millisecond, 50*time.Millisecond)
+
+	err = logs[0].Leave("1")
 	require.NoError(t, err)
 
 	time.Sleep(100 * time.Millisecond)
@@ -93,7 +182,7 @@ func TestMultipleNodes(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	record, err := logs[1].Read(off)
-	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+	require.IsType(t, &api.ErrorOffsetOutOfRange{}, err)
 	require.Nil(t, record)
 
 	record, err = logs[2].Read(off)
@@ -101,3 +190,242 @@ func TestMultipleNodes(t *testing.T) {
 	require.Equal(t, []byte("third"), record.Value)
 	require.Equal(t, off, record.Offset)
 }
+
+func TestDistributedLogAppendErrors(t *testing.T) {
+	var logs []*log.DistributedLog
+	nodeCount := 2
+	ports := dynaport.Get(nodeCount)
+
+	for i := 0; i < nodeCount; i++ {
+		dataDir, err := ioutil.TempDir("", "distributed-log-test")
+		require.NoError(t, err)
+		defer func(dir string) {
+			_ = os.RemoveAll(dir)
+		}(dataDir)
+
+		ln, err := net.Listen(
+			"tcp",
+			fmt.Sprintf("127.0.0.1:%d", ports[i]),
+		)
+		require.NoError(t, err)
+
+		config := log.Config{}
+		config.Raft.StreamLayer = log.NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.Quarantine = true
+
+		if i == 0 {
+			config.Raft.Bootstrap = true
+		}
+
+		l, err := log.NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		defer l.Close()
+
+		if i != 0 {
+			err = logs[0].Join(fmt.Sprintf("%d", i), ln.Addr().String())
+			require.NoError(t, err)
+		} else {
+			err = l.WaitForLeader(3 * time.Second)
+			require.NoError(t, err)
+		}
+		logs = append(logs, l)
+	}
+
+	// not leader
+	require.Eventually(t, func() bool {
+		_, err := logs[1].Append(&api.Record{Value: []byte("hello")})
+		notLeader, ok := err.(*api.ErrorNotLeader)
+		return ok && notLeader.Leader == fmt.Sprintf("127.0.0.1:%d", ports[0])
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// fsm error
+	_, err := logs[0].Append(nil)
+	applyErr, ok := err.(*api.ErrorApplyFailed)
+	require.True(t, ok)
+	require.Error(t, applyErr.Err)
+
+	quarantined, err := logs[0].Quarantined()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(quarantined))
+
+	off, err := logs[0].Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	record, err := logs[0].Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+}
+
+func TestWitness(t *testing.T) {
+	var logs []*log.DistributedLog
+	nodeCount := 2
+	ports := dynaport.Get(nodeCount)
+
+	for i := 0; i < nodeCount; i++ {
+		dataDir, err := ioutil.TempDir("", "distributed-log-test")
+		require.NoError(t, err)
+		defer func(dir string) {
+			_ = os.RemoveAll(dir)
+		}(dataDir)
+
+		ln, err := net.Listen(
+			"tcp",
+			fmt.Sprintf("127.0.0.1:%d", ports[i]),
+		)
+		require.NoError(t, err)
+
+		config := log.Config{}
+		config.Raft.StreamLayer = log.NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+
+		// The witness bootstraps the cluster, so it starts as the leader.
+		if i == 0 {
+			config.Raft.Bootstrap = true
+			config.Raft.Witness = true
+		}
+
+		l, err := log.NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		defer l.Close()
+
+		if i != 0 {
+			err = logs[0].Join(fmt.Sprintf("%d", i), ln.Addr().String())
+			require.NoError(t, err)
+		} else {
+			err = l.WaitForLeader(3 * time.Second)
+			require.NoError(t, err)
+		}
+		logs = append(logs, l)
+	}
+
+	_, err := logs[0].Append(&api.Record{Value: []byte("hello")})
+	require.IsType(t, &api.ErrorNotLeader{}, err)
+
+	// The witness hands leadership to the data node.
+	var off uint64
+	require.Eventually(t, func() bool {
+		off, err = logs[1].Append(&api.Record{Value: []byte("hello")})
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	record, err := logs[1].Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+
+	record, err = logs[0].Read(off)
+	require.Error(t, err)
+	require.Nil(t, record)
+}
+
+func TestWitnessLeaderWithLaggingFollower(t *testing.T) {
+	nodeCount := 3
+	ports := dynaport.Get(nodeCount)
+	dirs := make([]string, nodeCount)
+	for i := range dirs {
+		dirs[i] = t.TempDir()
+	}
+	start := func(i int) *log.DistributedLog {
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ports[i]))
+		require.NoError(t, err)
+
+		config := log.Config{}
+		config.Raft.StreamLayer = log.NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.SnapshotInterval = 50 * time.Millisecond
+		if i == 0 {
+			config.Raft.Bootstrap = true
+			config.Raft.Witness = true
+		}
+
+		l, err := log.NewDistributedLog(dirs[i], config)
+		require.NoError(t, err)
+		return l
+	}
+
+	logs := make([]*log.DistributedLog, nodeCount)
+	defer func() {
+		for _, l := range logs {
+			if l != nil {
+				l.Close()
+			}
+		}
+	}()
+	logs[0] = start(0)
+	require.NoError(t, logs[0].WaitForLeader(3*time.Second))
+	for i := 1; i < nodeCount; i++ {
+		logs[i] = start(i)
+		// Once a data node has joined, the witness hands it leadership, so
+		// join through whichever node leads.
+		require.Eventually(t, func() bool {
+			for _, l := range logs[:i] {
+				if l.Join(fmt.Sprintf("%d", i), fmt.Sprintf("127.0.0.1:%d", ports[i])) == nil {
+					return true
+				}
+			}
+			return false
+		}, 3*time.Second, 50*time.Millisecond)
+	}
+
+	// The witness hands leadership to a data node; the other follows it.
+	var leader int
+	require.Eventually(t, func() bool {
+		for leader = 1; leader < nodeCount; leader++ {
+			if _, err := logs[leader].Append(&api.Record{Value: []byte("first")}); err == nil {
+				return true
+			}
+		}
+		return false
+	}, 3*time.Second, 50*time.Millisecond)
+	follower := 3 - leader
+	require.Eventually(t, func() bool {
+		_, err := logs[follower].Read(0)
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// The follower falls behind the witness's trailing logs while it's
+	// down, and the witness snapshots past it.
+	require.NoError(t, logs[follower].Close())
+	logs[follower] = nil
+	var last string
+	for i := 0; i < 200; i++ {
+		last = fmt.Sprintf("record %d", i)
+		_, err := logs[leader].Append(&api.Record{Value: []byte(last)})
+		require.NoError(t, err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	// With the leader down, the witness leads the follower, which it
+	// mustn't catch up with its empty snapshot.
+	require.NoError(t, logs[leader].Close())
+	logs[leader] = nil
+	logs[follower] = start(follower)
+	time.Sleep(time.Second)
+	// Had it installed the snapshot, the follower would look caught up and
+	// take leadership from the witness without the records it missed.
+	_, err := logs[follower].Append(&api.Record{Value: []byte("lost")})
+	require.IsType(t, &api.ErrorNotLeader{}, err)
+
+	// Once the data node is back, it leads and catches the follower up
+	// with the records it missed.
+	logs[leader] = start(leader)
+	require.Eventually(t, func() bool {
+		highest, err := logs[follower].HighestOffset()
+		if err != nil {
+			return false
+		}
+		record, err := logs[follower].Read(highest)
+		return err == nil && string(record.Value) == last
+	}, 10*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,24 @@
+package log
+
+import (
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/hashicorp/raft"
+)
+
+// applyError translates the errors raft returns from Apply into api errors
+// so the server can hand clients accurate, typed failures. Writes that
+// were never proposed fail as ErrorNotLeader, which is safe to retry;
+// writes the leader proposed before losing leadership may still commit.
+func applyError(err error, leader raft.ServerAddress, timeout time.Duration) error {
+	switch err {
+	case raft.ErrNotLeader, raft.ErrLeadershipTransferInProgress:
+		return &api.ErrorNotLeader{Leader: string(leader)}
+	case raft.ErrLeadershipLost:
+		return &api.ErrorLeadershipLost{Leader: string(leader)}
+	case raft.ErrEnqueueTimeout:
+		return &api.ErrorApplyTimeout{Timeout: timeout}
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApplyError(t *testing.T) {
+	leader := raft.ServerAddress("127.0.0.1:8400")
+	timeout := time.Second
+
+	for _, err := range []error{
+		raft.ErrNotLeader,
+		raft.ErrLeadershipTransferInProgress,
+	} {
+		got := applyError(err, leader, timeout)
+		require.Equal(t, &api.ErrorNotLeader{Leader: string(leader)}, got)
+	}
+
+	// A proposed write may have committed, so it isn't reported as
+	// retryable.
+	got := applyError(raft.ErrLeadershipLost, leader, timeout)
+	require.Equal(t, &api.ErrorLeadershipLost{Leader: string(leader)}, got)
+	require.Equal(t, codes.Aborted, status.Code(got))
+
+	got = applyError(raft.ErrEnqueueTimeout, leader, timeout)
+	require.Equal(t, &api.ErrorApplyTimeout{Timeout: timeout}, got)
+
+	err := errors.New("boom")
+	require.Equal(t, err, applyError(err, leader, timeout))
+}
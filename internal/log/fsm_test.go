@@ -0,0 +1,325 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFSMQuarantine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+
+	f := &fsm{log: l, quarantine: true, logger: zap.NewNop()}
+
+	// A produce request without a record has nothing to append.
+	b, err := proto.Marshal(&api.ProduceRequest{})
+	require.NoError(t, err)
+	poison := []*raft.Log{
+		{Index: 1, Term: 1, Data: nil},
+		{Index: 2, Term: 1, Data: []byte{byte(42)}},
+		{Index: 3, Term: 1, Data: append([]byte{byte(AppendRequestType)}, b...)},
+	}
+
+	for _, entry := range poison {
+		res := f.Apply(entry)
+		require.Error(t, res.(error))
+	}
+
+	// Replaying the same entries must not duplicate them.
+	for _, entry := range poison {
+		f.Apply(entry)
+	}
+
+	quarantined := f.Quarantined()
+	require.Equal(t, len(poison), len(quarantined))
+	for i, entry := range poison {
+		require.Equal(t, entry.Index, quarantined[i].Index)
+		require.Equal(t, entry.Term, quarantined[i].Term)
+	}
+
+	b, err = proto.Marshal(&api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	res := f.Apply(&raft.Log{
+		Index: 4,
+		Term:  1,
+		Data:  append([]byte{byte(AppendRequestType)}, b...),
+	})
+	require.IsType(t, &api.ProduceResponse{}, res)
+	require.Equal(t, len(poison), len(f.Quarantined()))
+}
+
+func TestFSMTerms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsm-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+
+	f := &fsm{log: l, quarantine: true, logger: zap.NewNop()}
+	apply := func(index, term uint64, record *api.Record) interface{} {
+		b, err := proto.Marshal(&api.ProduceRequest{Record: record})
+		require.NoError(t, err)
+		return f.Apply(&raft.Log{
+			Index: index,
+			Term:  term,
+			Data:  append([]byte{byte(AppendRequestType)}, b...),
+		})
+	}
+
+	// Records take the term they were committed in.
+	res := apply(1, 2, &api.Record{Value: []byte("hello world")})
+	require.IsType(t, &api.ProduceResponse{}, res)
+	record, err := l.Read(res.(*api.ProduceResponse).Offset)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), record.Term)
+
+	// A record fenced to an earlier term is rejected, on every replica
+	// alike, so it isn't quarantined.
+	res = apply(2, 3, &api.Record{Value: []byte("hello world"), Term: 2})
+	require.Equal(t, &api.ErrorEpochMismatch{
+		Sent:    &api.Epoch{Term: 2},
+		Current: &api.Epoch{Term: 3},
+	}, res)
+	require.Empty(t, f.Quarantined())
+	highest, err := l.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), highest)
+}
+
+func TestFSMSnapshotPointInTime(t *testing.T) {
+	for _, segments := range []bool{false, true} {
+		l := newTransferLog(t)
+		l.Config.SegmentTransfer.Enabled = segments
+		for i := 0; i < 5; i++ {
+			_, err := l.Append(&api.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+		}
+
+		f := &fsm{log: l, logger: zap.NewNop()}
+		snap, err := f.Snapshot()
+		require.NoError(t, err)
+
+		// Appends and truncation while the snapshot persists don't change
+		// what it holds.
+		for i := 0; i < 3; i++ {
+			_, err := l.Append(&api.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+		}
+		require.NoError(t, l.Truncate(3))
+
+		r := bufio.NewReader(snap.(*snapshot).reader)
+		m, err := readManifest(r)
+		require.NoError(t, err)
+		want := uint64(0)
+		if segments {
+			want = m.next
+		}
+		for ; ; want++ {
+			p, err := readRecord(r, 0)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			record := &api.Record{}
+			require.NoError(t, proto.Unmarshal(p, record))
+			require.Equal(t, want, record.Offset)
+		}
+		require.Equal(t, uint64(5), want)
+		snap.Release()
+	}
+}
+
+func TestFSMTopics(t *testing.T) {
+	newFSM := func() *fsm {
+		c := Config{}
+		c.Segment.MaxIndexBytes = entWidth * 2
+		topics, err := NewTopics(t.TempDir(), c)
+		require.NoError(t, err)
+		t.Cleanup(func() { topics.Close() })
+		l, err := NewLog(t.TempDir(), c)
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+		return &fsm{log: l, topics: topics, quarantine: true, logger: zap.NewNop()}
+	}
+	f := newFSM()
+	index := uint64(0)
+	apply := func(reqType RequestType, req proto.Message) interface{} {
+		b, err := proto.Marshal(req)
+		require.NoError(t, err)
+		index++
+		return f.Apply(&raft.Log{Index: index, Term: 1, Data: append([]byte{byte(reqType)}, b...)})
+	}
+
+	create := &api.CreateTopicRequest{Topic: &api.Topic{Name: "orders", Partitions: 2}}
+	require.IsType(t, &api.CreateTopicResponse{}, apply(CreateTopicRequestType, create))
+	for i := 0; i < 5; i++ {
+		res := apply(AppendRequestType, &api.ProduceRequest{
+			Record:    &api.Record{Value: []byte("hello world")},
+			Topic:     "orders",
+			Partition: 1,
+		})
+		require.Equal(t, &api.ProduceResponse{Offset: uint64(i)}, res)
+	}
+
+	// Creating a topic that exists, or appending to one that doesn't, is
+	// rejected on every replica alike, so it isn't quarantined.
+	require.Equal(t, &api.ErrorTopicExists{Topic: "orders"}, apply(CreateTopicRequestType, create))
+	res := apply(AppendRequestType, &api.ProduceRequest{
+		Record:    &api.Record{Value: []byte("hello world")},
+		Topic:     "orders",
+		Partition: 2,
+	})
+	require.Equal(t, &api.ErrorUnknownTopic{Topic: "orders", Partition: 2}, res)
+	res = apply(ConfigureTopicRequestType, &api.ConfigureTopicRequest{Topic: "missing"})
+	require.Equal(t, &api.ErrorUnknownTopic{Topic: "missing"}, res)
+	require.Empty(t, f.Quarantined())
+
+	config := &api.TopicConfig{RetentionMaxAgeMs: 60000}
+	res = apply(ConfigureTopicRequestType, &api.ConfigureTopicRequest{Topic: "orders", Config: config})
+	require.IsType(t, &api.ConfigureTopicResponse{}, res)
+
+	// A snapshot carries the topics and their config overrides, truncated
+	// partitions included.
+	source, err := f.topics.partition("orders", 1)
+	require.NoError(t, err)
+	require.NoError(t, source.Truncate(1))
+	snap, err := f.Snapshot()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, snap.(*snapshot).topics.write(&buf))
+	_, err = io.Copy(&buf, snap.(*snapshot).reader)
+	require.NoError(t, err)
+	snap.Release()
+
+	target := newFSM()
+	require.NoError(t, target.Restore(io.NopCloser(&buf)))
+	list, err := target.topics.ListTopics()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "orders", list[1].Name)
+	require.Equal(t, uint32(2), list[1].Partitions)
+	require.True(t, proto.Equal(config, list[1].Config))
+	// Restoring the topics doesn't record their changes again: the
+	// snapshot's events are all there are.
+	events, err := target.topics.partition(api.TopicEventsTopic, 0)
+	require.NoError(t, err)
+	highest, err := events.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), highest)
+	restored, err := target.topics.partition("orders", 1)
+	require.NoError(t, err)
+	for _, l := range []*Log{source, restored} {
+		lowest, err := l.LowestOffset()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), lowest)
+		highest, err := l.HighestOffset()
+		require.NoError(t, err)
+		require.Equal(t, uint64(4), highest)
+	}
+	off, err := restored.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+}
+
+// FuzzFSMApply applies arbitrary replicated entries, which must be rejected
+// with an error rather than panic the node, with quarantine off.
+func FuzzFSMApply(f *testing.F) {
+	b, err := proto.Marshal(&api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(f, err)
+	f.Add(append([]byte{byte(AppendRequestType)}, b...))
+	f.Add(append([]byte{byte(AppendRequestType)}, b[:len(b)/2]...))
+	f.Add([]byte{byte(AppendRequestType)})
+	f.Add([]byte{byte(42)})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l, err := NewLog(t.TempDir(), Config{})
+		require.NoError(t, err)
+		defer l.Close()
+
+		target := &fsm{log: l, logger: zap.NewNop()}
+		switch res := target.Apply(&raft.Log{Index: 1, Term: 1, Data: data}).(type) {
+		case error:
+		case *api.ProduceResponse:
+			record, err := l.Read(res.Offset)
+			require.NoError(t, err)
+			require.Equal(t, res.Offset, record.Offset)
+		default:
+			t.Fatalf("unexpected apply result %T", res)
+		}
+	})
+}
+
+// FuzzFSMRestore restores arbitrary snapshots, seeded with truncated and
+// corrupted snapshots of records and of segments, which must fail with an
+// error rather than panic the node.
+func FuzzFSMRestore(f *testing.F) {
+	source := newTransferLog(f)
+	for i := 0; i < 5; i++ {
+		_, err := source.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(f, err)
+	}
+	from := &fsm{log: source, logger: zap.NewNop(), localAddr: "127.0.0.1:1"}
+	for _, segments := range []bool{false, true} {
+		source.Config.SegmentTransfer.Enabled = segments
+		snap, err := from.Snapshot()
+		require.NoError(f, err)
+		b, err := ioutil.ReadAll(snap.(*snapshot).reader)
+		require.NoError(f, err)
+
+		f.Add(b)
+		f.Add(b[:len(b)/2])
+		f.Add(b[:len(manifestMagic)+3])
+		corrupt := append([]byte(nil), b...)
+		corrupt[len(corrupt)-5] ^= 0xff
+		f.Add(corrupt)
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l := newTransferLog(t)
+		defer l.Close()
+		// Don't reach out to the addresses a manifest lists.
+		l.Config.SegmentTransfer.Dial = func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("no network while fuzzing")
+		}
+
+		target := &fsm{log: l, logger: zap.NewNop()}
+		if err := target.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+			return
+		}
+
+		// A restored log keeps appending after the records it holds, which
+		// are dense up to there.
+		off, err := l.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		lowest, err := l.LowestOffset()
+		require.NoError(t, err)
+		for o := lowest; o < off; o++ {
+			_, err := l.Read(o)
+			require.NoError(t, err)
+		}
+	})
+}
@@ -3,7 +3,10 @@ package log
 import (
 	"io"
 	"os"
+	"sort"
+	"sync"
 
+	"github.com/Tarunshrma/prolog/internal/budget"
 	"github.com/tysonmote/gommap"
 )
 
@@ -22,13 +25,24 @@ type index struct {
 		offering high performance.
 	*/
 	mmap gommap.MMap
+	// mu guards the mapping, which is replaced as an index grows.
+	mu sync.RWMutex
 
 	size uint64
+	// max is how large the mapping may grow.
+	max uint64
+
+	budget *budget.Budget
 }
 
+// initialIndexBytes is how much a growing index maps up front.
+const initialIndexBytes = 4096
+
 func newIndex(f *os.File, c Config) (*index, error) {
 	idx := &index{
-		file: f,
+		file:   f,
+		max:    c.Segment.MaxIndexBytes,
+		budget: c.Budget,
 	}
 
 	fi, err := os.Stat(f.Name())
@@ -37,22 +51,51 @@ func newIndex(f *os.File, c Config) (*index, error) {
 	}
 
 	idx.size = uint64(fi.Size())
-	if err := os.Truncate(f.Name(), int64(c.Segment.MaxIndexBytes)); err != nil {
+	mapped := idx.max
+	if c.Segment.IndexMmap == IndexMmapGrow {
+		mapped = min(initialIndexBytes, idx.max)
+		for mapped < idx.size+entWidth && mapped < idx.max {
+			mapped = min(2*mapped, idx.max)
+		}
+	}
+	if err := idx.remap(mapped); err != nil {
 		return nil, err
 	}
 
-	if idx.mmap, err = gommap.Map(
-		idx.file.Fd(),
+	return idx, nil
+}
+
+// remap sizes the index file to n bytes and maps all of it.
+func (i *index) remap(n uint64) error {
+	if i.mmap != nil {
+		if err := i.mmap.UnsafeUnmap(); err != nil {
+			return err
+		}
+		i.budget.Release(budget.MmapBytes, int64(len(i.mmap)))
+		i.mmap = nil
+	}
+	if err := os.Truncate(i.file.Name(), int64(n)); err != nil {
+		return err
+	}
+
+	var err error
+	i.mmap, err = gommap.Map(
+		i.file.Fd(),
 		gommap.PROT_READ|gommap.PROT_WRITE,
 		gommap.MAP_SHARED,
-	); err != nil {
-		return nil, err
+	)
+	if err != nil {
+		return err
 	}
-
-	return idx, nil
+	i.budget.Acquire(budget.MmapBytes, int64(len(i.mmap)))
+	return nil
 }
 
 func (i *index) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	defer i.budget.Release(budget.MmapBytes, int64(len(i.mmap)))
+
 	//Why both i.mmap.Sync and i.file.Sync?
 	//The operating system maintains its own buffer cache.
 	// mmap.Sync writes changes to this cache
@@ -72,30 +115,79 @@ func (i *index) Close() error {
 	return i.file.Close()
 }
 
+// Read returns the in'th entry, or the last entry if in is -1.
 func (i *index) Read(in int64) (out int32, pos uint64, err error) {
-	if i.size == 0 {
-		return 0, 0, nil
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.size == 0 || in < -1 {
+		return 0, 0, io.EOF
 	}
 
+	n := uint64(in)
 	if in == -1 {
-		out = int32((i.size / entWidth) - 1)
-	} else {
-		out = int32(in)
+		n = i.entries() - 1
 	}
-
-	pos = uint64(out) * entWidth
-	if i.size < pos+entWidth {
+	if n >= i.entries() {
 		return 0, 0, io.EOF
 	}
-	out = enc.Uint32(i.mmap[pos : pos+offWidth])
-	pos = enc.Uint64(i.mmap[pos+offWidth : pos+entWidth])
-	return out, pos, nil
 
+	off, pos := i.entry(n)
+	return int32(off), pos, nil
+}
+
+// Find returns the store position of the record at off, relative to the
+// segment's base offset. Records are indexed in order without gaps, so the
+// off'th entry normally holds it; Find checks that and falls back to a
+// binary search if it doesn't.
+func (i *index) Find(off uint32) (pos uint64, err error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	n := i.entries()
+	if uint64(off) < n {
+		if got, pos := i.entry(uint64(off)); got == off {
+			return pos, nil
+		}
+	}
+
+	j := uint64(sort.Search(int(n), func(j int) bool {
+		got, _ := i.entry(uint64(j))
+		return got >= off
+	}))
+	if j < n {
+		if got, pos := i.entry(j); got == off {
+			return pos, nil
+		}
+	}
+	return 0, io.EOF
+}
+
+func (i *index) entries() uint64 {
+	return i.size / entWidth
+}
+
+func (i *index) entry(n uint64) (off uint32, pos uint64) {
+	at := n * entWidth
+	off = enc.Uint32(i.mmap[at : at+offWidth])
+	pos = enc.Uint64(i.mmap[at+offWidth : at+entWidth])
+	return off, pos
 }
 
 func (i *index) Write(off int32, pos uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	if uint64(len(i.mmap)) < i.size+entWidth {
-		return io.EOF
+		if uint64(len(i.mmap)) >= i.max {
+			return io.EOF
+		}
+		if err := i.remap(min(2*uint64(len(i.mmap)), i.max)); err != nil {
+			return err
+		}
+		if uint64(len(i.mmap)) < i.size+entWidth {
+			return io.EOF
+		}
 	}
 
 	enc.PutUint32(i.mmap[i.size:i.size+offWidth], uint32(off))
@@ -104,6 +196,30 @@ func (i *index) Write(off int32, pos uint64) error {
 	return nil
 }
 
+// sync writes the entries written through the mapping to disk.
+func (i *index) sync() error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.mmap.Sync(gommap.MS_SYNC)
+}
+
+// truncate drops the entries from the n'th on.
+func (i *index) truncate(n uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if n*entWidth < i.size {
+		i.size = n * entWidth
+	}
+}
+
+// section returns a reader over the index's entries as of now. The file is
+// mapped shared, so reading it sees entries written through the mapping.
+func (i *index) section() *io.SectionReader {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return io.NewSectionReader(i.file, 0, int64(i.size))
+}
+
 func (i *index) Name() string {
 	return i.file.Name()
 }
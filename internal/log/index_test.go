@@ -5,7 +5,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/test-go/testify/require"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIndex(t *testing.T) {
@@ -36,7 +36,7 @@ func TestIndex(t *testing.T) {
 
 		got, pos, err := idx.Read(int64(want.Off))
 		require.NoError(t, err)
-		require.Equal(t, want.Off, got)
+		require.Equal(t, want.Off, uint32(got))
 		require.Equal(t, want.Pos, pos)
 	}
 
@@ -52,3 +52,73 @@ func TestIndex(t *testing.T) {
 	require.Equal(t, int32(1), off)
 	require.Equal(t, uint64(10), pos)
 }
+
+func TestIndexFind(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "index_find_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = 1024
+
+	idx, err := newIndex(f, c)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	_, err = idx.Find(0)
+	require.Equal(t, io.EOF, err)
+	_, _, err = idx.Read(-2)
+	require.Equal(t, io.EOF, err)
+
+	// A gap puts offsets 3 and 4 in entries 2 and 3, which Find has to
+	// search for.
+	for _, off := range []uint32{0, 1, 3, 4} {
+		require.NoError(t, idx.Write(int32(off), uint64(off)*10))
+	}
+	for _, off := range []uint32{0, 1, 3, 4} {
+		pos, err := idx.Find(off)
+		require.NoError(t, err)
+		require.Equal(t, uint64(off)*10, pos)
+	}
+	for _, off := range []uint32{2, 5} {
+		_, err = idx.Find(off)
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestIndexGrow(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "index_grow_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = 3 * initialIndexBytes
+	c.Segment.IndexMmap = IndexMmapGrow
+
+	idx, err := newIndex(f, c)
+	require.NoError(t, err)
+	require.Equal(t, initialIndexBytes, len(idx.mmap))
+
+	// Filling the index doubles the mapping until it reaches the max.
+	n := c.Segment.MaxIndexBytes / entWidth
+	for off := uint64(0); off < n; off++ {
+		require.NoError(t, idx.Write(int32(off), off*10))
+	}
+	require.Equal(t, int(c.Segment.MaxIndexBytes), len(idx.mmap))
+	require.Equal(t, io.EOF, idx.Write(int32(n), n*10))
+
+	pos, err := idx.Find(uint32(n - 1))
+	require.NoError(t, err)
+	require.Equal(t, (n-1)*10, pos)
+	require.NoError(t, idx.Close())
+
+	// A reopened index maps enough to hold its entries.
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0600)
+	require.NoError(t, err)
+	idx, err = newIndex(f, c)
+	require.NoError(t, err)
+	defer idx.Close()
+	off, _, err := idx.Read(-1)
+	require.NoError(t, err)
+	require.Equal(t, int32(n-1), off)
+}
@@ -0,0 +1,187 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+)
+
+const (
+	// journalName is the file in the log's directory holding its journal.
+	journalName = "segments.journal"
+	// maxJournalBytes is how large the journal grows before it's emptied,
+	// between operations.
+	maxJournalBytes = 64 << 10
+)
+
+// journal is a write-ahead journal of the log's segment lifecycle
+// operations: sealing the active segment and creating the next, removing
+// segments for retention or Raft, truncating them, replacing them and
+// installing fetched ones. Each operation is written to the journal and
+// synced before it touches any segment files, and marked done after, so
+// when the log opens after a crash midway through one, it rolls the
+// operation forward to the files it was headed for rather than leave
+// orphaned or half-removed ones.
+// An operation whose entry didn't reach the disk hadn't started, so it's
+// rolled back by ignoring it. Operations must be idempotent, since one
+// that finished may not have been marked done.
+type journal struct {
+	file *os.File
+	seq  uint64
+	size int64
+}
+
+// segmentOp is an entry in the journal: a segment lifecycle operation,
+// which removes segments, moves fetched ones in from a staging directory,
+// creates one and truncates one, in that order, or marks the operation
+// with the same sequence number done.
+type segmentOp struct {
+	Seq  uint64 `json:"seq"`
+	Done bool   `json:"done,omitempty"`
+	// Op names the operation, for operators reading the journal.
+	Op       string             `json:"op,omitempty"`
+	Remove   []uint64           `json:"remove,omitempty"`
+	Staging  string             `json:"staging,omitempty"`
+	Staged   []uint64           `json:"staged,omitempty"`
+	Create   *uint64            `json:"create,omitempty"`
+	Truncate *segmentTruncation `json:"truncate,omitempty"`
+}
+
+// segmentTruncation drops the records from Offset on from the segment
+// starting at Base.
+type segmentTruncation struct {
+	Base   uint64 `json:"base"`
+	Offset uint64 `json:"offset"`
+}
+
+// openJournal opens the journal in dir, creating both if need be, and
+// returns the operation a crash interrupted, if one did. Operations run one
+// at a time, and each one's entry is synced after the last one's done
+// mark, so only the last operation can be interrupted.
+func openJournal(dir string) (*journal, *segmentOp, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(
+		path.Join(dir, journalName),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending *segmentOp
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		op := &segmentOp{}
+		if err := json.Unmarshal(scanner.Bytes(), op); err != nil {
+			// A torn write, of the last entry.
+			break
+		}
+		switch {
+		case !op.Done:
+			pending = op
+		case pending != nil && pending.Seq == op.Seq:
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	j := &journal{file: f, size: info.Size()}
+	if pending != nil {
+		j.seq = pending.Seq
+	}
+	return j, pending, nil
+}
+
+// begin writes op to the journal, and syncs it, before the caller changes
+// any segment files.
+func (j *journal) begin(op *segmentOp) error {
+	j.seq++
+	op.Seq = j.seq
+	if err := j.write(op); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// done marks op done, emptying the journal instead if it's grown large.
+// The mark isn't synced: the next operation's entry syncs it, and until
+// then, rolling op forward again is harmless.
+func (j *journal) done(op *segmentOp) error {
+	if j.size >= maxJournalBytes {
+		return j.reset()
+	}
+	return j.write(&segmentOp{Seq: op.Seq, Done: true})
+}
+
+func (j *journal) write(op *segmentOp) error {
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	n, err := j.file.Write(append(b, '\n'))
+	j.size += int64(n)
+	return err
+}
+
+// reset empties the journal, once no operation is in progress.
+func (j *journal) reset() error {
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	j.size = 0
+	return j.file.Sync()
+}
+
+func (j *journal) Close() error {
+	return j.file.Close()
+}
+
+// rollForward applies op's changes to the files in dir, before the log
+// opens its segments, leaving any truncation to be applied to the opened
+// segment.
+func rollForward(dir string, op *segmentOp) error {
+	for _, base := range op.Remove {
+		for _, ext := range []string{".index", ".store"} {
+			if err := os.Remove(segmentPath(dir, base, ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	for _, base := range op.Staged {
+		for _, ext := range []string{".store", ".index"} {
+			err := os.Rename(segmentPath(op.Staging, base, ext), segmentPath(dir, base, ext))
+			// Files already moved aren't staged anymore.
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if op.Staging != "" {
+		if err := os.RemoveAll(op.Staging); err != nil {
+			return err
+		}
+	}
+	if op.Create != nil {
+		for _, ext := range []string{".store", ".index"} {
+			f, err := os.OpenFile(segmentPath(dir, *op.Create, ext), os.O_RDWR|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
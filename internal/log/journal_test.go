@@ -0,0 +1,106 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, dir string, log *Log){
+		"interrupted removal is rolled forward":         testJournalRemove,
+		"interrupted tail truncation is rolled forward": testJournalTruncateTail,
+		"torn entries are ignored":                      testJournalTorn,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir := t.TempDir()
+			// Segments hold two records each: 0-1, 2-3 and 4.
+			c := Config{}
+			c.Segment.MaxStoreBytes = 32
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			for i := 0; i < 5; i++ {
+				_, err := log.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+			fn(t, dir, log)
+		})
+	}
+}
+
+// crash closes log and leaves entries in its journal, as if it had crashed
+// after writing them.
+func crash(t *testing.T, dir string, log *Log, entries ...string) {
+	t.Helper()
+	require.NoError(t, log.Close())
+	f, err := os.OpenFile(path.Join(dir, journalName), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		_, err := f.WriteString(entry)
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+}
+
+func testJournalRemove(t *testing.T, dir string, log *Log) {
+	// Retention began removing the first two segments and got as far as
+	// the first's index.
+	crash(t, dir, log, `{"seq":1,"op":"truncate","remove":[0,2]}`+"\n")
+	require.NoError(t, os.Remove(segmentPath(dir, 0, ".index")))
+
+	log, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lowest)
+	for _, base := range []uint64{0, 2} {
+		for _, ext := range []string{".store", ".index"} {
+			_, err := os.Stat(segmentPath(dir, base, ext))
+			require.True(t, os.IsNotExist(err))
+		}
+	}
+
+	// Recovery empties the journal.
+	info, err := os.Stat(path.Join(dir, journalName))
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+}
+
+func testJournalTruncateTail(t *testing.T, dir string, log *Log) {
+	// Raft began dropping the records from offset 3 on.
+	crash(t, dir, log, `{"seq":1,"op":"truncate-tail","remove":[4],"truncate":{"base":2,"offset":3}}`+"\n")
+
+	log, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), highest)
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func testJournalTorn(t *testing.T, dir string, log *Log) {
+	// A finished operation, then one whose entry was torn, so it never
+	// started.
+	crash(t, dir, log,
+		`{"seq":1,"op":"truncate","remove":[0]}`+"\n",
+		`{"seq":1,"done":true}`+"\n",
+		`{"seq":2,"op":"trunc`,
+	)
+
+	log, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lowest)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), highest)
+}
@@ -1,7 +1,7 @@
 package log
 
 import (
-	"io"
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
@@ -9,10 +9,14 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	api "github.com/Tarunshrma/prolog/log/api/v1"
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
 )
 
+var _ backend.CommitLog = (*Log)(nil)
+
 type Log struct {
 	//Why are we using the RWMutex here?
 	//We are using RWMutex here because we want to allow multiple readers to read the log concurrently, but only one writer to write to the log at a time.
@@ -22,15 +26,21 @@ type Log struct {
 	Config        Config
 	activeSegment *segment
 	segments      []*segment
+	journal       *journal
+	// stopScrub stops the scrubber, and stopRetention the retention
+	// janitor, if they're running.
+	stopScrub     context.CancelFunc
+	stopRetention context.CancelFunc
+	// pausedUntil is when the maintenance pause holding retention back
+	// ends, if it's paused; see pauseMaintenance.
+	pausedUntil time.Time
+	// retention is retention's progress, for RetentionStatus.
+	retention retentionStats
 }
 
 func NewLog(dir string, c Config) (*Log, error) {
-	if c.Segment.MaxStoreBytes == 0 {
-		c.Segment.MaxStoreBytes = 1024
-	}
-
-	if c.Segment.MaxIndexBytes == 0 {
-		c.Segment.MaxIndexBytes = 1024
+	if err := c.setDefaults(); err != nil {
+		return nil, err
 	}
 
 	l := &Log{
@@ -42,6 +52,26 @@ func NewLog(dir string, c Config) (*Log, error) {
 }
 
 func (l *Log) setup() error {
+	// Opening the log, rather than reopening it after an install, finishes
+	// the segment operation a crash interrupted, if one did.
+	var pending *segmentOp
+	opening := l.journal == nil
+	if opening {
+		j, op, err := openJournal(l.Dir)
+		if err != nil {
+			return err
+		}
+		l.journal, pending = j, op
+		if pending != nil {
+			if err := rollForward(l.Dir, pending); err != nil {
+				return err
+			}
+		}
+		if err := l.cleanOrphans(); err != nil {
+			return err
+		}
+	}
+
 	files, err := ioutil.ReadDir(l.Dir)
 
 	if err != nil {
@@ -49,10 +79,18 @@ func (l *Log) setup() error {
 	}
 
 	var baseOffsets []uint64
+	seen := make(map[uint64]bool)
 
 	for _, file := range files {
-		offStr := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		off, _ := strconv.ParseUint(offStr, 10, 0)
+		ext := path.Ext(file.Name())
+		if ext != ".store" && ext != ".index" {
+			continue
+		}
+		off, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ext), 10, 64)
+		if err != nil || seen[off] {
+			continue
+		}
+		seen[off] = true
 		baseOffsets = append(baseOffsets, off)
 	}
 
@@ -60,11 +98,10 @@ func (l *Log) setup() error {
 		return baseOffsets[i] < baseOffsets[j]
 	})
 
-	for i := 0; i < len(baseOffsets); i++ {
-		if err := l.newSegment(baseOffsets[i]); err != nil {
+	for _, off := range baseOffsets {
+		if err := l.newSegment(off); err != nil {
 			return err
 		}
-		i++
 	}
 
 	if l.segments == nil {
@@ -73,6 +110,28 @@ func (l *Log) setup() error {
 		}
 	}
 
+	if pending != nil {
+		if t := pending.Truncate; t != nil {
+			for _, s := range l.segments {
+				if s.baseOffset == t.Base && s.nextOffset > t.Offset {
+					if err := s.truncate(t.Offset); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if err := l.journal.reset(); err != nil {
+			return err
+		}
+	}
+
+	if err := l.checkOffsets(); err != nil {
+		return err
+	}
+	if opening {
+		l.startScrub()
+		l.startRetention()
+	}
 	return nil
 }
 
@@ -92,35 +151,300 @@ func (l *Log) Append(record *api.Record) (uint64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	return l.append(record)
+}
+
+// AppendBatch appends records in order, taking the log's lock once, and
+// syncs them to disk once rather than after each, so they're durable when
+// it returns. It returns the offset of the first record.
+func (l *Log) AppendBatch(records []*api.Record) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var first uint64
+	written := []*segment{l.activeSegment}
+	for i, record := range records {
+		active := l.activeSegment
+		off, err := l.append(record)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 {
+			first = off
+		}
+		if l.activeSegment != active {
+			written = append(written, l.activeSegment)
+		}
+	}
+	for _, s := range written {
+		if err := s.sync(); err != nil {
+			return 0, err
+		}
+	}
+	return first, nil
+}
+
+// append appends record to the active segment, rolling over to a new one
+// once it's full. l.mu must be held.
+func (l *Log) append(record *api.Record) (uint64, error) {
+	if err := l.checkAppend(); err != nil {
+		return 0, err
+	}
 	off, err := l.activeSegment.Append(record)
 	if err != nil {
 		return 0, err
 	}
 	if l.activeSegment.IsMaxed() {
-		err = l.newSegment(off + 1)
+		err = l.roll(off + 1)
 	}
 
 	return off, err
 }
 
+// roll seals the active segment, syncing it, and starts a new one at off.
+// l.mu must be held.
+func (l *Log) roll(off uint64) error {
+	op := &segmentOp{Op: "seal", Create: &off}
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+	if err := l.activeSegment.sync(); err != nil {
+		return err
+	}
+	if err := l.newSegment(off); err != nil {
+		return err
+	}
+	return l.journal.done(op)
+}
+
 func (l *Log) Read(off uint64) (*api.Record, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
-	var s *segment
-	for _, segment := range l.segments {
-		if segment.baseOffset <= off && off < segment.nextOffset {
-			s = segment
-			break
+	s := l.segment(off)
+	if s == nil {
+		return nil, l.outOfRange(off)
+	}
+
+	return s.Read(off)
+}
+
+// Locate returns where the record at off is stored: the base offset of its
+// segment and the position of its first frame in the segment's store.
+func (l *Log) Locate(off uint64) (*api.RecordLocation, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	s := l.segment(off)
+	if s == nil {
+		return nil, l.outOfRange(off)
+	}
+	pos, err := s.Seek(off)
+	if err != nil {
+		return nil, err
+	}
+	return &api.RecordLocation{SegmentBaseOffset: s.baseOffset, Position: pos}, nil
+}
+
+// ReadRange calls fn with each record from offset from up to, but not
+// including, to, stopping early at the end of the log. It seeks the index
+// once per segment and then reads the store sequentially, so it's much
+// cheaper than reading each offset. It doesn't hold the log's lock while
+// calling fn, so slow readers don't block appends, but pins the segments it
+// reads, so truncating them meanwhile doesn't cut it short.
+func (l *Log) ReadRange(from, to uint64, fn func(*api.Record) error) error {
+	spans, err := l.pin(from, to)
+	if err != nil {
+		return err
+	}
+	defer unpin(spans)
+
+	for _, sp := range spans {
+		if err := sp.segment.ReadRange(sp.from, sp.to, fn); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	if s == nil || s.nextOffset <= off {
-		//return nil, fmt.Errorf("offset out of range: %d", off)
-		return nil, api.ErrOffsetOutOfRange{Offset: off}
+// ReadReverse calls fn with each record from offset to-1 down to from,
+// newest first, starting from the end of the log if to is past it, e.g. to
+// show the last records without reading the whole log. It walks the
+// segments backwards, looking each record up in its segment's index, and
+// like ReadRange pins the segments rather than holding the log's lock.
+func (l *Log) ReadReverse(from, to uint64, fn func(*api.Record) error) error {
+	spans, err := l.pin(from, to)
+	if err != nil {
+		return err
 	}
+	defer unpin(spans)
 
-	return s.Read(off)
+	for i := len(spans) - 1; i >= 0; i-- {
+		sp := spans[i]
+		if err := sp.segment.ReadReverse(sp.from, sp.to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// span is the part of a segment a range read covers.
+type span struct {
+	segment  *segment
+	from, to uint64
+}
+
+// pin acquires the segments holding offsets from up to, but not including,
+// to, returning the part of each the range covers, oldest first.
+func (l *Log) pin(from, to uint64) ([]span, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.segment(from) == nil {
+		return nil, l.outOfRange(from)
+	}
+	var spans []span
+	for _, s := range l.segments {
+		start, end := max(from, s.baseOffset), min(to, s.nextOffset)
+		if start < end {
+			s.acquire()
+			spans = append(spans, span{s, start, end})
+		}
+	}
+	return spans, nil
+}
+
+func unpin(spans []span) {
+	for _, sp := range spans {
+		sp.segment.release()
+	}
+}
+
+// segment returns the segment holding off, or nil if no segment does.
+func (l *Log) segment(off uint64) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].nextOffset > off
+	})
+	if i == len(l.segments) || off < l.segments[i].baseOffset {
+		return nil
+	}
+	return l.segments[i]
+}
+
+// outOfRange returns the error for reading off, which no segment holds: an
+// ErrorOffsetTruncated if it's before the lowest offset, or else an
+// ErrorOffsetOutOfRange. The log's lock must be held.
+func (l *Log) outOfRange(off uint64) error {
+	if lowest := l.segments[0].baseOffset; off < lowest {
+		return &api.ErrorOffsetTruncated{Offset: off, Lowest: lowest}
+	}
+	return &api.ErrorOffsetOutOfRange{Offset: off}
+}
+
+// sealed returns the segment starting at base, pinned, if the log has it
+// and it's no longer taking appends. The caller must release it.
+func (l *Log) sealed(base uint64) *segment {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, s := range l.segments[:len(l.segments)-1] {
+		if s.baseOffset == base {
+			s.acquire()
+			return s
+		}
+	}
+	return nil
+}
+
+// sealedRanges returns the offsets each sealed segment holds, the offset
+// the active segment starts at and a reader over its records, which follow
+// them. The reader must be closed.
+func (l *Log) sealedRanges() ([]segmentRange, uint64, *Reader) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var sealed []segmentRange
+	for _, s := range l.segments[:len(l.segments)-1] {
+		sealed = append(sealed, segmentRange{s.baseOffset, s.nextOffset})
+	}
+	return sealed, l.activeSegment.baseOffset, l.newReader(l.segments[len(l.segments)-1:])
+}
+
+// install replaces the log's contents with the sealed segments in want and
+// an empty active segment starting at next. Segments the log already has
+// are kept, and fetch is called to write the rest into a staging directory
+// beside the log's, which is moved into place once every one is fetched.
+func (l *Log) install(want []segmentRange, next uint64, fetch func(dir string, missing []segmentRange) error) error {
+	l.mu.RLock()
+	have := make(map[segmentRange]bool)
+	for _, s := range l.segments {
+		have[segmentRange{s.baseOffset, s.nextOffset}] = true
+	}
+	l.mu.RUnlock()
+
+	var missing []segmentRange
+	for _, seg := range want {
+		if !have[seg] {
+			missing = append(missing, seg)
+		}
+	}
+
+	dir := path.Clean(l.Dir)
+	staging, err := os.MkdirTemp(path.Dir(dir), path.Base(dir)+stagingSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if len(missing) > 0 {
+		if err := fetch(staging, missing); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keep := make(map[segmentRange]bool)
+	for _, seg := range want {
+		keep[seg] = true
+	}
+	op := &segmentOp{Op: "install", Staging: staging, Create: &next}
+	for _, s := range l.segments {
+		if !keep[segmentRange{s.baseOffset, s.nextOffset}] {
+			op.Remove = append(op.Remove, s.baseOffset)
+		}
+	}
+	for _, seg := range missing {
+		op.Staged = append(op.Staged, seg.base)
+	}
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+	for _, s := range l.segments {
+		if keep[segmentRange{s.baseOffset, s.nextOffset}] {
+			if err := s.Close(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	if err := moveStaged(staging, l.Dir, op.Staged); err != nil {
+		return err
+	}
+
+	l.segments, l.activeSegment = nil, nil
+	l.Config.Segment.InitialOffset = next
+	if err := l.setup(); err != nil {
+		return err
+	}
+	if len(want) > 0 {
+		if err := l.newSegment(next); err != nil {
+			return err
+		}
+	}
+	return l.journal.done(op)
 }
 
 func (l *Log) Close() error {
@@ -133,6 +457,19 @@ func (l *Log) Close() error {
 		}
 	}
 
+	if l.stopScrub != nil {
+		l.stopScrub()
+		l.stopScrub = nil
+	}
+	if l.stopRetention != nil {
+		l.stopRetention()
+		l.stopRetention = nil
+	}
+	if l.journal != nil {
+		err := l.journal.Close()
+		l.journal = nil
+		return err
+	}
 	return nil
 }
 
@@ -148,10 +485,31 @@ func (l *Log) Reset() error {
 	if err := l.Remove(); err != nil {
 		return err
 	}
+	// The removed segments are closed; setup starts over with new ones.
+	l.segments, l.activeSegment = nil, nil
 
 	return l.setup()
 }
 
+// reconfigure replaces the log's segment sizes and retention policy with
+// c's, restarting the retention janitor to match. The active segment keeps
+// the sizes it was created with; the next one takes up the new ones.
+func (l *Log) reconfigure(c Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Config.Segment.MaxStoreBytes = c.Segment.MaxStoreBytes
+	l.Config.Segment.MaxIndexBytes = c.Segment.MaxIndexBytes
+	l.Config.Retention.MaxAge = c.Retention.MaxAge
+	l.Config.Retention.MaxBytes = c.Retention.MaxBytes
+	l.Config.Retention.Interval = c.Retention.Interval
+	if l.stopRetention != nil {
+		l.stopRetention()
+		l.stopRetention = nil
+	}
+	l.startRetention()
+}
+
 func (l *Log) LowestOffset() (uint64, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -171,43 +529,117 @@ func (l *Log) HighestOffset() (uint64, error) {
 	return off - 1, nil
 }
 
-func (l *Log) Truncate(lowest uint64) error {
+// TruncateTail removes the records from offset from on, so the next record
+// appended gets offset from; Raft uses it to drop entries that conflict
+// with a new leader's. Readers already reading the removed records may
+// fail.
+func (l *Log) TruncateTail(from uint64) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	op := &segmentOp{Op: "truncate-tail"}
+	for _, s := range l.segments {
+		switch {
+		case s.baseOffset >= from:
+			op.Remove = append(op.Remove, s.baseOffset)
+		case s.nextOffset > from:
+			op.Truncate = &segmentTruncation{Base: s.baseOffset, Offset: from}
+		}
+	}
+	if len(op.Remove) == len(l.segments) {
+		op.Create = &from
+	}
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+
 	var segments []*segment
 	for _, s := range l.segments {
-		if s.nextOffset <= lowest+1 {
+		if s.baseOffset >= from {
 			if err := s.Remove(); err != nil {
 				return err
 			}
 			continue
 		}
+		if s.nextOffset > from {
+			if err := s.truncate(from); err != nil {
+				return err
+			}
+		}
 		segments = append(segments, s)
 	}
 	l.segments = segments
+	if len(segments) == 0 {
+		if err := l.newSegment(from); err != nil {
+			return err
+		}
+		return l.journal.done(op)
+	}
+	l.activeSegment = segments[len(segments)-1]
+	if err := l.journal.done(op); err != nil {
+		return err
+	}
+	if l.activeSegment.IsMaxed() {
+		return l.roll(from)
+	}
 	return nil
 }
 
-func (l *Log) Reader() io.Reader {
+// Clear removes every record, so the next record appended gets offset next.
+func (l *Log) Clear(next uint64) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	readers := make([]io.Reader, len(l.segments))
-	for i, segment := range l.segments {
-		readers[i] = &originReader{segment.store, 0}
+	op := &segmentOp{Op: "clear", Create: &next}
+	for _, s := range l.segments {
+		op.Remove = append(op.Remove, s.baseOffset)
 	}
-	return io.MultiReader(readers...)
-
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+	for _, s := range l.segments {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = nil
+	if err := l.newSegment(next); err != nil {
+		return err
+	}
+	return l.journal.done(op)
 }
 
-type originReader struct {
-	*store
-	off int64
-}
+// Truncate removes the segments holding only records up to lowest. Reads
+// that have already started on them, through ReadRange, a Reader or a
+// segment transfer, finish on the removed files; later reads see the
+// truncated log.
+func (l *Log) Truncate(lowest uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-func (or *originReader) Read(p []byte) (n int, err error) {
-	n, err = or.ReadAt(p, or.off)
-	or.off += int64(n)
-	return
+	op := &segmentOp{Op: "truncate"}
+	for _, s := range l.segments {
+		if s.nextOffset <= lowest+1 {
+			op.Remove = append(op.Remove, s.baseOffset)
+		}
+	}
+	if len(op.Remove) == 0 {
+		return nil
+	}
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+
+	var segments []*segment
+	for _, s := range l.segments {
+		if s.nextOffset <= lowest+1 {
+			if err := s.Remove(); err != nil {
+				return err
+			}
+			continue
+		}
+		segments = append(segments, s)
+	}
+	l.segments = segments
+	return l.journal.done(op)
 }
@@ -1,12 +1,17 @@
 package log
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
 
-	api "github.com/Tarunshrma/prolog/log/api/v1"
-	"github.com/test-go/testify/require"
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -17,6 +22,11 @@ func TestLog(t *testing.T) {
 		"init with existing segments":       testInitExisting,
 		"reader":                            testReader,
 		"truncate":                          testTruncate,
+		"read a range across segments":      testReadRange,
+		"read a range newest first":         testReadReverse,
+		"records larger than a segment":     testLargeRecords,
+		"offset gaps fail opening the log":  testOffsetGap,
+		"append a batch":                    testAppendBatch,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			dir, err := ioutil.TempDir("", "store-test")
@@ -91,22 +101,57 @@ func testInitExisting(t *testing.T, log *Log) {
 }
 
 func testReader(t *testing.T, log *Log) {
-	record := &api.Record{
-		Value: []byte("hello world"),
+	// Two records fill a segment, so the reader crosses segments.
+	for i := 0; i < 4; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("record %d", i))})
+		require.NoError(t, err)
 	}
 
-	off, err := log.Append(record)
+	reader := log.Reader()
+	off, b, err := reader.Next()
 	require.NoError(t, err)
 	require.Equal(t, uint64(0), off)
+	read := &api.Record{}
+	require.NoError(t, proto.Unmarshal(b, read))
+	require.Equal(t, "record 0", string(read.Value))
 
-	reader := log.Reader()
-	b, err := ioutil.ReadAll(reader)
+	// Records appended after the reader was created aren't read.
+	_, err = log.Append(&api.Record{Value: []byte("record 4")})
 	require.NoError(t, err)
+	for want := uint64(1); want < 4; want++ {
+		off, b, err = reader.Next()
+		require.NoError(t, err)
+		require.Equal(t, want, off)
+		require.NoError(t, proto.Unmarshal(b, read))
+		require.Equal(t, fmt.Sprintf("record %d", want), string(read.Value))
+	}
+	_, _, err = reader.Next()
+	require.Equal(t, io.EOF, err)
 
-	read := &api.Record{}
-	err = proto.Unmarshal(b[lenWidth:], read)
+	require.NoError(t, reader.Close())
+
+	// Truncating the segments a reader has pinned removes their files, but
+	// the reader still reads them.
+	reader = log.Reader()
+	defer reader.Close()
+	_, _, err = reader.Next()
 	require.NoError(t, err)
-	require.Equal(t, record.Value, read.Value)
+	require.NoError(t, log.Truncate(2))
+	_, err = os.Stat(segmentPath(log.Dir, 0, ".store"))
+	require.True(t, os.IsNotExist(err))
+	off, _, err = reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+
+	// As an io.Reader it reads records the way snapshots carry them.
+	all := log.Reader()
+	defer all.Close()
+	b, err = ioutil.ReadAll(all)
+	require.NoError(t, err)
+	p, err := readRecord(bytes.NewReader(b), 0)
+	require.NoError(t, err)
+	require.NoError(t, proto.Unmarshal(p, read))
+	require.Equal(t, uint64(2), read.Offset)
 }
 
 func testTruncate(t *testing.T, log *Log) {
@@ -119,14 +164,199 @@ func testTruncate(t *testing.T, log *Log) {
 		require.NoError(t, err)
 	}
 
+	// Truncating removes the segments holding only records up to lowest,
+	// which are the first two here.
 	err := log.Truncate(1)
 	require.NoError(t, err)
 
 	off, err := log.LowestOffset()
 	require.NoError(t, err)
-	require.Equal(t, uint64(1), off)
+	require.Equal(t, uint64(2), off)
 
 	off, err = log.HighestOffset()
 	require.NoError(t, err)
 	require.Equal(t, uint64(2), off)
+
+	// Reading a truncated record tells the reader where to skip to.
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	_, err = log.Read(0)
+	require.Equal(t, &api.ErrorOffsetTruncated{Offset: 0, Lowest: lowest}, err)
+}
+
+func testOffsetGap(t *testing.T, log *Log) {
+	for i := 0; i < 7; i++ {
+		_, err := log.Append(&api.Record{Value: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+	require.True(t, len(log.segments) > 2)
+	missing := log.segments[1].baseOffset
+	require.NoError(t, log.Close())
+
+	// Losing a segment's files leaves a hole the reopened log refuses to
+	// serve.
+	for _, ext := range []string{".store", ".index"} {
+		require.NoError(t, os.Remove(segmentPath(log.Dir, missing, ext)))
+	}
+	c := log.Config
+	c.Metrics = metrics.NewRegistry()
+	_, err := NewLog(log.Dir, c)
+	require.True(t, errors.Is(err, ErrOffsetGap))
+	require.Equal(t, uint64(1), c.Metrics.Counter("log_offset_anomalies").Value())
+}
+
+func testAppendBatch(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("first")})
+	require.NoError(t, err)
+
+	var records []*api.Record
+	for i := 0; i < 5; i++ {
+		records = append(records, &api.Record{Value: []byte{byte(i)}})
+	}
+	first, err := log.AppendBatch(records)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	require.True(t, len(log.segments) > 1)
+
+	for i := range records {
+		record, err := log.Read(first + uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(i)}, record.Value)
+	}
+
+	// The batch was synced, so the store files hold every record.
+	for _, s := range log.segments {
+		fi, err := os.Stat(s.store.Name())
+		require.NoError(t, err)
+		require.Equal(t, int64(s.store.size), fi.Size())
+	}
+}
+
+func testReadRange(t *testing.T, log *Log) {
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&api.Record{Value: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+	// The store's 32 byte limit spreads the records across segments.
+	require.True(t, len(log.segments) > 1)
+
+	read := func(from, to uint64) ([]*api.Record, error) {
+		var records []*api.Record
+		err := log.ReadRange(from, to, func(record *api.Record) error {
+			records = append(records, record)
+			return nil
+		})
+		return records, err
+	}
+
+	records, err := read(1, 4)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	for i, record := range records {
+		require.Equal(t, uint64(i+1), record.Offset)
+		require.Equal(t, []byte{byte(i + 1)}, record.Value)
+	}
+
+	records, err = read(3, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(records))
+
+	_, err = read(5, 10)
+	apiErr := err.(*api.ErrorOffsetOutOfRange)
+	require.Equal(t, uint64(5), apiErr.Offset)
+
+	// Truncating the segments a range is reading doesn't cut it short, but
+	// later ranges see the truncated log.
+	var offsets []uint64
+	err = log.ReadRange(0, 5, func(record *api.Record) error {
+		if record.Offset == 0 {
+			require.NoError(t, log.Truncate(3))
+		}
+		offsets = append(offsets, record.Offset)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1, 2, 3, 4}, offsets)
+	_, err = read(0, 5)
+	require.Equal(t, &api.ErrorOffsetTruncated{Offset: 0, Lowest: 3}, err)
+}
+
+func testReadReverse(t *testing.T, log *Log) {
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&api.Record{Value: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+	require.True(t, len(log.segments) > 1)
+
+	read := func(from, to uint64) ([]uint64, error) {
+		var offsets []uint64
+		err := log.ReadReverse(from, to, func(record *api.Record) error {
+			require.Equal(t, []byte{byte(record.Offset)}, record.Value)
+			offsets = append(offsets, record.Offset)
+			return nil
+		})
+		return offsets, err
+	}
+
+	offsets, err := read(1, 4)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 2, 1}, offsets)
+
+	// Past the end starts from the newest record.
+	offsets, err = read(2, 100)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 3, 2}, offsets)
+
+	require.NoError(t, log.Truncate(3))
+	_, err = read(0, 5)
+	require.Equal(t, &api.ErrorOffsetTruncated{Offset: 0, Lowest: 3}, err)
+}
+
+func TestLogConfigBounds(t *testing.T) {
+	for scenario, fn := range map[string]func(c *Config){
+		"index too small for an entry": func(c *Config) { c.Segment.MaxIndexBytes = entWidth - 1 },
+		"unknown index mmap policy":    func(c *Config) { c.Segment.IndexMmap = 2 },
+		"write buffer too small":       func(c *Config) { c.Store.WriteBufferBytes = minBufferBytes - 1 },
+		"read buffer too large":        func(c *Config) { c.Store.ReadBufferBytes = maxBufferBytes + 1 },
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "log-config-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			fn(&c)
+			_, err = NewLog(dir, c)
+			require.Error(t, err)
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "log-config-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	defer log.Close()
+	require.Equal(t, defaultBufferBytes, log.Config.Store.WriteBufferBytes)
+	require.Equal(t, defaultBufferBytes, log.Config.Store.ReadBufferBytes)
+}
+
+func testLargeRecords(t *testing.T, log *Log) {
+	// The segment holds 32 bytes, and the default frame 1MiB.
+	large := &api.Record{Value: bytes.Repeat([]byte("a"), 3<<20)}
+	off, err := log.Append(large)
+	require.NoError(t, err)
+	_, err = log.Append(&api.Record{Value: []byte("small")})
+	require.NoError(t, err)
+
+	got, err := log.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, large.Value, got.Value)
+
+	var values [][]byte
+	require.NoError(t, log.ReadRange(off, off+2, func(record *api.Record) error {
+		values = append(values, record.Value)
+		return nil
+	}))
+	require.Equal(t, [][]byte{large.Value, []byte("small")}, values)
 }
@@ -0,0 +1,87 @@
+package log
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/hashicorp/raft"
+)
+
+// defaultLogCacheEntries is how many Raft log entries are cached unless
+// configured otherwise.
+const defaultLogCacheEntries = 512
+
+// logCache is an LRU of recent Raft log entries, so Raft's repeated reads of
+// the entries it just stored, e.g. to replicate them to followers, don't
+// each go through the index and store.
+type logCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	// order holds the cached *raft.Log entries, most recently used first.
+	order *list.List
+
+	hits, misses *metrics.Counter
+}
+
+// newLogCache returns a cache of up to capacity entries that counts its
+// hits and misses in m, if it's set.
+func newLogCache(capacity int, m *metrics.Registry) *logCache {
+	c := &logCache{
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element),
+		order:    list.New(),
+		hits:     &metrics.Counter{},
+		misses:   &metrics.Counter{},
+	}
+	if m != nil {
+		c.hits = m.Counter("raft_log_cache_hits")
+		c.misses = m.Counter("raft_log_cache_misses")
+	}
+	return c
+}
+
+// get copies the entry at index into out and reports whether it was
+// cached.
+func (c *logCache) get(index uint64, out *raft.Log) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[index]
+	if !ok {
+		c.misses.Inc()
+		return false
+	}
+	c.hits.Inc()
+	c.order.MoveToFront(e)
+	*out = *e.Value.(*raft.Log)
+	return true
+}
+
+func (c *logCache) add(log *raft.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[log.Index]; ok {
+		e.Value = log
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[log.Index] = c.order.PushFront(log)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*raft.Log).Index)
+	}
+}
+
+// remove drops the entries from min to max inclusive.
+func (c *logCache) remove(min, max uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for index, e := range c.entries {
+		if index >= min && index <= max {
+			c.order.Remove(e)
+			delete(c.entries, index)
+		}
+	}
+}
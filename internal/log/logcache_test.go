@@ -0,0 +1,35 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogCache(t *testing.T) {
+	m := metrics.NewRegistry()
+	c := newLogCache(2, m)
+	for i := uint64(1); i <= 3; i++ {
+		c.add(&raft.Log{Index: i, Term: 1, Data: []byte{byte(i)}})
+	}
+
+	// The least recently used entry was evicted to make room.
+	var out raft.Log
+	require.False(t, c.get(1, &out))
+	require.True(t, c.get(2, &out))
+	require.Equal(t, raft.Log{Index: 2, Term: 1, Data: []byte{2}}, out)
+
+	// Reading 2 made 3 the least recently used.
+	c.add(&raft.Log{Index: 4, Term: 1})
+	require.False(t, c.get(3, &out))
+	require.True(t, c.get(2, &out))
+
+	c.remove(2, 4)
+	require.False(t, c.get(2, &out))
+	require.False(t, c.get(4, &out))
+
+	require.Equal(t, uint64(2), m.Counter("raft_log_cache_hits").Value())
+	require.Equal(t, uint64(4), m.Counter("raft_log_cache_misses").Value())
+}
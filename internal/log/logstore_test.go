@@ -0,0 +1,70 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogStoreDeleteRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-store-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 32
+	c.Segment.InitialOffset = 1
+	// Read the log itself rather than the cache.
+	c.Raft.LogCacheEntries = -1
+	s, err := newLogStore(dir, c)
+	require.NoError(t, err)
+
+	store := func(from, to uint64, data byte) {
+		for i := from; i <= to; i++ {
+			require.NoError(t, s.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte{data}}))
+		}
+	}
+	get := func(index uint64) byte {
+		var out raft.Log
+		require.NoError(t, s.GetLog(index, &out))
+		require.Equal(t, index, out.Index)
+		return out.Data[0]
+	}
+	store(1, 8, 'a')
+	require.True(t, len(s.segments) > 2)
+
+	// Deleting the tail, as a follower does with entries conflicting with
+	// the leader's, lets them be replaced.
+	require.NoError(t, s.DeleteRange(5, 8))
+	last, err := s.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), last)
+	store(5, 6, 'b')
+	require.Equal(t, byte('a'), get(4))
+	require.Equal(t, byte('b'), get(5))
+
+	// Deleting the head, as compaction does, keeps the rest.
+	require.NoError(t, s.DeleteRange(1, 3))
+	require.Equal(t, byte('a'), get(4))
+	require.Equal(t, byte('b'), get(6))
+
+	// Deleting everything, as restoring a snapshot does, resumes after it.
+	require.NoError(t, s.DeleteRange(1, 10))
+	store(11, 11, 'c')
+	require.Equal(t, byte('c'), get(11))
+	lowest, err := s.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), lowest)
+	// Entries compacted away, or not yet stored, are missing the way Raft
+	// expects, so it sends a snapshot instead.
+	var out raft.Log
+	require.Equal(t, raft.ErrLogNotFound, s.GetLog(4, &out))
+	require.Equal(t, raft.ErrLogNotFound, s.GetLog(12, &out))
+
+	// Raft never deletes from the middle.
+	store(12, 14, 'd')
+	require.Error(t, s.DeleteRange(12, 13))
+}
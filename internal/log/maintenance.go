@@ -0,0 +1,229 @@
+package log
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrInvalidPause is returned when asked to pause maintenance without an
+// expiry, which could leave it paused forever.
+var ErrInvalidPause = errors.New("maintenance must be paused for a positive duration")
+
+// PauseMaintenance stops Raft from taking snapshots and retention from
+// removing segments, of the default log and the topics' partitions, on
+// this node for d, e.g. to keep disk I/O down during an incident, and
+// returns when maintenance resumes on its own. Pausing again while paused
+// extends the pause. Raft's log keeps growing while paused, since it's
+// only compacted by snapshots.
+func (l *DistributedLog) PauseMaintenance(d time.Duration) (time.Time, error) {
+	if d <= 0 {
+		return time.Time{}, ErrInvalidPause
+	}
+
+	l.pauseMu.Lock()
+	defer l.pauseMu.Unlock()
+
+	until := l.config.Clock.Now().Add(d)
+	return until, l.pause(until)
+}
+
+// PauseClusterMaintenance pauses maintenance, as PauseMaintenance does,
+// on every node for d, through Raft, so it must be called on the leader.
+// Nodes pause until the leader's clock reads now plus d, so one whose
+// clock is skewed resumes that much earlier or later. Pausing or resuming
+// a node's maintenance on its own afterwards overrides the cluster's
+// pause there.
+func (l *DistributedLog) PauseClusterMaintenance(d time.Duration) (time.Time, error) {
+	if d <= 0 {
+		return time.Time{}, ErrInvalidPause
+	}
+
+	until := time.UnixMilli(l.config.Clock.Now().Add(d).UnixMilli())
+	_, err := l.apply(
+		PauseMaintenanceRequestType,
+		&api.MaintenancePause{PausedUntilUnixMs: until.UnixMilli()},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// ResumeClusterMaintenance ends a pause early on every node, through
+// Raft, so it must be called on the leader.
+func (l *DistributedLog) ResumeClusterMaintenance() error {
+	_, err := l.apply(PauseMaintenanceRequestType, &api.MaintenancePause{})
+	return err
+}
+
+// pause pauses maintenance until until. The caller holds pauseMu.
+func (l *DistributedLog) pause(until time.Time) error {
+	d := until.Sub(l.config.Clock.Now())
+	if l.pauseTimer == nil {
+		rc := l.raft.ReloadableConfig()
+		paused := rc
+		paused.SnapshotThreshold = math.MaxUint64
+		if err := l.raft.ReloadConfig(paused); err != nil {
+			return err
+		}
+		l.unpaused = rc
+		l.pauseTimer = l.config.Clock.AfterFunc(d, l.expirePause)
+	} else {
+		l.pauseTimer.Reset(d)
+	}
+	l.pausedUntil = until
+	l.log.pauseMaintenance(until)
+	l.topics.pauseMaintenance(until)
+	return nil
+}
+
+// pauseUntil applies a cluster pause: it pauses maintenance until until,
+// or resumes it if until is the zero time. Pauses that have already ended,
+// like those replayed after a restart, are ignored.
+func (l *DistributedLog) pauseUntil(until time.Time) error {
+	l.pauseMu.Lock()
+	defer l.pauseMu.Unlock()
+
+	if until.IsZero() {
+		return l.resume()
+	}
+	if !until.After(l.config.Clock.Now()) {
+		return nil
+	}
+	return l.pause(until)
+}
+
+// ResumeMaintenance ends a pause early on this node, whether it paused
+// on its own or with the cluster. It's a no-op if maintenance isn't
+// paused.
+func (l *DistributedLog) ResumeMaintenance() error {
+	l.pauseMu.Lock()
+	defer l.pauseMu.Unlock()
+	return l.resume()
+}
+
+func (l *DistributedLog) expirePause() {
+	l.pauseMu.Lock()
+	defer l.pauseMu.Unlock()
+	// The pause may have been extended while the timer fired.
+	if l.config.Clock.Now().Before(l.pausedUntil) {
+		return
+	}
+	_ = l.resume()
+}
+
+func (l *DistributedLog) resume() error {
+	if l.pauseTimer == nil {
+		return nil
+	}
+	l.pauseTimer.Stop()
+	l.pauseTimer = nil
+	l.pausedUntil = time.Time{}
+	l.log.pauseMaintenance(time.Time{})
+	l.topics.pauseMaintenance(time.Time{})
+	return l.raft.ReloadConfig(l.unpaused)
+}
+
+// MaintenancePausedUntil returns when a pause ends, or the zero time if
+// maintenance isn't paused.
+func (l *DistributedLog) MaintenancePausedUntil() time.Time {
+	l.pauseMu.Lock()
+	defer l.pauseMu.Unlock()
+	return l.pausedUntil
+}
+
+// DescribeMaintenance reports whether maintenance is paused on this node,
+// and retention's progress with each of its logs: the default log, then
+// the partitions of topics that aren't internal, which are exempt from
+// retention.
+func (l *DistributedLog) DescribeMaintenance() (*api.DescribeMaintenanceResponse, error) {
+	res := &api.DescribeMaintenanceResponse{Retention: l.retentionStatus()}
+	if until := l.MaintenancePausedUntil(); !until.IsZero() {
+		res.PausedUntilUnixMs = until.UnixMilli()
+	}
+	return res, nil
+}
+
+// TriggerMaintenance enforces retention on each of this node's logs now,
+// rather than waiting for their janitors, and reports its progress. It
+// fails with an *api.ErrorMaintenancePaused while maintenance is paused.
+func (l *DistributedLog) TriggerMaintenance() (*api.TriggerMaintenanceResponse, error) {
+	if until := l.MaintenancePausedUntil(); !until.IsZero() {
+		return nil, &api.ErrorMaintenancePaused{Until: until}
+	}
+	for _, clog := range l.retainedLogs() {
+		if _, err := clog.EnforceRetention(); err != nil {
+			return nil, err
+		}
+	}
+	return &api.TriggerMaintenanceResponse{Retention: l.retentionStatus()}, nil
+}
+
+func (l *DistributedLog) retentionStatus() []*api.RetentionStatus {
+	var statuses []*api.RetentionStatus
+	for _, clog := range l.retainedLogs() {
+		statuses = append(statuses, clog.RetentionStatus())
+	}
+	return statuses
+}
+
+// retainedLogs returns the logs retention applies to, with their
+// statuses' topic and partition set.
+func (l *DistributedLog) retainedLogs() []*retainedLog {
+	logs := []*retainedLog{{Log: l.log}}
+	l.topics.mu.RLock()
+	defer l.topics.mu.RUnlock()
+	for name, partitions := range l.topics.topics {
+		if strings.HasPrefix(name, api.InternalTopicPrefix) {
+			continue
+		}
+		for i, p := range partitions {
+			logs = append(logs, &retainedLog{Log: p, topic: name, partition: uint32(i)})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].topic != logs[j].topic {
+			return logs[i].topic < logs[j].topic
+		}
+		return logs[i].partition < logs[j].partition
+	})
+	return logs
+}
+
+// retainedLog is a log retention applies to, and the topic and partition
+// it is, if any.
+type retainedLog struct {
+	*Log
+	topic     string
+	partition uint32
+}
+
+func (r *retainedLog) RetentionStatus() *api.RetentionStatus {
+	status := r.Log.RetentionStatus()
+	status.Topic, status.Partition = r.topic, r.partition
+	return status
+}
+
+// applyPauseMaintenance applies a cluster maintenance pause to the node.
+func (l *fsm) applyPauseMaintenance(b []byte) interface{} {
+	var req api.MaintenancePause
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	var until time.Time
+	if req.PausedUntilUnixMs != 0 {
+		until = time.UnixMilli(req.PausedUntilUnixMs)
+	}
+	if l.pause != nil {
+		if err := l.pause(until); err != nil {
+			return err
+		}
+	}
+	return &req
+}
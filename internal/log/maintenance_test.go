@@ -0,0 +1,172 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"github.com/travisjeffery/go-dynaport"
+)
+
+// setupMaintenanceLog starts a single node distributed log, the leader of
+// its cluster, with config.
+func setupMaintenanceLog(t *testing.T, config Config) *DistributedLog {
+	t.Helper()
+	dataDir, err := ioutil.TempDir("", "maintenance-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dataDir) })
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", dynaport.Get(1)[0]))
+	require.NoError(t, err)
+
+	config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+	config.Raft.LocalID = raft.ServerID("0")
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.Raft.CommitTimeout = 5 * time.Millisecond
+	config.Raft.Bootstrap = true
+
+	l, err := NewDistributedLog(dataDir, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	require.NoError(t, l.WaitForLeader(3*time.Second))
+	return l
+}
+
+func TestPauseMaintenance(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := setupMaintenanceLog(t, Config{Clock: clk})
+
+	threshold := l.raft.ReloadableConfig().SnapshotThreshold
+
+	_, err := l.PauseMaintenance(0)
+	require.Equal(t, ErrInvalidPause, err)
+
+	until, err := l.PauseMaintenance(time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, until, l.MaintenancePausedUntil())
+	require.Equal(t, uint64(math.MaxUint64), l.raft.ReloadableConfig().SnapshotThreshold)
+
+	require.NoError(t, l.ResumeMaintenance())
+	require.True(t, l.MaintenancePausedUntil().IsZero())
+	require.Equal(t, threshold, l.raft.ReloadableConfig().SnapshotThreshold)
+
+	// Pauses expire on their own, and pausing again extends them.
+	_, err = l.PauseMaintenance(time.Hour)
+	require.NoError(t, err)
+	clk.Advance(30 * time.Minute)
+	until, err = l.PauseMaintenance(time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, clk.Now().Add(time.Hour), until)
+	clk.Advance(30 * time.Minute)
+	require.Equal(t, uint64(math.MaxUint64), l.raft.ReloadableConfig().SnapshotThreshold)
+
+	clk.Advance(30 * time.Minute)
+	require.Equal(t, threshold, l.raft.ReloadableConfig().SnapshotThreshold)
+	require.True(t, l.MaintenancePausedUntil().IsZero())
+}
+
+func TestPauseMaintenanceHoldsRetention(t *testing.T) {
+	config := Config{Clock: clock.NewFake(time.Now())}
+	// Each record fills a segment, and retention keeps just the newest.
+	config.Segment.MaxStoreBytes = 8
+	config.Retention.MaxBytes = 1
+	l := setupMaintenanceLog(t, config)
+	require.NoError(t, l.CreateTopic("orders", 1))
+	orders, err := l.topics.partition("orders", 0)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := l.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		_, err = orders.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	lowest, err := l.LowestOffset()
+	require.NoError(t, err)
+
+	// The pause holds back the topics' partitions too, including those
+	// created while paused.
+	_, err = l.PauseMaintenance(time.Hour)
+	require.NoError(t, err)
+	deletions, err := l.log.EnforceRetention()
+	require.NoError(t, err)
+	require.Empty(t, deletions)
+	deletions, err = orders.EnforceRetention()
+	require.NoError(t, err)
+	require.Empty(t, deletions)
+	require.NoError(t, l.CreateTopic("audit", 1))
+	audit, err := l.topics.partition("audit", 0)
+	require.NoError(t, err)
+	require.Equal(t, l.MaintenancePausedUntil(), audit.pausedUntil)
+	off, err := l.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, lowest, off)
+
+	require.NoError(t, l.ResumeMaintenance())
+	deletions, err = l.log.EnforceRetention()
+	require.NoError(t, err)
+	require.NotEmpty(t, deletions)
+	deletions, err = orders.EnforceRetention()
+	require.NoError(t, err)
+	require.NotEmpty(t, deletions)
+	off, err = l.LowestOffset()
+	require.NoError(t, err)
+	require.Greater(t, off, lowest)
+}
+
+func TestTriggerMaintenance(t *testing.T) {
+	config := Config{Clock: clock.NewFake(time.Now())}
+	// Each record fills a segment, and retention keeps just the newest.
+	config.Segment.MaxStoreBytes = 8
+	config.Retention.MaxBytes = 1
+	l := setupMaintenanceLog(t, config)
+	require.NoError(t, l.CreateTopic("orders", 1))
+	orders, err := l.Partition("orders", 0)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := l.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		_, err = orders.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	// The default log comes first, then the topics that aren't internal.
+	res, err := l.DescribeMaintenance()
+	require.NoError(t, err)
+	require.Zero(t, res.PausedUntilUnixMs)
+	require.Len(t, res.Retention, 2)
+	require.Equal(t, "", res.Retention[0].Topic)
+	require.Equal(t, "orders", res.Retention[1].Topic)
+	for _, status := range res.Retention {
+		require.NotZero(t, status.SegmentsPending)
+		require.Zero(t, status.LastRunUnixMs)
+	}
+
+	until, err := l.PauseMaintenance(time.Hour)
+	require.NoError(t, err)
+	res, err = l.DescribeMaintenance()
+	require.NoError(t, err)
+	require.Equal(t, until.UnixMilli(), res.PausedUntilUnixMs)
+	_, err = l.TriggerMaintenance()
+	require.Equal(t, &api.ErrorMaintenancePaused{Until: until}, err)
+
+	require.NoError(t, l.ResumeMaintenance())
+	triggered, err := l.TriggerMaintenance()
+	require.NoError(t, err)
+	require.Len(t, triggered.Retention, 2)
+	for _, status := range triggered.Retention {
+		require.Zero(t, status.SegmentsPending)
+		require.NotZero(t, status.SegmentsRemoved)
+		require.NotZero(t, status.BytesReclaimed)
+		require.Equal(t, config.Clock.Now().UnixMilli(), status.LastRunUnixMs)
+	}
+}
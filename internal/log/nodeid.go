@@ -0,0 +1,64 @@
+package log
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// nodeIDFile is the file in the data directory a node's ID is kept in. A
+// log stored in the data directory itself leaves it alone.
+const nodeIDFile = "node-id"
+
+// NodeID returns the ID of the node whose data directory is dataDir,
+// generating a random UUID and persisting it there on the node's first
+// start. Unlike the node's name, which may be a hostname that containers
+// repeat, the ID is unique to the node and stays with its data.
+func NodeID(dataDir string) (string, error) {
+	name := path.Join(dataDir, nodeIDFile)
+	b, err := os.ReadFile(name)
+	if err == nil {
+		id := strings.TrimSpace(string(b))
+		if id == "" {
+			return "", fmt.Errorf("node ID file %s is empty", name)
+		}
+		return id, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return "", err
+	}
+	// Write the ID aside and rename it into place, so a crash never
+	// leaves a partial ID behind.
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := syncFile(tmp); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", err
+	}
+	return id, syncFile(dataDir)
+}
+
+// newUUID returns a random, version 4, UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
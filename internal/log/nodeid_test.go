@@ -0,0 +1,27 @@
+package log
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeID(t *testing.T) {
+	dir := t.TempDir()
+	id, err := NodeID(dir)
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+
+	// The ID is kept across restarts, even with a log in the data
+	// directory, and other nodes get their own.
+	l, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	again, err := NodeID(dir)
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+	other, err := NodeID(t.TempDir())
+	require.NoError(t, err)
+	require.NotEqual(t, id, other)
+}
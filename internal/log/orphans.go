@@ -0,0 +1,106 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// orphanedDir is the directory in the log's directory that orphaned
+	// files are quarantined in.
+	orphanedDir = "orphaned"
+	// stagingSuffix follows the name of the log's directory in the names
+	// of the staging directories installs fetch segments into, beside it.
+	stagingSuffix = ".fetch-"
+)
+
+// orphans returns the files in the log's directory that neither a segment
+// nor the journal accounts for, like half of a half-removed segment, and
+// the staging directories interrupted installs left beside it.
+func (l *Log) orphans() ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	halves := make(map[uint64][]string)
+	for _, e := range entries {
+		name := e.Name()
+		if name == journalName || name == orphanedDir || name == topicsDir || name == nodeIDFile {
+			continue
+		}
+		ext := path.Ext(name)
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if e.IsDir() || err != nil || (ext != ".store" && ext != ".index") {
+			orphans = append(orphans, path.Join(l.Dir, name))
+			continue
+		}
+		halves[base] = append(halves[base], path.Join(l.Dir, name))
+	}
+	// A segment is its store and index.
+	for _, files := range halves {
+		if len(files) == 1 {
+			orphans = append(orphans, files[0])
+		}
+	}
+
+	dir := path.Clean(l.Dir)
+	entries, err = os.ReadDir(path.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), path.Base(dir)+stagingSuffix) {
+			orphans = append(orphans, path.Join(path.Dir(dir), e.Name()))
+		}
+	}
+	return orphans, nil
+}
+
+// cleanOrphans quarantines or removes the log's orphaned files, per its
+// OrphanPolicy, logging and counting each one.
+func (l *Log) cleanOrphans() error {
+	orphans, err := l.orphans()
+	if err != nil {
+		return err
+	}
+	for _, orphan := range orphans {
+		switch l.Config.Orphans {
+		case OrphansRemove:
+			err = os.RemoveAll(orphan)
+		default:
+			err = l.quarantine(orphan)
+		}
+		if err != nil {
+			return err
+		}
+		if l.Config.Metrics != nil {
+			l.Config.Metrics.Counter("log_orphaned_files").Inc()
+		}
+		zap.L().Named("log").Warn(
+			"orphaned file",
+			zap.String("path", orphan),
+			zap.String("policy", string(l.Config.Orphans)),
+		)
+	}
+	return nil
+}
+
+// quarantine moves orphan into the orphaned directory, keeping any orphan
+// of the same name quarantined before.
+func (l *Log) quarantine(orphan string) error {
+	dir := path.Join(l.Dir, orphanedDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dst := path.Join(dir, path.Base(orphan))
+	if _, err := os.Stat(dst); err == nil {
+		dst = fmt.Sprintf("%s.%d", dst, l.Config.Clock.Now().UnixNano())
+	}
+	return os.Rename(orphan, dst)
+}
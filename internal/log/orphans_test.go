@@ -0,0 +1,58 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrphans(t *testing.T) {
+	for policy, quarantined := range map[OrphanPolicy]int{
+		OrphansQuarantine: 3,
+		OrphansRemove:     0,
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			parent := t.TempDir()
+			dir := path.Join(parent, "log")
+			c := Config{Orphans: policy, Metrics: metrics.NewRegistry()}
+			c.Segment.MaxStoreBytes = 32
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			for i := 0; i < 5; i++ {
+				_, err := log.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+			require.NoError(t, log.Close())
+
+			// Half of a removed segment, a compaction's output and an
+			// interrupted install's staging directory.
+			orphans := []string{
+				segmentPath(dir, 100, ".store"),
+				path.Join(dir, "compact.tmp"),
+				path.Join(parent, "log"+stagingSuffix+"1"),
+			}
+			require.NoError(t, os.WriteFile(orphans[0], nil, 0644))
+			require.NoError(t, os.WriteFile(orphans[1], nil, 0644))
+			require.NoError(t, os.Mkdir(orphans[2], 0755))
+
+			log, err = NewLog(dir, log.Config)
+			require.NoError(t, err)
+			defer log.Close()
+			for _, orphan := range orphans {
+				_, err := os.Stat(orphan)
+				require.True(t, os.IsNotExist(err))
+			}
+			entries, _ := os.ReadDir(path.Join(dir, orphanedDir))
+			require.Equal(t, quarantined, len(entries))
+			require.Equal(t, uint64(3), c.Metrics.Counter("log_orphaned_files").Value())
+
+			highest, err := log.HighestOffset()
+			require.NoError(t, err)
+			require.Equal(t, uint64(4), highest)
+		})
+	}
+}
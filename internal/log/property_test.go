@@ -0,0 +1,185 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// FuzzLog runs sequences of appends, reads, truncations and restarts decoded
+// from its input against a log and checks the log's invariants after each
+// step: offsets are dense, reads return what was appended and restarts keep
+// every record. Plain go test runs the seeds; go test -fuzz=FuzzLog searches
+// for new failing sequences.
+func FuzzLog(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 10, 1, 1, 200, 3, 4, 2, 0, 4, 0, 8, 2})
+	for seed := int64(0); seed < 32; seed++ {
+		ops := make([]byte, 256)
+		rand.New(rand.NewSource(seed)).Read(ops)
+		f.Add(ops)
+	}
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		newLogModel(t, &opReader{b: ops}).run()
+	})
+}
+
+// opReader decodes a sequence of operations from bytes, returning zeros once
+// they run out.
+type opReader struct {
+	b []byte
+}
+
+func (r *opReader) done() bool {
+	return len(r.b) == 0
+}
+
+func (r *opReader) next() byte {
+	if r.done() {
+		return 0
+	}
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b
+}
+
+// logModel is what a log should hold: the values of the records from offset
+// lowest on.
+type logModel struct {
+	t      *testing.T
+	ops    *opReader
+	dir    string
+	config Config
+	log    *Log
+
+	lowest uint64
+	values [][]byte
+}
+
+func newLogModel(t *testing.T, ops *opReader) *logModel {
+	// Small segments, indexes and frames so short sequences roll segments,
+	// fill indexes and split records into frames.
+	shape := ops.next()
+	c := Config{}
+	c.Segment.MaxStoreBytes = 64 + uint64(shape&0x0f)*64
+	c.Segment.MaxIndexBytes = entWidth * uint64(1+shape>>4%8)
+	c.Segment.IndexMmap = IndexMmapPolicy(shape >> 7)
+	c.Store.MaxFrameBytes = minBufferBytes
+
+	m := &logModel{t: t, ops: ops, dir: t.TempDir(), config: c}
+	m.open()
+	t.Cleanup(func() { m.log.Close() })
+	return m
+}
+
+func (m *logModel) open() {
+	var err error
+	m.log, err = NewLog(m.dir, m.config)
+	require.NoError(m.t, err)
+}
+
+func (m *logModel) next() uint64 {
+	return m.lowest + uint64(len(m.values))
+}
+
+func (m *logModel) run() {
+	for !m.ops.done() {
+		switch m.ops.next() % 5 {
+		case 0, 1:
+			m.append()
+		case 2:
+			m.read()
+		case 3:
+			m.truncate()
+		case 4:
+			m.restart()
+		}
+		m.check()
+	}
+}
+
+func (m *logModel) append() {
+	// Values span from empty to a few frames long, and start with their
+	// offset so misplaced records can't pass for each other.
+	n := int(m.ops.next()) * int(m.ops.next()%8)
+	value := append(
+		[]byte(fmt.Sprintf("%d:", m.next())),
+		bytes.Repeat([]byte{m.ops.next()}, n)...,
+	)
+
+	off, err := m.log.Append(&api.Record{Value: value})
+	require.NoError(m.t, err)
+	require.Equal(m.t, m.next(), off)
+	m.values = append(m.values, value)
+}
+
+func (m *logModel) read() {
+	// Include offsets before and past the records the log holds.
+	off := uint64(m.ops.next()) % (m.next() + 2)
+	record, err := m.log.Read(off)
+	if off < m.lowest {
+		require.Nil(m.t, record)
+		require.Equal(m.t, &api.ErrorOffsetTruncated{Offset: off, Lowest: m.lowest}, err)
+		return
+	}
+	if off >= m.next() {
+		require.Nil(m.t, record)
+		require.IsType(m.t, &api.ErrorOffsetOutOfRange{}, err)
+		return
+	}
+	require.NoError(m.t, err)
+	require.Equal(m.t, off, record.Offset)
+	require.Equal(m.t, m.values[off-m.lowest], record.Value)
+}
+
+// truncate drops records up to an offset before the last one, so the
+// active segment always survives.
+func (m *logModel) truncate() {
+	if len(m.values) < 2 {
+		return
+	}
+	upTo := m.lowest + uint64(m.ops.next())%uint64(len(m.values)-1)
+	require.NoError(m.t, m.log.Truncate(upTo))
+
+	// Truncate removes whole segments, so it may keep records up to upTo.
+	lowest, err := m.log.LowestOffset()
+	require.NoError(m.t, err)
+	require.True(m.t, lowest >= m.lowest && lowest <= upTo+1,
+		"truncating up to %d moved lowest offset from %d to %d", upTo, m.lowest, lowest)
+	m.values = m.values[lowest-m.lowest:]
+	m.lowest = lowest
+}
+
+func (m *logModel) restart() {
+	require.NoError(m.t, m.log.Close())
+	m.open()
+}
+
+// check asserts the whole log matches the model.
+func (m *logModel) check() {
+	lowest, err := m.log.LowestOffset()
+	require.NoError(m.t, err)
+	require.Equal(m.t, m.lowest, lowest)
+
+	if len(m.values) == 0 {
+		return
+	}
+	highest, err := m.log.HighestOffset()
+	require.NoError(m.t, err)
+	require.Equal(m.t, m.next()-1, highest)
+
+	want := m.lowest
+	err = m.log.ReadRange(m.lowest, m.next(), func(record *api.Record) error {
+		require.Equal(m.t, want, record.Offset)
+		require.Equal(m.t, m.values[want-m.lowest], record.Value)
+		want++
+		return nil
+	})
+	require.NoError(m.t, err)
+	require.Equal(m.t, m.next(), want)
+}
@@ -0,0 +1,124 @@
+package log
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader reads a log's records in offset order, across its segments, as of
+// when it was created: appends can continue while it reads, but records
+// appended after it was created aren't read, and it pins the segments it
+// reads so truncating them doesn't cut it short. Close unpins them.
+//
+// As an io.Reader it reads each record as its length and then its bytes,
+// which is how snapshots carry records. A Reader must not be used by more
+// than one goroutine.
+type Reader struct {
+	// segments are the pinned segments and ends the offsets each held when
+	// they were pinned.
+	segments []*segment
+	ends     []uint64
+	// next is the offset of the record Next returns next, and r reads the
+	// records of segments[0] from it on.
+	next uint64
+	r    *bufio.Reader
+
+	// pending is the rest of the record Read is partway through.
+	pending []byte
+}
+
+// Reader returns a Reader over the records the log holds now.
+func (l *Log) Reader() *Reader {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.newReader(l.segments)
+}
+
+// newReader pins segments and returns a Reader over the records they hold
+// now. The log's lock must be held.
+func (l *Log) newReader(segments []*segment) *Reader {
+	r := &Reader{
+		segments: append([]*segment(nil), segments...),
+		next:     segments[0].baseOffset,
+	}
+	for _, s := range r.segments {
+		s.acquire()
+		r.ends = append(r.ends, s.nextOffset)
+	}
+	return r
+}
+
+// Next returns the next record's offset and its encoded bytes, an
+// api.Record in protobuf wire format. It returns io.EOF after the last
+// record.
+func (r *Reader) Next() (uint64, []byte, error) {
+	for len(r.segments) > 0 && r.next >= r.ends[0] {
+		r.r = nil
+		if err := r.segments[0].release(); err != nil {
+			return 0, nil, err
+		}
+		r.segments, r.ends = r.segments[1:], r.ends[1:]
+	}
+	if len(r.segments) == 0 {
+		return 0, nil, io.EOF
+	}
+
+	s := r.segments[0]
+	if r.r == nil {
+		// Records are stored back to back, so they're read sequentially
+		// through a buffer from the first one. The store is read up to its
+		// size now, which holds every record up to the segment's end.
+		pos, err := s.Seek(r.next)
+		if err != nil {
+			return 0, nil, err
+		}
+		if r.r, err = s.store.reader(pos); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	p, err := readRecord(r.r, s.store.maxRecordBytes)
+	if err != nil {
+		r.r = nil
+		return 0, nil, err
+	}
+	off := r.next
+	r.next++
+	return off, p, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		_, b, err := r.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.pending = make([]byte, lenWidth+len(b))
+		enc.PutUint64(r.pending, uint64(len(b)))
+		copy(r.pending[lenWidth:], b)
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// remaining returns how many records the reader has left to read.
+func (r *Reader) remaining() uint64 {
+	if len(r.ends) == 0 {
+		return 0
+	}
+	return r.ends[len(r.ends)-1] - r.next
+}
+
+// Close unpins the segments the reader hasn't finished reading.
+func (r *Reader) Close() error {
+	var err error
+	for _, s := range r.segments {
+		if rerr := s.release(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	r.segments, r.ends = nil, nil
+	return err
+}
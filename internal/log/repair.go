@@ -0,0 +1,71 @@
+package log
+
+import (
+	"fmt"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// Repair rewrites the sealed segment holding c's records with copies of
+// them that fetch gets, e.g. from a replica, along with copies of any other
+// records in the segment that can't be read back intact. The segment is
+// swapped for the rewritten one like Replace swaps segments, journaled as a
+// repair.
+func (l *Log) Repair(c *Corruption, fetch func(from, to uint64) ([]*api.Record, error)) error {
+	var next uint64
+	l.mu.RLock()
+	for _, s := range l.segments[:len(l.segments)-1] {
+		if s.baseOffset == c.Base {
+			next = s.nextOffset
+		}
+	}
+	l.mu.RUnlock()
+	if next == 0 {
+		return fmt.Errorf("no sealed segment starts at offset %d", c.Base)
+	}
+
+	fetched, err := fetchAll(fetch, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	return l.replace("repair", c.Base, next, func(r *Replacement) error {
+		for off := c.Base; off < next; off++ {
+			if off >= c.From && off < c.To {
+				if _, err := r.Append(fetched[off-c.From]); err != nil {
+					return err
+				}
+				continue
+			}
+			record, err := l.Read(off)
+			if err != nil {
+				records, ferr := fetchAll(fetch, off, off+1)
+				if ferr != nil {
+					return fmt.Errorf("record %d: %v, and fetching it: %w", off, err, ferr)
+				}
+				record = records[0]
+			}
+			if _, err := r.Append(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fetchAll fetches the records from offset from up to, but not including,
+// to, checking fetch got every one.
+func fetchAll(fetch func(from, to uint64) ([]*api.Record, error), from, to uint64) ([]*api.Record, error) {
+	records, err := fetch(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(records)) != to-from {
+		return nil, fmt.Errorf("fetched %d of the %d records from offset %d", len(records), to-from, from)
+	}
+	for i, record := range records {
+		if record.Offset != from+uint64(i) {
+			return nil, fmt.Errorf("fetched record %d for %d", record.Offset, from+uint64(i))
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair(t *testing.T) {
+	// Segments hold two records each: 0-1, 2-3 and 4.
+	c := Config{}
+	c.Segment.MaxStoreBytes = 32
+	c.Store.Checksums = true
+	var logs []*Log
+	for i := 0; i < 2; i++ {
+		log, err := NewLog(t.TempDir(), c)
+		require.NoError(t, err)
+		defer log.Close()
+		for i := 0; i < 5; i++ {
+			_, err := log.Append(&api.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+		}
+		logs = append(logs, log)
+	}
+	log, peer := logs[0], logs[1]
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go (&SegmentServer{Log: peer}).Serve(ln)
+	fetch := func(from, to uint64) ([]*api.Record, error) {
+		return fetchRange(context.Background(), nil, ln.Addr().String(), from, to)
+	}
+
+	_, err = fetch(3, 6)
+	require.Error(t, err)
+
+	// Flip a bit of each record of the second segment on disk.
+	for off := uint64(2); off < 4; off++ {
+		loc, err := log.Locate(off)
+		require.NoError(t, err)
+		f, err := os.OpenFile(segmentPath(log.Dir, loc.SegmentBaseOffset, ".store"), os.O_RDWR, 0644)
+		require.NoError(t, err)
+		b := make([]byte, 1)
+		at := int64(loc.Position + lenWidth + 4)
+		_, err = f.ReadAt(b, at)
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte{b[0] ^ 1}, at)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	found, err := log.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(found))
+
+	// Repairing part of the corruption repairs the rest of the segment too.
+	found[0].To--
+	require.NoError(t, log.Repair(found[0], fetch))
+	for off := uint64(0); off < 5; off++ {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+		require.Equal(t, "hello world", string(record.Value))
+	}
+	found, err = log.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// Records the peer doesn't hold can't be repaired.
+	require.True(t, errors.Is(log.Repair(&Corruption{Base: 0, From: 0, To: 1}, func(from, to uint64) ([]*api.Record, error) {
+		return nil, os.ErrNotExist
+	}), os.ErrNotExist))
+}
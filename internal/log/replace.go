@@ -0,0 +1,213 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+)
+
+// ErrReplaced is returned by Replace when the segments it was replacing
+// changed while the replacement was written, e.g. because retention
+// removed them.
+var ErrReplaced = errors.New("segments changed during replacement")
+
+// Replacement stages the segments Replace swaps in for the ones it
+// replaces. They're written in a staging directory beside the log's, and
+// must hold the offsets the replaced segments did, since the log's offsets
+// follow on from each other without gaps.
+type Replacement struct {
+	dir      string
+	config   Config
+	segments []*segment
+	next     uint64
+}
+
+// Append appends record at the replacement's next offset, starting a new
+// segment when the last is full, and returns the offset.
+func (r *Replacement) Append(record *api.Record) (uint64, error) {
+	if n := len(r.segments); n == 0 || r.segments[n-1].IsMaxed() {
+		s, err := newSegment(r.dir, r.next, r.config)
+		if err != nil {
+			return 0, err
+		}
+		r.segments = append(r.segments, s)
+	}
+	off, err := r.segments[len(r.segments)-1].Append(record)
+	if err != nil {
+		return 0, err
+	}
+	r.next = off + 1
+	return off, nil
+}
+
+// seal syncs the replacement's segments, and the staging directory, to
+// disk, and closes them.
+func (r *Replacement) seal() error {
+	for _, s := range r.segments {
+		if err := s.sync(); err != nil {
+			return err
+		}
+		if err := s.Close(); err != nil {
+			return err
+		}
+		// Closing the index trims it to its entries.
+		if err := syncFile(s.index.Name()); err != nil {
+			return err
+		}
+	}
+	return syncFile(r.dir)
+}
+
+// close closes the replacement's segments, if Replace gives up on it.
+func (r *Replacement) close() {
+	for _, s := range r.segments {
+		_ = s.Close()
+	}
+}
+
+// Replace atomically swaps the sealed segments holding offsets from up to,
+// but not including, to for the segments write appends those offsets'
+// records to, for maintenance like compaction that rewrites segments. from
+// and to must be the bounds of sealed segments. write runs without the
+// log's lock, so the log keeps serving reads and appends meanwhile, and the
+// replacement is synced to disk before the swap, which is journaled, so a
+// crash midway through it is rolled forward when the log opens. Readers see
+// either the replaced segments or the replacement, never a mix, and reads
+// that have already started on the replaced segments finish on them.
+func (l *Log) Replace(from, to uint64, write func(r *Replacement) error) error {
+	return l.replace("replace", from, to, write)
+}
+
+// replace replaces segments like Replace, journaling it as name.
+func (l *Log) replace(name string, from, to uint64, write func(r *Replacement) error) error {
+	old, err := l.sealedSpan(from, to)
+	if err != nil {
+		return err
+	}
+
+	dir := path.Clean(l.Dir)
+	staging, err := os.MkdirTemp(path.Dir(dir), path.Base(dir)+stagingSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	r := &Replacement{dir: staging, config: l.Config, next: from}
+	if err := write(r); err != nil {
+		r.close()
+		return err
+	}
+	if r.next != to {
+		r.close()
+		return fmt.Errorf("replacement ends before offset %d, not %d", r.next, to)
+	}
+	if err := r.seal(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, err := l.locate(old)
+	if err != nil {
+		return err
+	}
+	op := &segmentOp{Op: name, Staging: staging}
+	for _, s := range old {
+		op.Remove = append(op.Remove, s.baseOffset)
+	}
+	for _, s := range r.segments {
+		op.Staged = append(op.Staged, s.baseOffset)
+	}
+	if err := l.journal.begin(op); err != nil {
+		return err
+	}
+	for _, s := range old {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	if err := moveStaged(staging, l.Dir, op.Staged); err != nil {
+		return err
+	}
+
+	var replacement []*segment
+	for _, base := range op.Staged {
+		s, err := newSegment(l.Dir, base, l.Config)
+		if err != nil {
+			return err
+		}
+		replacement = append(replacement, s)
+	}
+	segments := append([]*segment{}, l.segments[:i]...)
+	segments = append(segments, replacement...)
+	l.segments = append(segments, l.segments[i+len(old):]...)
+	return l.journal.done(op)
+}
+
+// sealedSpan returns the sealed segments holding offsets from up to, but
+// not including, to, which must be their bounds.
+func (l *Log) sealedSpan(from, to uint64) ([]*segment, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var span []*segment
+	for _, s := range l.segments[:len(l.segments)-1] {
+		if s.baseOffset >= from && s.nextOffset <= to {
+			span = append(span, s)
+		}
+	}
+	if len(span) == 0 || span[0].baseOffset != from || span[len(span)-1].nextOffset != to {
+		return nil, fmt.Errorf("no sealed segments start at offset %d and end before %d", from, to)
+	}
+	return span, nil
+}
+
+// locate returns where segments, which were the log's, are in the log now,
+// or ErrReplaced if they no longer all are. l.mu must be held.
+func (l *Log) locate(segments []*segment) (int, error) {
+	for i, s := range l.segments {
+		if s != segments[0] {
+			continue
+		}
+		// The active segment can't be replaced, since it takes appends.
+		if i+len(segments) >= len(l.segments) {
+			break
+		}
+		for j, want := range segments {
+			if l.segments[i+j] != want {
+				return 0, ErrReplaced
+			}
+		}
+		return i, nil
+	}
+	return 0, ErrReplaced
+}
+
+// moveStaged moves the segments starting at bases from the staging
+// directory into dir, syncing dir so the renames are durable.
+func moveStaged(staging, dir string, bases []uint64) error {
+	for _, base := range bases {
+		for _, ext := range []string{".store", ".index"} {
+			if err := os.Rename(segmentPath(staging, base, ext), segmentPath(dir, base, ext)); err != nil {
+				return err
+			}
+		}
+	}
+	return syncFile(dir)
+}
+
+// syncFile syncs the file or directory at name to disk.
+func syncFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplace(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, log *Log){
+		"replaces sealed segments":            testReplace,
+		"rejects replacements of other spans": testReplaceSpan,
+		"rejects short replacements":          testReplaceShort,
+		"survives a crash midway":             testReplaceCrash,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// Segments hold two records each: 0-1, 2-3 and 4.
+			c := Config{}
+			c.Segment.MaxStoreBytes = 32
+			log, err := NewLog(t.TempDir(), c)
+			require.NoError(t, err)
+			defer log.Close()
+			for i := 0; i < 5; i++ {
+				_, err := log.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+			fn(t, log)
+		})
+	}
+}
+
+// compact rewrites the records of log from offset from up to to, as a
+// compaction would.
+func compact(log *Log, from, to uint64) func(r *Replacement) error {
+	return func(r *Replacement) error {
+		return log.ReadRange(from, to, func(record *api.Record) error {
+			_, err := r.Append(&api.Record{Value: []byte("compacted")})
+			return err
+		})
+	}
+}
+
+func testReplace(t *testing.T, log *Log) {
+	// A reader already reading the replaced segments finishes on them.
+	reader := log.Reader()
+	require.NoError(t, log.Replace(0, 4, compact(log, 0, 4)))
+	_, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	for off := uint64(0); off < 5; off++ {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+		if off < 4 {
+			require.Equal(t, "compacted", string(record.Value))
+		} else {
+			require.Equal(t, "hello world", string(record.Value))
+		}
+	}
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+
+	// The replacement is what the log opens with.
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	record, err := log.Read(2)
+	require.NoError(t, err)
+	require.Equal(t, "compacted", string(record.Value))
+}
+
+func testReplaceSpan(t *testing.T, log *Log) {
+	// Neither part of a segment nor the active segment can be replaced.
+	require.Error(t, log.Replace(1, 4, compact(log, 1, 4)))
+	require.Error(t, log.Replace(2, 5, compact(log, 2, 5)))
+}
+
+func testReplaceShort(t *testing.T, log *Log) {
+	require.Error(t, log.Replace(0, 4, compact(log, 0, 3)))
+	record, err := log.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(record.Value))
+}
+
+func testReplaceCrash(t *testing.T, log *Log) {
+	// The log crashed after journaling a replacement and removing the
+	// first replaced segment.
+	staging := t.TempDir()
+	r := &Replacement{dir: staging, config: log.Config}
+	require.NoError(t, compact(log, 0, 4)(r))
+	require.NoError(t, r.seal())
+	dir := log.Dir
+	crash(t, dir, log, `{"seq":1,"op":"replace","remove":[0,2],"staging":"`+staging+`","staged":[0,2]}`+"\n")
+	require.NoError(t, os.Remove(segmentPath(dir, 0, ".index")))
+	require.NoError(t, os.Remove(segmentPath(dir, 0, ".store")))
+
+	log, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	for off := uint64(0); off < 4; off++ {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, "compacted", string(record.Value))
+	}
+	_, err = os.Stat(staging)
+	require.True(t, os.IsNotExist(err))
+}
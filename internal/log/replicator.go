@@ -2,17 +2,35 @@ package log
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/budget"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
+// ErrReplicationBudget is returned when joining a peer would take the
+// replicator over its budget of goroutines.
+var ErrReplicationBudget = errors.New("replication goroutine budget exhausted")
+
+// replicationGoroutines is how many goroutines replicate each peer: one
+// receiving its records and one producing them locally.
+const replicationGoroutines = 2
+
 type Replicator struct {
 	// Replicate the given log entry to all peers.
 	DialOptions []grpc.DialOption
 	LocalServer api.LogClient
+	// NodeName is the local node's name. Records that originated here are
+	// skipped when replicating them back from peers, as are the copies
+	// peers replicated from elsewhere, so records don't loop around the
+	// mesh.
+	NodeName string
+	// Budget, if set, accounts for the goroutines replicating each peer,
+	// and refuses to replicate more peers than its limit allows.
+	Budget *budget.Budget
 
 	//using refrence type nsures that all parts of your program referencing the logger are accessing the same instance and its state.
 	logger *zap.Logger
@@ -25,6 +43,9 @@ type Replicator struct {
 
 	closed bool
 	close  chan struct{}
+	// wg tracks replicate goroutines so Close can wait for them to stop
+	// producing before the local log is closed.
+	wg sync.WaitGroup
 }
 
 func (r *Replicator) Join(name, addrs string) error {
@@ -42,12 +63,19 @@ func (r *Replicator) Join(name, addrs string) error {
 		return nil
 	}
 
+	if !r.Budget.TryAcquire(budget.ReplicationGoroutines, replicationGoroutines) {
+		return ErrReplicationBudget
+	}
 	r.servers[name] = make(chan struct{})
-	go r.replicate(addrs, r.servers[name])
+	r.wg.Add(1)
+	go r.replicate(name, addrs, r.servers[name])
 	return nil
 }
 
-func (r *Replicator) replicate(addrs string, leave chan struct{}) {
+func (r *Replicator) replicate(name, addrs string, leave chan struct{}) {
+	defer r.wg.Done()
+	defer r.Budget.Release(budget.ReplicationGoroutines, replicationGoroutines)
+
 	cc, err := grpc.Dial(addrs, r.DialOptions...)
 	if err != nil {
 		r.logger.Error("failed to dial", zap.String("address", addrs), zap.Error(err))
@@ -55,10 +83,14 @@ func (r *Replicator) replicate(addrs string, leave chan struct{}) {
 	}
 	defer cc.Close()
 
+	// Cancelling the stream's context ends it once the replicator closes or
+	// the peer leaves, rather than leaving it blocked on the peer.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	//grpc client
 	client := api.NewLogClient(cc)
-	ctx := context.Background()
-	stream, err := client.ConsumeStream(ctx,
+	stream, err := client.ConsumeStream(streamCtx,
 		&api.ConsumeRequest{
 			Offset: 0,
 		})
@@ -73,10 +105,16 @@ func (r *Replicator) replicate(addrs string, leave chan struct{}) {
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
-				r.logger.Error("failed to receive", zap.Error(err))
+				if streamCtx.Err() == nil {
+					r.logger.Error("failed to receive", zap.Error(err))
+				}
+				return
+			}
+			select {
+			case records <- resp.Record:
+			case <-streamCtx.Done():
 				return
 			}
-			records <- resp.Record
 		}
 	}()
 
@@ -87,7 +125,12 @@ func (r *Replicator) replicate(addrs string, leave chan struct{}) {
 		case <-leave:
 			return
 		case record := <-records:
-			_, err := r.LocalServer.Produce(ctx,
+			if !r.tagOrigin(name, record) {
+				continue
+			}
+			// A record already received is produced in full even if the
+			// replicator is closing; Close waits for it.
+			_, err := r.LocalServer.Produce(context.Background(),
 				&api.ProduceRequest{
 					Record: record,
 				})
@@ -99,6 +142,28 @@ func (r *Replicator) replicate(addrs string, leave chan struct{}) {
 	}
 }
 
+// tagOrigin tags record with the peer it was replicated from, and with it
+// as its origin unless it already has one, and reports whether it should
+// be replicated: only records that originated on the peer are. Every node
+// replicates each of its peers, so the copies a peer replicated from other
+// nodes, which it tagged, arrive from those nodes directly, and taking
+// them from the peer too would append them twice.
+func (r *Replicator) tagOrigin(peer string, record *api.Record) bool {
+	if _, ok := record.Headers[api.HeaderReplicatedFrom]; ok {
+		return false
+	}
+	if record.Headers == nil {
+		record.Headers = make(map[string]string)
+	}
+	origin, ok := record.Headers[api.HeaderOriginNode]
+	if !ok {
+		origin = peer
+		record.Headers[api.HeaderOriginNode] = origin
+	}
+	record.Headers[api.HeaderReplicatedFrom] = peer
+	return r.NodeName == "" || origin != r.NodeName
+}
+
 func (r *Replicator) Leave(name string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -129,18 +194,19 @@ func (r *Replicator) init() {
 	}
 }
 
+// Close stops replicating and waits for records being replicated to be
+// produced, so the local log can be closed safely once it returns.
 func (r *Replicator) Close() error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	r.init()
-
 	if r.closed {
+		r.mu.Unlock()
 		return nil
 	}
-
 	r.closed = true
 	close(r.close)
+	r.mu.Unlock()
 
+	r.wg.Wait()
 	return nil
 }
@@ -0,0 +1,55 @@
+package log
+
+import (
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicatorTagOrigin(t *testing.T) {
+	r := &Replicator{NodeName: "node-0"}
+
+	for scenario, tc := range map[string]struct {
+		headers   map[string]string
+		origin    string
+		replicate bool
+	}{
+		"untagged records are tagged with the peer": {
+			origin:    "node-1",
+			replicate: true,
+		},
+		"records produced to the peer keep their origin": {
+			headers:   map[string]string{api.HeaderOriginNode: "node-1"},
+			origin:    "node-1",
+			replicate: true,
+		},
+		"records mirrored to the peer keep their origin": {
+			headers:   map[string]string{api.HeaderOriginNode: "node-9"},
+			origin:    "node-9",
+			replicate: true,
+		},
+		"records the peer replicated from other nodes are skipped": {
+			headers: map[string]string{
+				api.HeaderOriginNode:     "node-2",
+				api.HeaderReplicatedFrom: "node-2",
+			},
+			origin:    "node-2",
+			replicate: false,
+		},
+		"records from this node are skipped": {
+			headers:   map[string]string{api.HeaderOriginNode: "node-0"},
+			origin:    "node-0",
+			replicate: false,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			record := &api.Record{Value: []byte("hello world"), Headers: tc.headers}
+			require.Equal(t, tc.replicate, r.tagOrigin("node-1", record))
+			require.Equal(t, tc.origin, record.Headers[api.HeaderOriginNode])
+			if tc.replicate {
+				require.Equal(t, "node-1", record.Headers[api.HeaderReplicatedFrom])
+			}
+		})
+	}
+}
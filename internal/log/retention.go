@@ -0,0 +1,260 @@
+package log
+
+import (
+	"context"
+	"os"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"go.uber.org/zap"
+)
+
+// RetentionReason is why retention removed segments.
+type RetentionReason string
+
+const (
+	// RetentionAge removed segments whose records were older than
+	// Config.Retention.MaxAge.
+	RetentionAge RetentionReason = "age"
+	// RetentionSize removed the oldest segments while the log was larger
+	// than Config.Retention.MaxBytes.
+	RetentionSize RetentionReason = "size"
+)
+
+// Deletion is a run of segments retention removed from the head of the
+// log.
+type Deletion struct {
+	// From and To bound the records removed, from offset From up to, but
+	// not including, To, which is the log's lowest offset now.
+	From, To uint64
+	// Segments are the base offsets of the segments removed, and Bytes
+	// the size of the records in them.
+	Segments []uint64
+	Bytes    uint64
+	Reason   RetentionReason
+}
+
+// retentionStats is how far retention has got with a log since it was
+// opened.
+type retentionStats struct {
+	lastRun         time.Time
+	lastErr         error
+	segmentsRemoved uint64
+	bytesReclaimed  uint64
+}
+
+// EnforceRetention removes the sealed segments Config.Retention expires,
+// from the head of the log: those whose newest record is older than MaxAge,
+// then the oldest of the rest while the log is larger than MaxBytes. It
+// returns the deletions it made, after calling OnDelete with each. The
+// janitor calls it every Config.Retention.Interval. Reads that have already
+// started on the removed segments finish on them. It removes nothing while
+// maintenance is paused.
+func (l *Log) EnforceRetention() ([]*Deletion, error) {
+	return l.enforceRetention(context.Background())
+}
+
+// enforceRetention enforces retention unless ctx is done by the time it
+// holds the log's lock, so a janitor stopped by Close doesn't remove the
+// closed log's files.
+func (l *Log) enforceRetention(ctx context.Context) ([]*Deletion, error) {
+	expired := l.expired()
+
+	l.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	// The pause may have started since the segments expired.
+	if l.Config.Clock.Now().Before(l.pausedUntil) {
+		l.mu.Unlock()
+		return nil, nil
+	}
+	var deletions []*Deletion
+	var err error
+	if len(expired) > 0 {
+		deletions, err = l.expire(expired)
+	}
+	l.retention.lastRun = l.Config.Clock.Now()
+	l.retention.lastErr = err
+	for _, d := range deletions {
+		l.retention.segmentsRemoved += uint64(len(d.Segments))
+		l.retention.bytesReclaimed += d.Bytes
+	}
+	l.mu.Unlock()
+
+	if l.Config.Metrics != nil {
+		l.Config.Metrics.Counter("log_retention_runs").Inc()
+		if err != nil {
+			l.Config.Metrics.Counter("log_retention_errors").Inc()
+		}
+	}
+	for _, d := range deletions {
+		if l.Config.Metrics != nil {
+			l.Config.Metrics.Counter("log_expired_segments").Add(uint64(len(d.Segments)))
+			l.Config.Metrics.Counter("log_reclaimed_bytes").Add(d.Bytes)
+		}
+		zap.L().Named("log").Info(
+			"removed expired segments",
+			zap.String("dir", l.Dir),
+			zap.String("reason", string(d.Reason)),
+			zap.Uint64("from", d.From),
+			zap.Uint64("to", d.To),
+		)
+		if l.Config.Retention.OnDelete != nil {
+			l.Config.Retention.OnDelete(d)
+		}
+	}
+	return deletions, err
+}
+
+// expiredSegment is a segment retention expires, and why.
+type expiredSegment struct {
+	*segment
+	reason RetentionReason
+}
+
+// expired returns the sealed segments at the head of the log that
+// retention expires, oldest first.
+func (l *Log) expired() []expiredSegment {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	policy := l.Config.Retention
+	sealed := l.segments[:len(l.segments)-1]
+	var size uint64
+	for _, s := range l.segments {
+		size += s.store.size
+	}
+
+	var expired []expiredSegment
+	now := l.Config.Clock.Now()
+	for _, s := range sealed {
+		if policy.MaxAge <= 0 || now.Sub(s.newest()) <= policy.MaxAge {
+			break
+		}
+		expired = append(expired, expiredSegment{s, RetentionAge})
+		size -= s.store.size
+	}
+	for _, s := range sealed[len(expired):] {
+		if policy.MaxBytes == 0 || size <= policy.MaxBytes {
+			break
+		}
+		expired = append(expired, expiredSegment{s, RetentionSize})
+		size -= s.store.size
+	}
+	return expired
+}
+
+// expire removes the expired segments, if they're still the head of the
+// log, returning the deletions it made by reason. l.mu must be held.
+func (l *Log) expire(expired []expiredSegment) ([]*Deletion, error) {
+	for i, s := range expired {
+		// Segments truncated or replaced since they expired are left for
+		// the next pass.
+		if i >= len(l.segments)-1 || l.segments[i] != s.segment {
+			return nil, nil
+		}
+	}
+
+	op := &segmentOp{Op: "retention"}
+	for _, s := range expired {
+		op.Remove = append(op.Remove, s.baseOffset)
+	}
+	if err := l.journal.begin(op); err != nil {
+		return nil, err
+	}
+
+	var deletions []*Deletion
+	for _, s := range expired {
+		size := s.store.size
+		if err := s.Remove(); err != nil {
+			return deletions, err
+		}
+		if n := len(deletions); n == 0 || deletions[n-1].Reason != s.reason {
+			deletions = append(deletions, &Deletion{From: s.baseOffset, Reason: s.reason})
+		}
+		d := deletions[len(deletions)-1]
+		d.To = s.nextOffset
+		d.Segments = append(d.Segments, s.baseOffset)
+		d.Bytes += size
+		l.segments = l.segments[1:]
+	}
+	return deletions, l.journal.done(op)
+}
+
+// newest returns when the segment's newest record was appended, from its
+// append time header, or, for records without one, when the segment's
+// store was last written.
+func (s *segment) newest() time.Time {
+	if s.nextOffset > s.baseOffset {
+		record, err := s.Read(s.nextOffset - 1)
+		if err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, record.Headers[api.HeaderAppendTime]); err == nil {
+				return t
+			}
+		}
+	}
+	info, err := os.Stat(s.store.Name())
+	if err != nil {
+		// Keep segments whose age can't be told.
+		return s.config.Clock.Now()
+	}
+	return info.ModTime()
+}
+
+// RetentionStatus returns how far retention has got with the log since it
+// was opened, and how many sealed segments it expires but hasn't removed
+// yet.
+func (l *Log) RetentionStatus() *api.RetentionStatus {
+	pending := len(l.expired())
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	status := &api.RetentionStatus{
+		SegmentsPending: uint64(pending),
+		SegmentsRemoved: l.retention.segmentsRemoved,
+		BytesReclaimed:  l.retention.bytesReclaimed,
+	}
+	if !l.retention.lastRun.IsZero() {
+		status.LastRunUnixMs = l.retention.lastRun.UnixMilli()
+	}
+	if l.retention.lastErr != nil {
+		status.LastError = l.retention.lastErr.Error()
+	}
+	return status
+}
+
+// pauseMaintenance holds retention back until until, or lets it run again
+// if until is the zero time.
+func (l *Log) pauseMaintenance(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pausedUntil = until
+}
+
+// retainEvery enforces retention every interval until ctx is done.
+func (l *Log) retainEvery(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-l.Config.Clock.After(interval):
+		case <-ctx.Done():
+			return
+		}
+		if _, err := l.enforceRetention(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Named("log").Error("retention failed", zap.String("dir", l.Dir), zap.Error(err))
+		}
+	}
+}
+
+// startRetention starts the retention janitor, if Config.Retention expires
+// anything.
+func (l *Log) startRetention() {
+	policy := l.Config.Retention
+	if policy.Interval <= 0 || (policy.MaxAge <= 0 && policy.MaxBytes == 0) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stopRetention = cancel
+	go l.retainEvery(ctx, policy.Interval)
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFake(start)
+	deleted := make(chan *Deletion, 4)
+	// Each segment holds one record.
+	c := Config{Clock: clk, Metrics: metrics.NewRegistry()}
+	c.Segment.MaxStoreBytes = 1
+	c.Retention.MaxAge = time.Hour
+	c.Retention.OnDelete = func(d *Deletion) {
+		deleted <- d
+	}
+	log, err := NewLog(t.TempDir(), c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	// Records 0 to 2 are two hours old, 3 to 5 half an hour.
+	for i := 0; i < 6; i++ {
+		appended := start.Add(-2 * time.Hour)
+		if i >= 3 {
+			appended = start.Add(-30 * time.Minute)
+		}
+		_, err := log.Append(&api.Record{
+			Value:   []byte("hello world"),
+			Headers: map[string]string{api.HeaderAppendTime: appended.Format(time.RFC3339Nano)},
+		})
+		require.NoError(t, err)
+	}
+
+	var aged, young uint64
+	for i, s := range log.segments[:5] {
+		if i < 3 {
+			aged += s.store.size
+		} else {
+			young += s.store.size
+		}
+	}
+	require.Zero(t, log.RetentionStatus().LastRunUnixMs)
+	require.Equal(t, uint64(3), log.RetentionStatus().SegmentsPending)
+
+	deletions, err := log.EnforceRetention()
+	require.NoError(t, err)
+	require.Equal(t, []*Deletion{{From: 0, To: 3, Segments: []uint64{0, 1, 2}, Bytes: aged, Reason: RetentionAge}}, deletions)
+	require.Equal(t, deletions[0], <-deleted)
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	require.Equal(t, uint64(3), c.Metrics.Counter("log_expired_segments").Value())
+	require.Equal(t, aged, c.Metrics.Counter("log_reclaimed_bytes").Value())
+	status := log.RetentionStatus()
+	require.Equal(t, start.UnixMilli(), status.LastRunUnixMs)
+	require.Equal(t, uint64(3), status.SegmentsRemoved)
+	require.Equal(t, aged, status.BytesReclaimed)
+	require.Zero(t, status.SegmentsPending)
+	require.Empty(t, status.LastError)
+
+	// Nothing else is expired yet.
+	deletions, err = log.EnforceRetention()
+	require.NoError(t, err)
+	require.Empty(t, deletions)
+
+	// Capping the log's size at the newest record's removes the oldest
+	// sealed segments, once maintenance isn't paused.
+	log.Config.Retention.MaxBytes = log.segments[2].store.size
+	log.pauseMaintenance(start.Add(time.Minute))
+	deletions, err = log.EnforceRetention()
+	require.NoError(t, err)
+	require.Empty(t, deletions)
+	require.Equal(t, uint64(2), log.RetentionStatus().SegmentsPending)
+	log.pauseMaintenance(time.Time{})
+	deletions, err = log.EnforceRetention()
+	require.NoError(t, err)
+	require.Equal(t, []*Deletion{{From: 3, To: 5, Segments: []uint64{3, 4}, Bytes: young, Reason: RetentionSize}}, deletions)
+	require.Equal(t, uint64(5), log.RetentionStatus().SegmentsRemoved)
+	require.Equal(t, uint64(3), c.Metrics.Counter("log_retention_runs").Value())
+	<-deleted
+	_, err = log.Read(4)
+	require.Error(t, err)
+	record, err := log.Read(5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), record.Offset)
+
+	// Segments removed are gone when the log reopens.
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, c)
+	require.NoError(t, err)
+	lowest, err = log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), lowest)
+	require.NoError(t, log.Close())
+}
+
+func TestRetentionJanitor(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	deleted := make(chan *Deletion, 1)
+	c := Config{Clock: clk}
+	c.Segment.MaxStoreBytes = 1
+	c.Retention.MaxAge = time.Hour
+	c.Retention.OnDelete = func(d *Deletion) {
+		deleted <- d
+	}
+	log, err := NewLog(t.TempDir(), c)
+	require.NoError(t, err)
+	defer log.Close()
+	require.Equal(t, defaultRetentionInterval, log.Config.Retention.Interval)
+
+	for i := 0; i < 2; i++ {
+		_, err := log.Append(&api.Record{
+			Value:   []byte("hello world"),
+			Headers: map[string]string{api.HeaderAppendTime: clk.Now().Format(time.RFC3339Nano)},
+		})
+		require.NoError(t, err)
+	}
+
+	// The janitor removes the records' segments once they're over an hour
+	// old.
+	for i := 0; i < 61; i++ {
+		for clk.Timers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(time.Minute)
+	}
+	select {
+	case d := <-deleted:
+		require.Equal(t, []uint64{0, 1}, d.Segments)
+	case <-time.After(time.Second):
+		t.Fatal("expired segment wasn't removed")
+	}
+}
@@ -0,0 +1,186 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// Corruption is a range of records in a sealed segment that couldn't be
+// read back intact.
+type Corruption struct {
+	// Base is the base offset of the segment holding the records, from
+	// From up to, but not including, To.
+	Base, From, To uint64
+	// Err is why the first of them couldn't be read.
+	Err error
+}
+
+func (c *Corruption) Error() string {
+	return fmt.Sprintf("records %d to %d of segment %d: %v", c.From, c.To-1, c.Base, c.Err)
+}
+
+func (c *Corruption) Unwrap() error {
+	return c.Err
+}
+
+// Scrub rereads the log's sealed segments, checking their indexes and
+// that each record matches its checksum, if it has one, decodes and holds
+// the offset it's indexed at. It counts and logs the corruption it finds,
+// and returns it. It reads no faster than Config.Scrub.BytesPerSecond, and
+// pins the segments rather than holding the log's lock, so it doesn't get
+// in the way of serving the log.
+func (l *Log) Scrub(ctx context.Context) ([]*Corruption, error) {
+	l.mu.RLock()
+	sealed := append([]*segment{}, l.segments[:len(l.segments)-1]...)
+	for _, s := range sealed {
+		s.acquire()
+	}
+	l.mu.RUnlock()
+	defer func() {
+		for _, s := range sealed {
+			s.release()
+		}
+	}()
+
+	pace := l.pacer(ctx)
+	var found []*Corruption
+	for _, s := range sealed {
+		corrupt, err := s.scrub(pace)
+		for _, c := range corrupt {
+			l.corrupt(c)
+		}
+		found = append(found, corrupt...)
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// scrub rereads the segment, calling pace with the size of each record.
+func (s *segment) scrub(pace func(n int) error) ([]*Corruption, error) {
+	if err := s.checkIndex(); err != nil {
+		return []*Corruption{{Base: s.baseOffset, From: s.baseOffset, To: s.nextOffset, Err: err}}, nil
+	}
+	var found []*Corruption
+	for off := s.baseOffset; off < s.nextOffset; off++ {
+		n, err := s.verify(off)
+		if err != nil {
+			if c := found; len(c) > 0 && c[len(c)-1].To == off {
+				c[len(c)-1].To++
+			} else {
+				found = append(found, &Corruption{Base: s.baseOffset, From: off, To: off + 1, Err: err})
+			}
+		}
+		if err := pace(n); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// verify reads the record at off back, returning its size.
+func (s *segment) verify(off uint64) (int, error) {
+	pos, err := s.Seek(off)
+	if err != nil {
+		return 0, err
+	}
+	p, err := s.store.Read(pos)
+	if err != nil {
+		return 0, err
+	}
+	record := &api.Record{}
+	if err := proto.Unmarshal(p, record); err != nil {
+		return len(p), err
+	}
+	if record.Offset != off {
+		return len(p), fmt.Errorf("record indexed at offset %d holds offset %d", off, record.Offset)
+	}
+	return len(p), nil
+}
+
+// pacer returns a func that waits after each n bytes read until the reads
+// are down to Config.Scrub.BytesPerSecond, returning early with ctx's
+// error if it's done.
+func (l *Log) pacer(ctx context.Context) func(n int) error {
+	rate := l.Config.Scrub.BytesPerSecond
+	start := l.Config.Clock.Now()
+	var read int64
+	return func(n int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rate <= 0 {
+			return nil
+		}
+		read += int64(n)
+		due := start.Add(time.Duration(float64(read) / float64(rate) * float64(time.Second)))
+		if d := due.Sub(l.Config.Clock.Now()); d > 0 {
+			select {
+			case <-l.Config.Clock.After(d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+}
+
+// corrupt counts and logs c, corruption the scrubber found.
+func (l *Log) corrupt(c *Corruption) {
+	if l.Config.Metrics != nil {
+		l.Config.Metrics.Counter("log_corrupt_records").Add(c.To - c.From)
+	}
+	zap.L().Named("log").Error(
+		"corrupt records",
+		zap.String("dir", l.Dir),
+		zap.Uint64("segment", c.Base),
+		zap.Uint64("from", c.From),
+		zap.Uint64("to", c.To),
+		zap.Error(c.Err),
+	)
+}
+
+// scrubEvery scrubs the log every Config.Scrub.Interval, repairing the
+// corruption it finds with Config.Scrub.Repair if it's set, until ctx is
+// done.
+func (l *Log) scrubEvery(ctx context.Context) {
+	for {
+		select {
+		case <-l.Config.Clock.After(l.Config.Scrub.Interval):
+		case <-ctx.Done():
+			return
+		}
+		found, err := l.Scrub(ctx)
+		if err != nil && ctx.Err() == nil {
+			zap.L().Named("log").Error("scrub failed", zap.String("dir", l.Dir), zap.Error(err))
+		}
+		if l.Config.Scrub.Repair == nil {
+			continue
+		}
+		for _, c := range found {
+			if err := l.Config.Scrub.Repair(c); err != nil {
+				zap.L().Named("log").Error("repair failed", zap.String("dir", l.Dir), zap.Error(err))
+				continue
+			}
+			if l.Config.Metrics != nil {
+				l.Config.Metrics.Counter("log_repaired_records").Add(c.To - c.From)
+			}
+		}
+	}
+}
+
+// startScrub starts the scrubber, if Config.Scrub.Interval is set.
+func (l *Log) startScrub() {
+	if l.Config.Scrub.Interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.stopScrub = cancel
+	go l.scrubEvery(ctx)
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrub(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	repaired := make(chan *Corruption, 1)
+	// Segments hold two records each: 0-1, 2-3 and 4.
+	c := Config{Clock: clk, Metrics: metrics.NewRegistry()}
+	c.Segment.MaxStoreBytes = 32
+	c.Store.Checksums = true
+	c.Scrub.Interval = time.Hour
+	c.Scrub.Repair = func(c *Corruption) error {
+		repaired <- c
+		return nil
+	}
+	log, err := NewLog(t.TempDir(), c)
+	require.NoError(t, err)
+	defer log.Close()
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	found, err := log.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// Flip a bit of record 2 on disk.
+	loc, err := log.Locate(2)
+	require.NoError(t, err)
+	f, err := os.OpenFile(segmentPath(log.Dir, loc.SegmentBaseOffset, ".store"), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	b := make([]byte, 1)
+	at := int64(loc.Position + lenWidth + 4)
+	_, err = f.ReadAt(b, at)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{b[0] ^ 1}, at)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = log.Read(2)
+	require.True(t, errors.Is(err, ErrRecordChecksum))
+
+	found, err = log.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(found))
+	require.Equal(t, uint64(2), found[0].Base)
+	require.Equal(t, uint64(2), found[0].From)
+	require.Equal(t, uint64(3), found[0].To)
+	require.True(t, errors.Is(found[0], ErrRecordChecksum))
+	require.Equal(t, uint64(1), c.Metrics.Counter("log_corrupt_records").Value())
+
+	// The scrubber finds it too, and has it repaired.
+	for clk.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Hour)
+	select {
+	case c := <-repaired:
+		require.Equal(t, uint64(2), c.From)
+	case <-time.After(time.Second):
+		t.Fatal("corruption wasn't repaired")
+	}
+}
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
 
-	api "github.com/Tarunshrma/prolog/log/api/v1"
+	api "github.com/Tarunshrma/prolog/api/v1"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -14,6 +15,13 @@ type segment struct {
 	index                  *index
 	baseOffset, nextOffset uint64
 	config                 Config
+
+	// refs counts the readers that have the segment pinned, and closed is
+	// whether the log is done with it, leaving the last of them to close
+	// its files.
+	refMu  sync.Mutex
+	refs   int
+	closed bool
 }
 
 func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
@@ -24,7 +32,7 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	var err error
 
 	storeFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprint("%d%s", baseOffset, ".store")),
+		segmentPath(dir, baseOffset, ".store"),
 		os.O_RDWR|os.O_CREATE|os.O_APPEND,
 		0644,
 	)
@@ -33,12 +41,12 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 		return nil, err
 	}
 
-	if s.store, err = newStore(storeFile); err != nil {
+	if s.store, err = newStore(storeFile, c); err != nil {
 		return nil, err
 	}
 
 	indexFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprint("%d%s", baseOffset, ".index")),
+		segmentPath(dir, baseOffset, ".index"),
 		os.O_RDWR|os.O_CREATE|os.O_APPEND,
 		0644,
 	)
@@ -60,6 +68,11 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	return s, nil
 }
 
+// segmentPath returns the path of the segment file with the given extension.
+func segmentPath(dir string, baseOffset uint64, ext string) string {
+	return path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ext))
+}
+
 func (s *segment) Append(record *api.Record) (offset uint64, err error) {
 	cur := s.nextOffset
 	record.Offset = cur
@@ -85,8 +98,17 @@ func (s *segment) Append(record *api.Record) (offset uint64, err error) {
 	return cur, nil
 }
 
+// Seek returns the store position of the record at the absolute offset. It
+// returns an ErrorOffsetOutOfRange if the segment doesn't hold the offset.
+func (s *segment) Seek(offset uint64) (uint64, error) {
+	if offset < s.baseOffset || offset >= s.nextOffset {
+		return 0, &api.ErrorOffsetOutOfRange{Offset: offset}
+	}
+	return s.index.Find(uint32(offset - s.baseOffset))
+}
+
 func (s *segment) Read(offset uint64) (*api.Record, error) {
-	_, pos, err := s.index.Read(int64(offset - s.baseOffset))
+	pos, err := s.Seek(offset)
 	if err != nil {
 		return nil, err
 	}
@@ -104,16 +126,105 @@ func (s *segment) Read(offset uint64) (*api.Record, error) {
 	return record, nil
 }
 
+// ReadRange calls fn with each record from offset from up to, but not
+// including, to, which must both be in the segment.
+func (s *segment) ReadRange(from, to uint64, fn func(*api.Record) error) error {
+	pos, err := s.Seek(from)
+	if err != nil {
+		return err
+	}
+
+	// Records are stored back to back, so they're read sequentially
+	// through a buffer from the first one.
+	r, err := s.store.reader(pos)
+	if err != nil {
+		return err
+	}
+	for off := from; off < to; off++ {
+		p, err := readRecord(r, s.store.maxRecordBytes)
+		if err != nil {
+			return err
+		}
+		record := &api.Record{}
+		if err = proto.Unmarshal(p, record); err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadReverse calls fn with each record from offset to-1 down to from,
+// which must both be in the segment. Records are only linked forwards in
+// the store, so each is found through the index.
+func (s *segment) ReadReverse(from, to uint64, fn func(*api.Record) error) error {
+	for off := to; off > from; off-- {
+		record, err := s.Read(off - 1)
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate drops the segment's records from offset on, so the next record
+// appended to it gets offset.
+func (s *segment) truncate(offset uint64) error {
+	pos, err := s.Seek(offset)
+	if err != nil {
+		return err
+	}
+	s.index.truncate(offset - s.baseOffset)
+	if err := s.store.truncate(pos); err != nil {
+		return err
+	}
+	s.nextOffset = offset
+	return nil
+}
+
+// sync writes the segment's buffered records and index entries to disk.
+func (s *segment) sync() error {
+	if err := s.store.sync(); err != nil {
+		return err
+	}
+	return s.index.sync()
+}
+
 func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes ||
 		s.index.size >= s.config.Segment.MaxIndexBytes
 }
 
-func (s *segment) Remove() error {
-	if err := s.Close(); err != nil {
-		return err
+// acquire pins the segment so its files stay open until release, even if
+// the log truncates or closes it meanwhile. The log's lock must be held, so
+// the segment is still the log's.
+func (s *segment) acquire() {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	s.refs++
+}
+
+// release unpins the segment, closing its files if the log is done with it
+// and no other reader has it pinned.
+func (s *segment) release() error {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	s.refs--
+	if s.refs == 0 && s.closed {
+		return s.close()
 	}
+	return nil
+}
 
+// Remove deletes the segment's files. Readers that have it pinned keep
+// reading the files they have open until they release it.
+func (s *segment) Remove() error {
 	if err := os.Remove(s.index.Name()); err != nil {
 		return err
 	}
@@ -122,10 +233,22 @@ func (s *segment) Remove() error {
 		return err
 	}
 
-	return nil
+	return s.Close()
 }
 
+// Close closes the segment's files, or leaves the last reader that has it
+// pinned to close them.
 func (s *segment) Close() error {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	s.closed = true
+	if s.refs > 0 {
+		return nil
+	}
+	return s.close()
+}
+
+func (s *segment) close() error {
 	if err := s.index.Close(); err != nil {
 		return err
 	}
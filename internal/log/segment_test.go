@@ -6,8 +6,8 @@ import (
 	"os"
 	"testing"
 
-	api "github.com/Tarunshrma/prolog/log/api/v1"
-	"github.com/test-go/testify/require"
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSegment(t *testing.T) {
@@ -41,6 +41,12 @@ func TestSegment(t *testing.T) {
 	require.Equal(t, io.EOF, err)
 	require.True(t, s.IsMaxed())
 
+	for _, off := range []uint64{15, 19} {
+		_, err = s.Seek(off)
+		apiErr := err.(*api.ErrorOffsetOutOfRange)
+		require.Equal(t, off, apiErr.Offset)
+	}
+
 	c.Segment.MaxStoreBytes = uint64(len(want.Value)) * 3
 	c.Segment.MaxIndexBytes = 1024
 
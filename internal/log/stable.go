@@ -0,0 +1,111 @@
+package log
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+var _ raft.StableStore = (*stableStore)(nil)
+
+// errKeyNotFound is the error Raft expects from a stable store's Get for a
+// key that was never set; it's matched by its message.
+var errKeyNotFound = errors.New("not found")
+
+// stableStore is where Raft keeps its metadata, like the current term and
+// the candidate it voted for. It's a handful of keys, rewritten in full on
+// every change, so each change is one atomic rename.
+type stableStore struct {
+	mu   sync.Mutex
+	path string
+	kv   map[string][]byte
+}
+
+// newStableStore opens the stable store kept in the file at name, creating
+// it on first use.
+func newStableStore(name string) (*stableStore, error) {
+	s := &stableStore{path: name, kv: make(map[string][]byte)}
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return s, os.MkdirAll(path.Dir(name), 0755)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.kv); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *stableStore) Set(key []byte, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.kv[string(key)]
+	s.kv[string(key)] = append([]byte(nil), val...)
+	if err := s.persist(); err != nil {
+		if had {
+			s.kv[string(key)] = prev
+		} else {
+			delete(s.kv, string(key))
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *stableStore) Get(key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.kv[string(key)]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return append([]byte(nil), val...), nil
+}
+
+func (s *stableStore) SetUint64(key []byte, val uint64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], val)
+	return s.Set(key, b[:])
+}
+
+// GetUint64 returns 0 for a key that was never set, as Raft expects.
+func (s *stableStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err == errKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, errors.New("stable store value isn't a uint64")
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// persist writes the store aside and renames it into place, so a crash
+// leaves either the old or the new values, never a mix.
+func (s *stableStore) persist() error {
+	b, err := json.Marshal(s.kv)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	return syncFile(path.Dir(s.path))
+}
@@ -0,0 +1,34 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStableStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "raft", "stable")
+	s, err := newStableStore(name)
+	require.NoError(t, err)
+
+	// Unset keys read as Raft expects.
+	_, err = s.Get([]byte("LastVoteCand"))
+	require.EqualError(t, err, "not found")
+	term, err := s.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), term)
+
+	require.NoError(t, s.Set([]byte("LastVoteCand"), []byte("node-1")))
+	require.NoError(t, s.SetUint64([]byte("CurrentTerm"), 7))
+
+	// The values survive a restart.
+	s, err = newStableStore(name)
+	require.NoError(t, err)
+	cand, err := s.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("node-1"), cand)
+	term, err = s.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), term)
+}
@@ -3,16 +3,35 @@ package log
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
 	"os"
 	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/budget"
 )
 
 var (
 	enc = binary.BigEndian
+	// crcTable is the CRC-32C table records' checksums are computed with.
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
 )
 
+// ErrRecordChecksum is returned when a record read from a store doesn't
+// match the checksum stored with it.
+var ErrRecordChecksum = errors.New("record checksum mismatch")
+
 const (
 	lenWidth = 8
+	crcWidth = 4
+	// continued is set in the length of every frame of a record but its
+	// last.
+	continued = uint64(1) << 63
+	// checksummed is set in the length of a record's last frame if the
+	// record's CRC-32C follows it.
+	checksummed = uint64(1) << 62
 )
 
 type store struct {
@@ -24,10 +43,18 @@ type store struct {
 	//instead of writing directly to the file, you're writing to a buffer, and then the buffer writes to the file.
 	buf  *bufio.Writer
 	size uint64
+
+	readBufferBytes int
+	maxFrameBytes   uint64
+	maxRecordBytes  uint64
+	checksums       bool
+
+	budget      *budget.Budget
+	bufferBytes int64
 }
 
 // newStore creates a new store object.
-func newStore(f *os.File) (*store, error) {
+func newStore(f *os.File, c Config) (*store, error) {
 	fi, err := os.Stat(f.Name())
 	if err != nil {
 		return nil, err
@@ -35,41 +62,70 @@ func newStore(f *os.File) (*store, error) {
 
 	size := uint64(fi.Size())
 
+	c.Budget.Acquire(budget.BufferBytes, int64(c.Store.WriteBufferBytes))
 	return &store{
-		file: f,
-		size: size,
-		buf:  bufio.NewWriter(f),
+		file:            f,
+		size:            size,
+		buf:             bufio.NewWriterSize(f, c.Store.WriteBufferBytes),
+		readBufferBytes: c.Store.ReadBufferBytes,
+		maxFrameBytes:   c.Store.MaxFrameBytes,
+		maxRecordBytes:  c.Store.MaxRecordBytes,
+		checksums:       c.Store.Checksums,
+		budget:          c.Budget,
+		bufferBytes:     int64(c.Store.WriteBufferBytes),
 	}, nil
 }
 
-// Append appends the provided byte slice to the store.
+// Append appends the provided byte slice to the store. Byte slices larger
+// than the max frame size are split across continuation frames.
 func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
 	// Acquire the lock to ensure thread-safe access to the store.
 	s.mu.Lock()
 	defer s.mu.Unlock() // Release the lock when the function exits.
 
+	if s.maxRecordBytes > 0 && uint64(len(p)) > s.maxRecordBytes {
+		return 0, 0, &api.ErrorRecordTooLarge{Size: uint64(len(p)), Max: s.maxRecordBytes}
+	}
+
 	pos = s.size
+	record := p
 
 	/* Why Write the Length First */
 	/*
 	* Writing the length of the data before the actual data allows for easier reading and parsing later.
 	* When reading, you can first read the length, know exactly how many bytes to read for the data, and process accordingly.
 	 */
-	if err := binary.Write(s.buf, enc, uint64(len(p))); err != nil {
-		return 0, 0, err
+	for {
+		frame, length := p, uint64(len(p))
+		if s.maxFrameBytes > 0 && length > s.maxFrameBytes {
+			frame, length = p[:s.maxFrameBytes], s.maxFrameBytes|continued
+		} else if s.checksums {
+			length |= checksummed
+		}
+		if err := binary.Write(s.buf, enc, length); err != nil {
+			return 0, 0, err
+		}
+
+		// It returns the number of bytes written
+		w, err := s.buf.Write(frame)
+		if err != nil {
+			return 0, 0, err
+		}
+		s.size += uint64(w) + lenWidth
+
+		p = p[len(frame):]
+		if length&continued == 0 {
+			break
+		}
 	}
-
-	// It returns the number of bytes written
-	w, err := s.buf.Write(p)
-
-	if err != nil {
-		return 0, 0, err
+	if s.checksums {
+		if err := binary.Write(s.buf, enc, crc32.Checksum(record, crcTable)); err != nil {
+			return 0, 0, err
+		}
+		s.size += crcWidth
 	}
 
-	w += lenWidth
-	s.size += uint64(w)
-
-	return uint64(w), pos, nil
+	return s.size - pos, pos, nil
 }
 
 func (s *store) Read(pos uint64) ([]byte, error) {
@@ -82,41 +138,65 @@ func (s *store) Read(pos uint64) ([]byte, error) {
 		return nil, err // If flushing the buffer fails, return an error.
 	}
 
-	// Create a slice of bytes to hold the size information (length of the data).
-	// lenWidth is assumed to be a predefined constant representing the size of the length header.
-
-	//size = 00 00 00 00 00 00 00 00
-	// where it is 8 bytes defined by lenWidth
-	size := make([]byte, lenWidth)
-
-	// Read the length of the stored data from the file.
-	// The length is stored at the position indicated by `pos`.
-	// ReadAt reads len(size) bytes starting from `pos`.
-
-	//size = 00 00 00 00 00 00 00 05
-	//where 05 is the length of the data e.f. Hello
-	if _, err := s.file.ReadAt(size, int64(pos)); err != nil {
-		return nil, err // Return an error if reading the length fails.
+	if pos >= s.size {
+		return nil, io.EOF
 	}
+	return readRecord(io.NewSectionReader(s.file, int64(pos), int64(s.size-pos)), s.maxRecordBytes)
+}
 
-	// Decode the size using BigEndian encoding.
-	// `enc.Uint64(size)` reads the size from the byte slice `size` (which contains the length prefix).
-
-	//b = 00 00 00 00 00
-	//5 bytes of data as read previosly
-	b := make([]byte, enc.Uint64(size))
-
-	// Read the actual data from the file.
-	// The position for reading starts after the length prefix (`pos + lenWidth`).
-
-	//b = H e l l o
-	// binary representation of ascii data where each letter reprent a byte.
-	if _, err := s.file.ReadAt(b, int64(pos+lenWidth)); err != nil {
-		return nil, err // Return an error if reading the actual data fails.
+// readRecord reads a record's frames from r and reassembles them. Each frame
+// is its length and then its bytes; the top bit of the length is set on
+// every frame but a record's last, and the next bit on its last if the
+// record's CRC-32C follows it. It returns io.EOF if r has no more records,
+// an ErrorRecordTooLarge if the record is larger than max, and
+// ErrRecordChecksum if it doesn't match its checksum.
+func readRecord(r io.Reader, max uint64) ([]byte, error) {
+	header := make([]byte, lenWidth)
+	var b []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF && b != nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		length := enc.Uint64(header)
+		more := length&continued != 0
+		sum := length&checksummed != 0
+		length &^= continued | checksummed
+
+		size := uint64(len(b)) + length
+		if max > 0 && size > max {
+			return nil, &api.ErrorRecordTooLarge{Size: size, Max: max}
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == nil {
+			b = frame
+		} else {
+			b = append(b, frame...)
+		}
+		if more {
+			continue
+		}
+		if sum {
+			if _, err := io.ReadFull(r, header[:crcWidth]); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			if enc.Uint32(header) != crc32.Checksum(b, crcTable) {
+				return nil, ErrRecordChecksum
+			}
+		}
+		return b, nil
 	}
-
-	// Return the read data and a nil error indicating success.
-	return b, nil
 }
 
 func (s *store) ReadAt(p []byte, off int64) (int, error) {
@@ -129,9 +209,61 @@ func (s *store) ReadAt(p []byte, off int64) (int, error) {
 	return s.file.ReadAt(p, off)
 }
 
+// reader returns a buffered reader over the store from pos to its current
+// end, flushing pending appends first so it sees them.
+func (s *store) reader(pos uint64) (*bufio.Reader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return nil, err
+	}
+	section := io.NewSectionReader(s.file, int64(pos), int64(s.size-pos))
+	return bufio.NewReaderSize(section, s.readBufferBytes), nil
+}
+
+// section returns a reader over the whole store as of now, flushing pending
+// appends first so it sees them.
+func (s *store) section() (*io.SectionReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(s.file, 0, int64(s.size)), nil
+}
+
+// sync flushes buffered appends and syncs the store file to disk.
+func (s *store) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// truncate drops everything in the store from pos on.
+func (s *store) truncate(pos uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Truncate(int64(pos)); err != nil {
+		return err
+	}
+	s.size = pos
+	return nil
+}
+
 func (s *store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.budget.Release(budget.BufferBytes, s.bufferBytes)
 
 	if err := s.buf.Flush(); err != nil {
 		return err
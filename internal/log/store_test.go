@@ -1,11 +1,13 @@
 package log
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"testing"
 
-	"github.com/test-go/testify/require"
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -18,14 +20,14 @@ func TestStoreAppendRead(t *testing.T) {
 	require.NoError(t, err)
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 
 	testAppend(t, s)
 	testRead(t, s)
 	testReadAt(t, s)
 
-	s, err = newStore(f)
+	s, err = newStore(f, Config{})
 	require.NoError(t, err)
 	testRead(t, s)
 }
@@ -69,7 +71,7 @@ func testReadAt(t *testing.T, s *store) {
 		n, err = s.ReadAt(b, int64(off))
 		require.NoError(t, err)
 		require.Equal(t, write, b)
-		require.Equal(t, int(size), uint64(n))
+		require.Equal(t, int(size), n)
 		off += uint64(n)
 	}
 }
@@ -79,7 +81,7 @@ func TestStoreClose(t *testing.T) {
 	require.NoError(t, err)
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 
 	_, _, err = s.Append(write)
@@ -115,3 +117,41 @@ func openFile(name string) (file *os.File, size int64, err error) {
 
 	return f, fi.Size(), nil
 }
+
+func TestStoreFrames(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_frames_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Store.MaxFrameBytes = 1024
+	c.Store.MaxRecordBytes = 4096
+	s, err := newStore(f, c)
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("a"), 3000)
+	n, pos, err := s.Append(large)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), pos)
+	// Split into frames of 1024, 1024 and 952 bytes, each after its length.
+	require.Equal(t, uint64(3000+3*lenWidth), n)
+
+	_, pos, err = s.Append(write)
+	require.NoError(t, err)
+	require.Equal(t, n, pos)
+
+	read, err := s.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, large, read)
+	read, err = s.Read(pos)
+	require.NoError(t, err)
+	require.Equal(t, write, read)
+
+	_, _, err = s.Append(make([]byte, 4097))
+	require.IsType(t, &api.ErrorRecordTooLarge{}, err)
+
+	// Records are checked against the max as they're reassembled, too.
+	s.maxRecordBytes = 2048
+	_, err = s.Read(0)
+	require.IsType(t, &api.ErrorRecordTooLarge{}, err)
+}
@@ -0,0 +1,115 @@
+package log
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamLayer(t *testing.T) {
+	ca, caKey := newCert(t, "ca", tls.Certificate{}, nil)
+	server, _ := newCert(t, "server", ca, caKey)
+	peer, _ := newCert(t, "peer", ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	serverTLS := &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	peerTLS := &tls.Config{Certificates: []tls.Certificate{peer}, RootCAs: pool}
+	anonymousTLS := &tls.Config{RootCAs: pool}
+
+	for name, tc := range map[string]struct {
+		server, peer *tls.Config
+		ok           bool
+	}{
+		"plaintext":                 {nil, nil, true},
+		"mutual tls":                {serverTLS, peerTLS, true},
+		"tls without a certificate": {serverTLS, anonymousTLS, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			accepting := NewStreamLayer(ln, tc.server, nil)
+			defer accepting.Close()
+			dialing := NewStreamLayer(nil, nil, tc.peer)
+
+			got := make(chan error, 1)
+			go func() {
+				conn, err := accepting.Accept()
+				if err != nil {
+					got <- err
+					return
+				}
+				defer conn.Close()
+				b := make([]byte, 5)
+				if _, err := io.ReadFull(conn, b); err != nil {
+					got <- err
+					return
+				}
+				_, err = conn.Write(b)
+				got <- err
+			}()
+
+			conn, err := dialing.Dial(raft.ServerAddress(accepting.Addr().String()), time.Second)
+			require.NoError(t, err)
+			defer conn.Close()
+			// TLS 1.3 clients finish their handshake before the server
+			// verifies them, so only the server knows if it failed.
+			_, _ = conn.Write([]byte("hello"))
+			err = <-got
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			b := make([]byte, 5)
+			_, err = io.ReadFull(conn, b)
+			require.NoError(t, err)
+			require.Equal(t, "hello", string(b))
+		})
+	}
+}
+
+// newCert returns a certificate for 127.0.0.1 signed by parent, or a
+// self-signed CA if parent is empty, with its key.
+func newCert(t *testing.T, name string, parent tls.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent.Leaf == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parentKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, key
+}
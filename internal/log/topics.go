@@ -0,0 +1,833 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"google.golang.org/protobuf/proto"
+)
+
+// topicsDir is the directory in the data directory that topics are stored
+// in. A log stored in the data directory itself leaves it alone.
+const topicsDir = "topics"
+
+// topicConfigFile is the file in a topic's directory its config overrides
+// are kept in, as an api.TopicConfig. Topics without overrides may not
+// have one.
+const topicConfigFile = "config"
+
+var _ backend.Topics = (*Topics)(nil)
+
+// Topics is a node's topics: named streams of records, each split into
+// partitions that are independent logs, stored under
+// <data dir>/topics/<topic>/<partition>. A topic's config overrides
+// Config for its partitions. Internal topics, whose names start with
+// api.InternalTopicPrefix, are exempt from retention, since the state they
+// hold, like consumer groups' commits, outlives the records it's about.
+type Topics struct {
+	mu sync.RWMutex
+
+	Dir     string
+	Config  Config
+	topics  map[string][]*Log
+	configs map[string]*api.TopicConfig
+	// pausedUntil is when the maintenance pause holding the partitions'
+	// retention back ends, if it's paused; see pauseMaintenance.
+	pausedUntil time.Time
+}
+
+// NewTopics opens the topics stored under dataDir, each partition's log
+// configured by c.
+func NewTopics(dataDir string, c Config) (*Topics, error) {
+	t := &Topics{
+		Dir:     path.Join(dataDir, topicsDir),
+		Config:  c,
+		topics:  make(map[string][]*Log),
+		configs: make(map[string]*api.TopicConfig),
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := t.setup(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// setup opens the topics in t.Dir, removing those a crash left half
+// created.
+func (t *Topics) setup() error {
+	entries, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), ".") {
+			if err := os.RemoveAll(path.Join(t.Dir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		partitions, config, err := t.open(e.Name())
+		if err != nil {
+			return err
+		}
+		t.topics[e.Name()] = partitions
+		t.configs[e.Name()] = config
+	}
+	return nil
+}
+
+// open opens a topic's partitions, which are the directories in its own
+// named by their numbers, with its config's overrides. Others, like the
+// staging directories installs leave beside a partition's, aren't
+// partitions.
+func (t *Topics) open(name string) ([]*Log, *api.TopicConfig, error) {
+	entries, err := os.ReadDir(path.Join(t.Dir, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	topicConfig, err := readTopicConfig(path.Join(t.Dir, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := t.partitionConfig(name, topicConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	var numbers []uint64
+	for _, e := range entries {
+		n, err := strconv.ParseUint(e.Name(), 10, 32)
+		if e.IsDir() && err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var partitions []*Log
+	for i, n := range numbers {
+		// Partitions are created together, so a gap means some were
+		// removed by hand.
+		if n != uint64(i) {
+			closeAll(partitions)
+			return nil, nil, fmt.Errorf("topic %q is missing partition %d", name, i)
+		}
+		l, err := NewLog(t.partitionDir(name, uint32(n)), config)
+		if err != nil {
+			closeAll(partitions)
+			return nil, nil, err
+		}
+		l.pauseMaintenance(t.pausedUntil)
+		partitions = append(partitions, l)
+	}
+	return partitions, topicConfig, nil
+}
+
+// partitionConfig returns the config of a topic's partitions: Config with
+// the topic's overrides, without retention for internal topics. It fails
+// if the overrides make an invalid config.
+func (t *Topics) partitionConfig(name string, topicConfig *api.TopicConfig) (Config, error) {
+	config := t.Config
+	if n := topicConfig.GetSegmentMaxStoreBytes(); n > 0 {
+		config.Segment.MaxStoreBytes = n
+	}
+	if n := topicConfig.GetSegmentMaxIndexBytes(); n > 0 {
+		config.Segment.MaxIndexBytes = n
+	}
+	if ms := topicConfig.GetRetentionMaxAgeMs(); ms > 0 {
+		config.Retention.MaxAge = time.Duration(ms) * time.Millisecond
+	}
+	if n := topicConfig.GetRetentionMaxBytes(); n > 0 {
+		config.Retention.MaxBytes = n
+	}
+	if strings.HasPrefix(name, api.InternalTopicPrefix) {
+		config.Retention.MaxAge, config.Retention.MaxBytes = 0, 0
+		config.Retention.OnDelete = nil
+	}
+	if err := config.setDefaults(); err != nil {
+		return Config{}, fmt.Errorf("topic %q: %w", name, err)
+	}
+	return config, nil
+}
+
+// readTopicConfig reads the config overrides in a topic's directory, which
+// are nil if it has none.
+func readTopicConfig(dir string) (*api.TopicConfig, error) {
+	b, err := os.ReadFile(path.Join(dir, topicConfigFile))
+	if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config := &api.TopicConfig{}
+	if err := proto.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("topic config %s: %w", dir, err)
+	}
+	return config, nil
+}
+
+// writeTopicConfig writes a topic's config overrides into its directory,
+// aside first and renamed into place, so a crash leaves the old overrides
+// or the new ones.
+func writeTopicConfig(dir string, config *api.TopicConfig) error {
+	b, err := proto.Marshal(config)
+	if err != nil {
+		return err
+	}
+	name := path.Join(dir, topicConfigFile)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return syncFile(dir)
+}
+
+func (t *Topics) partitionDir(topic string, partition uint32) string {
+	return path.Join(t.Dir, topic, strconv.FormatUint(uint64(partition), 10))
+}
+
+// CreateTopic creates a topic with partitions partitions.
+func (t *Topics) CreateTopic(name string, partitions uint32) error {
+	return t.CreateConfiguredTopic(&api.Topic{Name: name, Partitions: partitions})
+}
+
+// CreateConfiguredTopic creates a topic with its partitions and config
+// overrides. Its directories are made under a temporary name and renamed
+// into place, so a crash midway leaves no half-created topic behind.
+func (t *Topics) CreateConfiguredTopic(topic *api.Topic) error {
+	return t.createTopic(topic, true)
+}
+
+// createTopic creates a topic, recording its creation in the
+// api.TopicEventsTopic if notify is set.
+func (t *Topics) createTopic(topic *api.Topic, notify bool) error {
+	name, partitions := topic.GetName(), topic.GetPartitions()
+	if err := api.CheckTopicName(name); err != nil {
+		return err
+	}
+	if partitions == 0 {
+		return fmt.Errorf("topic %q needs at least one partition", name)
+	}
+	if _, err := t.partitionConfig(name, topic.GetConfig()); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.topics[name]; ok {
+		return &api.ErrorTopicExists{Topic: name}
+	}
+	if err := t.create(topic); err != nil {
+		return err
+	}
+	if !notify {
+		return nil
+	}
+	return t.notify(api.TopicEvent_CREATED, name)
+}
+
+// create makes a topic's directories and opens its partitions. The caller
+// holds t.mu.
+func (t *Topics) create(topic *api.Topic) error {
+	name := topic.GetName()
+	staging, err := os.MkdirTemp(t.Dir, "."+name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	for p := uint32(0); p < topic.GetPartitions(); p++ {
+		if err := os.Mkdir(path.Join(staging, strconv.FormatUint(uint64(p), 10)), 0755); err != nil {
+			return err
+		}
+	}
+	if topic.GetConfig() != nil {
+		if err := writeTopicConfig(staging, topic.Config); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(staging, path.Join(t.Dir, name)); err != nil {
+		return err
+	}
+	if err := syncFile(t.Dir); err != nil {
+		return err
+	}
+
+	logs, config, err := t.open(name)
+	if err != nil {
+		return err
+	}
+	t.topics[name] = logs
+	t.configs[name] = config
+	return nil
+}
+
+// notify records a change to a topic, as of now, in the
+// api.TopicEventsTopic, creating it with a single partition for the first
+// change. Internal topics' changes aren't recorded, so the events topic
+// doesn't record its own creation. The caller holds t.mu, so events are
+// recorded in the order the changes were made.
+func (t *Topics) notify(typ api.TopicEvent_Type, name string) error {
+	if strings.HasPrefix(name, api.InternalTopicPrefix) {
+		return nil
+	}
+	if _, ok := t.topics[api.TopicEventsTopic]; !ok {
+		err := t.create(&api.Topic{Name: api.TopicEventsTopic, Partitions: 1})
+		if err != nil {
+			return err
+		}
+	}
+	value, err := proto.Marshal(&api.TopicEvent{
+		Type: typ,
+		Topic: &api.Topic{
+			Name:       name,
+			Partitions: uint32(len(t.topics[name])),
+			Config:     t.configs[name],
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = t.topics[api.TopicEventsTopic][0].Append(&api.Record{Value: value})
+	return err
+}
+
+// ConfigureTopic replaces a topic's config overrides with config, which
+// may be nil to remove them, failing with an *api.ErrorUnknownTopic if
+// there's no such topic. Its partitions take up the new settings right
+// away, though their active segments keep the sizes they were created
+// with.
+func (t *Topics) ConfigureTopic(name string, config *api.TopicConfig) error {
+	return t.configureTopic(name, config, true)
+}
+
+// configureTopic replaces a topic's config overrides, recording the change
+// in the api.TopicEventsTopic if notify is set.
+func (t *Topics) configureTopic(name string, config *api.TopicConfig, notify bool) error {
+	logConfig, err := t.partitionConfig(name, config)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partitions, ok := t.topics[name]
+	if !ok {
+		return &api.ErrorUnknownTopic{Topic: name}
+	}
+	if err := writeTopicConfig(path.Join(t.Dir, name), config); err != nil {
+		return err
+	}
+	for _, l := range partitions {
+		l.reconfigure(logConfig)
+	}
+	if proto.Size(config) == 0 {
+		config = nil
+	}
+	t.configs[name] = config
+	if !notify {
+		return nil
+	}
+	return t.notify(api.TopicEvent_CONFIGURED, name)
+}
+
+// ListTopics lists the topics, by name.
+func (t *Topics) ListTopics() ([]*api.Topic, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	topics := make([]*api.Topic, 0, len(t.topics))
+	for name, partitions := range t.topics {
+		topics = append(topics, &api.Topic{
+			Name:       name,
+			Partitions: uint32(len(partitions)),
+			Config:     t.configs[name],
+		})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics, nil
+}
+
+// Partition returns the log of a topic's partition, failing with an
+// *api.ErrorUnknownTopic if there's no such partition.
+func (t *Topics) Partition(topic string, partition uint32) (backend.CommitLog, error) {
+	return t.partition(topic, partition)
+}
+
+func (t *Topics) partition(topic string, partition uint32) (*Log, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	partitions := t.topics[topic]
+	if int(partition) >= len(partitions) {
+		return nil, &api.ErrorUnknownTopic{Topic: topic, Partition: partition}
+	}
+	return partitions[partition], nil
+}
+
+// pauseMaintenance holds the partitions' retention back until until, or
+// lets it run again if until is the zero time. Partitions created while
+// paused are held back too.
+func (t *Topics) pauseMaintenance(until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pausedUntil = until
+	for _, partitions := range t.topics {
+		for _, p := range partitions {
+			p.pauseMaintenance(until)
+		}
+	}
+}
+
+// Close closes every partition's log.
+func (t *Topics) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	for _, partitions := range t.topics {
+		if cerr := closeAll(partitions); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeAll closes logs, returning the first error.
+func closeAll(logs []*Log) error {
+	var err error
+	for _, l := range logs {
+		if cerr := l.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// CreateTopic creates a topic on every replica, through Raft, so any of
+// them can serve it.
+func (l *DistributedLog) CreateTopic(name string, partitions uint32) error {
+	return l.CreateConfiguredTopic(&api.Topic{Name: name, Partitions: partitions})
+}
+
+// CreateConfiguredTopic creates a topic with its config overrides on every
+// replica, through Raft.
+func (l *DistributedLog) CreateConfiguredTopic(topic *api.Topic) error {
+	if l.config.Raft.Witness {
+		return &api.ErrorNotLeader{}
+	}
+	if err := api.CheckTopicName(topic.GetName()); err != nil {
+		return err
+	}
+	if topic.GetPartitions() == 0 {
+		return fmt.Errorf("topic %q needs at least one partition", topic.GetName())
+	}
+	// Invalid overrides are rejected before they're replicated, rather than
+	// failing on every replica.
+	if _, err := l.topics.partitionConfig(topic.Name, topic.Config); err != nil {
+		return err
+	}
+	_, err := l.apply(CreateTopicRequestType, &api.CreateTopicRequest{Topic: topic})
+	return err
+}
+
+// ConfigureTopic replaces a topic's config overrides on every replica,
+// through Raft.
+func (l *DistributedLog) ConfigureTopic(name string, config *api.TopicConfig) error {
+	if l.config.Raft.Witness {
+		return &api.ErrorNotLeader{}
+	}
+	if _, err := l.topics.partitionConfig(name, config); err != nil {
+		return err
+	}
+	_, err := l.apply(
+		ConfigureTopicRequestType,
+		&api.ConfigureTopicRequest{Topic: name, Config: config},
+	)
+	return err
+}
+
+// ListTopics lists the topics this replica has applied.
+func (l *DistributedLog) ListTopics() ([]*api.Topic, error) {
+	return l.topics.ListTopics()
+}
+
+// Partition returns a topic's partition, whose appends are replicated
+// through Raft and whose reads are served from this replica's copy.
+func (l *DistributedLog) Partition(topic string, partition uint32) (backend.CommitLog, error) {
+	log, err := l.topics.partition(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	return &replicatedPartition{dlog: l, log: log, topic: topic, partition: partition}, nil
+}
+
+var (
+	_ backend.CommitLog     = (*replicatedPartition)(nil)
+	_ backend.Termer        = (*replicatedPartition)(nil)
+	_ backend.Epocher       = (*replicatedPartition)(nil)
+	_ backend.Locator       = (*replicatedPartition)(nil)
+	_ backend.ReverseReader = (*replicatedPartition)(nil)
+	_ backend.Truncater     = (*replicatedPartition)(nil)
+)
+
+// replicatedPartition is a DistributedLog's topic partition. Its records
+// are committed through the same Raft log as the default log's, so they're
+// fenced by the same terms.
+type replicatedPartition struct {
+	dlog      *DistributedLog
+	log       *Log
+	topic     string
+	partition uint32
+}
+
+func (p *replicatedPartition) Append(record *api.Record) (uint64, error) {
+	if p.dlog.config.Raft.Witness {
+		return 0, &api.ErrorNotLeader{}
+	}
+	res, err := p.dlog.apply(
+		AppendRequestType,
+		&api.ProduceRequest{Record: record, Topic: p.topic, Partition: p.partition},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.ProduceResponse).Offset, nil
+}
+
+func (p *replicatedPartition) Read(offset uint64) (*api.Record, error) {
+	return p.log.Read(offset)
+}
+
+func (p *replicatedPartition) ReadRange(from, to uint64, fn func(*api.Record) error) error {
+	return p.log.ReadRange(from, to, fn)
+}
+
+func (p *replicatedPartition) ReadReverse(from, to uint64, fn func(*api.Record) error) error {
+	return p.log.ReadReverse(from, to, fn)
+}
+
+func (p *replicatedPartition) Locate(offset uint64) (*api.RecordLocation, error) {
+	return p.log.Locate(offset)
+}
+
+func (p *replicatedPartition) LowestOffset() (uint64, error) {
+	return p.log.LowestOffset()
+}
+
+func (p *replicatedPartition) HighestOffset() (uint64, error) {
+	return p.log.HighestOffset()
+}
+
+// Truncate removes the partition's segments holding only records up to
+// lowest on every replica, through Raft.
+func (p *replicatedPartition) Truncate(lowest uint64) error {
+	if p.dlog.config.Raft.Witness {
+		return &api.ErrorNotLeader{}
+	}
+	_, err := p.dlog.apply(
+		TruncatePartitionRequestType,
+		&api.PartitionTruncation{Topic: p.topic, Partition: p.partition, Lowest: lowest},
+	)
+	return err
+}
+
+func (p *replicatedPartition) Term() uint64 {
+	return p.dlog.Term()
+}
+
+func (p *replicatedPartition) Epoch() (*api.Epoch, error) {
+	return p.dlog.Epoch()
+}
+
+// applyCreateTopic creates the topic of a create topic request.
+func (l *fsm) applyCreateTopic(b []byte) interface{} {
+	var req api.CreateTopicRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if req.Topic == nil {
+		return fmt.Errorf("%w: create topic request without a topic", ErrMalformedEntry)
+	}
+	if l.witness || l.topics == nil {
+		return &api.CreateTopicResponse{Topic: req.Topic}
+	}
+	if err := l.topics.CreateConfiguredTopic(req.Topic); err != nil {
+		return err
+	}
+	return &api.CreateTopicResponse{Topic: req.Topic}
+}
+
+// applyConfigureTopic replaces the config overrides of a configure topic
+// request's topic.
+func (l *fsm) applyConfigureTopic(b []byte) interface{} {
+	var req api.ConfigureTopicRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if l.witness || l.topics == nil {
+		return &api.ConfigureTopicResponse{}
+	}
+	if err := l.topics.ConfigureTopic(req.Topic, req.Config); err != nil {
+		return err
+	}
+	return &api.ConfigureTopicResponse{}
+}
+
+// applyTruncatePartition removes the oldest segments of a truncation's
+// partition.
+func (l *fsm) applyTruncatePartition(b []byte) interface{} {
+	var req api.PartitionTruncation
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	if l.witness || l.topics == nil {
+		return &req
+	}
+	log, err := l.topics.partition(req.Topic, req.Partition)
+	if err != nil {
+		return err
+	}
+	if err := log.Truncate(req.Lowest); err != nil {
+		return err
+	}
+	return &req
+}
+
+// topicsMagic begins the section of a snapshot that holds its topics,
+// ahead of the default log's records or segment manifest. Snapshots taken
+// before topics were replicated don't have it, and those taken before
+// topics had config overrides begin it with topicsMagicV1 and leave out
+// the overrides.
+var (
+	topicsMagic   = []byte("PLTOPS02")
+	topicsMagicV1 = []byte("PLTOPS01")
+)
+
+// topicsSnapshot pins the topics' partitions as of a snapshot.
+type topicsSnapshot struct {
+	names      []string
+	configs    []*api.TopicConfig
+	partitions [][]*Reader
+}
+
+// snapshot returns a snapshot of the topics, which must be closed.
+func (t *Topics) snapshot() *topicsSnapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s := &topicsSnapshot{}
+	for name := range t.topics {
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	for _, name := range s.names {
+		var readers []*Reader
+		for _, l := range t.topics[name] {
+			readers = append(readers, l.Reader())
+		}
+		s.configs = append(s.configs, t.configs[name])
+		s.partitions = append(s.partitions, readers)
+	}
+	return s
+}
+
+// write writes the topics section of a snapshot: topicsMagic, the number of
+// topics and, for each, its name, its config overrides and its number of
+// partitions, and for each of those its first offset, its number of
+// records and the records, each after its length. A nil snapshot writes
+// nothing.
+func (s *topicsSnapshot) write(w io.Writer) error {
+	if s == nil {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(topicsMagic)
+	_ = binary.Write(bw, enc, uint32(len(s.names)))
+	for i, name := range s.names {
+		_ = binary.Write(bw, enc, uint16(len(name)))
+		bw.WriteString(name)
+		config, err := proto.Marshal(s.configs[i])
+		if err != nil {
+			return err
+		}
+		_ = binary.Write(bw, enc, uint32(len(config)))
+		bw.Write(config)
+		_ = binary.Write(bw, enc, uint32(len(s.partitions[i])))
+		for _, r := range s.partitions[i] {
+			_ = binary.Write(bw, enc, []uint64{r.next, r.remaining()})
+			if _, err := io.Copy(bw, r); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Close unpins the partitions.
+func (s *topicsSnapshot) Close() error {
+	if s == nil {
+		return nil
+	}
+	var err error
+	for _, readers := range s.partitions {
+		for _, r := range readers {
+			if rerr := r.Close(); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+// restoreTopics restores the topics section at the start of r, if r has
+// one, into t: it creates the topics t doesn't have, sets each topic's
+// config overrides to the snapshot's and replaces each partition's records
+// with the snapshot's. Topics are never deleted, so every topic t has is
+// in the section. If t is nil, e.g. on a witness, it reads past the
+// section, keeping nothing.
+func restoreTopics(r *bufio.Reader, t *Topics, maxRecordBytes uint64) error {
+	magic, err := r.Peek(len(topicsMagic))
+	if err != nil {
+		return nil
+	}
+	withConfigs := bytes.Equal(magic, topicsMagic)
+	if !withConfigs && !bytes.Equal(magic, topicsMagicV1) {
+		return nil
+	}
+	if _, err := r.Discard(len(magic)); err != nil {
+		return err
+	}
+
+	var topics uint32
+	if err := binary.Read(r, enc, &topics); err != nil {
+		return err
+	}
+	for ; topics > 0; topics-- {
+		var size uint16
+		if err := binary.Read(r, enc, &size); err != nil {
+			return err
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return err
+		}
+		var config *api.TopicConfig
+		if withConfigs {
+			if config, err = readSnapshotTopicConfig(r); err != nil {
+				return err
+			}
+		}
+		var partitions uint32
+		if err := binary.Read(r, enc, &partitions); err != nil {
+			return err
+		}
+		if t != nil {
+			// The snapshot's api.TopicEventsTopic already records its
+			// topics' changes.
+			err := t.createTopic(&api.Topic{
+				Name:       string(name),
+				Partitions: partitions,
+				Config:     config,
+			}, false)
+			if _, exists := err.(*api.ErrorTopicExists); exists {
+				err = t.configureTopic(string(name), config, false)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for p := uint32(0); p < partitions; p++ {
+			if err := restorePartition(r, t, string(name), p, maxRecordBytes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readSnapshotTopicConfig reads a topic's config overrides, after their
+// length, from the topics section of a snapshot.
+func readSnapshotTopicConfig(r io.Reader) (*api.TopicConfig, error) {
+	var size uint32
+	if err := binary.Read(r, enc, &size); err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	config := &api.TopicConfig{}
+	if err := proto.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// restorePartition replaces a partition's records with those that follow
+// in r, or reads past them if t is nil.
+func restorePartition(r io.Reader, t *Topics, topic string, partition uint32, maxRecordBytes uint64) error {
+	header := make([]uint64, 2)
+	if err := binary.Read(r, enc, header); err != nil {
+		return err
+	}
+	base, count := header[0], header[1]
+
+	var l *Log
+	if t != nil {
+		var err error
+		if l, err = t.partition(topic, partition); err != nil {
+			return err
+		}
+		l.Config.Segment.InitialOffset = base
+		if err := l.Reset(); err != nil {
+			return err
+		}
+	}
+	for ; count > 0; count-- {
+		p, err := readRecord(r, maxRecordBytes)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			continue
+		}
+		record := &api.Record{}
+		if err := proto.Unmarshal(p, record); err != nil {
+			return err
+		}
+		if _, err := l.Append(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
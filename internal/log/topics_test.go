@@ -0,0 +1,190 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTopics(t *testing.T) {
+	dir := t.TempDir()
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	topics, err := NewTopics(dir, c)
+	require.NoError(t, err)
+
+	require.NoError(t, topics.CreateTopic("orders", 2))
+	require.NoError(t, topics.CreateTopic("audit", 1))
+	err = topics.CreateTopic("orders", 3)
+	require.Equal(t, &api.ErrorTopicExists{Topic: "orders"}, err)
+	require.Error(t, topics.CreateTopic("../escape", 1))
+	require.Error(t, topics.CreateTopic("empty", 0))
+
+	list, err := topics.ListTopics()
+	require.NoError(t, err)
+	require.Equal(t, []*api.Topic{
+		{Name: api.TopicEventsTopic, Partitions: 1},
+		{Name: "audit", Partitions: 1},
+		{Name: "orders", Partitions: 2},
+	}, list)
+
+	// Partitions are independent logs with their own offsets.
+	for p := uint32(0); p < 2; p++ {
+		clog, err := topics.Partition("orders", p)
+		require.NoError(t, err)
+		for i := uint32(0); i <= p; i++ {
+			off, err := clog.Append(&api.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+			require.Equal(t, uint64(i), off)
+		}
+	}
+	_, err = topics.Partition("orders", 2)
+	require.Equal(t, &api.ErrorUnknownTopic{Topic: "orders", Partition: 2}, err)
+	_, err = topics.Partition("missing", 0)
+	require.Equal(t, &api.ErrorUnknownTopic{Topic: "missing"}, err)
+
+	// Topics and their records survive a restart, and a topic a crash
+	// left half created doesn't.
+	require.NoError(t, topics.Close())
+	require.NoError(t, os.MkdirAll(path.Join(dir, topicsDir, ".half-123", "0"), 0755))
+	topics, err = NewTopics(dir, c)
+	require.NoError(t, err)
+	defer topics.Close()
+	list, err = topics.ListTopics()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	clog, err := topics.Partition("orders", 1)
+	require.NoError(t, err)
+	highest, err := clog.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), highest)
+	_, err = os.Stat(path.Join(dir, topicsDir, ".half-123"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestTopicsBesideLog(t *testing.T) {
+	// A log in the data directory doesn't take the topics for orphans.
+	dir := t.TempDir()
+	topics, err := NewTopics(dir, Config{})
+	require.NoError(t, err)
+	require.NoError(t, topics.CreateTopic("orders", 1))
+	require.NoError(t, topics.Close())
+
+	log, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+	_, err = os.Stat(path.Join(dir, topicsDir, "orders", "0"))
+	require.NoError(t, err)
+}
+
+func TestInternalTopicsSkipRetention(t *testing.T) {
+	c := Config{}
+	c.Retention.MaxBytes = 1
+	topics, err := NewTopics(t.TempDir(), c)
+	require.NoError(t, err)
+	defer topics.Close()
+	require.NoError(t, topics.CreateTopic("orders", 1))
+	require.NoError(t, topics.CreateTopic("__consumer_offsets", 1))
+
+	for name, want := range map[string]uint64{"orders": 1, "__consumer_offsets": 0} {
+		l, err := topics.partition(name, 0)
+		require.NoError(t, err)
+		require.Equal(t, want, l.Config.Retention.MaxBytes, name)
+	}
+}
+
+func TestTopicConfig(t *testing.T) {
+	dir := t.TempDir()
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	topics, err := NewTopics(dir, c)
+	require.NoError(t, err)
+
+	config := &api.TopicConfig{SegmentMaxStoreBytes: 8, RetentionMaxBytes: 64}
+	require.NoError(t, topics.CreateConfiguredTopic(&api.Topic{Name: "orders", Partitions: 2, Config: config}))
+	require.NoError(t, topics.CreateTopic("audit", 1))
+	err = topics.CreateConfiguredTopic(&api.Topic{
+		Name:       "invalid",
+		Partitions: 1,
+		Config:     &api.TopicConfig{SegmentMaxIndexBytes: 1},
+	})
+	require.Error(t, err)
+	_, err = topics.Partition("invalid", 0)
+	require.IsType(t, &api.ErrorUnknownTopic{}, err)
+
+	// A topic's partitions take its overrides over the node's settings, and
+	// other topics keep the node's.
+	orders, err := topics.partition("orders", 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), orders.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(64), orders.Config.Retention.MaxBytes)
+	audit, err := topics.partition("audit", 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), audit.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(0), audit.Config.Retention.MaxBytes)
+
+	// The overrides survive a restart.
+	require.NoError(t, topics.Close())
+	topics, err = NewTopics(dir, c)
+	require.NoError(t, err)
+	defer topics.Close()
+	list, err := topics.ListTopics()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.Nil(t, list[1].Config)
+	require.True(t, proto.Equal(config, list[2].Config))
+
+	// Configuring a topic replaces its overrides on its open partitions.
+	orders, err = topics.partition("orders", 1)
+	require.NoError(t, err)
+	config = &api.TopicConfig{RetentionMaxAgeMs: 60000}
+	require.NoError(t, topics.ConfigureTopic("orders", config))
+	require.Equal(t, uint64(1024), orders.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(0), orders.Config.Retention.MaxBytes)
+	require.Equal(t, time.Minute, orders.Config.Retention.MaxAge)
+	require.NotNil(t, orders.stopRetention)
+	list, err = topics.ListTopics()
+	require.NoError(t, err)
+	require.True(t, proto.Equal(config, list[2].Config))
+
+	require.NoError(t, topics.ConfigureTopic("orders", nil))
+	require.Nil(t, orders.stopRetention)
+	err = topics.ConfigureTopic("missing", config)
+	require.Equal(t, &api.ErrorUnknownTopic{Topic: "missing"}, err)
+}
+
+func TestTopicEvents(t *testing.T) {
+	topics, err := NewTopics(t.TempDir(), Config{})
+	require.NoError(t, err)
+	defer topics.Close()
+
+	config := &api.TopicConfig{RetentionMaxAgeMs: 60000}
+	require.NoError(t, topics.CreateTopic("orders", 2))
+	require.NoError(t, topics.CreateTopic("__consumer_offsets", 1))
+	require.NoError(t, topics.ConfigureTopic("orders", config))
+	require.Error(t, topics.CreateTopic("orders", 1))
+
+	// Changes are recorded in the order they're made, as of each change,
+	// leaving out internal topics' and failed ones.
+	events, err := topics.partition(api.TopicEventsTopic, 0)
+	require.NoError(t, err)
+	want := []*api.TopicEvent{
+		{Type: api.TopicEvent_CREATED, Topic: &api.Topic{Name: "orders", Partitions: 2}},
+		{Type: api.TopicEvent_CONFIGURED, Topic: &api.Topic{Name: "orders", Partitions: 2, Config: config}},
+	}
+	next, err := events.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(want)-1), next)
+	for i, w := range want {
+		record, err := events.Read(uint64(i))
+		require.NoError(t, err)
+		event := &api.TopicEvent{}
+		require.NoError(t, proto.Unmarshal(record.Value, event))
+		require.True(t, proto.Equal(w, event), "event %d: %v", i, event)
+	}
+}
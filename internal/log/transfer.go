@@ -0,0 +1,502 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SegmentRPC starts connections that fetch sealed segment files. They share
+// the Raft port, like RaftRPC connections, and are told apart by this byte.
+const SegmentRPC = 2
+
+// RangeRPC starts connections that fetch the records of an offset range,
+// to repair corrupt copies of them. The segment server serves them too.
+const RangeRPC = 3
+
+const (
+	segmentFound   byte = 0
+	segmentMissing byte = 1
+
+	// maxSegmentRequest bounds how many segments one connection asks for.
+	maxSegmentRequest = 1 << 16
+	// maxRangeRequest bounds how many records one connection asks for.
+	maxRangeRequest = 1 << 20
+	// segmentIdleTimeout bounds how long a fetch waits on a quiet peer.
+	segmentIdleTimeout = 30 * time.Second
+)
+
+// ErrSegmentChecksum is returned when a fetched segment's files don't match
+// the checksum the peer sent with them.
+var ErrSegmentChecksum = errors.New("segment checksum mismatch")
+
+// ErrMalformedManifest is returned when restoring a snapshot whose segment
+// manifest doesn't list contiguous, non-empty segments ending at or before
+// its next offset.
+var ErrMalformedManifest = errors.New("malformed segment manifest")
+
+// segmentRange is the offsets a segment holds, from base up to, but not
+// including, next.
+type segmentRange struct {
+	base, next uint64
+}
+
+// SegmentDialer opens a connection to the segment server at addr.
+type SegmentDialer func(ctx context.Context, addr string) (net.Conn, error)
+
+func dialSegments(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// SegmentServer serves a log's sealed segment files to peers catching up, so
+// they copy whole files rather than replaying every record.
+//
+// A peer writes SegmentRPC, the number of segments it wants and each one's
+// base offset. For each, the server writes segmentMissing if it doesn't have
+// the segment sealed, or segmentFound, the segment's next offset, the sizes
+// of its store and index, the two files and a SHA-256 of both.
+//
+// A peer repairing records writes RangeRPC and the offsets it wants, from
+// and to. The server writes segmentMissing if its log doesn't hold them
+// all, or segmentFound and each record, framed as in a store with its
+// CRC-32C.
+type SegmentServer struct {
+	Log *Log
+	// BytesPerSecond throttles each transfer so catch-up doesn't starve
+	// the node's own traffic. Zero doesn't throttle.
+	BytesPerSecond int64
+}
+
+// Serve serves transfers on connections accepted from ln until ln closes.
+func (s *SegmentServer) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *SegmentServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(segmentIdleTimeout))
+	r := bufio.NewReader(conn)
+	b, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	switch b {
+	case SegmentRPC:
+		s.serveSegments(conn, r)
+	case RangeRPC:
+		s.serveRange(conn, r)
+	}
+}
+
+func (s *SegmentServer) serveSegments(conn net.Conn, r *bufio.Reader) {
+	var n uint32
+	if err := binary.Read(r, enc, &n); err != nil || n > maxSegmentRequest {
+		return
+	}
+	bases := make([]uint64, n)
+	if err := binary.Read(r, enc, bases); err != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	w := bufio.NewWriter(throttle(conn, s.BytesPerSecond))
+	for _, base := range bases {
+		if err := s.writeSegment(w, base); err != nil {
+			return
+		}
+	}
+	_ = w.Flush()
+}
+
+func (s *SegmentServer) serveRange(conn net.Conn, r *bufio.Reader) {
+	bounds := make([]uint64, 2)
+	if err := binary.Read(r, enc, bounds); err != nil {
+		return
+	}
+	from, to := bounds[0], bounds[1]
+	if to < from || to-from > maxRangeRequest {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	w := bufio.NewWriter(throttle(conn, s.BytesPerSecond))
+	if !s.holds(from, to) {
+		_ = w.WriteByte(segmentMissing)
+		_ = w.Flush()
+		return
+	}
+	_ = w.WriteByte(segmentFound)
+	err := s.Log.ReadRange(from, to, func(record *api.Record) error {
+		p, err := proto.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// A record the size of a frame or larger is framed the same way,
+		// since the peer reads it back whole.
+		if err := binary.Write(w, enc, uint64(len(p))|checksummed); err != nil {
+			return err
+		}
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+		return binary.Write(w, enc, crc32.Checksum(p, crcTable))
+	})
+	// A failed read leaves the peer short of records.
+	if err == nil {
+		_ = w.Flush()
+	}
+}
+
+// holds reports whether the server's log holds every offset from up to,
+// but not including, to.
+func (s *SegmentServer) holds(from, to uint64) bool {
+	lowest, err := s.Log.LowestOffset()
+	if err != nil || from < lowest {
+		return false
+	}
+	highest, err := s.Log.HighestOffset()
+	if err != nil {
+		return false
+	}
+	if to <= highest {
+		return true
+	}
+	_, err = s.Log.Read(to - 1)
+	return to == highest+1 && err == nil
+}
+
+func (s *SegmentServer) writeSegment(w *bufio.Writer, base uint64) error {
+	seg := s.Log.sealed(base)
+	if seg == nil {
+		return w.WriteByte(segmentMissing)
+	}
+	defer seg.release()
+	store, err := seg.store.section()
+	if err != nil {
+		return err
+	}
+	index := seg.index.section()
+
+	if err := w.WriteByte(segmentFound); err != nil {
+		return err
+	}
+	header := []uint64{seg.nextOffset, uint64(store.Size()), uint64(index.Size())}
+	if err := binary.Write(w, enc, header); err != nil {
+		return err
+	}
+	h := sha256.New()
+	for _, f := range []*io.SectionReader{store, index} {
+		if _, err := io.Copy(io.MultiWriter(w, h), f); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(h.Sum(nil))
+	return err
+}
+
+// fetchSegments copies the segments in want from the segment server at addr
+// into dir. It returns how many it fetched, in order, before failing.
+func fetchSegments(ctx context.Context, dial SegmentDialer, addr, dir string, want []segmentRange) (int, error) {
+	if dial == nil {
+		dial = dialSegments
+	}
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	w := bufio.NewWriter(conn)
+	_ = w.WriteByte(SegmentRPC)
+	_ = binary.Write(w, enc, uint32(len(want)))
+	for _, seg := range want {
+		_ = binary.Write(w, enc, seg.base)
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(&idleReader{conn: conn})
+	for i, seg := range want {
+		if err := readSegment(r, dir, seg); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return i, fmt.Errorf("segment %d: %w", seg.base, err)
+		}
+	}
+	return len(want), nil
+}
+
+// fetchRange fetches the records from offset from up to, but not including,
+// to from the segment server at addr.
+func fetchRange(ctx context.Context, dial SegmentDialer, addr string, from, to uint64) ([]*api.Record, error) {
+	if dial == nil {
+		dial = dialSegments
+	}
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	w := bufio.NewWriter(conn)
+	_ = w.WriteByte(RangeRPC)
+	_ = binary.Write(w, enc, []uint64{from, to})
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(&idleReader{conn: conn})
+	status, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if status != segmentFound {
+		return nil, errors.New("peer doesn't hold the records")
+	}
+	var records []*api.Record
+	for off := from; off < to; off++ {
+		p, err := readRecord(r, 0)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return nil, fmt.Errorf("record %d: %w", off, err)
+		}
+		record := &api.Record{}
+		if err := proto.Unmarshal(p, record); err != nil {
+			return nil, fmt.Errorf("record %d: %w", off, err)
+		}
+		if record.Offset != off {
+			return nil, fmt.Errorf("peer sent record %d for %d", record.Offset, off)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readSegment reads one segment's reply into its files in dir and checks
+// it's the segment wanted.
+func readSegment(r *bufio.Reader, dir string, want segmentRange) error {
+	status, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if status != segmentFound {
+		return errors.New("peer doesn't have it sealed")
+	}
+	header := make([]uint64, 3)
+	if err := binary.Read(r, enc, header); err != nil {
+		return err
+	}
+	next, storeBytes, indexBytes := header[0], header[1], header[2]
+	if next != want.next {
+		return fmt.Errorf("peer's ends at offset %d, not %d", next, want.next)
+	}
+	if indexBytes != (next-want.base)*entWidth {
+		return fmt.Errorf("index of %d bytes doesn't hold %d entries", indexBytes, next-want.base)
+	}
+
+	h := sha256.New()
+	for _, f := range []struct {
+		ext  string
+		size uint64
+	}{{".store", storeBytes}, {".index", indexBytes}} {
+		if err := receiveFile(segmentPath(dir, want.base, f.ext), io.TeeReader(r, h), f.size); err != nil {
+			return err
+		}
+	}
+	sum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, sum); err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, h.Sum(nil)) {
+		return ErrSegmentChecksum
+	}
+	return nil
+}
+
+func receiveFile(name string, r io.Reader, size uint64) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, int64(size)); err != nil {
+		f.Close()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// idleReader fails reads once the peer has sent nothing for
+// segmentIdleTimeout, however long the whole transfer takes.
+type idleReader struct {
+	conn net.Conn
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(segmentIdleTimeout)); err != nil {
+		return 0, err
+	}
+	return r.conn.Read(p)
+}
+
+// throttle limits writes to w to about bytesPerSecond, or returns w itself
+// if that's zero.
+func throttle(w io.Writer, bytesPerSecond int64) io.Writer {
+	if bytesPerSecond <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, rate: bytesPerSecond, start: time.Now()}
+}
+
+type throttledWriter struct {
+	w       io.Writer
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// Write a tenth of a second's worth at a time so the rate stays
+		// smooth rather than bursting.
+		chunk := p[:min(int64(len(p)), max(t.rate/10, 1))]
+		m, err := t.w.Write(chunk)
+		n += m
+		t.written += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+
+		due := t.start.Add(time.Duration(float64(t.written) / float64(t.rate) * float64(time.Second)))
+		if d := time.Until(due); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	return n, nil
+}
+
+// manifestMagic begins snapshots that list sealed segments rather than
+// carrying their records. Snapshots of records begin with a record's
+// length, which is never this large.
+var manifestMagic = []byte("PLSEGS01")
+
+// segmentManifest lists the sealed segments a snapshot holds and the
+// addresses of the replicas to fetch them from. The records after them
+// follow it in the snapshot.
+type segmentManifest struct {
+	sources  []string
+	segments []segmentRange
+	next     uint64
+}
+
+func (m *segmentManifest) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.Write(manifestMagic)
+	_ = binary.Write(&buf, enc, uint32(len(m.sources)))
+	for _, addr := range m.sources {
+		_ = binary.Write(&buf, enc, uint16(len(addr)))
+		buf.WriteString(addr)
+	}
+	_ = binary.Write(&buf, enc, uint32(len(m.segments)))
+	for _, seg := range m.segments {
+		_ = binary.Write(&buf, enc, []uint64{seg.base, seg.next})
+	}
+	_ = binary.Write(&buf, enc, m.next)
+	return buf.WriteTo(w)
+}
+
+// readManifest reads the manifest at the start of r, or returns nil if r
+// doesn't start with one.
+func readManifest(r *bufio.Reader) (*segmentManifest, error) {
+	magic, err := r.Peek(len(manifestMagic))
+	if err != nil || !bytes.Equal(magic, manifestMagic) {
+		return nil, nil
+	}
+	if _, err := r.Discard(len(magic)); err != nil {
+		return nil, err
+	}
+
+	m := &segmentManifest{}
+	var n uint32
+	if err := binary.Read(r, enc, &n); err != nil {
+		return nil, err
+	}
+	for ; n > 0; n-- {
+		var size uint16
+		if err := binary.Read(r, enc, &size); err != nil {
+			return nil, err
+		}
+		addr := make([]byte, size)
+		if _, err := io.ReadFull(r, addr); err != nil {
+			return nil, err
+		}
+		m.sources = append(m.sources, string(addr))
+	}
+	if err := binary.Read(r, enc, &n); err != nil {
+		return nil, err
+	}
+	for ; n > 0; n-- {
+		seg := make([]uint64, 2)
+		if err := binary.Read(r, enc, seg); err != nil {
+			return nil, err
+		}
+		m.segments = append(m.segments, segmentRange{seg[0], seg[1]})
+	}
+	if err := binary.Read(r, enc, &m.next); err != nil {
+		return nil, err
+	}
+
+	next := uint64(0)
+	if len(m.segments) > 0 {
+		next = m.segments[0].base
+	}
+	for _, seg := range m.segments {
+		if seg.base != next || seg.next <= seg.base {
+			return nil, ErrMalformedManifest
+		}
+		next = seg.next
+	}
+	if m.next < next {
+		return nil, ErrMalformedManifest
+	}
+	return m, nil
+}
@@ -0,0 +1,198 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSegmentTransfer(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, source *Log, addr string){
+		"fetch sealed segments":           testFetchSegments,
+		"restore a snapshot of segments":  testRestoreSegments,
+		"active segment can't be fetched": testFetchActiveSegment,
+		"corrupted segments are rejected": testFetchCorrupted,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			source := newTransferLog(t)
+			for i := 0; i < 5; i++ {
+				_, err := source.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer ln.Close()
+			go (&SegmentServer{Log: source}).Serve(ln)
+
+			fn(t, source, ln.Addr().String())
+		})
+	}
+}
+
+// newTransferLog returns a log in a directory of its own, whose segments
+// hold two records each.
+func newTransferLog(t testing.TB) *Log {
+	dir, err := ioutil.TempDir("", "transfer-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// Leave room beside the log for install's staging directory.
+	dir = path.Join(dir, "log")
+	require.NoError(t, os.Mkdir(dir, 0755))
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = entWidth * 2
+	l, err := NewLog(dir, c)
+	require.NoError(t, err)
+	return l
+}
+
+func testFetchSegments(t *testing.T, source *Log, addr string) {
+	sealed, next, active := source.sealedRanges()
+	require.NoError(t, active.Close())
+	require.Equal(t, []segmentRange{{0, 2}, {2, 4}}, sealed)
+	require.Equal(t, uint64(4), next)
+
+	target := newTransferLog(t)
+	err := target.install(sealed, next, func(dir string, missing []segmentRange) error {
+		n, err := fetchSegments(context.Background(), nil, addr, dir, missing)
+		require.Equal(t, len(missing), n)
+		return err
+	})
+	require.NoError(t, err)
+
+	for off := uint64(0); off < next; off++ {
+		record, err := target.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello world"), record.Value)
+	}
+	off, err := target.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, next, off)
+}
+
+func testRestoreSegments(t *testing.T, source *Log, addr string) {
+	source.Config.SegmentTransfer.Enabled = true
+	from := &fsm{log: source, logger: zap.NewNop(), localAddr: addr}
+	snap, err := from.Snapshot()
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(snap.(*snapshot).reader)
+	require.NoError(t, err)
+
+	target := newTransferLog(t)
+	to := &fsm{log: target, logger: zap.NewNop(), localAddr: "127.0.0.1:1"}
+	require.NoError(t, to.Restore(io.NopCloser(bytes.NewReader(b))))
+	require.Equal(t, []string{addr}, to.servers)
+
+	highest, err := target.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), highest)
+	for off := uint64(0); off <= highest; off++ {
+		record, err := target.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+	}
+
+	// Restoring again keeps the segments it has instead of fetching them.
+	to.localAddr = addr
+	require.NoError(t, to.Restore(io.NopCloser(bytes.NewReader(b))))
+	highest, err = target.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), highest)
+}
+
+func testFetchActiveSegment(t *testing.T, source *Log, addr string) {
+	n, err := fetchSegments(context.Background(), nil, addr, t.TempDir(), []segmentRange{{4, 5}})
+	require.Error(t, err)
+	require.Equal(t, 0, n)
+}
+
+func testFetchCorrupted(t *testing.T, source *Log, addr string) {
+	// Flip a byte of the reply on its way to the client.
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := dialSegments(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &corruptingConn{Conn: conn, at: 1 + 3*8 + 1}, nil
+	}
+	_, err := fetchSegments(context.Background(), dial, addr, t.TempDir(), []segmentRange{{0, 2}})
+	require.ErrorIs(t, err, ErrSegmentChecksum)
+}
+
+type corruptingConn struct {
+	net.Conn
+	at   int
+	read int
+}
+
+func (c *corruptingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.at >= c.read && c.at < c.read+n {
+		p[c.at-c.read] ^= 0xff
+	}
+	c.read += n
+	return n, err
+}
+
+func TestSegmentManifest(t *testing.T) {
+	want := &segmentManifest{
+		sources:  []string{"127.0.0.1:8400", "127.0.0.1:8500"},
+		segments: []segmentRange{{0, 16}, {16, 32}},
+		next:     32,
+	}
+	var buf bytes.Buffer
+	_, err := want.WriteTo(&buf)
+	require.NoError(t, err)
+	buf.WriteString("records")
+
+	r := bufio.NewReader(&buf)
+	got, err := readManifest(r)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	rest, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "records", string(rest))
+
+	// Snapshots of records start with a record's length instead.
+	buf.Reset()
+	require.NoError(t, binary.Write(&buf, enc, uint64(11)))
+	got, err = readManifest(bufio.NewReader(&buf))
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	// Segments must follow each other without gaps, up to next.
+	for _, bad := range []*segmentManifest{
+		{segments: []segmentRange{{0, 16}, {20, 32}}, next: 32},
+		{segments: []segmentRange{{0, 16}, {16, 16}}, next: 32},
+		{segments: []segmentRange{{0, 16}, {16, 32}}, next: 20},
+	} {
+		buf.Reset()
+		_, err = bad.WriteTo(&buf)
+		require.NoError(t, err)
+		_, err = readManifest(bufio.NewReader(&buf))
+		require.Equal(t, ErrMalformedManifest, err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Now()
+	_, err := throttle(&buf, 10_000).Write(make([]byte, 3_000))
+	require.NoError(t, err)
+	require.Equal(t, 3_000, buf.Len())
+	require.True(t, time.Since(start) >= 250*time.Millisecond)
+}
@@ -0,0 +1,122 @@
+// Package metrics keeps a node's counters and gauges and pushes them to a
+// collector, for environments where nothing can scrape the node.
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kind is how a metric's value behaves over time.
+type Kind int
+
+const (
+	// KindCounter values only go up, from zero when the node starts.
+	KindCounter Kind = iota
+	// KindGauge values are a measurement taken when the metric is read.
+	KindGauge
+)
+
+// Sample is a metric's value at one point in time.
+type Sample struct {
+	Name  string
+	Kind  Kind
+	Value float64
+}
+
+// Counter is a count that only goes up. It's safe for concurrent use.
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// Registry holds a node's metrics by name.
+type Registry struct {
+	mu       sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]func() float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters: make(map[string]*Counter),
+		gauges:   make(map[string]func() float64),
+	}
+}
+
+// Counter returns the counter called name, creating it if it doesn't exist.
+func (r *Registry) Counter(name string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[name]
+	if !ok {
+		c = &Counter{}
+		r.counters[name] = c
+	}
+	return c
+}
+
+// Gauge registers fn to measure the gauge called name, replacing any fn
+// registered before.
+func (r *Registry) Gauge(name string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = fn
+}
+
+// Snapshot reads every metric, sorted by name.
+func (r *Registry) Snapshot() []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	samples := make([]Sample, 0, len(r.counters)+len(r.gauges))
+	for name, c := range r.counters {
+		samples = append(samples, Sample{Name: name, Kind: KindCounter, Value: float64(c.Value())})
+	}
+	for name, fn := range r.gauges {
+		samples = append(samples, Sample{Name: name, Kind: KindGauge, Value: fn()})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+	return samples
+}
+
+// Pusher sends samples to a collector.
+type Pusher interface {
+	Push(ctx context.Context, samples []Sample) error
+	Close() error
+}
+
+// Push pushes a snapshot of r to p every interval until ctx is done. Failed
+// pushes are logged and retried with the next snapshot.
+func Push(ctx context.Context, r *Registry, p Pusher, interval time.Duration) {
+	logger := zap.L().Named("metrics")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Push(ctx, r.Snapshot()); err != nil && ctx.Err() == nil {
+			logger.Error("failed to push metrics", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("records_produced").Add(2)
+	r.Counter("records_produced").Inc()
+	r.Gauge("highest_offset", func() float64 { return 7 })
+
+	require.Equal(t, []Sample{
+		{Name: "highest_offset", Kind: KindGauge, Value: 7},
+		{Name: "records_produced", Kind: KindCounter, Value: 3},
+	}, r.Snapshot())
+}
+
+func TestStatsdPusher(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	p, err := NewStatsdPusher(conn.LocalAddr().String(), "prolog.")
+	require.NoError(t, err)
+	defer p.Close()
+
+	read := func() []string {
+		buf := make([]byte, maxStatsdPacket)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	ctx := context.Background()
+	r := NewRegistry()
+	r.Counter("records_produced").Add(3)
+	r.Gauge("highest_offset", func() float64 { return 2 })
+	require.NoError(t, p.Push(ctx, r.Snapshot()))
+	require.Equal(t, []string{
+		"prolog.highest_offset:2|g",
+		"prolog.records_produced:3|c",
+	}, read())
+
+	// Counters are sent as their increase since the last push.
+	r.Counter("records_produced").Add(2)
+	require.NoError(t, p.Push(ctx, r.Snapshot()))
+	require.Equal(t, []string{
+		"prolog.highest_offset:2|g",
+		"prolog.records_produced:2|c",
+	}, read())
+}
+
+type collector struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	reqs chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (c *collector) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	c.reqs <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPPusher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	c := &collector{reqs: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	colmetricspb.RegisterMetricsServiceServer(srv, c)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	p, err := NewOTLPPusher(
+		ln.Addr().String(),
+		"node-0",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	r := NewRegistry()
+	r.Counter("records_produced").Add(3)
+	r.Gauge("highest_offset", func() float64 { return 2 })
+	require.NoError(t, p.Push(context.Background(), r.Snapshot()))
+
+	req := <-c.reqs
+	rm := req.ResourceMetrics[0]
+	require.Equal(t, "node-0", rm.Resource.Attributes[1].Value.GetStringValue())
+	metrics := rm.ScopeMetrics[0].Metrics
+	require.Equal(t, "highest_offset", metrics[0].Name)
+	require.Equal(t, 2.0, metrics[0].GetGauge().DataPoints[0].GetAsDouble())
+	require.Equal(t, "records_produced", metrics[1].Name)
+	require.True(t, metrics[1].GetSum().IsMonotonic)
+	require.Equal(t, 3.0, metrics[1].GetSum().DataPoints[0].GetAsDouble())
+}
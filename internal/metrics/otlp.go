@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+)
+
+var _ Pusher = (*OTLPPusher)(nil)
+
+// OTLPPusher exports samples to an OpenTelemetry collector over OTLP/gRPC.
+// Counters are exported as cumulative monotonic sums starting when the
+// pusher was created.
+type OTLPPusher struct {
+	conn     *grpc.ClientConn
+	client   colmetricspb.MetricsServiceClient
+	resource *resourcepb.Resource
+	start    time.Time
+}
+
+// NewOTLPPusher dials the collector at target. Samples are exported as
+// coming from the service.instance.id instance of the prolog service.
+func NewOTLPPusher(target, instance string, opts ...grpc.DialOption) (*OTLPPusher, error) {
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPPusher{
+		conn:   conn,
+		client: colmetricspb.NewMetricsServiceClient(conn),
+		resource: &resourcepb.Resource{
+			Attributes: []*commonpb.KeyValue{
+				{Key: "service.name", Value: stringValue("prolog")},
+				{Key: "service.instance.id", Value: stringValue(instance)},
+			},
+		},
+		start: time.Now(),
+	}, nil
+}
+
+func (p *OTLPPusher) Push(ctx context.Context, samples []Sample) error {
+	now := uint64(time.Now().UnixNano())
+	metrics := make([]*metricspb.Metric, 0, len(samples))
+	for _, s := range samples {
+		point := &metricspb.NumberDataPoint{
+			TimeUnixNano: now,
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: s.Value},
+		}
+		metric := &metricspb.Metric{Name: s.Name}
+		switch s.Kind {
+		case KindCounter:
+			point.StartTimeUnixNano = uint64(p.start.UnixNano())
+			metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				DataPoints:             []*metricspb.NumberDataPoint{point},
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}}
+		case KindGauge:
+			metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{point},
+			}}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	_, err := p.client.Export(ctx, &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: p.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "github.com/Tarunshrma/prolog"},
+				Metrics: metrics,
+			}},
+		}},
+	})
+	return err
+}
+
+func (p *OTLPPusher) Close() error {
+	return p.conn.Close()
+}
+
+func stringValue(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
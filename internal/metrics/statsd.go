@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+var _ Pusher = (*StatsdPusher)(nil)
+
+// StatsdPusher sends samples to a statsd server over UDP. Counters are sent
+// as the increase since the last push and gauges as their current value.
+type StatsdPusher struct {
+	conn   net.Conn
+	prefix string
+	last   map[string]float64
+}
+
+// maxStatsdPacket keeps packets under the usual network MTU.
+const maxStatsdPacket = 1432
+
+// NewStatsdPusher sends samples to addr, with their names prefixed by
+// prefix, e.g. "prolog.".
+func NewStatsdPusher(addr, prefix string) (*StatsdPusher, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdPusher{
+		conn:   conn,
+		prefix: prefix,
+		last:   make(map[string]float64),
+	}, nil
+}
+
+func (p *StatsdPusher) Push(ctx context.Context, samples []Sample) error {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		var line string
+		switch s.Kind {
+		case KindCounter:
+			delta := s.Value - p.last[s.Name]
+			p.last[s.Name] = s.Value
+			if delta == 0 {
+				continue
+			}
+			line = fmt.Sprintf("%s%s:%s|c", p.prefix, s.Name, formatFloat(delta))
+		case KindGauge:
+			line = fmt.Sprintf("%s%s:%s|g", p.prefix, s.Name, formatFloat(s.Value))
+		}
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxStatsdPacket {
+			if _, err := p.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := p.conn.Write(buf.Bytes())
+	return err
+}
+
+func (p *StatsdPusher) Close() error {
+	return p.conn.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
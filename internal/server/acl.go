@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+)
+
+// Action is what a data-plane RPC does with the log, which an ACL grants
+// clients.
+type Action string
+
+const (
+	// ActionProduce appends records and creates topics.
+	ActionProduce Action = "produce"
+	// ActionConsume reads records and tracks consumer groups' offsets,
+	// members and assignments.
+	ActionConsume Action = "consume"
+)
+
+// AnySubject in an ACL grants an action to every client, including those
+// without a certificate.
+const AnySubject = "*"
+
+// action returns the action method needs, and false if the ACL doesn't
+// govern it: cluster and admin RPCs aren't data-plane RPCs.
+func action(method string) (Action, bool) {
+	switch {
+	case !dataPlane(method):
+		return "", false
+	case produces(method), method == api.Log_CreateTopic_FullMethodName:
+		return ActionProduce, true
+	default:
+		return ActionConsume, true
+	}
+}
+
+// ACL authorizes clients' data-plane RPCs. Clients are known by the common
+// name of the TLS certificate they present, so ACLs need the server to
+// verify client certificates; those without one are the empty subject.
+// RPCs needing an action the client wasn't granted fail with an
+// api.ErrorNotAuthorized.
+type ACL struct {
+	// IsPeer reports whether identity, a certificate's common name, is one
+	// of the cluster's nodes, which may call every RPC.
+	IsPeer func(identity string) bool
+
+	mu     sync.RWMutex
+	grants map[string]map[Action]bool
+}
+
+// NewACL returns an ACL granting nothing.
+func NewACL() *ACL {
+	return &ACL{grants: make(map[string]map[Action]bool)}
+}
+
+// LoadACL reads an ACL from a policy file, which grants an action per line
+// as "subject,action", e.g. "billing,consume". Lines starting with '#' are
+// comments.
+func LoadACL(path string) (*ACL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	acl := NewACL()
+	for {
+		grant, err := r.Read()
+		if err == io.EOF {
+			return acl, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("acl %s: %w", path, err)
+		}
+		subject, act := strings.TrimSpace(grant[0]), Action(strings.TrimSpace(grant[1]))
+		if act != ActionProduce && act != ActionConsume {
+			line, _ := r.FieldPos(1)
+			return nil, fmt.Errorf("acl %s:%d: unknown action %q", path, line, act)
+		}
+		acl.Allow(subject, act)
+	}
+}
+
+// Allow grants subject the action.
+func (a *ACL) Allow(subject string, action Action) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.grants[subject] == nil {
+		a.grants[subject] = make(map[Action]bool)
+	}
+	a.grants[subject][action] = true
+}
+
+// allowed reports whether subject was granted action.
+func (a *ACL) allowed(subject string, action Action) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.grants[subject][action] || a.grants[AnySubject][action]
+}
+
+func (a *ACL) authorize(ctx context.Context, method string) error {
+	if a == nil {
+		return nil
+	}
+	act, ok := action(method)
+	if !ok {
+		return nil
+	}
+	subject := subject(ctx)
+	if a.allowed(subject, act) {
+		return nil
+	}
+	if subject != "" && a.IsPeer != nil && a.IsPeer(subject) {
+		return nil
+	}
+	return &api.ErrorNotAuthorized{Subject: subject, Action: string(act), Method: method}
+}
+
+func (a *ACL) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := a.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *ACL) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := a.authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// withSubject returns ctx carrying a client that presented a verified
+// certificate with the common name subject.
+func withSubject(ctx context.Context, subject string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: subject}}
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		},
+	})
+}
+
+func TestACL(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "acl.csv")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"# billing reads, ingest writes\nbilling, consume\ningest,produce\n*,consume\n",
+	), 0644))
+	acl, err := LoadACL(path)
+	require.NoError(t, err)
+	acl.IsPeer = func(identity string) bool { return identity == "node-1" }
+	// Without a wildcard grant, anonymous clients may do nothing.
+	strict := NewACL()
+	strict.Allow("ingest", ActionProduce)
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		acl     *ACL
+		subject string
+		method  string
+		allowed bool
+	}{
+		{nil, "", api.Log_Produce_FullMethodName, true},
+		{acl, "ingest", api.Log_Produce_FullMethodName, true},
+		{acl, "ingest", api.Log_CreateTopic_FullMethodName, true},
+		{acl, "billing", api.Log_ProduceStream_FullMethodName, false},
+		{acl, "billing", api.Log_ConsumeStream_FullMethodName, true},
+		{acl, "", api.Log_Consume_FullMethodName, true},
+		{acl, "", api.Log_Produce_FullMethodName, false},
+		{acl, "node-1", api.Log_Produce_FullMethodName, true},
+		{acl, "billing", api.Log_GetServers_FullMethodName, true},
+		{acl, "billing", api.Admin_PauseMaintenance_FullMethodName, true},
+		{strict, "", api.Log_Consume_FullMethodName, false},
+		{strict, "billing", api.Log_CommitOffset_FullMethodName, false},
+	} {
+		reqCtx := ctx
+		if tc.subject != "" {
+			reqCtx = withSubject(ctx, tc.subject)
+		}
+		err := tc.acl.authorize(reqCtx, tc.method)
+		if tc.allowed {
+			require.NoError(t, err, tc.method)
+			continue
+		}
+		act, _ := action(tc.method)
+		require.Equal(t, &api.ErrorNotAuthorized{
+			Subject: tc.subject,
+			Action:  string(act),
+			Method:  tc.method,
+		}, err)
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte("billing,delete\n"), 0644))
+	_, err = LoadACL(path)
+	require.Error(t, err)
+}
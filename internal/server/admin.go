@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ api.AdminServer = (*adminServer)(nil)
+
+// adminServer serves the operator facing Admin service alongside the Log
+// service on the same gRPC server.
+type adminServer struct {
+	api.UnimplementedAdminServer
+	*Config
+}
+
+func (s *adminServer) ListQuarantined(ctx context.Context, req *api.ListQuarantinedRequest) (*api.ListQuarantinedResponse, error) {
+	if s.Quarantine == nil {
+		return nil, status.Error(codes.Unimplemented, "quarantine is not supported by this log")
+	}
+
+	entries, err := s.Quarantine.Quarantined()
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ListQuarantinedResponse{Entries: entries}, nil
+}
+
+func (s *adminServer) PauseMaintenance(ctx context.Context, req *api.PauseMaintenanceRequest) (*api.PauseMaintenanceResponse, error) {
+	if s.Maintenance == nil {
+		return nil, status.Error(codes.Unimplemented, "maintenance can't be paused on this log")
+	}
+	if req.DurationMs == 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration_ms must be positive so the pause expires")
+	}
+
+	d := time.Duration(req.DurationMs) * time.Millisecond
+	var until time.Time
+	var err error
+	if req.Cluster {
+		cluster, ok := s.Maintenance.(backend.ClusterMaintenancePauser)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, "maintenance can't be paused cluster-wide on this log")
+		}
+		until, err = cluster.PauseClusterMaintenance(d)
+	} else {
+		until, err = s.Maintenance.PauseMaintenance(d)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.PauseMaintenanceResponse{PausedUntilUnixMs: until.UnixMilli()}, nil
+}
+
+func (s *adminServer) ResumeMaintenance(ctx context.Context, req *api.ResumeMaintenanceRequest) (*api.ResumeMaintenanceResponse, error) {
+	if s.Maintenance == nil {
+		return nil, status.Error(codes.Unimplemented, "maintenance can't be paused on this log")
+	}
+
+	if req.Cluster {
+		cluster, ok := s.Maintenance.(backend.ClusterMaintenancePauser)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, "maintenance can't be paused cluster-wide on this log")
+		}
+		if err := cluster.ResumeClusterMaintenance(); err != nil {
+			return nil, err
+		}
+		return &api.ResumeMaintenanceResponse{}, nil
+	}
+	if err := s.Maintenance.ResumeMaintenance(); err != nil {
+		return nil, err
+	}
+
+	return &api.ResumeMaintenanceResponse{}, nil
+}
+
+func (s *adminServer) DescribeMaintenance(ctx context.Context, req *api.DescribeMaintenanceRequest) (*api.DescribeMaintenanceResponse, error) {
+	reporter, ok := s.Maintenance.(backend.MaintenanceReporter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "this log doesn't report maintenance")
+	}
+
+	return reporter.DescribeMaintenance()
+}
+
+func (s *adminServer) TriggerMaintenance(ctx context.Context, req *api.TriggerMaintenanceRequest) (*api.TriggerMaintenanceResponse, error) {
+	reporter, ok := s.Maintenance.(backend.MaintenanceReporter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "this log doesn't report maintenance")
+	}
+
+	return reporter.TriggerMaintenance()
+}
+
+func (s *adminServer) PromoteStandby(ctx context.Context, req *api.PromoteStandbyRequest) (*api.PromoteStandbyResponse, error) {
+	if s.Standby == nil {
+		return nil, status.Error(codes.Unimplemented, "this log has no standbys")
+	}
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id must name the standby to promote")
+	}
+
+	if err := s.Standby.PromoteStandby(req.Id); err != nil {
+		return nil, err
+	}
+
+	return &api.PromoteStandbyResponse{}, nil
+}
+
+func (s *adminServer) GetSyncStatus(ctx context.Context, req *api.GetSyncStatusRequest) (*api.GetSyncStatusResponse, error) {
+	if s.Standby == nil {
+		return nil, status.Error(codes.Unimplemented, "this log doesn't sync from a leader")
+	}
+
+	return s.Standby.SyncStatus()
+}
+
+func (s *adminServer) ListQuarantinedMembers(ctx context.Context, req *api.ListQuarantinedMembersRequest) (*api.ListQuarantinedMembersResponse, error) {
+	if s.Members == nil {
+		return nil, status.Error(codes.Unimplemented, "this node doesn't quarantine members")
+	}
+
+	members, err := s.Members.QuarantinedMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ListQuarantinedMembersResponse{Members: members}, nil
+}
+
+func (s *adminServer) ReleaseMember(ctx context.Context, req *api.ReleaseMemberRequest) (*api.ReleaseMemberResponse, error) {
+	if s.Members == nil {
+		return nil, status.Error(codes.Unimplemented, "this node doesn't quarantine members")
+	}
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id must name the member to release")
+	}
+
+	if err := s.Members.ReleaseMember(req.Id); err != nil {
+		return nil, err
+	}
+
+	return &api.ReleaseMemberResponse{}, nil
+}
+
+func (s *adminServer) ConfigureTopic(ctx context.Context, req *api.ConfigureTopicRequest) (*api.ConfigureTopicResponse, error) {
+	configurer, ok := s.Topics.(backend.TopicConfigurer)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "the server's topics can't be configured")
+	}
+	if strings.HasPrefix(req.Topic, api.InternalTopicPrefix) {
+		return nil, status.Errorf(codes.InvalidArgument, "topic %q is internal", req.Topic)
+	}
+
+	if err := configurer.ConfigureTopic(req.Topic, req.Config); err != nil {
+		return nil, err
+	}
+
+	topics, err := s.Topics.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+	for _, topic := range topics {
+		if topic.Name == req.Topic {
+			return &api.ConfigureTopicResponse{Topic: topic}, nil
+		}
+	}
+	return &api.ConfigureTopicResponse{Topic: &api.Topic{Name: req.Topic, Config: req.Config}}, nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+)
+
+// Role is the part a node plays in the cluster, which decides the
+// data-plane RPCs it serves to clients. Peers, the cluster's other nodes,
+// may call every RPC whatever the role.
+type Role string
+
+const (
+	// RoleAll, the default, serves every RPC to clients.
+	RoleAll Role = ""
+	// RoleStorage holds the log but serves no data-plane RPCs to clients,
+	// only to peers, e.g. edge nodes forwarding produces.
+	RoleStorage Role = "storage"
+	// RoleIngest holds the log but only takes produces from clients.
+	RoleIngest Role = "ingest"
+	// RoleEdge holds no log: it takes produces from clients and forwards
+	// them to the nodes that do.
+	RoleEdge Role = "edge"
+)
+
+// Roles lists every role a node may have.
+var Roles = []Role{RoleAll, RoleStorage, RoleIngest, RoleEdge}
+
+// HoldsLog reports whether nodes with the role store the log.
+func (r Role) HoldsLog() bool {
+	return r != RoleEdge
+}
+
+// Authorizer rejects the data-plane RPCs a node's role doesn't serve to
+// clients with an api.ErrorWrongRole. Cluster and admin RPCs stay
+// available to everyone.
+type Authorizer struct {
+	Role Role
+	// IsPeer reports whether identity, named as the StreamLimiter names
+	// clients, is one of the cluster's nodes. Without TLS peers are told
+	// apart by IP, so clients sharing a peer's host count as peers.
+	IsPeer func(identity string) bool
+}
+
+// produces reports whether method appends records.
+func produces(method string) bool {
+	return method == api.Log_Produce_FullMethodName ||
+		method == api.Log_ProduceStream_FullMethodName ||
+		method == "/"+collogspb.LogsService_ServiceDesc.ServiceName+"/Export"
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string) error {
+	if a == nil || a.Role == RoleAll || !dataPlane(method) {
+		return nil
+	}
+	if (a.Role == RoleIngest || a.Role == RoleEdge) && produces(method) {
+		return nil
+	}
+	if a.IsPeer != nil && a.IsPeer(identity(ctx)) {
+		return nil
+	}
+	return &api.ErrorWrongRole{Role: string(a.Role), Method: method}
+}
+
+func (a *Authorizer) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := a.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *Authorizer) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := a.authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
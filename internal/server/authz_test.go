@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	peer := func(string) bool { return true }
+	for _, tc := range []struct {
+		authz   *Authorizer
+		method  string
+		allowed bool
+	}{
+		{nil, api.Log_Consume_FullMethodName, true},
+		{&Authorizer{Role: RoleAll}, api.Log_Consume_FullMethodName, true},
+		{&Authorizer{Role: RoleStorage}, api.Log_Produce_FullMethodName, false},
+		{&Authorizer{Role: RoleStorage}, api.Log_GetServers_FullMethodName, true},
+		{&Authorizer{Role: RoleStorage, IsPeer: peer}, api.Log_Produce_FullMethodName, true},
+		{&Authorizer{Role: RoleIngest}, api.Log_ProduceStream_FullMethodName, true},
+		{&Authorizer{Role: RoleIngest}, api.Log_ConsumeStream_FullMethodName, false},
+		{&Authorizer{Role: RoleEdge}, api.Log_Produce_FullMethodName, true},
+		{&Authorizer{Role: RoleEdge}, api.Log_ConsumeRange_FullMethodName, false},
+		{&Authorizer{Role: RoleEdge}, api.Admin_PauseMaintenance_FullMethodName, true},
+	} {
+		err := tc.authz.authorize(ctx, tc.method)
+		if tc.allowed {
+			require.NoError(t, err, tc.method)
+		} else {
+			require.Equal(t, &api.ErrorWrongRole{Role: string(tc.authz.Role), Method: tc.method}, err)
+		}
+	}
+}
+
+func TestServerRoles(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Authorizer = &Authorizer{Role: RoleIngest}
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	st := status.Convert(err)
+	require.Equal(t, codes.PermissionDenied, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "WRONG_ROLE", info.Reason)
+	require.Equal(t, "ingest", info.Metadata["role"])
+}
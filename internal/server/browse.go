@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+)
+
+const (
+	// defaultListLimit and maxListLimit bound the records a ListRecords
+	// page holds.
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// errPageFull stops reading records once a page is full.
+var errPageFull = errors.New("page full")
+
+// ListRecords returns a page of records for UIs browsing the log, along
+// with the range of offsets the log holds so they can draw pagination
+// controls. Unlike ConsumeRange it's unary, so a page is one round trip,
+// and it can page backwards from the newest records, which commit logs
+// that implement reverseReader serve without reading the rest of the log.
+func (s *grpcServer) ListRecords(ctx context.Context, req *api.ListRecordsRequest) (*api.ListRecordsResponse, error) {
+	release, err := s.schedule(ctx, PriorityBulk)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	lowest, next, err := s.logRange()
+	if err != nil {
+		return nil, err
+	}
+	res := &api.ListRecordsResponse{
+		LowestOffset: lowest,
+		NextOffset:   next,
+	}
+	if next <= lowest {
+		return res, nil
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	var start uint64
+	switch req.Position {
+	case api.ConsumeRequest_OFFSET:
+		start = req.Start
+	case api.ConsumeRequest_EARLIEST:
+		start = lowest
+	case api.ConsumeRequest_LATEST:
+		start = next - 1
+	}
+
+	var bytes uint64
+	add := func(record *api.Record) error {
+		if len(res.Records) == limit {
+			return errPageFull
+		}
+		if req.ResolveClaimChecks {
+			if err := s.resolveClaim(ctx, record); err != nil {
+				return err
+			}
+		}
+		size := uint64(len(record.Value))
+		if req.MaxBytes > 0 && len(res.Records) > 0 && bytes+size > req.MaxBytes {
+			return errPageFull
+		}
+		bytes += size
+		s.consumed(record)
+		res.Records = append(res.Records, record)
+		return nil
+	}
+
+	if req.Reverse {
+		if start < lowest {
+			return res, nil
+		}
+		if start >= next {
+			start = next - 1
+		}
+		err = s.readReverse(lowest, start+1, add)
+	} else {
+		if start >= next {
+			return res, nil
+		}
+		if start < lowest {
+			start = lowest
+		}
+		err = s.CommitLog.ReadRange(start, next, add)
+	}
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+
+	if n := len(res.Records); n > 0 {
+		last := res.Records[n-1].Offset
+		if req.Reverse && last > lowest {
+			res.HasMore, res.NextStart = true, last-1
+		}
+		if !req.Reverse && last+1 < next {
+			res.HasMore, res.NextStart = true, last+1
+		}
+	}
+	return res, nil
+}
+
+// readReverse calls fn with each record from offset to-1 down to from,
+// reading them one at a time if the commit log can't read backwards.
+func (s *grpcServer) readReverse(from, to uint64, fn func(*api.Record) error) error {
+	if r, ok := s.CommitLog.(backend.ReverseReader); ok {
+		return r.ReadReverse(from, to, fn)
+	}
+	for off := to; off > from; off-- {
+		record, err := s.CommitLog.Read(off - 1)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logRange returns the offsets the log holds, from lowest up to, but not
+// including, next.
+func (s *grpcServer) logRange() (lowest, next uint64, err error) {
+	lowest, err = s.CommitLog.LowestOffset()
+	if err != nil {
+		return 0, 0, err
+	}
+	highest, err := s.CommitLog.HighestOffset()
+	if err != nil {
+		return 0, 0, err
+	}
+	next = highest + 1
+	// An empty log reports a highest offset of zero too.
+	if _, err := s.CommitLog.Read(highest); err != nil {
+		if _, ok := err.(*api.ErrorOffsetOutOfRange); ok {
+			next = highest
+		}
+	}
+	return lowest, next, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/blob"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimCheck moves record values larger than Threshold bytes to Store as
+// they're produced, so the log only keeps a pointer to them. Consumers
+// asking to resolve claim checks get the original values back. Nodes that
+// replicate each other's records must share the store.
+type ClaimCheck struct {
+	Store     blob.Store
+	Threshold int
+}
+
+// checkClaim moves record's value to the blob store if it's over the
+// threshold. Values are keyed by their SHA-256, so retried produces store
+// the same blob.
+func (s *grpcServer) checkClaim(ctx context.Context, record *api.Record) error {
+	if s.ClaimCheck == nil || record == nil || len(record.Value) <= s.ClaimCheck.Threshold {
+		return nil
+	}
+	if _, ok := record.Headers[api.HeaderClaimCheck]; ok {
+		return nil
+	}
+
+	sum := sha256.Sum256(record.Value)
+	key := hex.EncodeToString(sum[:])
+	if err := s.ClaimCheck.Store.Put(ctx, key, record.Value); err != nil {
+		return status.Errorf(codes.Unavailable, "failed to store value in blob store: %v", err)
+	}
+	if record.Headers == nil {
+		record.Headers = make(map[string]string)
+	}
+	record.Headers[api.HeaderClaimCheck] = key
+	record.Headers[api.HeaderClaimCheckSize] = strconv.Itoa(len(record.Value))
+	record.Value = nil
+	return nil
+}
+
+// resolveClaim replaces a claim check record's value with the one in the
+// blob store.
+func (s *grpcServer) resolveClaim(ctx context.Context, record *api.Record) error {
+	key, ok := record.Headers[api.HeaderClaimCheck]
+	if !ok {
+		return nil
+	}
+	if s.ClaimCheck == nil {
+		return status.Errorf(
+			codes.FailedPrecondition,
+			"record %d is a claim check but the server has no blob store",
+			record.Offset,
+		)
+	}
+
+	value, err := s.ClaimCheck.Store.Get(ctx, key)
+	if err == blob.ErrNotFound {
+		return status.Errorf(codes.DataLoss, "blob %s for record %d is missing", key, record.Offset)
+	}
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to read blob %s: %v", key, err)
+	}
+	record.Value = value
+	delete(record.Headers, api.HeaderClaimCheck)
+	delete(record.Headers, api.HeaderClaimCheckSize)
+	return nil
+}
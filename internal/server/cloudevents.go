@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CloudEventsMode is how the server holds produced records to the
+// CloudEvents spec, so event-driven tooling and brokers that speak it can
+// exchange events through the log.
+type CloudEventsMode string
+
+const (
+	// CloudEventsOff, the default, takes records as they come.
+	CloudEventsOff CloudEventsMode = ""
+	// CloudEventsBinary stores events in binary mode: the event's context
+	// attributes in api.HeaderCloudEventsPrefix headers and its data as the
+	// value.
+	CloudEventsBinary CloudEventsMode = "binary"
+	// CloudEventsStructured stores events in structured mode: the whole
+	// event as an api.ContentTypeCloudEvents value.
+	CloudEventsStructured CloudEventsMode = "structured"
+)
+
+// CloudEventsModes lists every CloudEvents mode.
+var CloudEventsModes = []CloudEventsMode{CloudEventsOff, CloudEventsBinary, CloudEventsStructured}
+
+// cloudEventsSpecVersion is the version of the spec events must follow.
+const cloudEventsSpecVersion = "1.0"
+
+// cloudEvent is an event's context attributes, its datacontenttype aside,
+// and its data.
+type cloudEvent struct {
+	attrs       map[string]string
+	contentType string
+	data        []byte
+}
+
+// cloudEvents rejects produced records that aren't valid CloudEvents, in
+// either mode, and converts those in the other mode to the server's.
+func (s *grpcServer) cloudEvents(record *api.Record) error {
+	if s.CloudEvents == CloudEventsOff || record == nil {
+		return nil
+	}
+	structured := record.MediaType() == api.ContentTypeCloudEvents
+	event, err := parseCloudEvent(record, structured)
+	if err == nil {
+		err = event.validate()
+	}
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid CloudEvent: %v", err)
+	}
+
+	switch {
+	case s.CloudEvents == CloudEventsBinary && structured:
+		event.binary(record)
+	case s.CloudEvents == CloudEventsStructured && !structured:
+		return event.structured(record)
+	}
+	return nil
+}
+
+// parseCloudEvent reads the event record holds in structured mode, or
+// else in binary mode.
+func parseCloudEvent(record *api.Record, structured bool) (*cloudEvent, error) {
+	event := &cloudEvent{attrs: make(map[string]string)}
+	if !structured {
+		for k, v := range record.Headers {
+			if name, ok := strings.CutPrefix(k, api.HeaderCloudEventsPrefix); ok {
+				event.attrs[name] = v
+			}
+		}
+		event.contentType = record.MediaType()
+		event.data = record.Value
+		return event, nil
+	}
+
+	value, err := record.DecodedValue()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, err
+	}
+	var data, data64 json.RawMessage
+	for k, v := range fields {
+		switch k {
+		case "data":
+			data = v
+		case "data_base64":
+			data64 = v
+		default:
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				// Extension attributes may be numbers or booleans.
+				s = string(v)
+			}
+			if k == "datacontenttype" {
+				event.contentType = s
+			} else if string(v) != "null" {
+				event.attrs[k] = s
+			}
+		}
+	}
+	switch {
+	case data64 != nil:
+		var s string
+		if err := json.Unmarshal(data64, &s); err != nil {
+			return nil, err
+		}
+		if event.data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("data_base64: %w", err)
+		}
+	case data != nil && jsonContentType(event.contentType):
+		event.data = data
+	case data != nil:
+		// Data that isn't JSON is held as a string.
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("data of content type %q isn't a string", event.contentType)
+		}
+		event.data = []byte(s)
+	}
+	return event, nil
+}
+
+func (e *cloudEvent) validate() error {
+	for _, name := range []string{"id", "source", "specversion", "type"} {
+		if e.attrs[name] == "" {
+			return fmt.Errorf("missing required attribute %q", name)
+		}
+	}
+	if v := e.attrs["specversion"]; v != cloudEventsSpecVersion {
+		return fmt.Errorf("unsupported specversion %q", v)
+	}
+	if t, ok := e.attrs["time"]; ok {
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			return fmt.Errorf("time %q isn't RFC 3339", t)
+		}
+	}
+	for name := range e.attrs {
+		if !validAttributeName(name) {
+			return fmt.Errorf("invalid attribute name %q", name)
+		}
+	}
+	return nil
+}
+
+// binary rewrites record, which holds the event in structured mode, to
+// hold it in binary mode.
+func (e *cloudEvent) binary(record *api.Record) {
+	if record.Headers == nil {
+		record.Headers = make(map[string]string)
+	}
+	for k, v := range e.attrs {
+		record.Headers[api.HeaderCloudEventsPrefix+k] = v
+	}
+	delete(record.Headers, api.HeaderContentType)
+	record.ContentType = e.contentType
+	record.ContentEncoding = ""
+	record.Value = e.data
+}
+
+// structured rewrites record, which holds the event in binary mode, to
+// hold it in structured mode.
+func (e *cloudEvent) structured(record *api.Record) error {
+	fields := make(map[string]interface{}, len(e.attrs)+2)
+	for k, v := range e.attrs {
+		fields[k] = v
+	}
+	if e.contentType != "" {
+		fields["datacontenttype"] = e.contentType
+	}
+	if len(e.data) > 0 {
+		if jsonContentType(e.contentType) && json.Valid(e.data) {
+			fields["data"] = json.RawMessage(e.data)
+		} else {
+			fields["data_base64"] = base64.StdEncoding.EncodeToString(e.data)
+		}
+	}
+	value, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	for k := range record.Headers {
+		if strings.HasPrefix(k, api.HeaderCloudEventsPrefix) {
+			delete(record.Headers, k)
+		}
+	}
+	delete(record.Headers, api.HeaderContentType)
+	record.ContentType = api.ContentTypeCloudEvents
+	record.ContentEncoding = ""
+	record.Value = value
+	return nil
+}
+
+// jsonContentType reports whether data of content type ct is JSON, as it's
+// taken to be when ct is empty.
+func jsonContentType(ct string) bool {
+	if ct == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// validAttributeName reports whether name is a valid CloudEvents attribute
+// name: lowercase ASCII letters and digits.
+func validAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
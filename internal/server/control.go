@@ -0,0 +1,73 @@
+package server
+
+import (
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConsumeControlled is ConsumeStream for consumers that pause and resume
+// delivery, e.g. to apply backpressure, without tearing down the stream
+// and losing its position. The first frame carries the consume request;
+// later ones pause or resume the stream.
+func (s *grpcServer) ConsumeControlled(stream api.Log_ConsumeControlledServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Request == nil {
+		return status.Error(codes.InvalidArgument, "the first control frame must carry the consume request")
+	}
+
+	gate := &pauseGate{}
+	gate.apply(first.Action)
+	go func() {
+		// Ends once the consumer closes its side or the stream ends.
+		for {
+			frame, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			gate.apply(frame.Action)
+		}
+	}()
+	return s.consumeStream(first.Request, stream, gate)
+}
+
+// pauseGate is whether a consumer has paused its stream. A nil gate is
+// never paused.
+type pauseGate struct {
+	mu sync.Mutex
+	// resumed is closed when the stream resumes, and nil while it isn't
+	// paused.
+	resumed chan struct{}
+}
+
+func (g *pauseGate) apply(action api.ConsumeControl_Action) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch action {
+	case api.ConsumeControl_PAUSE:
+		if g.resumed == nil {
+			g.resumed = make(chan struct{})
+		}
+	case api.ConsumeControl_RESUME:
+		if g.resumed != nil {
+			close(g.resumed)
+			g.resumed = nil
+		}
+	}
+}
+
+// paused returns a channel closed once the stream resumes, or nil if it
+// isn't paused.
+func (g *pauseGate) paused() <-chan struct{} {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ConsumerOffsetsTopic is the internal topic agents keep consumer groups'
+// committed offsets in.
+const ConsumerOffsetsTopic = "__consumer_offsets"
+
+// contentTypeCommit is the content type of the records ConsumerGroups
+// persists commits as.
+const contentTypeCommit = "application/x-protobuf; messageType=log.v1.CommitOffsetRequest"
+
+// contentTypeAssignment is the content type of the records ConsumerGroups
+// persists static assignments as.
+const contentTypeAssignment = "application/x-protobuf; messageType=log.v1.AssignPartitionsRequest"
+
+// DefaultCompactThreshold is how many records are appended to the
+// ConsumerOffsetsTopic on top of the groups' live state before it's
+// compacted, unless ConsumerGroups.CompactThreshold says otherwise.
+const DefaultCompactThreshold = 1024
+
+// groupKey names the log a consumer group committed an offset for.
+type groupKey struct {
+	group     string
+	topic     string
+	partition uint32
+}
+
+func (k groupKey) less(o groupKey) bool {
+	if k.group != o.group {
+		return k.group < o.group
+	}
+	if k.topic != o.topic {
+		return k.topic < o.topic
+	}
+	return k.partition < o.partition
+}
+
+// ConsumerGroups tracks the offsets consumer groups commit, so their
+// consumers resume where they left off. Each commit is appended to the
+// ConsumerOffsetsTopic, which is exempt from retention, and the groups
+// read the commits in it before each commit and fetch, the last commit
+// for a log winning. With Raft the topic is replicated, so commits taken
+// by one leader are read by the next. The topic is compacted as it grows,
+// see compact.
+//
+// Groups' members share topics' partitions through heartbeats, see
+// Heartbeat. Membership is kept in memory by the node serving the
+// heartbeats, so after a leader change members rejoin the new leader with
+// their next heartbeats. Static assignments, see Assign, are appended to
+// the ConsumerOffsetsTopic like commits, so they outlive leader changes.
+type ConsumerGroups struct {
+	// SessionTimeout is how long members may go without heartbeating
+	// before they leave their group. Defaults to
+	// DefaultGroupSessionTimeout.
+	SessionTimeout time.Duration
+	// CompactThreshold is how many records are appended to the
+	// ConsumerOffsetsTopic on top of the groups' live state before it's
+	// compacted. Defaults to DefaultCompactThreshold.
+	CompactThreshold int
+
+	mu     sync.Mutex
+	topics backend.Topics
+	logger *zap.Logger
+	// log is the ConsumerOffsetsTopic's partition, or nil until the topic
+	// exists, and next the offset of the first commit in it not yet read.
+	log     backend.CommitLog
+	next    uint64
+	offsets map[groupKey]uint64
+	members map[membersKey]*groupMembers
+	static  map[membersKey][]*api.PartitionAssignment
+	// compactedFrom is the offset compact last appended the live state
+	// from.
+	compactedFrom uint64
+}
+
+// NewConsumerGroups opens the consumer groups whose commits are in topics.
+// The ConsumerOffsetsTopic is created by the first commit, since with Raft
+// only the leader can create it.
+func NewConsumerGroups(topics backend.Topics) (*ConsumerGroups, error) {
+	g := &ConsumerGroups{
+		topics:  topics,
+		logger:  zap.L().Named("groups"),
+		offsets: make(map[groupKey]uint64),
+		members: make(map[membersKey]*groupMembers),
+		static:  make(map[membersKey][]*api.PartitionAssignment),
+	}
+	if err := g.catchUp(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// catchUp reads the commits and static assignments appended since the
+// groups last read the log. Records that are neither are logged and
+// skipped rather than wedging the groups. g.mu must be held, or g not yet
+// shared.
+func (g *ConsumerGroups) catchUp() error {
+	if g.log == nil {
+		clog, err := g.topics.Partition(ConsumerOffsetsTopic, 0)
+		if _, ok := err.(*api.ErrorUnknownTopic); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		g.log = clog
+	}
+	lowest, err := g.log.LowestOffset()
+	if err != nil {
+		return err
+	}
+	highest, err := g.log.HighestOffset()
+	if err != nil {
+		return err
+	}
+	if g.next < lowest {
+		g.next = lowest
+	}
+	if g.next > highest {
+		return nil
+	}
+	// An empty log has no record at its highest offset.
+	_, err = g.log.Read(highest)
+	switch err.(type) {
+	case nil:
+	case *api.ErrorOffsetOutOfRange, *api.ErrorOffsetTruncated:
+		return nil
+	default:
+		return err
+	}
+	return g.log.ReadRange(g.next, highest+1, func(record *api.Record) error {
+		off := g.next
+		g.next++
+		if record.ContentType == contentTypeAssignment {
+			assign := &api.AssignPartitionsRequest{}
+			if err := proto.Unmarshal(record.Value, assign); err != nil {
+				g.logger.Warn("skipping a record that isn't an assignment",
+					zap.Uint64("offset", off),
+					zap.Error(err))
+				return nil
+			}
+			g.applyAssignment(assign)
+			return nil
+		}
+		commit := &api.CommitOffsetRequest{}
+		if err := proto.Unmarshal(record.Value, commit); err != nil {
+			g.logger.Warn("skipping a record that isn't a commit",
+				zap.Uint64("offset", off),
+				zap.Error(err))
+			return nil
+		}
+		g.offsets[groupKey{commit.Group, commit.Topic, commit.Partition}] = commit.Offset
+		return nil
+	})
+}
+
+// applyAssignment replaces the group's static assignments for the topic,
+// starting a new generation for its members.
+func (g *ConsumerGroups) applyAssignment(assign *api.AssignPartitionsRequest) {
+	key := membersKey{assign.Group, assign.Topic}
+	if len(assign.Assignments) == 0 {
+		delete(g.static, key)
+	} else {
+		g.static[key] = assign.Assignments
+	}
+	if m, ok := g.members[key]; ok {
+		m.generation++
+	}
+}
+
+// Commit records that group consumes the log, a partition of topic or the
+// default log if topic is empty, from offset next.
+func (g *ConsumerGroups) Commit(group, topic string, partition uint32, next uint64) error {
+	return g.append(contentTypeCommit, &api.CommitOffsetRequest{
+		Group:     group,
+		Topic:     topic,
+		Partition: partition,
+		Offset:    next,
+	})
+}
+
+// Assign statically assigns group's members the partitions of topic, or
+// the default log if topic is empty, or ranges of them, replacing the
+// group's assignments for it. No assignments return the group to sharing
+// the partitions among its members.
+func (g *ConsumerGroups) Assign(group, topic string, assignments []*api.PartitionAssignment) error {
+	return g.append(contentTypeAssignment, &api.AssignPartitionsRequest{
+		Group:       group,
+		Topic:       topic,
+		Assignments: assignments,
+	})
+}
+
+// append persists msg as a record of contentType in the
+// ConsumerOffsetsTopic, creating it if need be, reads it back, and
+// compacts the topic if it's due.
+func (g *ConsumerGroups) append(contentType string, msg proto.Message) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.log == nil {
+		err := g.topics.CreateTopic(ConsumerOffsetsTopic, 1)
+		if _, ok := err.(*api.ErrorTopicExists); err != nil && !ok {
+			return err
+		}
+		if g.log, err = g.topics.Partition(ConsumerOffsetsTopic, 0); err != nil {
+			return err
+		}
+	}
+	if err := g.write(contentType, msg); err != nil {
+		return err
+	}
+	// Reading the record back, rather than applying it here, keeps the
+	// groups in the log's order when other nodes append too.
+	if err := g.catchUp(); err != nil {
+		return err
+	}
+	// The record's persisted, so failing to compact doesn't fail it.
+	if err := g.compact(); err != nil {
+		g.logger.Warn("failed to compact the consumer offsets", zap.Error(err))
+	}
+	return nil
+}
+
+// write appends msg to the ConsumerOffsetsTopic as a record of
+// contentType. g.mu must be held.
+func (g *ConsumerGroups) write(contentType string, msg proto.Message) error {
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = g.log.Append(&api.Record{Value: value, ContentType: contentType})
+	return err
+}
+
+// compact keeps the ConsumerOffsetsTopic from growing without bound. Once
+// CompactThreshold records have been appended on top of the groups' live
+// state, the last commit of each log and each group's static assignments,
+// it appends the live state again and truncates the records before it,
+// which replicas apply through Raft too. Truncation removes whole
+// segments, so the records in the segment the live state starts in stay
+// until a later compaction. Logs that can't be truncated aren't compacted.
+// g.mu must be held.
+func (g *ConsumerGroups) compact() error {
+	t, ok := g.log.(backend.Truncater)
+	if !ok {
+		return nil
+	}
+	lowest, err := g.log.LowestOffset()
+	if err != nil {
+		return err
+	}
+	from := g.compactedFrom
+	if from < lowest {
+		from = lowest
+	}
+	live := len(g.offsets) + len(g.static)
+	if g.next-from <= uint64(live+g.compactThreshold()) {
+		return nil
+	}
+
+	first := g.next
+	commits := make([]groupKey, 0, len(g.offsets))
+	for key := range g.offsets {
+		commits = append(commits, key)
+	}
+	sort.Slice(commits, func(i, j int) bool { return commits[i].less(commits[j]) })
+	for _, key := range commits {
+		err := g.write(contentTypeCommit, &api.CommitOffsetRequest{
+			Group:     key.group,
+			Topic:     key.topic,
+			Partition: key.partition,
+			Offset:    g.offsets[key],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	assigned := make([]membersKey, 0, len(g.static))
+	for key := range g.static {
+		assigned = append(assigned, key)
+	}
+	sort.Slice(assigned, func(i, j int) bool {
+		a, b := assigned[i], assigned[j]
+		return a.group < b.group || a.group == b.group && a.topic < b.topic
+	})
+	for _, key := range assigned {
+		err := g.write(contentTypeAssignment, &api.AssignPartitionsRequest{
+			Group:       key.group,
+			Topic:       key.topic,
+			Assignments: g.static[key],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := g.catchUp(); err != nil {
+		return err
+	}
+	g.compactedFrom = first
+	return t.Truncate(first - 1)
+}
+
+func (g *ConsumerGroups) compactThreshold() int {
+	if g.CompactThreshold > 0 {
+		return g.CompactThreshold
+	}
+	return DefaultCompactThreshold
+}
+
+// Fetch returns the offset group last committed for the log, and false if
+// it hasn't committed one.
+func (g *ConsumerGroups) Fetch(group, topic string, partition uint32) (uint64, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.catchUp(); err != nil {
+		return 0, false, err
+	}
+	next, ok := g.offsets[groupKey{group, topic, partition}]
+	return next, ok, nil
+}
+
+func (s *grpcServer) CommitOffset(ctx context.Context, req *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	if err := s.checkGroup(req.Group, req.Topic, req.Partition); err != nil {
+		return nil, err
+	}
+	if err := s.Groups.Commit(req.Group, req.Topic, req.Partition, req.Offset); err != nil {
+		return nil, err
+	}
+	return &api.CommitOffsetResponse{}, nil
+}
+
+func (s *grpcServer) FetchOffset(ctx context.Context, req *api.FetchOffsetRequest) (*api.FetchOffsetResponse, error) {
+	if err := s.checkGroup(req.Group, req.Topic, req.Partition); err != nil {
+		return nil, err
+	}
+	next, ok, err := s.Groups.Fetch(req.Group, req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchOffsetResponse{Offset: next, Committed: ok}, nil
+}
+
+// checkGroup fails requests for a group's offsets the server can't serve:
+// those without a group, or for logs it doesn't have.
+func (s *grpcServer) checkGroup(group, topic string, partition uint32) error {
+	if s.Groups == nil {
+		return status.Error(codes.Unimplemented, "the server doesn't track consumer groups")
+	}
+	if group == "" {
+		return status.Error(codes.InvalidArgument, "group must be set")
+	}
+	_, err := s.route(topic, partition)
+	return err
+}
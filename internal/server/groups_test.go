@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/internal/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerGroupsCompact(t *testing.T) {
+	c := log.Config{}
+	c.Segment.MaxStoreBytes = 256
+	topics, err := log.NewTopics(t.TempDir(), c)
+	require.NoError(t, err)
+	defer topics.Close()
+
+	groups, err := NewConsumerGroups(topics)
+	require.NoError(t, err)
+	groups.CompactThreshold = 16
+	assignments := []*api.PartitionAssignment{{Member: "a", Partition: 1}}
+	require.NoError(t, groups.Assign("billing", "orders", assignments))
+	for i := 0; i < 500; i++ {
+		require.NoError(t, groups.Commit("billing", "orders", uint32(i%3), uint64(i)))
+	}
+
+	clog, err := topics.Partition(ConsumerOffsetsTopic, 0)
+	require.NoError(t, err)
+	lowest, err := clog.LowestOffset()
+	require.NoError(t, err)
+	highest, err := clog.HighestOffset()
+	require.NoError(t, err)
+	require.Greater(t, highest, uint64(500))
+	require.Less(t, highest-lowest, uint64(64))
+
+	// The compacted topic still holds every log's last commit and the
+	// static assignments.
+	groups, err = NewConsumerGroups(topics)
+	require.NoError(t, err)
+	for partition, want := range []uint64{498, 499, 497} {
+		next, ok, err := groups.Fetch("billing", "orders", uint32(partition))
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, want, next)
+	}
+	res, err := groups.Heartbeat("billing", "a", "orders", 3, nil, time.Now())
+	require.NoError(t, err)
+	require.True(t, res.Static)
+	require.Equal(t, []uint32{1}, res.Assigned)
+}
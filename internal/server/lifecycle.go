@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+)
+
+// State is a phase in the server's life.
+type State int
+
+const (
+	StateStarting State = iota
+	StateWaitingForQuorum
+	StateServing
+	StateDraining
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateWaitingForQuorum:
+		return "waiting-for-quorum"
+	case StateServing:
+		return "serving"
+	case StateDraining:
+		return "draining"
+	}
+	return "unknown"
+}
+
+// Lifecycle tracks the server's state as it moves from starting, through
+// waiting for quorum, to serving and finally draining. Data-plane RPCs are
+// rejected unless the server is serving.
+type Lifecycle struct {
+	mu        sync.RWMutex
+	state     State
+	phase     string
+	listeners []func(State)
+	draining  chan struct{}
+}
+
+// Set moves the lifecycle to state and notifies listeners.
+func (l *Lifecycle) Set(state State) {
+	l.mu.Lock()
+	l.state = state
+	listeners := l.listeners
+	if state == StateDraining {
+		draining := l.drainingLocked()
+		select {
+		case <-draining:
+		default:
+			close(draining)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(state)
+	}
+}
+
+// Draining returns a channel that's closed once the lifecycle starts
+// draining, so streams that would otherwise run until their client hangs up
+// end and let the server stop gracefully.
+func (l *Lifecycle) Draining() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.drainingLocked()
+}
+
+func (l *Lifecycle) drainingLocked() chan struct{} {
+	if l.draining == nil {
+		l.draining = make(chan struct{})
+	}
+	return l.draining
+}
+
+func (l *Lifecycle) State() State {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.state
+}
+
+// SetPhase records the step of its startup the server is at, e.g.
+// "joining-cluster", which says more than its state while it isn't serving
+// yet.
+func (l *Lifecycle) SetPhase(phase string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.phase = phase
+}
+
+// Phase returns the step of its startup the server is at, until it serves,
+// and then its state.
+func (l *Lifecycle) Phase() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.phase != "" && (l.state == StateStarting || l.state == StateWaitingForQuorum) {
+		return l.phase
+	}
+	return l.state.String()
+}
+
+// OnChange registers fn to be called with the current state and then with
+// every state the lifecycle moves to.
+func (l *Lifecycle) OnChange(fn func(State)) {
+	l.mu.Lock()
+	l.listeners = append(l.listeners, fn)
+	state := l.state
+	l.mu.Unlock()
+
+	fn(state)
+}
+
+// dataPlane reports whether method reads or writes records, as opposed to
+// cluster and admin RPCs that stay available in every state.
+func dataPlane(method string) bool {
+	if strings.HasPrefix(method, "/"+collogspb.LogsService_ServiceDesc.ServiceName+"/") {
+		return true
+	}
+	return strings.HasPrefix(method, "/"+api.Log_ServiceDesc.ServiceName+"/") &&
+		method != api.Log_GetServers_FullMethodName
+}
+
+func (l *Lifecycle) checkServing(method string) error {
+	if l == nil || !dataPlane(method) {
+		return nil
+	}
+	if state := l.State(); state != StateServing {
+		return &api.ErrorNotServing{State: state.String()}
+	}
+	return nil
+}
+
+func (l *Lifecycle) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := l.checkServing(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *Lifecycle) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := l.checkServing(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// Headers OTLP log records are mapped into. Resource and log attributes keep
+// their keys under the resource and attribute prefixes.
+const (
+	OTLPResourcePrefix  = "otel.resource."
+	OTLPAttributePrefix = "otel.attr."
+	OTLPScopeName       = "otel.scope.name"
+	OTLPScopeVersion    = "otel.scope.version"
+	OTLPTime            = "otel.time_unix_nano"
+	OTLPSeverityText    = "otel.severity_text"
+	OTLPSeverityNumber  = "otel.severity_number"
+	OTLPTraceID         = "otel.trace_id"
+	OTLPSpanID          = "otel.span_id"
+)
+
+var _ collogspb.LogsServiceServer = (*otlpServer)(nil)
+
+// otlpServer accepts OTLP/gRPC log exports so OpenTelemetry collectors can
+// ship logs to the cluster. Each log record is produced as a record whose
+// value is the log's body.
+type otlpServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	log *grpcServer
+}
+
+func (s *otlpServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	for _, rl := range req.ResourceLogs {
+		resource := make(map[string]string)
+		for _, kv := range rl.GetResource().GetAttributes() {
+			resource[OTLPResourcePrefix+kv.Key] = anyValueString(kv.Value)
+		}
+
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				record := otlpRecord(resource, sl.Scope, lr)
+				if _, err := s.log.Produce(ctx, &api.ProduceRequest{Record: record}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func otlpRecord(resource map[string]string, scope *commonpb.InstrumentationScope, lr *logspb.LogRecord) *api.Record {
+	headers := make(map[string]string, len(resource)+len(lr.Attributes)+8)
+	for k, v := range resource {
+		headers[k] = v
+	}
+	for _, kv := range lr.Attributes {
+		headers[OTLPAttributePrefix+kv.Key] = anyValueString(kv.Value)
+	}
+	if scope.GetName() != "" {
+		headers[OTLPScopeName] = scope.GetName()
+	}
+	if scope.GetVersion() != "" {
+		headers[OTLPScopeVersion] = scope.GetVersion()
+	}
+	t := lr.TimeUnixNano
+	if t == 0 {
+		t = lr.ObservedTimeUnixNano
+	}
+	if t != 0 {
+		headers[OTLPTime] = strconv.FormatUint(t, 10)
+	}
+	if lr.SeverityText != "" {
+		headers[OTLPSeverityText] = lr.SeverityText
+	}
+	if lr.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		headers[OTLPSeverityNumber] = strconv.Itoa(int(lr.SeverityNumber))
+	}
+	if len(lr.TraceId) > 0 {
+		headers[OTLPTraceID] = hex.EncodeToString(lr.TraceId)
+	}
+	if len(lr.SpanId) > 0 {
+		headers[OTLPSpanID] = hex.EncodeToString(lr.SpanId)
+	}
+
+	// String and bytes bodies are stored as is; structured bodies as JSON.
+	record := &api.Record{Headers: headers}
+	switch body := lr.GetBody().GetValue().(type) {
+	case nil:
+	case *commonpb.AnyValue_StringValue:
+		record.Value = []byte(body.StringValue)
+		record.ContentType = "text/plain"
+	case *commonpb.AnyValue_BytesValue:
+		record.Value = body.BytesValue
+	default:
+		record.Value, _ = json.Marshal(anyValue(lr.Body))
+		record.ContentType = "application/json"
+	}
+
+	return record
+}
+
+// anyValueString renders an attribute value as a header value: strings as
+// is and anything else as JSON.
+func anyValueString(v *commonpb.AnyValue) string {
+	if s, ok := v.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return s.StringValue
+	}
+	b, _ := json.Marshal(anyValue(v))
+	return string(b)
+}
+
+// anyValue converts v into a value encoding/json can marshal.
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, e := range v.ArrayValue.GetValues() {
+			values = append(values, anyValue(e))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]interface{}, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			values[kv.Key] = anyValue(kv.Value)
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/clock"
+)
+
+// maxPacerCredit caps how far a stream can fall below its rate limit, so a
+// consumer that idled at the tail can't then burst far above the limit.
+const maxPacerCredit = time.Second
+
+// pacer throttles a stream to at most recordsPerSec records and bytesPerSec
+// bytes per second. A zero limit is unlimited.
+type pacer struct {
+	clock         clock.Clock
+	recordsPerSec uint64
+	bytesPerSec   uint64
+
+	start   time.Time
+	records uint64
+	bytes   uint64
+}
+
+func newPacer(clk clock.Clock, recordsPerSec, bytesPerSec uint64) *pacer {
+	return &pacer{
+		clock:         clk,
+		recordsPerSec: recordsPerSec,
+		bytesPerSec:   bytesPerSec,
+		start:         clk.Now(),
+	}
+}
+
+// wait blocks until a record of size n bytes can be sent without exceeding
+// the limits, or until ctx is done.
+func (p *pacer) wait(ctx context.Context, n int) error {
+	if p.recordsPerSec == 0 && p.bytesPerSec == 0 {
+		return nil
+	}
+
+	// Work out when this record is due given everything sent before it.
+	var due time.Duration
+	if p.recordsPerSec != 0 {
+		due = rateDuration(p.records, p.recordsPerSec)
+	}
+	if p.bytesPerSec != 0 {
+		if d := rateDuration(p.bytes, p.bytesPerSec); d > due {
+			due = d
+		}
+	}
+	p.records++
+	p.bytes += uint64(n)
+
+	delay := p.start.Add(due).Sub(p.clock.Now())
+	if delay < -maxPacerCredit {
+		p.start = p.start.Add(-delay - maxPacerCredit)
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := p.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// rateDuration is how long sending n units takes at perSec units a second.
+func rateDuration(n, perSec uint64) time.Duration {
+	return time.Duration(float64(n) / float64(perSec) * float64(time.Second))
+}
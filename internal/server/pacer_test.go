@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacer(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	p := newPacer(clk, 10, 0)
+	ctx := context.Background()
+
+	// The first record is due straight away, the next a tenth of a second
+	// later.
+	require.NoError(t, p.wait(ctx, 1))
+
+	done := make(chan error)
+	go func() { done <- p.wait(ctx, 1) }()
+	require.Eventually(t, func() bool {
+		return clk.Timers() == 1
+	}, time.Second, time.Millisecond)
+
+	clk.Advance(99 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("record sent before it was due")
+	default:
+	}
+	clk.Advance(time.Millisecond)
+	require.NoError(t, <-done)
+
+	// An idle stream earns at most a second of credit.
+	clk.Advance(time.Minute)
+	for i := 0; i < 11; i++ {
+		require.NoError(t, p.wait(ctx, 1))
+	}
+	require.Equal(t, 0, clk.Timers())
+	go func() { done <- p.wait(ctx, 1) }()
+	require.Eventually(t, func() bool {
+		return clk.Timers() == 1
+	}, time.Second, time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, p.wait(cancelled, 1), context.Canceled)
+	clk.Advance(time.Second)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultGroupSessionTimeout is how long consumer group members may go
+// without heartbeating before they leave their group, unless
+// ConsumerGroups.SessionTimeout says otherwise.
+const DefaultGroupSessionTimeout = 10 * time.Second
+
+// membersKey names the members of a consumer group sharing a topic.
+type membersKey struct {
+	group string
+	topic string
+}
+
+// groupMembers are the members of a consumer group sharing a topic's
+// partitions, and the share of them each is to consume.
+type groupMembers struct {
+	members    map[string]*groupMember
+	partitions uint32
+	target     map[string][]uint32
+	generation uint64
+}
+
+// groupMember is a member of a group, the partitions it said it consumed
+// in its last heartbeat, and when that was.
+type groupMember struct {
+	owned    []uint32
+	lastSeen time.Time
+}
+
+// Heartbeat keeps member in group, sharing topic's partitions, which it
+// says it owns some of, as of now, and returns its assignment. Members
+// that haven't heartbeated for the session timeout leave the group first.
+//
+// Each member's target share is sticky, see stickyAssign, and a member is
+// only assigned the partitions of its share that no other member owns, so
+// partitions move between members without any member stopping the rest.
+// If the group's partitions are assigned statically, see Assign, the
+// member is assigned its static assignments instead.
+func (g *ConsumerGroups) Heartbeat(group, member, topic string, partitions uint32, owned []uint32, now time.Time) (*api.HeartbeatResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.catchUp(); err != nil {
+		return nil, err
+	}
+
+	key := membersKey{group, topic}
+	m, ok := g.members[key]
+	if !ok {
+		m = &groupMembers{members: make(map[string]*groupMember)}
+		g.members[key] = m
+	}
+	changed := m.partitions != partitions
+	for id, mem := range m.members {
+		if id != member && now.Sub(mem.lastSeen) > g.sessionTimeout() {
+			delete(m.members, id)
+			changed = true
+		}
+	}
+	mem, ok := m.members[member]
+	if !ok {
+		mem = &groupMember{}
+		m.members[member] = mem
+		changed = true
+	}
+	mem.owned = owned
+	mem.lastSeen = now
+	if changed {
+		m.partitions = partitions
+		m.rebalance()
+	}
+
+	res := &api.HeartbeatResponse{
+		Assigned:         []uint32{},
+		Generation:       m.generation,
+		SessionTimeoutMs: uint64(g.sessionTimeout().Milliseconds()),
+	}
+	if static, ok := g.static[key]; ok {
+		res.Static = true
+		seen := make(map[uint32]bool)
+		for _, a := range static {
+			if a.Member != member {
+				continue
+			}
+			res.Ranges = append(res.Ranges, a)
+			if !seen[a.Partition] {
+				seen[a.Partition] = true
+				res.Assigned = append(res.Assigned, a.Partition)
+			}
+		}
+		sort.Slice(res.Assigned, func(i, j int) bool { return res.Assigned[i] < res.Assigned[j] })
+		return res, nil
+	}
+
+	claimed := make(map[uint32]bool)
+	for id, other := range m.members {
+		if id == member {
+			continue
+		}
+		for _, p := range other.owned {
+			claimed[p] = true
+		}
+	}
+	for _, p := range m.target[member] {
+		if !claimed[p] {
+			res.Assigned = append(res.Assigned, p)
+		}
+	}
+	return res, nil
+}
+
+// Leave takes member out of group's members sharing topic.
+func (g *ConsumerGroups) Leave(group, member, topic string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := membersKey{group, topic}
+	m, ok := g.members[key]
+	if !ok {
+		return
+	}
+	if _, ok := m.members[member]; !ok {
+		return
+	}
+	delete(m.members, member)
+	if len(m.members) == 0 {
+		delete(g.members, key)
+		return
+	}
+	m.rebalance()
+}
+
+func (g *ConsumerGroups) sessionTimeout() time.Duration {
+	if g.SessionTimeout > 0 {
+		return g.SessionTimeout
+	}
+	return DefaultGroupSessionTimeout
+}
+
+// rebalance recomputes the members' target shares and starts a new
+// generation.
+func (m *groupMembers) rebalance() {
+	ids := make([]string, 0, len(m.members))
+	for id := range m.members {
+		ids = append(ids, id)
+	}
+	m.target = stickyAssign(m.target, ids, m.partitions)
+	m.generation++
+}
+
+// stickyAssign shares partitions partitions among members as evenly as it
+// can, their shares differing by one at most, while moving as few of them
+// as it can from the members they were shared to before, in prev.
+func stickyAssign(prev map[string][]uint32, members []string, partitions uint32) map[string][]uint32 {
+	target := make(map[string][]uint32, len(members))
+	if len(members) == 0 {
+		return target
+	}
+	sort.Strings(members)
+
+	// Members keep what they had, unless the partition's gone.
+	taken := make(map[uint32]bool)
+	for _, id := range members {
+		for _, p := range prev[id] {
+			if p < partitions && !taken[p] {
+				taken[p] = true
+				target[id] = append(target[id], p)
+			}
+		}
+	}
+
+	// Those keeping the most get the larger shares, so fewer move.
+	order := append([]string(nil), members...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(target[order[i]]) > len(target[order[j]])
+	})
+	n := uint32(len(members))
+	quota := make(map[string]int, len(members))
+	for i, id := range order {
+		quota[id] = int(partitions / n)
+		if uint32(i) < partitions%n {
+			quota[id]++
+		}
+	}
+
+	var pool []uint32
+	for _, id := range order {
+		if kept := target[id]; len(kept) > quota[id] {
+			pool = append(pool, kept[quota[id]:]...)
+			target[id] = kept[:quota[id]]
+		}
+	}
+	for p := uint32(0); p < partitions; p++ {
+		if !taken[p] {
+			pool = append(pool, p)
+		}
+	}
+	sort.Slice(pool, func(i, j int) bool { return pool[i] < pool[j] })
+	for _, id := range order {
+		for len(target[id]) < quota[id] {
+			target[id] = append(target[id], pool[0])
+			pool = pool[1:]
+		}
+		sort.Slice(target[id], func(i, j int) bool { return target[id][i] < target[id][j] })
+	}
+	return target
+}
+
+func (s *grpcServer) Heartbeat(ctx context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	if err := s.checkMember(req.Group, req.Member); err != nil {
+		return nil, err
+	}
+	partitions, err := s.partitions(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return s.Groups.Heartbeat(req.Group, req.Member, req.Topic, partitions, req.Owned, s.Clock.Now())
+}
+
+func (s *grpcServer) LeaveGroup(ctx context.Context, req *api.LeaveGroupRequest) (*api.LeaveGroupResponse, error) {
+	if err := s.checkMember(req.Group, req.Member); err != nil {
+		return nil, err
+	}
+	s.Groups.Leave(req.Group, req.Member, req.Topic)
+	return &api.LeaveGroupResponse{}, nil
+}
+
+func (s *grpcServer) AssignPartitions(ctx context.Context, req *api.AssignPartitionsRequest) (*api.AssignPartitionsResponse, error) {
+	if s.Groups == nil {
+		return nil, status.Error(codes.Unimplemented, "the server doesn't track consumer groups")
+	}
+	if req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "group must be set")
+	}
+	partitions, err := s.partitions(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAssignments(req.Assignments, partitions); err != nil {
+		return nil, err
+	}
+	if err := s.Groups.Assign(req.Group, req.Topic, req.Assignments); err != nil {
+		return nil, err
+	}
+	return &api.AssignPartitionsResponse{}, nil
+}
+
+// checkAssignments fails static assignments that name no member, a
+// partition past the topic's, or an empty range, or that assign any of a
+// partition's offsets more than once.
+func checkAssignments(assignments []*api.PartitionAssignment, partitions uint32) error {
+	byPartition := make(map[uint32][]*api.PartitionAssignment)
+	for _, a := range assignments {
+		if a.Member == "" {
+			return status.Error(codes.InvalidArgument, "assignments must name a member")
+		}
+		if a.Partition >= partitions {
+			return status.Errorf(codes.InvalidArgument, "partition %d is out of range: the topic has %d", a.Partition, partitions)
+		}
+		if a.ToOffset != 0 && a.ToOffset <= a.FromOffset {
+			return status.Errorf(codes.InvalidArgument, "partition %d's range [%d, %d) is empty", a.Partition, a.FromOffset, a.ToOffset)
+		}
+		byPartition[a.Partition] = append(byPartition[a.Partition], a)
+	}
+	for p, ranges := range byPartition {
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].FromOffset < ranges[j].FromOffset })
+		for i := 1; i < len(ranges); i++ {
+			if prev := ranges[i-1]; prev.ToOffset == 0 || prev.ToOffset > ranges[i].FromOffset {
+				return status.Errorf(codes.InvalidArgument, "partition %d's ranges overlap at offset %d", p, ranges[i].FromOffset)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMember fails membership requests the server can't serve: those
+// without a group or member.
+func (s *grpcServer) checkMember(group, member string) error {
+	if s.Groups == nil {
+		return status.Error(codes.Unimplemented, "the server doesn't track consumer groups")
+	}
+	if group == "" || member == "" {
+		return status.Error(codes.InvalidArgument, "group and member must be set")
+	}
+	return nil
+}
+
+// partitions returns how many partitions topic has, the default log
+// counting as one, failing with an *api.ErrorUnknownTopic if there's no
+// such topic.
+func (s *grpcServer) partitions(topic string) (uint32, error) {
+	if topic == "" {
+		return 1, nil
+	}
+	if s.Topics != nil {
+		topics, err := s.Topics.ListTopics()
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range topics {
+			if t.Name == topic {
+				return t.Partitions, nil
+			}
+		}
+	}
+	return 0, &api.ErrorUnknownTopic{Topic: topic}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStickyAssign(t *testing.T) {
+	target := stickyAssign(nil, []string{"a", "b", "c"}, 7)
+	require.Equal(t, map[string][]uint32{
+		"a": {0, 1, 2},
+		"b": {3, 4},
+		"c": {5, 6},
+	}, target)
+
+	// When a member leaves, only its partitions move.
+	next := stickyAssign(target, []string{"a", "c"}, 7)
+	require.Subset(t, next["a"], target["a"])
+	require.Subset(t, next["c"], target["c"])
+	require.ElementsMatch(t, []uint32{0, 1, 2, 3, 4, 5, 6}, append(next["a"], next["c"]...))
+	require.InDelta(t, len(next["a"]), len(next["c"]), 1)
+
+	// When one joins, the others give it what they have over their share.
+	next = stickyAssign(target, []string{"a", "b", "c", "d"}, 7)
+	for _, id := range []string{"a", "b", "c"} {
+		require.Subset(t, target[id], next[id])
+	}
+	require.Len(t, next["d"], 1)
+
+	// Partitions that are gone are dropped.
+	require.Equal(t, map[string][]uint32{"a": {0}, "b": {1}}, stickyAssign(target, []string{"a", "b"}, 2))
+}
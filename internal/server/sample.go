@@ -0,0 +1,18 @@
+package server
+
+// sampled reports whether the record at off is in a sample of ratio of the
+// log's records, every record if ratio is zero. It hashes the offset, so
+// the sample is the same for every consumer, spreads evenly over the log,
+// and grows with the ratio: a record in a 1% sample is in the 10% sample.
+func sampled(off uint64, ratio float64) bool {
+	if ratio == 0 || ratio >= 1 {
+		return true
+	}
+	// splitmix64's finalizer, which mixes consecutive offsets into
+	// unrelated hashes.
+	h := off + 0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	h ^= h >> 31
+	return float64(h>>11) < ratio*(1<<53)
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampled(t *testing.T) {
+	const n = 100000
+	count := func(ratio float64) (c int) {
+		for off := uint64(0); off < n; off++ {
+			if sampled(off, ratio) {
+				c++
+			}
+		}
+		return c
+	}
+	require.Equal(t, n, count(0))
+	require.Equal(t, n, count(1))
+	require.InDelta(t, n/100, count(0.01), n/1000)
+	require.InDelta(t, n/10, count(0.1), n/100)
+
+	// Lower ratios sample a subset of higher ones.
+	for off := uint64(0); off < n; off++ {
+		if sampled(off, 0.01) {
+			require.True(t, sampled(off, 0.1))
+		}
+	}
+}
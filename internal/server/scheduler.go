@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrSchedulerQueueFull is returned by Acquire when MaxQueue requests are
+// already waiting for a worker.
+var ErrSchedulerQueueFull = errors.New("scheduler queue is full")
+
+// Priority is the scheduling class of a request.
+type Priority int
+
+const (
+	// PriorityInteractive is for latency sensitive work like produces.
+	PriorityInteractive Priority = iota
+	// PriorityBulk is for throughput work like replaying history.
+	PriorityBulk
+)
+
+// PriorityMetadataKey is the gRPC metadata key clients set to "interactive"
+// or "bulk" to pick the priority class of their requests.
+const PriorityMetadataKey = "prolog-priority"
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBulk:
+		return "bulk"
+	default:
+		return "interactive"
+	}
+}
+
+// WithPriority returns an outgoing context that asks the server to schedule
+// its requests under p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, PriorityMetadataKey, p.String())
+}
+
+// priorityFromContext returns the priority the client asked for, or def if
+// it didn't ask for one.
+func priorityFromContext(ctx context.Context, def Priority) Priority {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return def
+	}
+	vals := md.Get(PriorityMetadataKey)
+	if len(vals) == 0 {
+		return def
+	}
+	switch strings.ToLower(vals[0]) {
+	case "interactive":
+		return PriorityInteractive
+	case "bulk":
+		return PriorityBulk
+	}
+	return def
+}
+
+// SchedulerConfig configures a Scheduler.
+type SchedulerConfig struct {
+	// Workers is how many requests may run at once.
+	Workers int
+	// Weights sets each class's share of the workers when classes compete,
+	// e.g. 4 interactive to 1 bulk. Classes without a weight get 1.
+	Weights map[Priority]int
+	// MaxQueue, if set, bounds how many requests may wait for a worker.
+	// Requests beyond it are refused straight away, so a surge sheds load
+	// instead of piling up waiting goroutines.
+	MaxQueue int
+	// Metrics, if set, is where the scheduler reports its busy workers,
+	// the depth of each class's queue and the requests it refused.
+	Metrics *metrics.Registry
+}
+
+// Scheduler is a weighted fair scheduler that bounds how many requests run
+// at once. When requests of different priorities are waiting, freed slots
+// go to each class in proportion to its weight, so bulk consumers can't
+// inflate produce latency.
+type Scheduler struct {
+	mu       sync.Mutex
+	workers  int
+	free     int
+	weights  [2]int
+	credit   [2]int
+	queues   [2][]chan struct{}
+	maxQueue int
+	refused  *metrics.Counter
+}
+
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	s := &Scheduler{
+		free:     config.Workers,
+		maxQueue: config.MaxQueue,
+		refused:  &metrics.Counter{},
+	}
+	if s.free <= 0 {
+		s.free = 1
+	}
+	s.workers = s.free
+	for _, p := range []Priority{PriorityInteractive, PriorityBulk} {
+		w := config.Weights[p]
+		if w <= 0 {
+			w = 1
+		}
+		s.weights[p] = w
+	}
+	if m := config.Metrics; m != nil {
+		s.refused = m.Counter("scheduler_refused")
+		m.Gauge("scheduler_busy_workers", func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return float64(s.workers - s.free)
+		})
+		for _, p := range []Priority{PriorityInteractive, PriorityBulk} {
+			p := p
+			m.Gauge("scheduler_queue_depth_"+p.String(), func() float64 {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				return float64(len(s.queues[p]))
+			})
+		}
+	}
+	return s
+}
+
+// Acquire blocks until a worker is free for a request of priority p, or ctx
+// is done, or fails with ErrSchedulerQueueFull if too many requests are
+// waiting already. The caller must call release once the request has
+// finished.
+func (s *Scheduler) Acquire(ctx context.Context, p Priority) (release func(), err error) {
+	s.mu.Lock()
+	if s.free > 0 && len(s.queues[PriorityInteractive]) == 0 && len(s.queues[PriorityBulk]) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return s.release, nil
+	}
+	if s.maxQueue > 0 && len(s.queues[PriorityInteractive])+len(s.queues[PriorityBulk]) >= s.maxQueue {
+		s.mu.Unlock()
+		s.refused.Inc()
+		return nil, ErrSchedulerQueueFull
+	}
+	ready := make(chan struct{})
+	s.queues[p] = append(s.queues[p], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, ch := range s.queues[p] {
+			if ch == ready {
+				s.queues[p] = append(s.queues[p][:i], s.queues[p][i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// We were handed a worker as ctx finished, so give it back.
+		s.free++
+		s.dispatch()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.free++
+	s.dispatch()
+}
+
+// dispatch hands free workers to waiting requests using weighted round
+// robin: each class spends a credit per request and credits are refilled
+// from the weights once every waiting class has run out.
+func (s *Scheduler) dispatch() {
+	for s.free > 0 {
+		p, ok := s.next()
+		if !ok {
+			return
+		}
+		ready := s.queues[p][0]
+		s.queues[p] = s.queues[p][1:]
+		s.credit[p]--
+		s.free--
+		close(ready)
+	}
+}
+
+func (s *Scheduler) next() (Priority, bool) {
+	waiting := false
+	for _, p := range []Priority{PriorityInteractive, PriorityBulk} {
+		if len(s.queues[p]) == 0 {
+			continue
+		}
+		waiting = true
+		if s.credit[p] > 0 {
+			return p, true
+		}
+	}
+	if !waiting {
+		return 0, false
+	}
+	for p := range s.credit {
+		s.credit[p] = s.weights[p]
+	}
+	return s.next()
+}
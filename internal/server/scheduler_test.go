@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSchedulerWeights(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{
+		Workers: 1,
+		Weights: map[Priority]int{
+			PriorityInteractive: 3,
+			PriorityBulk:        1,
+		},
+	})
+	ctx := context.Background()
+
+	// Hold the only worker while requests queue up behind it.
+	release, err := s.Acquire(ctx, PriorityBulk)
+	require.NoError(t, err)
+
+	order := make(chan Priority, 8)
+	for i := 0; i < 4; i++ {
+		for _, p := range []Priority{PriorityBulk, PriorityInteractive} {
+			go func(p Priority) {
+				release, err := s.Acquire(ctx, p)
+				require.NoError(t, err)
+				order <- p
+				release()
+			}(p)
+		}
+	}
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues[PriorityInteractive]) == 4 && len(s.queues[PriorityBulk]) == 4
+	}, time.Second, 10*time.Millisecond)
+	release()
+
+	var got []Priority
+	for i := 0; i < 8; i++ {
+		got = append(got, <-order)
+	}
+	require.Equal(t, []Priority{
+		PriorityInteractive, PriorityInteractive, PriorityInteractive, PriorityBulk,
+		PriorityInteractive, PriorityBulk, PriorityBulk, PriorityBulk,
+	}, got)
+}
+
+func TestSchedulerAcquireCanceled(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Workers: 1})
+
+	release, err := s.Acquire(context.Background(), PriorityInteractive)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(ctx, PriorityBulk)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	release()
+	release, err = s.Acquire(context.Background(), PriorityBulk)
+	require.NoError(t, err)
+	release()
+}
+
+func TestSchedulerMaxQueue(t *testing.T) {
+	m := metrics.NewRegistry()
+	s := NewScheduler(SchedulerConfig{Workers: 1, MaxQueue: 1, Metrics: m})
+	ctx := context.Background()
+
+	release, err := s.Acquire(ctx, PriorityInteractive)
+	require.NoError(t, err)
+	queued := make(chan struct{})
+	go func() {
+		release, err := s.Acquire(ctx, PriorityBulk)
+		require.NoError(t, err)
+		release()
+		close(queued)
+	}()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues[PriorityBulk]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The queue is full, so more requests are refused rather than wait.
+	_, err = s.Acquire(ctx, PriorityInteractive)
+	require.Equal(t, ErrSchedulerQueueFull, err)
+	require.Equal(t, []metrics.Sample{
+		{Name: "scheduler_busy_workers", Kind: metrics.KindGauge, Value: 1},
+		{Name: "scheduler_queue_depth_bulk", Kind: metrics.KindGauge, Value: 1},
+		{Name: "scheduler_queue_depth_interactive", Kind: metrics.KindGauge, Value: 0},
+		{Name: "scheduler_refused", Kind: metrics.KindCounter, Value: 1},
+	}, m.Snapshot())
+
+	release()
+	<-queued
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, PriorityBulk, priorityFromContext(ctx, PriorityBulk))
+
+	md, _ := metadata.FromOutgoingContext(WithPriority(ctx, PriorityBulk))
+	ctx = metadata.NewIncomingContext(ctx, md)
+	require.Equal(t, PriorityBulk, priorityFromContext(ctx, PriorityInteractive))
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultSearchLimit and maxSearchLimit bound the matches a search
+	// returns, and defaultSearchScan and maxSearchScan the records it
+	// scans.
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+	defaultSearchScan  = 10000
+	maxSearchScan      = 1000000
+)
+
+// SearchRecords scans a window of the log for records matching the
+// request's matchers. It reads the window with ReadRange and stops at the
+// request's bounds, returning where to continue from, so a search never
+// costs more than a bounded range read.
+func (s *grpcServer) SearchRecords(ctx context.Context, req *api.SearchRecordsRequest) (*api.SearchRecordsResponse, error) {
+	matchers, err := compileMatchers(req.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	maxScan := req.MaxScan
+	if maxScan == 0 {
+		maxScan = defaultSearchScan
+	}
+	if maxScan > maxSearchScan {
+		maxScan = maxSearchScan
+	}
+
+	release, err := s.schedule(ctx, PriorityBulk)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	lowest, next, err := s.logRange()
+	if err != nil {
+		return nil, err
+	}
+	from, to := max(req.From, lowest), req.To
+	if to == 0 || to > next {
+		to = next
+	}
+	res := &api.SearchRecordsResponse{NextOffset: from}
+	if from >= to {
+		return res, nil
+	}
+
+	err = s.CommitLog.ReadRange(from, to, func(record *api.Record) error {
+		if len(res.Records) == limit || res.Scanned == maxScan {
+			return errPageFull
+		}
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		res.Scanned++
+		res.NextOffset = record.Offset + 1
+		if !inWindow(record, req.SinceUnixMs, req.UntilUnixMs) {
+			return nil
+		}
+		for _, m := range matchers {
+			if !m.match(record) {
+				return nil
+			}
+		}
+		s.consumed(record)
+		res.Records = append(res.Records, record)
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+	res.HasMore = res.NextOffset < to
+	return res, nil
+}
+
+// matcher is a compiled api.Matcher.
+type matcher struct {
+	header   string
+	contains string
+	regex    *regexp.Regexp
+	negate   bool
+}
+
+func compileMatchers(ms []*api.Matcher) ([]matcher, error) {
+	var compiled []matcher
+	for _, m := range ms {
+		c := matcher{header: m.Header, contains: m.Contains, negate: m.Negate}
+		if m.Regex != "" {
+			re, err := regexp.Compile(m.Regex)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid regex %q: %v", m.Regex, err)
+			}
+			c.regex = re
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func (m matcher) match(record *api.Record) bool {
+	var value string
+	if m.header == "" {
+		value = string(record.Value)
+	} else {
+		v, ok := record.Headers[m.header]
+		if !ok {
+			return m.negate
+		}
+		value = v
+	}
+	matched := strings.Contains(value, m.contains) &&
+		(m.regex == nil || m.regex.MatchString(value))
+	return matched != m.negate
+}
+
+// inWindow reports whether record was appended in the window from since up
+// to until, in Unix milliseconds, either of which may be zero for no bound.
+// Records without an append time are outside every bounded window.
+func inWindow(record *api.Record, since, until int64) bool {
+	if since == 0 && until == 0 {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, record.Headers[api.HeaderAppendTime])
+	if err != nil {
+		return false
+	}
+	ms := t.UnixMilli()
+	return (since == 0 || ms >= since) && (until == 0 || ms < until)
+}
@@ -2,73 +2,459 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"github.com/Tarunshrma/prolog/internal/budget"
+	"github.com/Tarunshrma/prolog/internal/clock"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+// Config configures a server. Its options are grouped by the part of the
+// server they concern into Storage, Auth, Telemetry and Limits, which are
+// embedded, so their fields read as the Config's, and can be set on their
+// own with NewGRPCServer's options.
 type Config struct {
-	CommitLog CommitLog
-	GetServer GetServer
+	Storage
+	Auth
+	Telemetry
+	Limits
+
+	// Lifecycle, if set, gates data-plane RPCs and the gRPC health service
+	// on the server's state. Without it the server is always serving.
+	Lifecycle *Lifecycle
+	// SplitBrain, if set, refuses produces while it's fenced, e.g. because
+	// the node is on the minority side of a split brain.
+	SplitBrain *SplitBrainGuard
+	// DisableReflection stops the server from registering the gRPC
+	// reflection service that tools like grpcurl and evans use to discover
+	// the API.
+	DisableReflection bool
+	// NodeName, if set, is stamped on produced records as their origin
+	// along with the append time and, if the log runs Raft, the leader's
+	// term.
+	NodeName string
+	// OTLP registers the OpenTelemetry logs service, so OTel collectors can
+	// export logs to the server over OTLP/gRPC.
+	OTLP bool
+	// CloudEvents, if set, rejects produced records that aren't valid
+	// CloudEvents and stores events in its mode, converting those produced
+	// in the other.
+	CloudEvents CloudEventsMode
+	// SessionTimeout bounds how long a consume carrying a session token
+	// waits for the node to hold the session's writes, and the records it's
+	// read, before failing with SESSION_BEHIND. Defaults to 5s.
+	SessionTimeout time.Duration
+	// Clock times produces and paces consumers, so tests can advance it
+	// instead of sleeping. Defaults to the system clock.
+	Clock clock.Clock
+}
+
+// Storage is the log the server serves and what it can do with it beyond
+// reads and writes.
+type Storage struct {
+	CommitLog  backend.CommitLog
+	GetServer  backend.GetServer
+	Quarantine backend.QuarantineLister
+	// Maintenance, if set, lets operators pause background maintenance
+	// through the Admin service.
+	Maintenance backend.MaintenancePauser
+	// Standby, if set, lets operators promote warm standbys and check a
+	// node's sync lag through the Admin service.
+	Standby backend.StandbyManager
+	// Members, if set, lets operators list and release the members
+	// quarantined for flapping through the Admin service.
+	Members backend.MemberQuarantine
+	// ClaimCheck, if set, moves large record values out of the log into a
+	// blob store.
+	ClaimCheck *ClaimCheck
+	// Topics, if set, serves produces and consumes that name a topic from
+	// its partitions, and lets clients create and list topics. Requests
+	// without a topic are served from CommitLog.
+	Topics backend.Topics
+	// Groups, if set, tracks the offsets consumer groups commit.
+	Groups *ConsumerGroups
+}
+
+// Auth decides which clients the server serves what.
+type Auth struct {
+	// TLS, if set, serves over TLS, authenticating clients as its
+	// ClientAuth says. config.SetupTLSConfig builds it from certificate
+	// files. Clients are then identified by their certificates' common
+	// names.
+	TLS *tls.Config
+	// Authorizer, if set, limits the RPCs the server serves to clients by
+	// the node's role.
+	Authorizer *Authorizer
+	// ACL, if set, limits the data-plane RPCs clients may call by the
+	// common name of their certificates, so it needs TLS verifying client
+	// certificates.
+	ACL *ACL
+}
+
+// Telemetry is where the server reports on itself.
+type Telemetry struct {
+	// Metrics, if set, is where the server counts the records and bytes it
+	// produces and consumes.
+	Metrics *metrics.Registry
+}
+
+// Limits bound the work the server takes on.
+type Limits struct {
+	// Scheduler, if set, bounds concurrent Produce and Consume work and
+	// shares it between priority classes.
+	Scheduler *Scheduler
+	// StreamLimiter, if set, caps the streams clients may have open at
+	// once.
+	StreamLimiter *StreamLimiter
+	// Budget, if set, accounts for the ConsumeStreams being served and
+	// refuses new ones over its limit.
+	Budget *budget.Budget
+	// MaxMessageBytes, if set, raises gRPC's 4MiB limit on the messages
+	// the server sends and receives, so it can serve large records.
+	// client.MaxMessageBytes sizes it from the log's MaxRecordBytes.
+	MaxMessageBytes int
+}
+
+// Option sets part of a server's Config.
+type Option func(*Config)
+
+// WithStorage sets the server's Storage.
+func WithStorage(storage Storage) Option {
+	return func(c *Config) { c.Storage = storage }
+}
+
+// WithAuth sets the server's Auth.
+func WithAuth(auth Auth) Option {
+	return func(c *Config) { c.Auth = auth }
+}
+
+// WithTelemetry sets the server's Telemetry.
+func WithTelemetry(telemetry Telemetry) Option {
+	return func(c *Config) { c.Telemetry = telemetry }
+}
+
+// WithLimits sets the server's Limits.
+func WithLimits(limits Limits) Option {
+	return func(c *Config) { c.Limits = limits }
 }
 
 var _ api.LogServer = (*grpcServer)(nil)
 
-func NewGRPCServer(config *Config) (*grpc.Server, error) {
-	srv := grpc.NewServer()
+// NewGRPCServer builds a server from config, which may be nil, with opts
+// applied to it.
+func NewGRPCServer(config *Config, opts ...Option) (*grpc.Server, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			config.Lifecycle.unaryInterceptor,
+			config.Authorizer.unaryInterceptor,
+			config.ACL.unaryInterceptor,
+			config.SplitBrain.unaryInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			config.Lifecycle.streamInterceptor,
+			config.Authorizer.streamInterceptor,
+			config.ACL.streamInterceptor,
+			config.SplitBrain.streamInterceptor,
+			config.StreamLimiter.streamInterceptor,
+		),
+	}
+	if config.TLS != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(config.TLS)))
+	}
+	if config.MaxMessageBytes > 0 {
+		serverOpts = append(serverOpts,
+			grpc.MaxRecvMsgSize(config.MaxMessageBytes),
+			grpc.MaxSendMsgSize(config.MaxMessageBytes),
+		)
+	}
+	srv := grpc.NewServer(serverOpts...)
 	s, err := newgrpcServer(config)
 	if err != nil {
 		return nil, err
 	}
 
 	api.RegisterLogServer(srv, s)
+	api.RegisterAdminServer(srv, &adminServer{Config: config})
+	if config.OTLP {
+		collogspb.RegisterLogsServiceServer(srv, &otlpServer{log: s})
+	}
+
+	// Reflection lets tools like grpcurl call a node without the protos.
+	if !config.DisableReflection {
+		reflection.Register(srv)
+	}
+
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, phaseHealthServer{Server: healthSrv, lifecycle: config.Lifecycle})
+	if config.Lifecycle != nil {
+		config.Lifecycle.OnChange(func(state State) {
+			status := healthpb.HealthCheckResponse_NOT_SERVING
+			if state == StateServing {
+				status = healthpb.HealthCheckResponse_SERVING
+			}
+			healthSrv.SetServingStatus("", status)
+		})
+	}
 	return srv, nil
 }
 
+// PhaseHeader is the header health checks report the server's Lifecycle
+// phase in, so probes of a server that's slow to start say what it's
+// waiting on, e.g. `grpcurl -v localhost:8400 grpc.health.v1.Health/Check`.
+const PhaseHeader = "prolog-phase"
+
+// phaseHealthServer is the gRPC health service, reporting the lifecycle's
+// phase in its checks' PhaseHeader.
+type phaseHealthServer struct {
+	*health.Server
+	lifecycle *Lifecycle
+}
+
+func (h phaseHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if h.lifecycle != nil {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(PhaseHeader, h.lifecycle.Phase()))
+	}
+	return h.Server.Check(ctx, req)
+}
+
 type grpcServer struct {
 	api.UnimplementedLogServer
 	*Config
-}
 
-type CommitLog interface {
-	Append(*api.Record) (uint64, error)
-	Read(uint64) (*api.Record, error)
+	recordsProduced *metrics.Counter
+	bytesProduced   *metrics.Counter
+	recordsConsumed *metrics.Counter
+	bytesConsumed   *metrics.Counter
+	// consumesTruncated counts consumes of records truncated from the log
+	// before they were consumed, e.g. by retention.
+	consumesTruncated *metrics.Counter
+
+	// topic and partition name the partition a server returned by route
+	// serves as its CommitLog. They're empty for the default log.
+	topic     string
+	partition uint32
 }
 
 func newgrpcServer(config *Config) (srv *grpcServer, err error) {
+	registry := config.Metrics
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
 	srv = &grpcServer{
-		Config: config,
+		Config:          config,
+		recordsProduced: registry.Counter("records_produced"),
+		bytesProduced:   registry.Counter("bytes_produced"),
+		recordsConsumed: registry.Counter("records_consumed"),
+		bytesConsumed:   registry.Counter("bytes_consumed"),
+
+		consumesTruncated: registry.Counter("consumes_truncated"),
 	}
 
 	return srv, nil
 }
 
 func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
+	received := s.Clock.Now()
+	if req.Record == nil {
+		return nil, status.Error(codes.InvalidArgument, "record is required")
+	}
+	if strings.HasPrefix(req.Topic, api.InternalTopicPrefix) {
+		return nil, status.Errorf(codes.InvalidArgument, "topic %q is internal", req.Topic)
+	}
+	s, err := s.route(req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.schedule(ctx, PriorityInteractive)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	epoch, err := s.fence(req.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	// The log sets records' terms; a fenced write carries the term it was
+	// fenced to, so the log can reject it if the term changes before it
+	// commits.
+	req.Record.Term = 0
+	if req.Epoch != nil {
+		req.Record.Term = epoch.GetTerm()
+	}
+	if err := s.cloudEvents(req.Record); err != nil {
+		return nil, err
+	}
+	s.stamp(req.Record)
+	if err := s.checkClaim(ctx, req.Record); err != nil {
+		return nil, err
+	}
 	off, err := s.CommitLog.Append(req.Record)
 	if err != nil {
 		return nil, err
 	}
+	s.recordsProduced.Inc()
+	s.bytesProduced.Add(uint64(len(req.Record.Value)))
+
+	res := &api.ProduceResponse{
+		Offset:              off,
+		ReceiveTimeUnixNano: received.UnixNano(),
+		CommitTimeUnixNano:  s.Clock.Now().UnixNano(),
+		Epoch:               epoch,
+	}
+	if req.Verbose {
+		res.Location = s.locate(off)
+	}
+	return res, nil
+}
+
+// locate returns where the commit log stored the record at off, or nil if
+// it can't tell. The record is already committed, so failing to locate it
+// doesn't fail the produce.
+func (s *grpcServer) locate(off uint64) *api.RecordLocation {
+	l, ok := s.CommitLog.(backend.Locator)
+	if !ok {
+		return nil
+	}
+	location, err := l.Locate(off)
+	if err != nil {
+		return nil
+	}
+	return location
+}
 
-	return &api.ProduceResponse{Offset: off}, nil
+// fence returns the cluster's epoch, rejecting the write if the client sent
+// a different one. Logs without an epoch accept every write.
+func (s *grpcServer) fence(sent *api.Epoch) (*api.Epoch, error) {
+	e, ok := s.CommitLog.(backend.Epocher)
+	if !ok {
+		return nil, nil
+	}
+	current, err := e.Epoch()
+	if err != nil {
+		return nil, err
+	}
+	if sent != nil && sent.Compare(current) != 0 {
+		return nil, &api.ErrorEpochMismatch{Sent: sent, Current: current}
+	}
+	return current, nil
 }
 
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
-	record, err := s.CommitLog.Read(req.Offset)
+	s, err := s.route(req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	// Wait before taking a worker, so reads waiting on replication don't
+	// hold up others.
+	if err := s.awaitSession(ctx, req.Session); err != nil {
+		return nil, err
+	}
+	release, err := s.schedule(ctx, PriorityBulk)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	off, err := s.startOffset(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkDiverged(off, req.LastTerm); err != nil {
+		return nil, err
+	}
+
+	return s.read(ctx, off, req.ResolveClaimChecks)
+}
+
+// read reads the record at off for a consumer, resolving its claim check
+// if resolveClaims is set. The caller holds a worker.
+func (s *grpcServer) read(ctx context.Context, off uint64, resolveClaims bool) (*api.ConsumeResponse, error) {
+	record, err := s.CommitLog.Read(off)
+	if err != nil {
+		if _, ok := err.(*api.ErrorOffsetTruncated); ok {
+			s.consumesTruncated.Inc()
+		}
+		return nil, err
+	}
+	if resolveClaims {
+		if err := s.resolveClaim(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	s.consumed(record)
 
 	return &api.ConsumeResponse{Record: record}, nil
 }
 
+// produceReadAhead is how many requests ProduceStream receives ahead of the
+// one it's appending, so clients pipelining produces don't wait on a
+// receive between appends.
+const produceReadAhead = 64
+
+// ProduceStream appends the records a client sends, which it may send
+// without waiting for the previous ones to be acknowledged. Requests are
+// received ahead, but appended and acknowledged one at a time in the order
+// they were sent, so a stream's offsets increase in send order. The first
+// that fails ends the stream without the rest being appended.
 func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
+	type received struct {
+		req *api.ProduceRequest
+		err error
+	}
+	reqs := make(chan received, produceReadAhead)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case reqs <- received{req, err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
 	for {
-		req, err := stream.Recv()
-		if err != nil {
-			return err
+		r := <-reqs
+		if r.err == io.EOF {
+			// The client closed its side and every record it sent is
+			// acknowledged.
+			return nil
+		}
+		if r.err != nil {
+			return r.err
 		}
 
-		resp, err := s.Produce(stream.Context(), req)
+		resp, err := s.Produce(stream.Context(), r.req)
 		if err != nil {
 			return err
 		}
@@ -80,36 +466,303 @@ func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 }
 
 func (s *grpcServer) ConsumeStream(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
+	return s.consumeStream(req, stream, nil)
+}
+
+// consumeStreamServer is the sending side of ConsumeStream and
+// ConsumeControlled streams.
+type consumeStreamServer interface {
+	Send(*api.ConsumeResponse) error
+	Context() context.Context
+}
+
+// consumeStream streams records to stream from where req says, holding
+// them back while gate is paused.
+func (s *grpcServer) consumeStream(req *api.ConsumeRequest, stream consumeStreamServer, gate *pauseGate) error {
+	if req.SampleRatio < 0 || req.SampleRatio > 1 {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"sample ratio must be between 0 and 1, got %g",
+			req.SampleRatio,
+		)
+	}
+	s, err := s.route(req.Topic, req.Partition)
+	if err != nil {
+		return err
+	}
+
+	// Wait for the session's writes once, rather than for every record.
+	if err := s.awaitSession(stream.Context(), req.Session); err != nil {
+		return err
+	}
+	req.Session = nil
+
+	// Resolve a relative start once, then stream on from that offset.
+	off, err := s.startOffset(req)
+	if err != nil {
+		return err
+	}
+	if err := s.checkDiverged(off, req.LastTerm); err != nil {
+		return err
+	}
+	req.Offset = off
+	req.Position = api.ConsumeRequest_OFFSET
+	req.RelativeOffset = 0
+	req.LastTerm = 0
+
+	if !s.Budget.TryAcquire(budget.ConsumeStreams, 1) {
+		return &api.ErrorTooManyStreams{
+			Scope:    "node",
+			Identity: identity(stream.Context()),
+			Limit:    int(s.Budget.Limit(budget.ConsumeStreams)),
+		}
+	}
+	defer s.Budget.Release(budget.ConsumeStreams, 1)
+	// Take a worker for the life of the stream, rather than for each
+	// record it reads.
+	release, err := s.schedule(stream.Context(), PriorityBulk)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	p := newPacer(s.Clock, req.MaxRecordsPerSecond, req.MaxBytesPerSecond)
+	draining := s.Lifecycle.Draining()
+	heartbeat := time.Duration(req.HeartbeatIntervalMs) * time.Millisecond
+	lastSent := s.Clock.Now()
+	idle := minIdleWait
+
 	for {
+		if resumed := gate.paused(); resumed != nil {
+			// Hold records back, keeping the stream's position, and
+			// keep sending heartbeats so the stream isn't taken for
+			// dead.
+			var tick <-chan time.Time
+			if heartbeat > 0 {
+				tick = s.Clock.After(heartbeat)
+			}
+			select {
+			case <-stream.Context().Done():
+				return nil
+			case <-draining:
+				return &api.ErrorNotServing{State: StateDraining.String()}
+			case <-resumed:
+			case <-tick:
+				if err := s.sendHeartbeat(stream); err != nil {
+					return err
+				}
+				lastSent = s.Clock.Now()
+			}
+			continue
+		}
+
 		select {
 		case <-stream.Context().Done():
 			return nil
+		case <-draining:
+			// Hang up so the server can stop; the client resumes from
+			// another node.
+			return &api.ErrorNotServing{State: StateDraining.String()}
 		default:
-			resp, err := s.Consume(stream.Context(), req)
+			// Skip records outside the sample without reading them, even
+			// past the end of the log: the stream waits at the next
+			// offset in the sample.
+			if !sampled(req.Offset, req.SampleRatio) {
+				req.Offset++
+				continue
+			}
+			resp, err := s.read(stream.Context(), req.Offset, req.ResolveClaimChecks)
 			switch err.(type) {
 			case nil:
-			case api.ErrorOffsetOutOfRange:
+				idle = minIdleWait
+			case *api.ErrorOffsetOutOfRange:
+				// Past the end of the log, wait for appends, checking
+				// less often the longer the log stays idle. Truncated
+				// records won't come, so those errors end the stream.
+				wait := idle
+				if heartbeat > 0 {
+					wait = min(wait, max(heartbeat-s.Clock.Now().Sub(lastSent), 0))
+				}
+				select {
+				case <-stream.Context().Done():
+					return nil
+				case <-draining:
+					return &api.ErrorNotServing{State: StateDraining.String()}
+				case <-s.Clock.After(wait):
+				}
+				idle = min(2*idle, maxIdleWait)
+				if heartbeat > 0 && s.Clock.Now().Sub(lastSent) >= heartbeat {
+					if err := s.sendHeartbeat(stream); err != nil {
+						return err
+					}
+					lastSent = s.Clock.Now()
+				}
 				continue
 			default:
 				return err
 			}
+			if err := p.wait(stream.Context(), proto.Size(resp.Record)); err != nil {
+				return nil
+			}
 			if err := stream.Send(resp); err != nil {
 				return err
 			}
+			lastSent = s.Clock.Now()
 			req.Offset++
 		}
 	}
 }
 
+// minIdleWait and maxIdleWait bound how long a consume stream that's
+// caught up waits before checking the log for appends again.
+const (
+	minIdleWait = time.Millisecond
+	maxIdleWait = 100 * time.Millisecond
+)
+
+// sendHeartbeat tells an idle consumer the stream is alive and where the
+// log ends.
+func (s *grpcServer) sendHeartbeat(stream consumeStreamServer) error {
+	_, next, err := s.logRange()
+	if err != nil {
+		return err
+	}
+	return stream.Send(&api.ConsumeResponse{HighWatermark: next})
+}
+
+func (s *grpcServer) ConsumeRange(req *api.ConsumeRangeRequest, stream api.Log_ConsumeRangeServer) error {
+	if req.To <= req.From {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"range end %d must be after its start %d",
+			req.To,
+			req.From,
+		)
+	}
+
+	release, err := s.schedule(stream.Context(), PriorityBulk)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.CommitLog.ReadRange(req.From, req.To, func(record *api.Record) error {
+		if req.ResolveClaimChecks {
+			if err := s.resolveClaim(stream.Context(), record); err != nil {
+				return err
+			}
+		}
+		s.consumed(record)
+		return stream.Send(&api.ConsumeResponse{Record: record})
+	})
+}
+
+func (s *grpcServer) consumed(record *api.Record) {
+	s.recordsConsumed.Inc()
+	s.bytesConsumed.Add(uint64(len(record.Value)))
+}
+
+// schedule waits for the scheduler to admit a request at the priority the
+// client asked for, or def if it didn't ask.
+func (s *grpcServer) schedule(ctx context.Context, def Priority) (release func(), err error) {
+	if s.Scheduler == nil {
+		return func() {}, nil
+	}
+	release, err = s.Scheduler.Acquire(ctx, priorityFromContext(ctx, def))
+	if err == ErrSchedulerQueueFull {
+		return nil, status.Error(codes.ResourceExhausted, "server is overloaded, try again later")
+	}
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return release, nil
+}
+
+// checkDiverged fails if a consumer resuming at off read the record before
+// it with a term other than the one the log holds now.
+func (s *grpcServer) checkDiverged(off, lastTerm uint64) error {
+	if lastTerm == 0 || off == 0 {
+		return nil
+	}
+	record, err := s.CommitLog.Read(off - 1)
+	switch err.(type) {
+	case nil:
+	case *api.ErrorOffsetOutOfRange, *api.ErrorOffsetTruncated:
+		// Not here yet, or gone, so there's nothing to compare.
+		return nil
+	default:
+		return err
+	}
+	if record.Term != lastTerm {
+		return &api.ErrorLogDiverged{Offset: off, Want: lastTerm, Got: record.Term}
+	}
+	return nil
+}
+
+// startOffset resolves the offset a consume request starts reading from.
+func (s *grpcServer) startOffset(req *api.ConsumeRequest) (uint64, error) {
+	if req.RelativeOffset > 0 {
+		return 0, status.Errorf(
+			codes.InvalidArgument,
+			"relative offset must be negative, got %d",
+			req.RelativeOffset,
+		)
+	}
+
+	if req.RelativeOffset == 0 {
+		switch req.Position {
+		case api.ConsumeRequest_OFFSET:
+			return req.Offset, nil
+		case api.ConsumeRequest_EARLIEST:
+			return s.CommitLog.LowestOffset()
+		}
+	}
+
+	lowest, next, err := s.logRange()
+	if err != nil {
+		return 0, err
+	}
+	if req.RelativeOffset == 0 {
+		return next, nil
+	}
+	back := uint64(-req.RelativeOffset)
+	if back > next-lowest {
+		return lowest, nil
+	}
+	return next - back, nil
+}
+
 func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
 	servers, err := s.GetServer.GetServers()
 	if err != nil {
 		return nil, err
 	}
 
-	return &api.GetServersResponse{Servers: servers}, nil
+	res := &api.GetServersResponse{Servers: servers}
+	if e, ok := s.CommitLog.(backend.Epocher); ok {
+		if res.Epoch, err = e.Epoch(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
-type GetServer interface {
-	GetServers() ([]*api.Server, error)
+// stamp records where and when record was first appended. Records that
+// already have an origin, e.g. ones being replicated or mirrored from
+// another node, keep it.
+func (s *grpcServer) stamp(record *api.Record) {
+	if s.NodeName == "" || record == nil {
+		return
+	}
+	if _, ok := record.Headers[api.HeaderOriginNode]; ok {
+		return
+	}
+	if record.Headers == nil {
+		record.Headers = make(map[string]string)
+	}
+	record.Headers[api.HeaderOriginNode] = s.NodeName
+	record.Headers[api.HeaderAppendTime] = s.Clock.Now().UTC().Format(time.RFC3339Nano)
+	if t, ok := s.CommitLog.(backend.Termer); ok {
+		record.Headers[api.HeaderOriginTerm] = strconv.FormatUint(t.Term(), 10)
+	}
 }
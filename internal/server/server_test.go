@@ -2,13 +2,32 @@ package server
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Tarunshrma/prolog/backend"
+	"github.com/Tarunshrma/prolog/internal/blob"
+	"github.com/Tarunshrma/prolog/internal/clock"
 	"github.com/Tarunshrma/prolog/internal/log"
-	"github.com/test-go/testify/require"
+	"github.com/Tarunshrma/prolog/internal/metrics"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	api "github.com/Tarunshrma/prolog/api/v1"
 )
@@ -17,7 +36,25 @@ func TestServer(t *testing.T) {
 	for scenario, fn := range map[string]func(t *testing.T, client api.LogClient, config *Config){
 		"produce/consume a message to/from the log succeeds": testProduceConsume,
 		"produce/consume stream succeeds":                    testProduceConsumeStream,
+		"pipelined produce stream acks in send order":        testProduceStreamPipelined,
 		"consume past log boundries fails":                   testConsumePastBoundry,
+		"consume after a diverged record fails":              testConsumeDiverged,
+		"consume from relative positions succeeds":           testConsumeRelative,
+		"relative positions stay within the log's range":     testConsumeRelativeBounds,
+		"consume stream is paced":                            testConsumeStreamPaced,
+		"consume stream samples records":                     testConsumeStreamSampled,
+		"idle consume stream sends heartbeats":               testConsumeStreamHeartbeat,
+		"heartbeats report an empty log's end as zero":       testConsumeStreamHeartbeatEmpty,
+		"controlled consume stream pauses and resumes":       testConsumeControlled,
+		"consume range streams a bounded range":              testConsumeRange,
+		"list records pages through the log":                 testListRecords,
+		"search records scans a bounded window":              testSearchRecords,
+		"cloudevents mode validates and converts events":     testCloudEvents,
+		"consume with a session waits for its writes":        testConsumeSession,
+		"topics partition records into independent logs":     testTopics,
+		"consumer groups commit and fetch offsets":           testConsumerGroups,
+		"consumer groups rebalance cooperatively":            testGroupRebalance,
+		"consumer groups take static assignments":            testStaticAssignment,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			client, config, teardown := setupTest(t, nil)
@@ -27,6 +64,401 @@ func TestServer(t *testing.T) {
 	}
 }
 
+func testCloudEvents(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	binary := &api.Record{
+		Value:       []byte(`{"order":"o-1"}`),
+		ContentType: "application/json",
+		Headers: map[string]string{
+			"ce-specversion": "1.0",
+			"ce-id":          "1",
+			"ce-source":      "/checkout",
+			"ce-type":        "order.placed",
+		},
+	}
+
+	// Binary events are stored structured.
+	config.CloudEvents = CloudEventsStructured
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: binary})
+	require.NoError(t, err)
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, api.ContentTypeCloudEvents, consume.Record.ContentType)
+	require.NotContains(t, consume.Record.Headers, "ce-id")
+	require.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "1",
+		"source": "/checkout",
+		"type": "order.placed",
+		"datacontenttype": "application/json",
+		"data": {"order": "o-1"}
+	}`, string(consume.Record.Value))
+
+	// And structured ones binary.
+	config.CloudEvents = CloudEventsBinary
+	structured := &api.Record{
+		Value:       consume.Record.Value,
+		ContentType: api.ContentTypeCloudEvents,
+	}
+	produce, err = client.Produce(ctx, &api.ProduceRequest{Record: structured})
+	require.NoError(t, err)
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, "application/json", consume.Record.ContentType)
+	require.Equal(t, `{"order":"o-1"}`, string(consume.Record.Value))
+	for k, v := range binary.Headers {
+		require.Equal(t, v, consume.Record.Headers[k])
+	}
+
+	// Records that aren't events are rejected.
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello")},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testTopics(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 2},
+	})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	topics, err := log.NewTopics(t.TempDir(), log.Config{})
+	require.NoError(t, err)
+	defer topics.Close()
+	config.Topics = topics
+
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 2},
+	})
+	require.NoError(t, err)
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 1},
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "../orders", Partitions: 1},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Internal topics are the cluster's own.
+	require.NoError(t, topics.CreateTopic(ConsumerOffsetsTopic, 1))
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "__orders", Partitions: 1},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("forged")},
+		Topic:  ConsumerOffsetsTopic,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Topics, 3)
+	require.Equal(t, "orders", list.Topics[2].Name)
+	require.Equal(t, uint32(2), list.Topics[2].Partitions)
+
+	// Each partition has its own offsets, apart from the default log's.
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("default")}})
+	require.NoError(t, err)
+	for _, value := range []string{"first", "second"} {
+		produce, err := client.Produce(ctx, &api.ProduceRequest{
+			Record:    &api.Record{Value: []byte(value)},
+			Topic:     "orders",
+			Partition: 1,
+		})
+		require.NoError(t, err)
+		consume, err := client.Consume(ctx, &api.ConsumeRequest{
+			Offset:    produce.Offset,
+			Topic:     "orders",
+			Partition: 1,
+		})
+		require.NoError(t, err)
+		require.Equal(t, value, string(consume.Record.Value))
+	}
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, "default", string(consume.Record.Value))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: "orders"})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Position:  api.ConsumeRequest_EARLIEST,
+		Topic:     "orders",
+		Partition: 1,
+	})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "first", string(res.Record.Value))
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record:    &api.Record{Value: []byte("lost")},
+		Topic:     "orders",
+		Partition: 2,
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Partition: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Topics can override the node's log settings when they're created,
+	// and through the Admin service afterwards.
+	retention := &api.TopicConfig{RetentionMaxAgeMs: 60000}
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "audit", Partitions: 1, Config: retention},
+	})
+	require.NoError(t, err)
+	admin := &adminServer{Config: config}
+	segments := &api.TopicConfig{SegmentMaxStoreBytes: 4096}
+	configured, err := admin.ConfigureTopic(ctx, &api.ConfigureTopicRequest{Topic: "orders", Config: segments})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), configured.Topic.Partitions)
+	_, err = admin.ConfigureTopic(ctx, &api.ConfigureTopicRequest{Topic: ConsumerOffsetsTopic, Config: segments})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = admin.ConfigureTopic(ctx, &api.ConfigureTopicRequest{Topic: "missing", Config: segments})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	list, err = client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Topics, 4)
+	require.True(t, proto.Equal(retention, list.Topics[2].Config))
+	require.True(t, proto.Equal(segments, list.Topics[3].Config))
+
+	// Watchers see every change to the topics, from where they ask, and
+	// then each change as it's made.
+	watch, err := client.WatchTopics(ctx, &api.WatchTopicsRequest{Offset: 1})
+	require.NoError(t, err)
+	for _, want := range []struct {
+		typ   api.TopicEvent_Type
+		topic string
+	}{
+		{api.TopicEvent_CREATED, "audit"},
+		{api.TopicEvent_CONFIGURED, "orders"},
+	} {
+		event, err := watch.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want.typ, event.Type)
+		require.Equal(t, want.topic, event.Topic.Name)
+	}
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "payments", Partitions: 3},
+	})
+	require.NoError(t, err)
+	event, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, api.TopicEvent_CREATED, event.Type)
+	require.Equal(t, uint32(3), event.Topic.Partitions)
+	require.Equal(t, uint64(3), event.Offset)
+}
+
+func testConsumerGroups(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	fetch := &api.FetchOffsetRequest{Group: "billing"}
+	_, err := client.FetchOffset(ctx, fetch)
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	topics, err := log.NewTopics(t.TempDir(), log.Config{})
+	require.NoError(t, err)
+	defer topics.Close()
+	config.Groups, err = NewConsumerGroups(topics)
+	require.NoError(t, err)
+
+	res, err := client.FetchOffset(ctx, fetch)
+	require.NoError(t, err)
+	require.False(t, res.Committed)
+
+	for _, next := range []uint64{3, 7} {
+		_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Offset: next})
+		require.NoError(t, err)
+	}
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "audit", Offset: 1})
+	require.NoError(t, err)
+	res, err = client.FetchOffset(ctx, fetch)
+	require.NoError(t, err)
+	require.True(t, res.Committed)
+	require.Equal(t, uint64(7), res.Offset)
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Offset: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing", Topic: "missing"})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	// Reopening the groups replays their commits, skipping records that
+	// aren't commits.
+	clog, err := topics.Partition(ConsumerOffsetsTopic, 0)
+	require.NoError(t, err)
+	_, err = clog.Append(&api.Record{Value: []byte("not a commit")})
+	require.NoError(t, err)
+	groups, err := NewConsumerGroups(topics)
+	require.NoError(t, err)
+	next, ok, err := groups.Fetch("billing", "", 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(7), next)
+	next, ok, err = groups.Fetch("audit", "", 0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), next)
+
+	// Commits others append, like those replicated from a Raft leader,
+	// are read before fetches.
+	require.NoError(t, groups.Commit("billing", "", 0, 9))
+	res, err = client.FetchOffset(ctx, fetch)
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), res.Offset)
+}
+
+func testGroupRebalance(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	topics, err := log.NewTopics(t.TempDir(), log.Config{})
+	require.NoError(t, err)
+	defer topics.Close()
+	require.NoError(t, topics.CreateTopic("orders", 4))
+	config.Topics = topics
+	config.Groups, err = NewConsumerGroups(topics)
+	require.NoError(t, err)
+	clk := clock.NewFake(time.Now())
+	config.Clock = clk
+
+	heartbeat := func(member string, owned ...uint32) *api.HeartbeatResponse {
+		t.Helper()
+		res, err := client.Heartbeat(ctx, &api.HeartbeatRequest{
+			Group:  "billing",
+			Member: member,
+			Topic:  "orders",
+			Owned:  owned,
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	res := heartbeat("a")
+	require.Equal(t, []uint32{0, 1, 2, 3}, res.Assigned)
+	require.Equal(t, uint64(DefaultGroupSessionTimeout.Milliseconds()), res.SessionTimeoutMs)
+	generation := res.Generation
+	heartbeat("a", 0, 1, 2, 3)
+
+	// A new member only gets the partitions moving to it once their old
+	// member has let them go, which keeps consuming the rest throughout.
+	res = heartbeat("b")
+	require.Empty(t, res.Assigned)
+	require.Greater(t, res.Generation, generation)
+	require.Equal(t, []uint32{0, 1}, heartbeat("a", 0, 1, 2, 3).Assigned)
+	require.Equal(t, []uint32{0, 1}, heartbeat("a", 0, 1).Assigned)
+	require.Equal(t, []uint32{2, 3}, heartbeat("b").Assigned)
+
+	// Members that stop heartbeating leave, and so do those that say so.
+	clk.Advance(DefaultGroupSessionTimeout + time.Second)
+	require.Equal(t, []uint32{0, 1, 2, 3}, heartbeat("b", 2, 3).Assigned)
+	heartbeat("a")
+	_, err = client.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "billing", Member: "b", Topic: "orders"})
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 1, 2, 3}, heartbeat("a").Assigned)
+
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", Member: "a", Topic: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", Topic: "orders"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testStaticAssignment(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	topics, err := log.NewTopics(t.TempDir(), log.Config{})
+	require.NoError(t, err)
+	defer topics.Close()
+	require.NoError(t, topics.CreateTopic("orders", 2))
+	config.Topics = topics
+	config.Groups, err = NewConsumerGroups(topics)
+	require.NoError(t, err)
+
+	heartbeat := func(member string) *api.HeartbeatResponse {
+		t.Helper()
+		res, err := client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "billing", Member: member, Topic: "orders"})
+		require.NoError(t, err)
+		return res
+	}
+
+	a := &api.PartitionAssignment{Member: "a", Partition: 0, ToOffset: 100}
+	b := []*api.PartitionAssignment{
+		{Member: "b", Partition: 0, FromOffset: 100},
+		{Member: "b", Partition: 1},
+	}
+	_, err = client.AssignPartitions(ctx, &api.AssignPartitionsRequest{
+		Group:       "billing",
+		Topic:       "orders",
+		Assignments: append([]*api.PartitionAssignment{a}, b...),
+	})
+	require.NoError(t, err)
+
+	res := heartbeat("a")
+	require.True(t, res.Static)
+	require.Equal(t, []uint32{0}, res.Assigned)
+	require.Len(t, res.Ranges, 1)
+	require.True(t, proto.Equal(a, res.Ranges[0]))
+	res = heartbeat("b")
+	require.Equal(t, []uint32{0, 1}, res.Assigned)
+	require.Len(t, res.Ranges, 2)
+	require.Empty(t, heartbeat("c").Assigned)
+
+	// Assignments are persisted with the commits.
+	groups, err := NewConsumerGroups(topics)
+	require.NoError(t, err)
+	reopened, err := groups.Heartbeat("billing", "a", "orders", 2, nil, time.Now())
+	require.NoError(t, err)
+	require.True(t, reopened.Static)
+	require.Equal(t, []uint32{0}, reopened.Assigned)
+
+	for _, assignments := range [][]*api.PartitionAssignment{
+		{{Partition: 0}},
+		{{Member: "a", Partition: 2}},
+		{{Member: "a", Partition: 0, FromOffset: 10, ToOffset: 10}},
+		{{Member: "a", Partition: 0, ToOffset: 10}, {Member: "b", Partition: 0, FromOffset: 5}},
+		{{Member: "a", Partition: 1}, {Member: "b", Partition: 1, FromOffset: 5}},
+	} {
+		_, err = client.AssignPartitions(ctx, &api.AssignPartitionsRequest{Group: "billing", Topic: "orders", Assignments: assignments})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// No assignments return the group to rebalancing.
+	_, err = client.AssignPartitions(ctx, &api.AssignPartitionsRequest{Group: "billing", Topic: "orders"})
+	require.NoError(t, err)
+	res = heartbeat("a")
+	require.False(t, res.Static)
+	require.Empty(t, res.Ranges)
+}
+
+func testConsumeSession(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}
+	_, err := client.Produce(ctx, req)
+	require.NoError(t, err)
+
+	// A consume of a write the node doesn't hold yet waits for it.
+	session := &api.Session{ProducedOffset: 1}
+	consumed := make(chan error)
+	go func() {
+		_, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 1, Session: session})
+		consumed <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.Produce(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, <-consumed)
+
+	// But only so long, whether the session wrote or read further than the
+	// node holds, and the node says where its log ends.
+	config.SessionTimeout = 50 * time.Millisecond
+	for _, session := range []*api.Session{{ProducedOffset: 5}, {ReadOffset: 5}} {
+		var trailer metadata.MD
+		_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 0, Session: session}, grpc.Trailer(&trailer))
+		st := status.Convert(err)
+		require.Equal(t, codes.Unavailable, st.Code())
+		require.Equal(t, "SESSION_BEHIND", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+		require.Equal(t, []string{"2"}, trailer.Get(api.LogEndMetadataKey))
+	}
+}
+
 func setupTest(t *testing.T, fn func(*Config)) (
 	client api.LogClient,
 	config *Config,
@@ -47,7 +479,7 @@ func setupTest(t *testing.T, fn func(*Config)) (
 	clog, err := log.NewLog(dir, log.Config{})
 	require.NoError(t, err)
 
-	cgf := &Config{CommitLog: clog}
+	cgf := &Config{Storage: Storage{CommitLog: clog}}
 	if fn != nil {
 		fn(cgf)
 	}
@@ -75,13 +507,30 @@ func testProduceConsume(t *testing.T, client api.LogClient, config *Config) {
 		Value: []byte("hello world"),
 	}
 
+	sent := time.Now()
 	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: want})
 	require.NoError(t, err)
+	acked := time.Now()
 	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
 	require.NoError(t, err)
 
 	require.Equal(t, want.Value, consume.Record.Value)
 	require.Equal(t, want.Offset, consume.Record.Offset)
+
+	// The server echoes when it received and committed the record.
+	require.True(t, sent.UnixNano() <= produce.ReceiveTimeUnixNano)
+	require.True(t, produce.ReceiveTimeUnixNano <= produce.CommitTimeUnixNano)
+	require.True(t, produce.CommitTimeUnixNano <= acked.UnixNano())
+	require.Nil(t, produce.Location)
+
+	// Verbose produces say where the record was stored.
+	produce, err = client.Produce(ctx, &api.ProduceRequest{Record: want, Verbose: true})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produce.Location.SegmentBaseOffset)
+	require.True(t, produce.Location.Position > 0)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func testProduceConsumeStream(t *testing.T, client api.LogClient, config *Config) {
@@ -122,6 +571,35 @@ func testProduceConsumeStream(t *testing.T, client api.LogClient, config *Config
 	}
 }
 
+func testProduceStreamPipelined(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	stream, err := client.ProduceStream(ctx)
+	require.NoError(t, err)
+
+	// Send every record before reading any acknowledgement.
+	for i := 0; i < 10; i++ {
+		err := stream.Send(&api.ProduceRequest{
+			Record: &api.Record{Value: []byte{byte(i)}},
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, stream.CloseSend())
+
+	for i := 0; i < 10; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), res.Offset)
+	}
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+
+	for i := 0; i < 10; i++ {
+		res, err := client.Consume(ctx, &api.ConsumeRequest{Offset: uint64(i)})
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(i)}, res.Record.Value)
+	}
+}
+
 func testConsumePastBoundry(t *testing.T, client api.LogClient, config *Config) {
 	ctx := context.Background()
 	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
@@ -132,10 +610,831 @@ func testConsumePastBoundry(t *testing.T, client api.LogClient, config *Config)
 		t.Fatal("consume not nil")
 	}
 
-	got := grpc.Code(err)
-	want := grpc.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Code())
+	got := status.Code(err)
+	want := (&api.ErrorOffsetOutOfRange{}).GRPCStatus().Code()
 	if got != want {
 		t.Fatalf("got err: %v, want: %v", got, want)
 	}
 
+	st := status.Convert(err)
+	require.Equal(t, codes.OutOfRange, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "OFFSET_OUT_OF_RANGE", info.Reason)
+	require.Equal(t, "1", info.Metadata["offset"])
+
+}
+
+func testConsumeDiverged(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world"), Term: 7},
+		})
+		require.NoError(t, err)
+	}
+
+	// The server ignores producers' terms, and a log without Raft leaves
+	// them unset.
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Zero(t, consume.Record.Term)
+
+	// A consumer that read the record before its offset in another term
+	// is told the log diverged.
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1, LastTerm: 3})
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "LOG_DIVERGED", info.Reason)
+	require.Equal(t, "3", info.Metadata["want"])
+	require.Equal(t, "0", info.Metadata["got"])
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 1, LastTerm: 3})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func testConsumeRelative(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	values := []string{"first", "second", "third"}
+	for _, value := range values {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte(value)},
+		})
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		req  *api.ConsumeRequest
+		want string
+	}{
+		{req: &api.ConsumeRequest{Position: api.ConsumeRequest_EARLIEST}, want: "first"},
+		{req: &api.ConsumeRequest{RelativeOffset: -1}, want: "third"},
+		{req: &api.ConsumeRequest{RelativeOffset: -2}, want: "second"},
+		{req: &api.ConsumeRequest{RelativeOffset: -10}, want: "first"},
+	} {
+		consume, err := client.Consume(ctx, tc.req)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, string(consume.Record.Value))
+	}
+
+	_, err := client.Consume(ctx, &api.ConsumeRequest{Position: api.ConsumeRequest_LATEST})
+	require.Error(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{RelativeOffset: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{RelativeOffset: -2})
+	require.NoError(t, err)
+	for _, want := range values[1:] {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want, string(res.Record.Value))
+	}
+}
+
+func testConsumeRelativeBounds(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	// On an empty log, the latest position and positions back from it
+	// start at the first record produced.
+	s := &grpcServer{Config: config}
+	for _, req := range []*api.ConsumeRequest{
+		{Position: api.ConsumeRequest_LATEST},
+		{RelativeOffset: -1},
+	} {
+		off, err := s.startOffset(req)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), off)
+	}
+
+	// Positions further back than the log's start begin at its lowest
+	// offset, not at zero, once the start has been truncated.
+	logConfig := log.Config{}
+	logConfig.Segment.MaxStoreBytes = 8
+	clog, err := log.NewLog(t.TempDir(), logConfig)
+	require.NoError(t, err)
+	defer clog.Close()
+	for i := 0; i < 5; i++ {
+		_, err := clog.Append(&api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, clog.Truncate(1))
+	lowest, err := clog.LowestOffset()
+	require.NoError(t, err)
+	require.True(t, lowest > 0)
+	config.CommitLog = clog
+
+	for _, tc := range []struct {
+		back int64
+		want uint64
+	}{
+		{back: -1, want: 4},
+		{back: -int64(5 - lowest), want: lowest},
+		{back: -10, want: lowest},
+	} {
+		consume, err := client.Consume(ctx, &api.ConsumeRequest{RelativeOffset: tc.back})
+		require.NoError(t, err)
+		require.Equal(t, tc.want, consume.Record.Offset)
+	}
+}
+
+func testConsumeStreamPaced(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	start := time.Now()
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Position:            api.ConsumeRequest_EARLIEST,
+		MaxRecordsPerSecond: 20,
+	})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := stream.Recv()
+		require.NoError(t, err)
+	}
+
+	// The first record goes out immediately, the rest 50ms apart.
+	require.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func testConsumeStreamSampled(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	var want []uint64
+	for i := uint64(0); i < 100; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+		if sampled(i, 0.1) {
+			want = append(want, i)
+		}
+	}
+	require.NotEmpty(t, want)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{SampleRatio: 0.1})
+	require.NoError(t, err)
+	var got []uint64
+	for range want {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		got = append(got, res.Record.Offset)
+	}
+	require.Equal(t, want, got)
+
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{SampleRatio: 2})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testConsumeStreamHeartbeat(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Offset:              0,
+		HeartbeatIntervalMs: 10,
+	})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), res.Record.Value)
+
+	// Caught up, the stream goes idle and heartbeats say where the log
+	// ends.
+	for i := 0; i < 2; i++ {
+		res, err = stream.Recv()
+		require.NoError(t, err)
+		require.Nil(t, res.Record)
+		require.Equal(t, uint64(1), res.HighWatermark)
+	}
+}
+
+func testConsumeStreamHeartbeatEmpty(t *testing.T, client api.LogClient, config *Config) {
+	stream, err := client.ConsumeStream(context.Background(), &api.ConsumeRequest{
+		Offset:              0,
+		HeartbeatIntervalMs: 10,
+	})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Nil(t, res.Record)
+	require.Equal(t, uint64(0), res.HighWatermark)
+}
+
+func TestServerLifecycle(t *testing.T) {
+	lifecycle := &Lifecycle{}
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Lifecycle = lifecycle
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}
+
+	// The startup phase is reported until the server serves.
+	lifecycle.SetPhase("joining-cluster")
+	for _, state := range []State{StateStarting, StateWaitingForQuorum, StateDraining} {
+		lifecycle.Set(state)
+		_, err := client.Produce(ctx, req)
+		st := status.Convert(err)
+		require.Equal(t, codes.Unavailable, st.Code())
+		require.Equal(t, 1, len(st.Details()))
+		info := st.Details()[0].(*errdetails.ErrorInfo)
+		require.Equal(t, "NOT_SERVING", info.Reason)
+		require.Equal(t, state.String(), info.Metadata["state"])
+		if state == StateDraining {
+			require.Equal(t, "draining", lifecycle.Phase())
+		} else {
+			require.Equal(t, "joining-cluster", lifecycle.Phase())
+		}
+	}
+
+	lifecycle.Set(StateServing)
+	require.Equal(t, "serving", lifecycle.Phase())
+	_, err := client.Produce(ctx, req)
+	require.NoError(t, err)
+}
+
+func TestServerSplitBrainGuard(t *testing.T) {
+	guard := &SplitBrainGuard{}
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.SplitBrain = guard
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}
+	_, err := client.Produce(ctx, req)
+	require.NoError(t, err)
+
+	// On the minority side, produces are refused but reads are served.
+	guard.Fence([]string{"a", "b"})
+	require.True(t, guard.Fenced())
+	_, err = client.Produce(ctx, req)
+	st := status.Convert(err)
+	require.Equal(t, codes.Unavailable, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "SPLIT_BRAIN", info.Reason)
+	require.Equal(t, "a,b", info.Metadata["leaders"])
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+
+	guard.Clear()
+	_, err = client.Produce(ctx, req)
+	require.NoError(t, err)
+}
+
+func TestServerMaintenance(t *testing.T) {
+	ctx := context.Background()
+	admin := &adminServer{Config: &Config{}}
+	_, err := admin.DescribeMaintenance(ctx, &api.DescribeMaintenanceRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = admin.TriggerMaintenance(ctx, &api.TriggerMaintenanceRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	maintenance := &pausedMaintenance{until: time.Now().Add(time.Hour)}
+	admin.Maintenance = maintenance
+	_, err = admin.PauseMaintenance(ctx, &api.PauseMaintenanceRequest{DurationMs: 1000, Cluster: true})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = admin.ResumeMaintenance(ctx, &api.ResumeMaintenanceRequest{Cluster: true})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	res, err := admin.DescribeMaintenance(ctx, &api.DescribeMaintenanceRequest{})
+	require.NoError(t, err)
+	require.Equal(t, maintenance.until.UnixMilli(), res.PausedUntilUnixMs)
+	_, err = admin.TriggerMaintenance(ctx, &api.TriggerMaintenanceRequest{})
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "MAINTENANCE_PAUSED", info.Reason)
+}
+
+// pausedMaintenance is a node's maintenance, paused until until, which
+// can't be paused cluster-wide.
+type pausedMaintenance struct {
+	until time.Time
+}
+
+func (m *pausedMaintenance) PauseMaintenance(time.Duration) (time.Time, error) {
+	return m.until, nil
+}
+
+func (m *pausedMaintenance) ResumeMaintenance() error {
+	return nil
+}
+
+func (m *pausedMaintenance) DescribeMaintenance() (*api.DescribeMaintenanceResponse, error) {
+	return &api.DescribeMaintenanceResponse{PausedUntilUnixMs: m.until.UnixMilli()}, nil
+}
+
+func (m *pausedMaintenance) TriggerMaintenance() (*api.TriggerMaintenanceResponse, error) {
+	return nil, &api.ErrorMaintenancePaused{Until: m.until}
+}
+
+func testConsumeControlled(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.ConsumeControlled(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ConsumeControl{
+		Request: &api.ConsumeRequest{HeartbeatIntervalMs: 10},
+		Action:  api.ConsumeControl_PAUSE,
+	}))
+
+	// Paused, the stream only sends heartbeats.
+	for i := 0; i < 3; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Nil(t, res.Record)
+		require.Equal(t, uint64(2), res.HighWatermark)
+	}
+
+	require.NoError(t, stream.Send(&api.ConsumeControl{Action: api.ConsumeControl_RESUME}))
+	var got []uint64
+	for len(got) < 2 {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		if res.Record != nil {
+			got = append(got, res.Record.Offset)
+		}
+	}
+	require.Equal(t, []uint64{0, 1}, got)
+
+	stream, err = client.ConsumeControlled(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ConsumeControl{Action: api.ConsumeControl_PAUSE}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerDrainingEndsConsumeStreams(t *testing.T) {
+	lifecycle := &Lifecycle{}
+	lifecycle.Set(StateServing)
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Lifecycle = lifecycle
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	// The stream is waiting at the end of the log until the server drains.
+	lifecycle.Set(StateDraining)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// readCounter counts the reads of the log it wraps.
+type readCounter struct {
+	backend.CommitLog
+	reads atomic.Int64
+}
+
+func (r *readCounter) Read(off uint64) (*api.Record, error) {
+	r.reads.Add(1)
+	return r.CommitLog.Read(off)
+}
+
+func TestServerIdleConsumeStream(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	var counter *readCounter
+	client, _, teardown := setupTest(t, func(c *Config) {
+		counter = &readCounter{CommitLog: c.CommitLog}
+		c.CommitLog = counter
+		c.Clock = clk
+		c.Scheduler = NewScheduler(SchedulerConfig{Workers: 2})
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+
+	// Caught up, the stream waits on the clock rather than rereading the
+	// log.
+	require.Eventually(t, func() bool { return counter.reads.Load() > 0 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(1), counter.reads.Load())
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	got := make(chan *api.ConsumeResponse)
+	go func() {
+		res, _ := stream.Recv()
+		got <- res
+	}()
+	var res *api.ConsumeResponse
+	require.Eventually(t, func() bool {
+		clk.Advance(maxIdleWait)
+		select {
+		case res = <-got:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []byte("hello world"), res.Record.Value)
+}
+
+func TestServerReflection(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		srv, err := NewGRPCServer(&Config{DisableReflection: disabled})
+		require.NoError(t, err)
+		_, registered := srv.GetServiceInfo()["grpc.reflection.v1.ServerReflection"]
+		require.Equal(t, !disabled, registered)
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	registry := metrics.NewRegistry()
+	config := &Config{NodeName: "node-0"}
+	_, err := NewGRPCServer(config,
+		WithTelemetry(Telemetry{Metrics: registry}),
+		WithLimits(Limits{MaxMessageBytes: 1 << 20}),
+	)
+	require.NoError(t, err)
+	// Options set their part of the config, leaving the rest.
+	require.Equal(t, registry, config.Metrics)
+	require.Equal(t, 1<<20, config.MaxMessageBytes)
+	require.Equal(t, "node-0", config.NodeName)
+
+	_, err = NewGRPCServer(nil, WithAuth(Auth{Authorizer: &Authorizer{Role: RoleAll}}))
+	require.NoError(t, err)
+}
+
+func TestServerStampsLineage(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.NodeName = "node-0"
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	before := time.Now()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+
+	headers := consume.Record.Headers
+	require.Equal(t, "node-0", headers[api.HeaderOriginNode])
+	appended, err := time.Parse(time.RFC3339Nano, headers[api.HeaderAppendTime])
+	require.NoError(t, err)
+	require.False(t, appended.Before(before))
+	// The log doesn't run Raft, so there's no term to stamp.
+	_, ok := headers[api.HeaderOriginTerm]
+	require.False(t, ok)
+
+	// Records replicated from another node keep their origin.
+	produce, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world"), Headers: headers},
+	})
+	require.NoError(t, err)
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, headers, consume.Record.Headers)
+}
+
+func testConsumeRange(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte{byte(i)}},
+		})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{From: 1, To: 4})
+	require.NoError(t, err)
+	for i := 1; i < 4; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), res.Record.Offset)
+		require.Equal(t, []byte{byte(i)}, res.Record.Value)
+	}
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+
+	stream, err = client.ConsumeRange(ctx, &api.ConsumeRangeRequest{From: 4, To: 4})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testListRecords(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	res, err := client.ListRecords(ctx, &api.ListRecordsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, res.Records)
+	require.Equal(t, uint64(0), res.NextOffset)
+
+	for i := 0; i < 5; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte{byte(i), byte(i)}},
+		})
+		require.NoError(t, err)
+	}
+	offsets := func(res *api.ListRecordsResponse) (offs []uint64) {
+		for _, record := range res.Records {
+			offs = append(offs, record.Offset)
+		}
+		return offs
+	}
+
+	res, err = client.ListRecords(ctx, &api.ListRecordsRequest{Start: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, offsets(res))
+	require.Equal(t, uint64(0), res.LowestOffset)
+	require.Equal(t, uint64(5), res.NextOffset)
+	require.True(t, res.HasMore)
+	require.Equal(t, uint64(3), res.NextStart)
+
+	res, err = client.ListRecords(ctx, &api.ListRecordsRequest{Start: res.NextStart, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, offsets(res))
+	require.False(t, res.HasMore)
+
+	// Newest first, cut short by the byte budget.
+	res, err = client.ListRecords(ctx, &api.ListRecordsRequest{
+		Position: api.ConsumeRequest_LATEST,
+		Reverse:  true,
+		MaxBytes: 5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 3}, offsets(res))
+	require.True(t, res.HasMore)
+	require.Equal(t, uint64(2), res.NextStart)
+
+	res, err = client.ListRecords(ctx, &api.ListRecordsRequest{Start: 1, Reverse: true})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 0}, offsets(res))
+	require.False(t, res.HasMore)
+
+	// A page always holds a record, however large.
+	res, err = client.ListRecords(ctx, &api.ListRecordsRequest{MaxBytes: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0}, offsets(res))
+}
+
+func testSearchRecords(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for i, value := range []string{"user signed up", "order placed", "user logged in", "order shipped"} {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{
+				Value:   []byte(value),
+				Headers: map[string]string{"shard": strconv.Itoa(i % 2)},
+			},
+		})
+		require.NoError(t, err)
+	}
+	search := func(req *api.SearchRecordsRequest) (offs []uint64, res *api.SearchRecordsResponse) {
+		res, err := client.SearchRecords(ctx, req)
+		require.NoError(t, err)
+		for _, record := range res.Records {
+			offs = append(offs, record.Offset)
+		}
+		return offs, res
+	}
+
+	offs, res := search(&api.SearchRecordsRequest{
+		Matchers: []*api.Matcher{{Contains: "user"}},
+	})
+	require.Equal(t, []uint64{0, 2}, offs)
+	require.Equal(t, uint64(4), res.Scanned)
+	require.False(t, res.HasMore)
+
+	offs, _ = search(&api.SearchRecordsRequest{
+		Matchers: []*api.Matcher{
+			{Regex: "^order"},
+			{Header: "shard", Contains: "0", Negate: true},
+		},
+	})
+	require.Equal(t, []uint64{1, 3}, offs)
+
+	offs, _ = search(&api.SearchRecordsRequest{
+		From:     1,
+		Matchers: []*api.Matcher{{Header: "shard", Regex: "^0$"}},
+	})
+	require.Equal(t, []uint64{2}, offs)
+
+	// Searches stop at their bounds and say where to continue.
+	offs, res = search(&api.SearchRecordsRequest{MaxScan: 3, Matchers: []*api.Matcher{{Contains: "shipped"}}})
+	require.Empty(t, offs)
+	require.True(t, res.HasMore)
+	require.Equal(t, uint64(3), res.NextOffset)
+	offs, res = search(&api.SearchRecordsRequest{From: res.NextOffset, Matchers: []*api.Matcher{{Contains: "shipped"}}})
+	require.Equal(t, []uint64{3}, offs)
+
+	offs, _ = search(&api.SearchRecordsRequest{
+		SinceUnixMs: time.Now().Add(time.Hour).UnixMilli(),
+	})
+	require.Empty(t, offs)
+
+	_, err := client.SearchRecords(ctx, &api.SearchRecordsRequest{
+		Matchers: []*api.Matcher{{Regex: "("}},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerOTLP(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		srv, err := NewGRPCServer(&Config{OTLP: enabled})
+		require.NoError(t, err)
+		_, registered := srv.GetServiceInfo()["opentelemetry.proto.collector.logs.v1.LogsService"]
+		require.Equal(t, enabled, registered)
+	}
+
+	client, config, teardown := setupTest(t, func(c *Config) {
+		c.OTLP = true
+	})
+	defer teardown()
+	s, err := newgrpcServer(config)
+	require.NoError(t, err)
+
+	str := func(s string) *commonpb.AnyValue {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+	}
+	ctx := context.Background()
+	_, err = (&otlpServer{log: s}).Export(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{{Key: "service.name", Value: str("checkout")}},
+			},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope: &commonpb.InstrumentationScope{Name: "http"},
+				LogRecords: []*logspb.LogRecord{{
+					TimeUnixNano:   42,
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+					SeverityText:   "ERROR",
+					Body:           str("payment failed"),
+					Attributes: []*commonpb.KeyValue{{
+						Key:   "http.status_code",
+						Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 502}},
+					}},
+					TraceId: []byte{0xab, 0xcd},
+				}, {
+					Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{
+						KvlistValue: &commonpb.KeyValueList{
+							Values: []*commonpb.KeyValue{{Key: "order", Value: str("o-1")}},
+						},
+					}},
+				}},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, "payment failed", string(consume.Record.Value))
+	require.Equal(t, map[string]string{
+		"otel.resource.service.name": "checkout",
+		"otel.attr.http.status_code": "502",
+		OTLPScopeName:                "http",
+		OTLPTime:                     "42",
+		OTLPSeverityText:             "ERROR",
+		OTLPSeverityNumber:           "17",
+		OTLPTraceID:                  "abcd",
+	}, consume.Record.Headers)
+	require.Equal(t, "text/plain", consume.Record.ContentType)
+
+	// Structured bodies are stored as JSON.
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"order":"o-1"}`, string(consume.Record.Value))
+	require.Equal(t, "application/json", consume.Record.ContentType)
+}
+
+func TestServerClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claim-check-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.ClaimCheck = &ClaimCheck{Store: &blob.FileStore{Dir: dir}, Threshold: 16}
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	large := []byte("a value too large to keep in the log")
+	for _, value := range [][]byte{[]byte("small"), large} {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: value}})
+		require.NoError(t, err)
+	}
+
+	// Records under the threshold are kept as is.
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, []byte("small"), consume.Record.Value)
+	_, ok := consume.Record.Headers[api.HeaderClaimCheck]
+	require.False(t, ok)
+
+	// The log keeps a pointer to large values unless asked to resolve it.
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	require.NoError(t, err)
+	require.Empty(t, consume.Record.Value)
+	require.NotEmpty(t, consume.Record.Headers[api.HeaderClaimCheck])
+	require.Equal(t, strconv.Itoa(len(large)), consume.Record.Headers[api.HeaderClaimCheckSize])
+
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1, ResolveClaimChecks: true})
+	require.NoError(t, err)
+	require.Equal(t, large, consume.Record.Value)
+	_, ok = consume.Record.Headers[api.HeaderClaimCheck]
+	require.False(t, ok)
+
+	stream, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{
+		From:               0,
+		To:                 2,
+		ResolveClaimChecks: true,
+	})
+	require.NoError(t, err)
+	for _, want := range [][]byte{[]byte("small"), large} {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want, res.Record.Value)
+	}
+
+	// A missing blob is reported rather than returning an empty value.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, files[0].Name())))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1, ResolveClaimChecks: true})
+	require.Equal(t, codes.DataLoss, status.Code(err))
+}
+
+// epochLog is a commit log with a cluster epoch, like a Raft log's.
+type epochLog struct {
+	*log.Log
+	epoch *api.Epoch
+}
+
+func (l *epochLog) Epoch() (*api.Epoch, error) {
+	return l.epoch, nil
+}
+
+func (l *epochLog) GetServers() ([]*api.Server, error) {
+	return nil, nil
+}
+
+func TestServerFencesWrites(t *testing.T) {
+	epoch := &api.Epoch{Term: 3, ConfigIndex: 10}
+	client, _, teardown := setupTest(t, func(c *Config) {
+		l := &epochLog{Log: c.CommitLog.(*log.Log), epoch: epoch}
+		c.CommitLog = l
+		c.GetServer = l
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	servers, err := client.GetServers(ctx, &api.GetServersRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 0, servers.Epoch.Compare(epoch))
+
+	// Unfenced writes and writes in the current epoch are accepted.
+	record := &api.Record{Value: []byte("hello world")}
+	for _, sent := range []*api.Epoch{nil, servers.Epoch} {
+		produce, err := client.Produce(ctx, &api.ProduceRequest{Record: record, Epoch: sent})
+		require.NoError(t, err)
+		require.Equal(t, 0, produce.Epoch.Compare(epoch))
+	}
+
+	for _, sent := range []*api.Epoch{
+		{Term: 2, ConfigIndex: 12},
+		{Term: 3, ConfigIndex: 9},
+		{Term: 4, ConfigIndex: 1},
+	} {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: record, Epoch: sent})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		info := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+		require.Equal(t, "EPOCH_MISMATCH", info.Reason)
+		require.Equal(t, "3", info.Metadata["current_term"])
+		require.Equal(t, "10", info.Metadata["current_config_index"])
+	}
 }
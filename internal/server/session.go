@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultSessionTimeout bounds how long a read carrying a session
+	// token waits for the node to catch up unless Config.SessionTimeout
+	// says otherwise.
+	defaultSessionTimeout = 5 * time.Second
+	// sessionPoll is how often a waiting read checks whether the node has
+	// caught up.
+	sessionPoll = 10 * time.Millisecond
+)
+
+// awaitSession waits until the log reaches the session's end, up to the
+// session timeout, so a read carrying it sees the session's writes and
+// nothing older than it's read. It tells the client where the log ended in
+// the LogEndMetadataKey trailer, so its load balancer learns which replicas
+// are behind its sessions.
+func (s *grpcServer) awaitSession(ctx context.Context, session *api.Session) error {
+	if session == nil {
+		return nil
+	}
+	end := session.End()
+	timeout := s.SessionTimeout
+	if timeout == 0 {
+		timeout = defaultSessionTimeout
+	}
+	deadline := s.Clock.Now().Add(timeout)
+	for {
+		_, next, err := s.logRange()
+		if err != nil {
+			return err
+		}
+		if behind := next < end; !behind || !s.Clock.Now().Before(deadline) {
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(api.LogEndMetadataKey, strconv.FormatUint(next, 10)))
+			if !behind {
+				return nil
+			}
+			return &api.ErrorSessionBehind{End: end, Next: next, Timeout: timeout}
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.Clock.After(sessionPoll):
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+)
+
+// SplitBrainGuard refuses produces while the node is on the minority side
+// of a split brain, where more than one node claims to lead the cluster, so
+// it takes no writes the majority's leader would overwrite once the
+// partition heals. Produces fail with an api.ErrorSplitBrain; other RPCs
+// are served as usual.
+type SplitBrainGuard struct {
+	mu      sync.RWMutex
+	leaders []string
+}
+
+// Fence refuses produces, naming the leaders the cluster's nodes claim.
+func (g *SplitBrainGuard) Fence(leaders []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.leaders = leaders
+}
+
+// Clear serves produces again.
+func (g *SplitBrainGuard) Clear() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.leaders = nil
+}
+
+// Fenced reports whether produces are refused.
+func (g *SplitBrainGuard) Fenced() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.leaders != nil
+}
+
+func (g *SplitBrainGuard) check(method string) error {
+	if g == nil || !produces(method) {
+		return nil
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.leaders == nil {
+		return nil
+	}
+	return &api.ErrorSplitBrain{Leaders: g.leaders}
+}
+
+func (g *SplitBrainGuard) unaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := g.check(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g *SplitBrainGuard) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := g.check(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// StreamLimiterConfig configures a StreamLimiter. Zero limits are
+// unlimited.
+type StreamLimiterConfig struct {
+	// PerIdentity is how many streams one client may have open at once.
+	PerIdentity int
+	// PerNode is how many streams the node serves at once.
+	PerNode int
+}
+
+// StreamLimiter caps the ConsumeStream and ProduceStream calls open at
+// once, per client and per node, so misbehaving clients can't exhaust the
+// node's goroutines and memory. Streams over a limit fail with a
+// ResourceExhausted status.
+//
+// Clients are identified by the common name of their verified TLS
+// certificate or, without one, by their IP address.
+type StreamLimiter struct {
+	config StreamLimiterConfig
+
+	mu         sync.Mutex
+	total      int
+	byIdentity map[string]int
+}
+
+func NewStreamLimiter(config StreamLimiterConfig) *StreamLimiter {
+	return &StreamLimiter{
+		config:     config,
+		byIdentity: make(map[string]int),
+	}
+}
+
+// limited reports whether method is a stream the limiter counts.
+func limited(method string) bool {
+	return method == api.Log_ConsumeStream_FullMethodName ||
+		method == api.Log_ConsumeControlled_FullMethodName ||
+		method == api.Log_ProduceStream_FullMethodName
+}
+
+// acquire counts a stream opened by identity, or fails if that would take
+// it or the node over a limit. The caller must call release once the
+// stream ends.
+func (l *StreamLimiter) acquire(identity string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.PerNode > 0 && l.total >= l.config.PerNode {
+		return nil, &api.ErrorTooManyStreams{
+			Scope:    "node",
+			Identity: identity,
+			Limit:    l.config.PerNode,
+		}
+	}
+	if l.config.PerIdentity > 0 && l.byIdentity[identity] >= l.config.PerIdentity {
+		return nil, &api.ErrorTooManyStreams{
+			Scope:    "identity",
+			Identity: identity,
+			Limit:    l.config.PerIdentity,
+		}
+	}
+	l.total++
+	l.byIdentity[identity]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.total--
+		if l.byIdentity[identity]--; l.byIdentity[identity] == 0 {
+			delete(l.byIdentity, identity)
+		}
+	}, nil
+}
+
+func (l *StreamLimiter) streamInterceptor(
+	srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if l == nil || !limited(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	release, err := l.acquire(identity(stream.Context()))
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, stream)
+}
+
+// identity names the client that made a request.
+func identity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if subject := subject(ctx); subject != "" {
+		return subject
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// subject returns the common name of the client's verified TLS
+// certificate, or "" if it presented none.
+func subject(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if chains := info.State.VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+			return chains[0][0].Subject.CommonName
+		}
+	}
+	return ""
+}
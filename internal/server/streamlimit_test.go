@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	l := NewStreamLimiter(StreamLimiterConfig{PerIdentity: 2, PerNode: 3})
+
+	releaseA1, err := l.acquire("a")
+	require.NoError(t, err)
+	_, err = l.acquire("a")
+	require.NoError(t, err)
+	_, err = l.acquire("a")
+	require.Equal(t, &api.ErrorTooManyStreams{Scope: "identity", Identity: "a", Limit: 2}, err)
+
+	_, err = l.acquire("b")
+	require.NoError(t, err)
+	_, err = l.acquire("c")
+	require.Equal(t, &api.ErrorTooManyStreams{Scope: "node", Identity: "c", Limit: 3}, err)
+
+	// Ending a stream frees its slot.
+	releaseA1()
+	_, err = l.acquire("c")
+	require.NoError(t, err)
+}
+
+func TestServerStreamLimits(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.StreamLimiter = NewStreamLimiter(StreamLimiterConfig{PerIdentity: 1})
+	})
+	defer teardown()
+
+	_, err := client.Produce(context.Background(), &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	_, err = first.Recv()
+	require.NoError(t, err)
+
+	second, err := client.ProduceStream(context.Background())
+	require.NoError(t, err)
+	_, err = second.Recv()
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, "TOO_MANY_STREAMS", info.Reason)
+	require.Equal(t, "identity", info.Metadata["scope"])
+
+	// Once the first stream ends, the client may open another.
+	cancel()
+	require.Eventually(t, func() bool {
+		stream, err := client.ProduceStream(context.Background())
+		if err != nil {
+			return false
+		}
+		err = stream.Send(&api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		if err != nil {
+			return false
+		}
+		_, err = stream.Recv()
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/backend"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// route returns the server serving a topic's partition: s itself for the
+// log it serves, otherwise a copy of s whose CommitLog is the partition's,
+// so the RPCs serve partitions just as they serve the default log.
+func (s *grpcServer) route(topic string, partition uint32) (*grpcServer, error) {
+	if topic == s.topic && partition == s.partition {
+		return s, nil
+	}
+	if topic == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "partition %d needs a topic", partition)
+	}
+	if s.Topics == nil {
+		return nil, status.Error(codes.Unimplemented, "the server doesn't serve topics")
+	}
+	clog, err := s.Topics.Partition(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	config := *s.Config
+	config.CommitLog = clog
+	routed := *s
+	routed.Config = &config
+	routed.topic = topic
+	routed.partition = partition
+	return &routed, nil
+}
+
+func (s *grpcServer) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	if s.Topics == nil {
+		return nil, status.Error(codes.Unimplemented, "the server doesn't serve topics")
+	}
+	topic := req.GetTopic()
+	if err := api.CheckTopicName(topic.GetName()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if strings.HasPrefix(topic.GetName(), api.InternalTopicPrefix) {
+		return nil, status.Errorf(codes.InvalidArgument, "topic %q is internal", topic.Name)
+	}
+	if topic.GetPartitions() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "topic needs at least one partition")
+	}
+	if topic.Config == nil {
+		if err := s.Topics.CreateTopic(topic.Name, topic.Partitions); err != nil {
+			return nil, err
+		}
+		return &api.CreateTopicResponse{Topic: topic}, nil
+	}
+	configurer, ok := s.Topics.(backend.TopicConfigurer)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "the server's topics can't be configured")
+	}
+	if err := configurer.CreateConfiguredTopic(topic); err != nil {
+		return nil, err
+	}
+	return &api.CreateTopicResponse{Topic: topic}, nil
+}
+
+func (s *grpcServer) ListTopics(ctx context.Context, req *api.ListTopicsRequest) (*api.ListTopicsResponse, error) {
+	if s.Topics == nil {
+		return &api.ListTopicsResponse{}, nil
+	}
+	topics, err := s.Topics.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+	return &api.ListTopicsResponse{Topics: topics}, nil
+}
+
+// WatchTopics streams the topics' changes from the api.TopicEventsTopic,
+// which is created with the first topic, so until then it waits for it.
+func (s *grpcServer) WatchTopics(req *api.WatchTopicsRequest, stream api.Log_WatchTopicsServer) error {
+	if s.Topics == nil {
+		return status.Error(codes.Unimplemented, "the server doesn't serve topics")
+	}
+	for {
+		_, err := s.Topics.Partition(api.TopicEventsTopic, 0)
+		if err == nil {
+			break
+		}
+		if _, ok := err.(*api.ErrorUnknownTopic); !ok {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.Clock.After(maxIdleWait):
+		}
+	}
+	return s.consumeStream(
+		&api.ConsumeRequest{Topic: api.TopicEventsTopic, Offset: req.Offset},
+		topicEventStream{stream},
+		nil,
+	)
+}
+
+// topicEventStream sends the records consumeStream reads from the
+// api.TopicEventsTopic as the TopicEvents they hold.
+type topicEventStream struct {
+	api.Log_WatchTopicsServer
+}
+
+func (s topicEventStream) Send(res *api.ConsumeResponse) error {
+	if res.Record == nil {
+		return nil
+	}
+	event := &api.TopicEvent{}
+	if err := proto.Unmarshal(res.Record.Value, event); err != nil {
+		return status.Errorf(codes.DataLoss, "topic event %d: %v", res.Record.Offset, err)
+	}
+	event.Offset = res.Record.Offset
+	return s.Log_WatchTopicsServer.Send(event)
+}
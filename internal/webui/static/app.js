@@ -0,0 +1,114 @@
+// The admin UI. It polls the agent's JSON API and renders it into the
+// tables of index.html.
+
+function cell(row, text) {
+  const td = row.insertCell();
+  td.textContent = text;
+  return td;
+}
+
+function clear(table) {
+  while (table.rows.length > 1) table.deleteRow(1);
+}
+
+async function getJSON(path) {
+  const res = await fetch(path);
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
+
+async function refresh() {
+  try {
+    const cluster = await getJSON("api/cluster");
+    document.getElementById("node").textContent = cluster.node;
+    const servers = document.getElementById("servers");
+    clear(servers);
+    for (const s of cluster.servers || []) {
+      const row = servers.insertRow();
+      cell(row, s.id);
+      cell(row, s.rpc_addr);
+      cell(row, s.is_leader ? "yes" : "");
+      cell(row, s.is_standby ? "yes" : "");
+    }
+    const members = document.getElementById("members");
+    clear(members);
+    for (const m of cluster.members || []) {
+      const row = members.insertRow();
+      cell(row, m.name);
+      cell(row, m.addr);
+      cell(row, m.status);
+      cell(row, Object.entries(m.tags || {}).map(([k, v]) => k + "=" + v).join(", "));
+    }
+
+    const log = await getJSON("api/log");
+    document.getElementById("lowest").textContent = log.lowest;
+    document.getElementById("next").textContent = log.next;
+
+    const consumers = document.getElementById("consumers");
+    clear(consumers);
+    for (const c of await getJSON("api/consumers")) {
+      const row = consumers.insertRow();
+      cell(row, c.name);
+      cell(row, c.next);
+      cell(row, c.lag);
+    }
+  } catch (err) {
+    console.error(err);
+  }
+}
+
+// value renders a record's value: JSON values as they are, others decoded
+// from base64 as text.
+function value(record) {
+  if (typeof record.value !== "string") return JSON.stringify(record.value, null, 2);
+  try {
+    return atob(record.value);
+  } catch (err) {
+    return record.value;
+  }
+}
+
+function addRecord(record) {
+  const row = document.getElementById("records").insertRow();
+  cell(row, record.offset);
+  const meta = Object.entries(record.headers || {}).map(([k, v]) => k + ": " + v);
+  if (record.content_type) meta.unshift("content type: " + record.content_type);
+  if (record.content_encoding) meta.unshift("content encoding: " + record.content_encoding);
+  cell(row, meta.join("\n"));
+  const pre = document.createElement("pre");
+  pre.textContent = value(record);
+  row.insertCell().appendChild(pre);
+}
+
+let tail = null;
+
+function stopTail() {
+  if (tail) tail.close();
+  tail = null;
+  document.getElementById("stop").disabled = true;
+}
+
+document.getElementById("browse").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  stopTail();
+  clear(document.getElementById("records"));
+  const from = document.getElementById("from").value;
+  const res = await fetch("api/records?from=" + from);
+  const text = await res.text();
+  for (const line of text.split("\n")) {
+    if (line) addRecord(JSON.parse(line));
+  }
+});
+
+document.getElementById("tail").addEventListener("click", () => {
+  stopTail();
+  clear(document.getElementById("records"));
+  tail = new EventSource("api/tail");
+  tail.onmessage = (e) => addRecord(JSON.parse(e.data));
+  document.getElementById("stop").disabled = false;
+});
+
+document.getElementById("stop").addEventListener("click", stopTail);
+
+refresh();
+setInterval(refresh, 3000);
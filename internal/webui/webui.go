@@ -0,0 +1,272 @@
+// Package webui serves the agent's optional web admin UI: static pages
+// showing the cluster's members and servers, the log's offsets and
+// consumers' lag, and letting operators browse and tail records, backed by
+// a JSON API under /api/ that scripts can use too.
+package webui
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/export"
+	"github.com/Tarunshrma/prolog/schema"
+)
+
+//go:embed static
+var static embed.FS
+
+// Log is the log the UI shows.
+type Log interface {
+	Read(uint64) (*api.Record, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+}
+
+// ServerLister lists the servers the log is replicated to.
+type ServerLister interface {
+	GetServers() ([]*api.Server, error)
+}
+
+// Member is a node in the cluster's membership.
+type Member struct {
+	Name   string            `json:"name"`
+	Addr   string            `json:"addr"`
+	Status string            `json:"status"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+type Config struct {
+	// NodeName is the node serving the UI.
+	NodeName string
+	Log      Log
+	// Servers, Members and Consumers are optional. Consumers returns each
+	// consumer the node knows of, like its connectors, and the next
+	// offset it will consume.
+	Servers   ServerLister
+	Members   func() []Member
+	Consumers func(ctx context.Context) (map[string]uint64, error)
+	// TailPoll is how often tails check for new records. Defaults to
+	// 500ms.
+	TailPoll time.Duration
+	// Registry, if set, resolves the types of protobuf Any values, so
+	// they're shown as JSON.
+	Registry *schema.Registry
+}
+
+// maxBrowse bounds the records one browse request returns.
+const maxBrowse = 1000
+
+// New returns the UI's handler.
+func New(config Config) http.Handler {
+	if config.TailPoll == 0 {
+		config.TailPoll = 500 * time.Millisecond
+	}
+	s := &ui{Config: config}
+	assets, _ := fs.Sub(static, "static")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.HandleFunc("/api/cluster", s.handleCluster)
+	mux.HandleFunc("/api/log", s.handleLog)
+	mux.HandleFunc("/api/consumers", s.handleConsumers)
+	mux.HandleFunc("/api/records", s.handleRecords)
+	mux.HandleFunc("/api/tail", s.handleTail)
+	return mux
+}
+
+type ui struct {
+	Config
+}
+
+func (s *ui) handleCluster(w http.ResponseWriter, r *http.Request) {
+	res := struct {
+		Node    string        `json:"node"`
+		Servers []*api.Server `json:"servers"`
+		Members []Member      `json:"members"`
+	}{Node: s.NodeName}
+	if s.Servers != nil {
+		servers, err := s.Servers.GetServers()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		res.Servers = servers
+	}
+	if s.Members != nil {
+		res.Members = s.Members()
+	}
+	writeJSON(w, res)
+}
+
+// logOffsets is the range of offsets the log holds. Next is the offset the
+// next record appended gets.
+type logOffsets struct {
+	Lowest uint64 `json:"lowest"`
+	Next   uint64 `json:"next"`
+}
+
+func (s *ui) offsets() (logOffsets, error) {
+	lowest, err := s.Log.LowestOffset()
+	if err != nil {
+		return logOffsets{}, err
+	}
+	highest, err := s.Log.HighestOffset()
+	if err != nil {
+		return logOffsets{}, err
+	}
+	next := highest + 1
+	// An empty log reports a highest offset of zero too.
+	if _, err := s.Log.Read(highest); err != nil {
+		next = highest
+	}
+	return logOffsets{Lowest: lowest, Next: next}, nil
+}
+
+func (s *ui) handleLog(w http.ResponseWriter, r *http.Request) {
+	offsets, err := s.offsets()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, offsets)
+}
+
+type consumer struct {
+	Name string `json:"name"`
+	Next uint64 `json:"next"`
+	Lag  uint64 `json:"lag"`
+}
+
+func (s *ui) handleConsumers(w http.ResponseWriter, r *http.Request) {
+	consumers := []consumer{}
+	if s.Consumers != nil {
+		offsets, err := s.offsets()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		nexts, err := s.Consumers(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for name, next := range nexts {
+			c := consumer{Name: name, Next: next}
+			if offsets.Next > next {
+				c.Lag = offsets.Next - next
+			}
+			consumers = append(consumers, c)
+		}
+	}
+	writeJSON(w, consumers)
+}
+
+// handleRecords writes up to limit records from offset from as JSON lines,
+// in the export package's format.
+func (s *ui) handleRecords(w http.ResponseWriter, r *http.Request) {
+	from, err := uintParam(r, "from", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := uintParam(r, "limit", 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit > maxBrowse {
+		limit = maxBrowse
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	jw := export.NewJSONLWriter(w)
+	jw.Registry = s.Registry
+	for off := from; off < from+limit; off++ {
+		record, err := s.Log.Read(off)
+		if err != nil {
+			break
+		}
+		if err := jw.Write(record); err != nil {
+			return
+		}
+	}
+	_ = jw.Close()
+}
+
+// handleTail streams records from offset from, or from the end of the
+// log, as server-sent events, each a record in the export package's JSON
+// format, until the client goes away.
+func (s *ui) handleTail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	offsets, err := s.offsets()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	off, err := uintParam(r, "from", offsets.Next)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		record, err := s.Log.Read(off)
+		if err != nil {
+			var outOfRange *api.ErrorOffsetOutOfRange
+			if !errors.As(err, &outOfRange) {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(s.TailPoll):
+			}
+			continue
+		}
+		if _, err := w.Write([]byte("data: ")); err != nil {
+			return
+		}
+		jw := export.NewJSONLWriter(w)
+		jw.Registry = s.Registry
+		if err := jw.Write(record); err != nil {
+			return
+		}
+		_ = jw.Close()
+		// The JSON line ends the data line; a blank line ends the event.
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return
+		}
+		flusher.Flush()
+		off++
+	}
+}
+
+func uintParam(r *http.Request, name string, def uint64) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
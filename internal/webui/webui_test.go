@@ -0,0 +1,128 @@
+package webui
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// memLog is an in-memory log.
+type memLog struct {
+	mu      sync.Mutex
+	records []*api.Record
+}
+
+func (l *memLog) append(value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, &api.Record{
+		Offset: uint64(len(l.records)),
+		Value:  []byte(value),
+	})
+}
+
+func (l *memLog) Read(off uint64) (*api.Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if off >= uint64(len(l.records)) {
+		return nil, &api.ErrorOffsetOutOfRange{Offset: off}
+	}
+	return l.records[off], nil
+}
+
+func (l *memLog) LowestOffset() (uint64, error) {
+	return 0, nil
+}
+
+func (l *memLog) HighestOffset() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) == 0 {
+		return 0, nil
+	}
+	return uint64(len(l.records) - 1), nil
+}
+
+func TestUI(t *testing.T) {
+	log := &memLog{}
+	for _, v := range []string{"a", "b", "c"} {
+		log.append(v)
+	}
+	srv := httptest.NewServer(New(Config{
+		NodeName: "node-0",
+		Log:      log,
+		Members: func() []Member {
+			return []Member{{Name: "node-0", Addr: "127.0.0.1:8401", Status: "alive"}}
+		},
+		Consumers: func(ctx context.Context) (map[string]uint64, error) {
+			return map[string]uint64{"webhook": 1}, nil
+		},
+		TailPoll: 10 * time.Millisecond,
+	}))
+	defer srv.Close()
+
+	get := func(path string, v interface{}) {
+		res, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+
+	var cluster struct {
+		Node    string   `json:"node"`
+		Members []Member `json:"members"`
+	}
+	get("/api/cluster", &cluster)
+	require.Equal(t, "node-0", cluster.Node)
+	require.Equal(t, "alive", cluster.Members[0].Status)
+
+	var offsets logOffsets
+	get("/api/log", &offsets)
+	require.Equal(t, logOffsets{Lowest: 0, Next: 3}, offsets)
+
+	var consumers []consumer
+	get("/api/consumers", &consumers)
+	require.Equal(t, []consumer{{Name: "webhook", Next: 1, Lag: 2}}, consumers)
+
+	res, err := http.Get(srv.URL + "/api/records?from=1&limit=5")
+	require.NoError(t, err)
+	var got []uint64
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var record struct {
+			Offset uint64 `json:"offset"`
+		}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		got = append(got, record.Offset)
+	}
+	res.Body.Close()
+	require.Equal(t, []uint64{1, 2}, got)
+
+	// Tailing from the end gets the records appended after.
+	res, err = http.Get(srv.URL + "/api/tail")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	log.append("d")
+	scanner = bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			require.Contains(t, line, `"offset":3`)
+			break
+		}
+	}
+
+	res, err = http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,146 @@
+// Package schema decodes typed record payloads: values that are
+// google.protobuf.Any messages, whose type URLs name message types a
+// Registry knows.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ErrNotAny is returned when decoding a record whose content type isn't
+// api.ContentTypeProtobufAny.
+var ErrNotAny = errors.New("schema: record isn't a protobuf Any")
+
+// Registry resolves type URLs to message types: those linked into the
+// binary, and those in the file descriptor sets it loads, so tools can
+// decode payloads whose types they weren't built with. Load everything
+// before sharing it; lookups are safe for concurrent use, Load isn't.
+type Registry struct {
+	types protoregistry.Types
+}
+
+// NewRegistry returns a registry that knows the message types linked into
+// the binary.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Load adds the message types in the file descriptor set at path, as
+// written by `buf build -o` or `protoc --include_imports
+// --descriptor_set_out`. Types the registry already knows are kept.
+func (r *Registry) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return fmt.Errorf("schema: %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return fmt.Errorf("schema: %s: %w", path, err)
+	}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		r.register(fd.Messages())
+		return true
+	})
+	return nil
+}
+
+func (r *Registry) register(mds protoreflect.MessageDescriptors) {
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		if _, err := r.FindMessageByName(md.FullName()); err == protoregistry.NotFound {
+			_ = r.types.RegisterMessage(dynamicpb.NewMessageType(md))
+		}
+		r.register(md.Messages())
+	}
+}
+
+// FindMessageByName implements protoregistry.MessageTypeResolver.
+func (r *Registry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return r.types.FindMessageByName(name)
+}
+
+// FindMessageByURL implements protoregistry.MessageTypeResolver.
+func (r *Registry) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByURL(url); err == nil {
+		return mt, nil
+	}
+	return r.types.FindMessageByURL(url)
+}
+
+// FindExtensionByName implements protoregistry.ExtensionTypeResolver.
+func (r *Registry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+// FindExtensionByNumber implements protoregistry.ExtensionTypeResolver.
+func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// NewRecord returns a record whose value is m packed in a
+// google.protobuf.Any.
+func NewRecord(m proto.Message) (*api.Record, error) {
+	a, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+	value, err := proto.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return &api.Record{Value: value, ContentType: api.ContentTypeProtobufAny}, nil
+}
+
+// Decode returns the message packed in record's value, failing with
+// protoregistry.NotFound if the registry doesn't know its type.
+func (r *Registry) Decode(record *api.Record) (proto.Message, error) {
+	a, err := unpack(record)
+	if err != nil {
+		return nil, err
+	}
+	return anypb.UnmarshalNew(a, proto.UnmarshalOptions{Resolver: r})
+}
+
+// JSON renders the message packed in record's value as JSON, with its type
+// URL under "@type".
+func (r *Registry) JSON(record *api.Record) ([]byte, error) {
+	a, err := unpack(record)
+	if err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{Resolver: r}.Marshal(a)
+}
+
+func unpack(record *api.Record) (*anypb.Any, error) {
+	if record.MediaType() != api.ContentTypeProtobufAny {
+		return nil, ErrNotAny
+	}
+	value, err := record.DecodedValue()
+	if err != nil {
+		return nil, err
+	}
+	a := &anypb.Any{}
+	if err := proto.Unmarshal(value, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	// Types linked into the binary decode as they are.
+	record, err := NewRecord(wrapperspb.String("hello"))
+	require.NoError(t, err)
+	require.Equal(t, api.ContentTypeProtobufAny, record.ContentType)
+	m, err := r.Decode(record)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.String("hello"), m))
+	b, err := r.JSON(record)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"hello"}`, string(b))
+
+	// Others decode once their descriptors are loaded.
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("shop/order.proto"),
+		Package: proto.String("shop"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				JsonName: proto.String("id"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	require.NoError(t, err)
+	order := dynamicpb.NewMessage(fd.Messages().Get(0))
+	order.Set(fd.Messages().Get(0).Fields().Get(0), protoreflect.ValueOfString("o-1"))
+	a, err := anypb.New(order)
+	require.NoError(t, err)
+	value, err := proto.Marshal(a)
+	require.NoError(t, err)
+	record = &api.Record{Value: value, ContentType: api.ContentTypeProtobufAny}
+
+	_, err = r.Decode(record)
+	require.True(t, errors.Is(err, protoregistry.NotFound))
+
+	b, err = proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{file},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "schema.binpb")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	require.NoError(t, r.Load(path))
+
+	b, err = r.JSON(record)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"@type":"type.googleapis.com/shop.Order","id":"o-1"}`, string(b))
+
+	_, err = r.Decode(&api.Record{Value: []byte("hello")})
+	require.Equal(t, ErrNotAny, err)
+}
@@ -0,0 +1,373 @@
+// Package soak runs long mixed produce and consume workloads against a
+// cluster, optionally killing nodes as it goes, and checks that no record
+// the cluster acknowledged is lost or appended more than once.
+package soak
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+)
+
+// Client is the part of client.Client a soak test drives.
+type Client interface {
+	Produce(ctx context.Context, record *api.Record) (uint64, error)
+	ConsumeRange(ctx context.Context, from, to uint64, handler client.Handler) error
+}
+
+var _ Client = (*client.Client)(nil)
+
+type Config struct {
+	// Duration is how long to produce for before the final check.
+	Duration time.Duration
+	// Producers is how many goroutines produce concurrently. Defaults to 4.
+	Producers int
+	// ProduceInterval paces each producer. Zero produces as fast as the
+	// cluster acknowledges.
+	ProduceInterval time.Duration
+	// RecordBytes pads record values to this size. Defaults to 128.
+	RecordBytes int
+	// VerifyInterval is how often the records acknowledged so far are read
+	// back and checked. Defaults to 10s.
+	VerifyInterval time.Duration
+	// Disrupt, if set, is called every DisruptInterval to kill or restart
+	// a node of the cluster under test.
+	Disrupt         func(ctx context.Context) error
+	DisruptInterval time.Duration
+	// SettleTimeout bounds how long the final check waits for the cluster
+	// to serve every acknowledged record before reporting the rest lost.
+	// Defaults to 1m.
+	SettleTimeout time.Duration
+	// Progress, if set, is called with the report so far after each check.
+	Progress func(Report)
+}
+
+// ViolationKind is an invariant a cluster broke.
+type ViolationKind string
+
+const (
+	// Lost is an acknowledged record that can't be read back at its
+	// offset, or an offset the log skipped.
+	Lost ViolationKind = "lost"
+	// Duplicated is a record appended at more than one offset.
+	Duplicated ViolationKind = "duplicated"
+)
+
+type Violation struct {
+	Kind   ViolationKind
+	Offset uint64
+	Detail string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s at offset %d: %s", v.Kind, v.Offset, v.Detail)
+}
+
+// Report counts what a soak test did and lists the violations it found.
+type Report struct {
+	Produced      uint64
+	ProduceErrors uint64
+	Verified      uint64
+	ConsumeErrors uint64
+	Disruptions   uint64
+	DisruptErrors uint64
+	Violations    []Violation
+}
+
+// Run runs the workload until config.Duration passes or ctx is done, then
+// waits for the cluster to settle and checks every record it acknowledged.
+func Run(ctx context.Context, c Client, config Config) (*Report, error) {
+	if config.Producers == 0 {
+		config.Producers = 4
+	}
+	if config.RecordBytes == 0 {
+		config.RecordBytes = 128
+	}
+	if config.VerifyInterval == 0 {
+		config.VerifyInterval = 10 * time.Second
+	}
+	if config.SettleTimeout == 0 {
+		config.SettleTimeout = time.Minute
+	}
+	if config.Disrupt != nil && config.DisruptInterval <= 0 {
+		return nil, fmt.Errorf("disrupting needs a positive interval")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &soaker{
+		c:      c,
+		config: config,
+		prefix: []byte("soak/" + hex.EncodeToString(id) + "/"),
+		acked:  make(map[uint64]uint64),
+		seen:   make(map[uint64]uint64),
+	}
+	return s.run(ctx), nil
+}
+
+type soaker struct {
+	c      Client
+	config Config
+	// prefix starts the values of this run's records, which go on with
+	// their sequence number, so runs sharing a cluster tell their records
+	// apart.
+	prefix []byte
+
+	mu     sync.Mutex
+	report Report
+	seq    uint64
+	// acked maps the offsets acknowledged but not yet verified to the
+	// sequence numbers of the records produced there.
+	acked map[uint64]uint64
+	// seen maps the sequence numbers of this run's records read back so
+	// far to their offsets.
+	seen map[uint64]uint64
+	// next is the offset checks resume from, and started whether the
+	// first acknowledgment has set it. Checks also start from any lower
+	// offset in acked.
+	next    uint64
+	started bool
+}
+
+func (s *soaker) run(ctx context.Context) *Report {
+	runCtx, cancel := context.WithTimeout(ctx, s.config.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.produce(runCtx)
+		}()
+	}
+	if s.config.Disrupt != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.disrupt(runCtx)
+		}()
+	}
+
+	ticker := time.NewTicker(s.config.VerifyInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-runCtx.Done():
+			done = true
+		case <-ticker.C:
+			s.verify(runCtx)
+		}
+	}
+	wg.Wait()
+
+	// Give restarted nodes time to rejoin and catch up before reporting
+	// what they still don't serve as lost.
+	settleCtx, cancel := context.WithTimeout(context.Background(), s.config.SettleTimeout)
+	defer cancel()
+	for !s.verify(settleCtx) {
+		select {
+		case <-settleCtx.Done():
+			s.unserved()
+			return s.snapshot()
+		case <-time.After(time.Second):
+		}
+	}
+	return s.snapshot()
+}
+
+func (s *soaker) produce(ctx context.Context) {
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		seq := s.seq
+		s.seq++
+		s.mu.Unlock()
+
+		record := &api.Record{Value: s.value(seq)}
+		off, err := s.c.Produce(ctx, record)
+
+		s.mu.Lock()
+		if err != nil {
+			// The record may or may not have been appended, which the
+			// checks allow for.
+			if ctx.Err() == nil {
+				s.report.ProduceErrors++
+			}
+		} else {
+			s.report.Produced++
+			if prev, ok := s.acked[off]; ok {
+				s.violate(Duplicated, off, fmt.Sprintf("acknowledged records %d and %d", prev, seq))
+			}
+			s.acked[off] = seq
+			if !s.started {
+				s.next, s.started = off, true
+			}
+		}
+		s.mu.Unlock()
+
+		if s.config.ProduceInterval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.config.ProduceInterval):
+			}
+		}
+	}
+}
+
+// value returns the value of record seq.
+func (s *soaker) value(seq uint64) []byte {
+	b := make([]byte, 0, s.config.RecordBytes)
+	b = append(b, s.prefix...)
+	b = strconv.AppendUint(b, seq, 10)
+	b = append(b, '/')
+	for len(b) < s.config.RecordBytes {
+		b = append(b, 'x')
+	}
+	return b
+}
+
+// parse returns the sequence number in a record's value, or false if the
+// record wasn't produced by this run.
+func (s *soaker) parse(value []byte) (uint64, bool) {
+	if !bytes.HasPrefix(value, s.prefix) {
+		return 0, false
+	}
+	rest := value[len(s.prefix):]
+	end := bytes.IndexByte(rest, '/')
+	if end < 0 {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(string(rest[:end]), 10, 64)
+	return seq, err == nil
+}
+
+func (s *soaker) disrupt(ctx context.Context) {
+	ticker := time.NewTicker(s.config.DisruptInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := s.config.Disrupt(ctx)
+		s.mu.Lock()
+		s.report.Disruptions++
+		if err != nil && ctx.Err() == nil {
+			s.report.DisruptErrors++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// verify reads back the records from the last offset checked up to the
+// highest acknowledged, and returns whether every acknowledged record has
+// been checked. Records the cluster doesn't serve yet are checked again
+// next time.
+func (s *soaker) verify(ctx context.Context) bool {
+	s.mu.Lock()
+	from, to := s.next, s.next
+	for off := range s.acked {
+		if off < from {
+			from = off
+		}
+		if off >= to {
+			to = off + 1
+		}
+	}
+	s.mu.Unlock()
+	if from == to {
+		return true
+	}
+
+	next := from
+	err := s.c.ConsumeRange(ctx, from, to, func(_ context.Context, record *api.Record) error {
+		s.check(next, record)
+		next = record.Offset + 1
+		return nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && ctx.Err() == nil {
+		s.report.ConsumeErrors++
+	}
+	// Records acknowledged after the check read past them haven't been
+	// checked, so resume from the lowest of them.
+	s.next = next
+	for off := range s.acked {
+		if off < s.next {
+			s.next = off
+		}
+	}
+	if s.config.Progress != nil {
+		s.config.Progress(s.report)
+	}
+	return len(s.acked) == 0
+}
+
+// unserved reports the acknowledged records the cluster never served lost.
+func (s *soaker) unserved() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for off, seq := range s.acked {
+		s.violate(Lost, off, fmt.Sprintf("acknowledged record %d was never served", seq))
+		delete(s.acked, off)
+	}
+}
+
+// check checks record, read back where offset want was expected next.
+func (s *soaker) check(want uint64, record *api.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for off := want; off < record.Offset; off++ {
+		s.violate(Lost, off, fmt.Sprintf("the log skipped from %d to %d", want, record.Offset))
+		delete(s.acked, off)
+	}
+
+	seq, ours := s.parse(record.Value)
+	ackedSeq, acked := s.acked[record.Offset]
+	if acked {
+		delete(s.acked, record.Offset)
+		s.report.Verified++
+		if !ours || seq != ackedSeq {
+			s.violate(Lost, record.Offset, fmt.Sprintf("acknowledged record %d was replaced", ackedSeq))
+		}
+	}
+	if !ours {
+		return
+	}
+	if off, ok := s.seen[seq]; ok && off != record.Offset {
+		s.violate(Duplicated, record.Offset, fmt.Sprintf("record %d was also appended at offset %d", seq, off))
+		return
+	}
+	s.seen[seq] = record.Offset
+}
+
+// violate records a violation. s.mu must be held.
+func (s *soaker) violate(kind ViolationKind, off uint64, detail string) {
+	s.report.Violations = append(s.report.Violations, Violation{
+		Kind:   kind,
+		Offset: off,
+		Detail: detail,
+	})
+}
+
+func (s *soaker) snapshot() *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.Violations = append([]Violation(nil), s.report.Violations...)
+	return &report
+}
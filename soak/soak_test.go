@@ -0,0 +1,160 @@
+package soak
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/Tarunshrma/prolog/api/v1"
+	"github.com/Tarunshrma/prolog/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, c *fakeCluster){
+		"healthy cluster":    testHealthy,
+		"lost record":        testLost,
+		"duplicated record":  testDuplicated,
+		"skipped offset":     testSkipped,
+		"disrupted produces": testDisrupted,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t, &fakeCluster{})
+		})
+	}
+}
+
+func run(t *testing.T, c *fakeCluster, config Config) *Report {
+	config.Duration = 200 * time.Millisecond
+	config.Producers = 2
+	config.ProduceInterval = time.Millisecond
+	config.VerifyInterval = 20 * time.Millisecond
+	config.SettleTimeout = 100 * time.Millisecond
+	report, err := Run(context.Background(), c, config)
+	require.NoError(t, err)
+	require.NotZero(t, report.Produced)
+	return report
+}
+
+func testHealthy(t *testing.T, c *fakeCluster) {
+	report := run(t, c, Config{})
+	require.Empty(t, report.Violations)
+	require.Equal(t, report.Produced, report.Verified)
+}
+
+func testLost(t *testing.T, c *fakeCluster) {
+	c.produced = func(off uint64) {
+		// Acknowledge the tenth record and then drop it.
+		if off == 10 {
+			c.records[off] = &api.Record{Offset: off, Value: []byte("other")}
+		}
+	}
+	report := run(t, c, Config{})
+	require.Len(t, report.Violations, 1)
+	require.Equal(t, Lost, report.Violations[0].Kind)
+	require.Equal(t, uint64(10), report.Violations[0].Offset)
+}
+
+func testDuplicated(t *testing.T, c *fakeCluster) {
+	c.produced = func(off uint64) {
+		if off == 10 {
+			c.records = append(c.records, &api.Record{
+				Offset: off + 1,
+				Value:  c.records[off].Value,
+			})
+		}
+	}
+	report := run(t, c, Config{})
+	require.Len(t, report.Violations, 1)
+	require.Equal(t, Duplicated, report.Violations[0].Kind)
+	require.Equal(t, uint64(11), report.Violations[0].Offset)
+}
+
+func testSkipped(t *testing.T, c *fakeCluster) {
+	c.skip = 10
+	report := run(t, c, Config{})
+	require.Len(t, report.Violations, 1)
+	require.Equal(t, Violation{
+		Kind:   Lost,
+		Offset: 10,
+		Detail: "the log skipped from 10 to 11",
+	}, report.Violations[0])
+}
+
+func testDisrupted(t *testing.T, c *fakeCluster) {
+	// Fail produces, and consumes, while a node restarts, as a client of a
+	// cluster electing a new leader would.
+	report := run(t, c, Config{
+		Disrupt: func(ctx context.Context) error {
+			c.setDown(true)
+			time.Sleep(5 * time.Millisecond)
+			c.setDown(false)
+			return nil
+		},
+		DisruptInterval: 10 * time.Millisecond,
+	})
+	require.Empty(t, report.Violations)
+	require.NotZero(t, report.Disruptions)
+	require.NotZero(t, report.ProduceErrors)
+	require.Equal(t, report.Produced, report.Verified)
+}
+
+var errDown = errors.New("node down")
+
+// fakeCluster is an in-memory log whose misbehaviour tests inject.
+type fakeCluster struct {
+	mu      sync.Mutex
+	records []*api.Record
+	down    bool
+	// produced is called, with mu held, after each record is appended.
+	produced func(off uint64)
+	// skip is an offset, other than 0, the log leaves out.
+	skip uint64
+}
+
+func (c *fakeCluster) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *fakeCluster) Produce(ctx context.Context, record *api.Record) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return 0, errDown
+	}
+	if c.skip != 0 && uint64(len(c.records)) == c.skip {
+		c.records = append(c.records, nil)
+	}
+	off := uint64(len(c.records))
+	c.records = append(c.records, &api.Record{Offset: off, Value: record.Value})
+	if c.produced != nil {
+		c.produced(off)
+	}
+	return off, nil
+}
+
+func (c *fakeCluster) ConsumeRange(ctx context.Context, from, to uint64, handler client.Handler) error {
+	c.mu.Lock()
+	if c.down {
+		c.mu.Unlock()
+		return errDown
+	}
+	var records []*api.Record
+	for off := from; off < to && off < uint64(len(c.records)); off++ {
+		if c.records[off] != nil {
+			records = append(records, c.records[off])
+		}
+	}
+	c.mu.Unlock()
+
+	for _, record := range records {
+		if err := handler(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}